@@ -2,19 +2,23 @@ package accounts
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/soluchok/tgsender/pkg/auth"
 	tgclient "github.com/soluchok/tgsender/pkg/telegram"
+	"github.com/soluchok/tgsender/pkg/workspaces"
 )
 
 // Handler provides HTTP handlers for account management
 type Handler struct {
 	store       *Store
 	qrManager   *QRAuthManager
+	phoneAuth   *PhoneAuthManager
 	validator   *Validator
 	spamChecker *SpamChecker
 	auth        *auth.Handler
+	workspaces  *workspaces.Store
 }
 
 // NewHandler creates a new accounts handler
@@ -28,7 +32,22 @@ func NewHandler(store *Store, qrManager *QRAuthManager, validator *Validator, sp
 	}
 }
 
+// WithWorkspaces shares accounts within team workspaces. Without it every
+// user only has their personal workspace.
+func (h *Handler) WithWorkspaces(store *workspaces.Store) *Handler {
+	h.workspaces = store
+	return h
+}
+
+// WithPhoneAuth enables linking accounts with a login code sent to the phone
+// number, next to QR login
+func (h *Handler) WithPhoneAuth(manager *PhoneAuthManager) *Handler {
+	h.phoneAuth = manager
+	return h
+}
+
 // HandleListAccounts handles GET /api/accounts
+// Lists the accounts of the workspace selected with the X-Workspace-ID header
 func (h *Handler) HandleListAccounts(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -41,7 +60,12 @@ func (h *Handler) HandleListAccounts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	accounts := h.store.GetByOwner(ownerID)
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	accounts := h.store.GetByOwner(workspaceID)
 	if accounts == nil {
 		accounts = []*Account{}
 	}
@@ -71,7 +95,19 @@ func (h *Handler) HandleDeleteAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.Delete(id, ownerID); err != nil {
+	// Verify account exists and the caller's role in its workspace allows this
+	account, ok := h.store.Get(id)
+	if !ok {
+		writeJSONError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleAdmin) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if err := h.store.Delete(id, account.OwnerID); err != nil {
 		writeJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -99,14 +135,14 @@ func (h *Handler) HandleValidateAccount(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.store.Get(id)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -127,6 +163,37 @@ func (h *Handler) HandleValidateAccount(w http.ResponseWriter, r *http.Request)
 	}, http.StatusOK)
 }
 
+// HandleStatusHistory handles GET /api/accounts/{id}/status-history
+// Lists the latest times the account became active or inactive, newest first
+func (h *Handler) HandleStatusHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	account, ok := h.store.Get(id)
+	if !ok {
+		writeJSONError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleViewer) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"history": h.store.StatusHistory(id),
+	}, http.StatusOK)
+}
+
 // HandleCheckSpamStatus handles GET /api/accounts/{id}/spam-status
 func (h *Handler) HandleCheckSpamStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -147,14 +214,14 @@ func (h *Handler) HandleCheckSpamStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.store.Get(id)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -192,14 +259,14 @@ func (h *Handler) HandleUpdateSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.store.Get(id)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleAdmin) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -275,14 +342,14 @@ func (h *Handler) HandleGetSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.store.Get(id)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleAdmin) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -298,6 +365,7 @@ func (h *Handler) HandleGetSettings(w http.ResponseWriter, r *http.Request) {
 }
 
 // HandleStartQRAuth handles POST /api/accounts/qr/start
+// The account is linked to the workspace selected with the X-Workspace-ID header
 func (h *Handler) HandleStartQRAuth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -310,7 +378,12 @@ func (h *Handler) HandleStartQRAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	state, err := h.qrManager.StartAuth(ownerID)
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	state, err := h.qrManager.StartAuth(ownerID, workspaceID)
 	if err != nil {
 		writeJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -326,13 +399,19 @@ func (h *Handler) HandleQRAuthStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
 	token := r.URL.Query().Get("token")
 	if token == "" {
 		writeJSONError(w, "Token required", http.StatusBadRequest)
 		return
 	}
 
-	state, ok := h.qrManager.GetStatus(token)
+	state, ok := h.qrManager.GetStatus(token, ownerID)
 	if !ok {
 		writeJSONError(w, "Session not found or expired", http.StatusNotFound)
 		return
@@ -348,6 +427,12 @@ func (h *Handler) HandleCancelQRAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
 	var req struct {
 		Token string `json:"token"`
 	}
@@ -356,7 +441,7 @@ func (h *Handler) HandleCancelQRAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.qrManager.CancelAuth(req.Token)
+	h.qrManager.CancelAuth(req.Token, ownerID)
 	writeJSON(w, map[string]string{"message": "Cancelled"}, http.StatusOK)
 }
 
@@ -367,6 +452,12 @@ func (h *Handler) HandleSubmitPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
 	var req struct {
 		Token    string `json:"token"`
 		Password string `json:"password"`
@@ -381,7 +472,12 @@ func (h *Handler) HandleSubmitPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.qrManager.SubmitPassword(req.Token, req.Password); err != nil {
+	err := h.qrManager.SubmitPassword(req.Token, ownerID, req.Password)
+	if errors.Is(err, ErrPasswordLocked) {
+		writeJSONError(w, "Too many invalid passwords, start a new login", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
 		writeJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -389,18 +485,201 @@ func (h *Handler) HandleSubmitPassword(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, map[string]string{"message": "Password submitted"}, http.StatusOK)
 }
 
-func (h *Handler) getOwnerID(r *http.Request) (int64, bool) {
-	cookie, err := r.Cookie("session_token")
+// HandleStartPhoneAuth handles POST /api/accounts/phone/start
+// The account is linked to the workspace selected with the X-Workspace-ID header
+func (h *Handler) HandleStartPhoneAuth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Phone string `json:"phone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Phone == "" {
+		writeJSONError(w, "Phone required", http.StatusBadRequest)
+		return
+	}
+
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	state, err := h.phoneAuth.StartAuth(ownerID, workspaceID, req.Phone)
+	if errors.Is(err, ErrInvalidPhone) {
+		writeJSONError(w, "Invalid phone number", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		return 0, false
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	session, ok := h.auth.GetSession(cookie.Value)
-	if !ok || session.User == nil {
-		return 0, false
+	writeJSON(w, state, http.StatusOK)
+}
+
+// HandlePhoneAuthStatus handles GET /api/accounts/phone/status
+func (h *Handler) HandlePhoneAuthStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeJSONError(w, "Token required", http.StatusBadRequest)
+		return
+	}
+
+	state, ok := h.phoneAuth.GetStatus(token, ownerID)
+	if !ok {
+		writeJSONError(w, "Session not found or expired", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, state, http.StatusOK)
+}
+
+// HandleSubmitPhoneCode handles POST /api/accounts/phone/code
+func (h *Handler) HandleSubmitPhoneCode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+		Code  string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.Code == "" {
+		writeJSONError(w, "Token and code required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.phoneAuth.SubmitCode(req.Token, ownerID, req.Code)
+	if errors.Is(err, ErrCodeLocked) {
+		writeJSONError(w, "Too many invalid codes, start a new login", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Code submitted"}, http.StatusOK)
+}
+
+// HandleSubmitPhonePassword handles POST /api/accounts/phone/password
+func (h *Handler) HandleSubmitPhonePassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Token == "" || req.Password == "" {
+		writeJSONError(w, "Token and password required", http.StatusBadRequest)
+		return
+	}
+
+	err := h.phoneAuth.SubmitPassword(req.Token, ownerID, req.Password)
+	if errors.Is(err, ErrPasswordLocked) {
+		writeJSONError(w, "Too many invalid passwords, start a new login", http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Password submitted"}, http.StatusOK)
+}
+
+// HandleCancelPhoneAuth handles POST /api/accounts/phone/cancel
+func (h *Handler) HandleCancelPhoneAuth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
-	return session.User.ID, true
+	h.phoneAuth.CancelAuth(req.Token, ownerID)
+	writeJSON(w, map[string]string{"message": "Cancelled"}, http.StatusOK)
+}
+
+func (h *Handler) getOwnerID(r *http.Request) (int64, bool) {
+	return h.auth.OwnerID(r)
+}
+
+// selectWorkspace returns the workspace the request acts in. It writes the
+// error response if the caller lacks the role there.
+func (h *Handler) selectWorkspace(w http.ResponseWriter, r *http.Request, ownerID int64, need workspaces.Role) (int64, bool) {
+	workspaceID, err := h.workspaces.Selected(r, ownerID, need)
+	if errors.Is(err, workspaces.ErrInvalidHeader) {
+		writeJSONError(w, "Invalid "+workspaces.Header+" header", http.StatusBadRequest)
+		return 0, false
+	}
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return 0, false
+	}
+	return workspaceID, true
 }
 
 // HandleTestProxy handles POST /api/accounts/{id}/test-proxy
@@ -423,14 +702,14 @@ func (h *Handler) HandleTestProxy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.store.Get(id)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleAdmin) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -0,0 +1,128 @@
+package accounts
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/metrics"
+)
+
+// Defaults of the health monitor
+const (
+	DefaultCheckInterval    = time.Hour
+	DefaultCheckJitter      = 5 * time.Minute
+	DefaultCheckConcurrency = 4
+
+	checkTimeout = 2 * time.Minute
+)
+
+// Monitor validates the sessions of every linked account in the background,
+// so revoked and deactivated accounts are noticed before a job fails
+type Monitor struct {
+	store       *Store
+	interval    time.Duration
+	jitter      time.Duration
+	concurrency int
+	check       func(ctx context.Context, accountID string) (*ValidationResult, error)
+}
+
+// NewMonitor creates a health monitor that validates with validator
+func NewMonitor(store *Store, validator *Validator) *Monitor {
+	return &Monitor{
+		store:       store,
+		interval:    DefaultCheckInterval,
+		jitter:      DefaultCheckJitter,
+		concurrency: DefaultCheckConcurrency,
+		check: func(ctx context.Context, accountID string) (*ValidationResult, error) {
+			return validator.validateAndUpdate(ctx, accountID, SourceMonitor)
+		},
+	}
+}
+
+// WithInterval sets how often every account is validated
+func (m *Monitor) WithInterval(interval time.Duration) *Monitor {
+	m.interval = interval
+	return m
+}
+
+// WithJitter sets the longest random delay before each account is validated,
+// which spreads the checks of a round over time
+func (m *Monitor) WithJitter(jitter time.Duration) *Monitor {
+	m.jitter = jitter
+	return m
+}
+
+// WithConcurrency sets how many accounts are validated at the same time
+func (m *Monitor) WithConcurrency(concurrency int) *Monitor {
+	m.concurrency = max(concurrency, 1)
+	return m
+}
+
+// Run validates every account each interval until ctx is cancelled
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.CheckAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll validates every account once and returns when all checks are done
+func (m *Monitor) CheckAll(ctx context.Context) {
+	sem := make(chan struct{}, m.concurrency)
+	var wg sync.WaitGroup
+
+	for _, account := range m.store.List() {
+		wg.Add(1)
+		go func(accountID string) {
+			defer wg.Done()
+
+			if m.jitter > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(rand.N(m.jitter)):
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case sem <- struct{}{}:
+			}
+			defer func() { <-sem }()
+
+			m.checkOne(ctx, accountID)
+		}(account.ID)
+	}
+
+	wg.Wait()
+}
+
+func (m *Monitor) checkOne(ctx context.Context, accountID string) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	result, err := m.check(ctx, accountID)
+	if err != nil {
+		metrics.AccountHealthChecks.WithLabelValues("error").Inc()
+		slog.Warn("account health check failed", "account_id", accountID, "error", err)
+		return
+	}
+
+	if !result.IsValid {
+		metrics.AccountHealthChecks.WithLabelValues(result.Reason).Inc()
+		return
+	}
+	metrics.AccountHealthChecks.WithLabelValues("valid").Inc()
+}
@@ -0,0 +1,143 @@
+package accounts
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMonitorCheckAll(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := store.Create(&Account{OwnerID: 1, TelegramID: int64(i), IsActive: true}); err != nil {
+			t.Fatalf("failed to create account: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	checked := make(map[string]int)
+	running, peak := 0, 0
+
+	m := NewMonitor(store, nil).WithJitter(time.Millisecond).WithConcurrency(2)
+	m.check = func(ctx context.Context, accountID string) (*ValidationResult, error) {
+		mu.Lock()
+		checked[accountID]++
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if accountID == "3" {
+			return nil, fmt.Errorf("connection refused")
+		}
+		return &ValidationResult{IsValid: true}, nil
+	}
+
+	m.CheckAll(context.Background())
+
+	if len(checked) != 5 {
+		t.Fatalf("expected every account to be checked once, got %v", checked)
+	}
+	for id, n := range checked {
+		if n != 1 {
+			t.Errorf("account %s checked %d times", id, n)
+		}
+	}
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent checks, got %d", peak)
+	}
+}
+
+func TestStatusHistory(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if err := store.Create(&Account{OwnerID: 1, TelegramID: 7, IsActive: true}); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	if err := store.RecordStatusChange(&StatusChange{AccountID: "8", Source: SourceMonitor}); err == nil {
+		t.Fatal("expected an error for an unknown account")
+	}
+
+	start := time.Now()
+	for i := 0; i < maxStatusChanges+5; i++ {
+		change := &StatusChange{AccountID: "7", IsActive: i%2 == 1, Source: SourceMonitor, ChangedAt: start.Add(time.Duration(i) * time.Second)}
+		if !change.IsActive {
+			change.Reason = ReasonSessionRevoked
+		}
+		if err := store.RecordStatusChange(change); err != nil {
+			t.Fatalf("failed to record change: %v", err)
+		}
+	}
+
+	// The history survives a reload, capped and newest first
+	store, err = NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to reload store: %v", err)
+	}
+	history := store.StatusHistory("7")
+	if len(history) != maxStatusChanges {
+		t.Fatalf("expected %d changes, got %d", maxStatusChanges, len(history))
+	}
+	if !history[0].ChangedAt.After(history[1].ChangedAt) || history[0].Reason != ReasonSessionRevoked {
+		t.Fatalf("unexpected newest change: %+v", history[0])
+	}
+
+	if err := store.Delete("7", 1); err != nil {
+		t.Fatalf("failed to delete account: %v", err)
+	}
+	if len(store.StatusHistory("7")) != 0 {
+		t.Fatal("history of a deleted account was kept")
+	}
+}
+
+func TestSetHealthKeepsConcurrentEdits(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	if err := store.Create(&Account{OwnerID: 1, TelegramID: 7, IsActive: true}); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	// The proxy is changed while a session check is running
+	edited, _ := store.Get("7")
+	updated := *edited
+	updated.ProxyURL = "socks5://proxy:1080"
+	if err := store.Update(&updated); err != nil {
+		t.Fatalf("failed to update account: %v", err)
+	}
+
+	changed, err := store.SetHealth("7", false, ReasonSessionRevoked, time.Now(), "")
+	if err != nil {
+		t.Fatalf("failed to set health: %v", err)
+	}
+	if !changed {
+		t.Fatal("expected the status change to be reported")
+	}
+
+	store, err = NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to reload store: %v", err)
+	}
+	account, _ := store.Get("7")
+	if account.ProxyURL != "socks5://proxy:1080" {
+		t.Fatalf("proxy edit was lost, got %q", account.ProxyURL)
+	}
+	if account.IsActive || account.InactiveReason != ReasonSessionRevoked || account.LastCheckedAt == nil {
+		t.Fatalf("health was not saved: %+v", account)
+	}
+}
@@ -0,0 +1,448 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+
+	tgclient "github.com/soluchok/tgsender/pkg/telegram"
+)
+
+// PhoneAuthState represents the state of a phone code authentication session
+type PhoneAuthState struct {
+	Token     string    `json:"token"`
+	Status    string    `json:"status"` // pending, code_required, password_required, success, error, expired, locked
+	Phone     string    `json:"phone"`
+	CodeVia   string    `json:"code_via,omitempty"` // app, sms, call, email, ...
+	Error     string    `json:"error,omitempty"`
+	Account   *Account  `json:"account,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// maxCodeAttempts is how many invalid login codes lock a phone session
+const maxCodeAttempts = 5
+
+var (
+	// ErrInvalidPhone is returned for phone numbers that can not be one
+	ErrInvalidPhone = errors.New("invalid phone number")
+	// ErrCodeLocked is returned for phone sessions locked after too many
+	// invalid login codes
+	ErrCodeLocked = errors.New("too many invalid codes, start a new login")
+)
+
+// PhoneAuthManager manages phone code authentication sessions. It is the
+// alternative to QR login for users without a second logged in device.
+type PhoneAuthManager struct {
+	mu       sync.RWMutex
+	sessions map[string]*phoneSession
+	store    *Store
+	appID    int
+	appHash  string
+}
+
+type phoneSession struct {
+	state            *PhoneAuthState
+	ownerID          int64 // User who started the session
+	workspaceID      int64 // Workspace the linked account will belong to
+	cancel           context.CancelFunc
+	memorySession    *memorySession // In-memory session storage
+	sent             chan struct{}  // Closed once the code is sent or sending failed
+	sentOnce         sync.Once
+	codeCh           chan string // Channel to receive the login code
+	passwordCh       chan string // Channel to receive 2FA password
+	codeFailures     int         // Invalid login codes so far
+	passwordFailures int         // Invalid 2FA passwords so far
+}
+
+// NewPhoneAuthManager creates a new phone auth manager
+func NewPhoneAuthManager(store *Store, appID int, appHash string) *PhoneAuthManager {
+	return &PhoneAuthManager{
+		sessions: make(map[string]*phoneSession),
+		store:    store,
+		appID:    appID,
+		appHash:  appHash,
+	}
+}
+
+// StartAuth asks Telegram to send a login code to phone. The linked account
+// will belong to workspaceID.
+func (m *PhoneAuthManager) StartAuth(ownerID, workspaceID int64, phone string) (*PhoneAuthState, error) {
+	phone = phoneDigits(phone)
+	if len(phone) < 7 || len(phone) > 15 {
+		return nil, ErrInvalidPhone
+	}
+
+	token, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &PhoneAuthState{
+		Token:     token,
+		Status:    "pending",
+		Phone:     "+" + phone,
+		ExpiresAt: time.Now().Add(5 * time.Minute),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+
+	session := &phoneSession{
+		state:       state,
+		ownerID:     ownerID,
+		workspaceID: workspaceID,
+		cancel:      cancel,
+		sent:        make(chan struct{}),
+		codeCh:      make(chan string, 1),
+		passwordCh:  make(chan string, 1),
+	}
+
+	m.mu.Lock()
+	m.sessions[token] = session
+	m.mu.Unlock()
+
+	// Start phone auth in background
+	go m.runPhoneAuth(ctx, session, phone)
+
+	// Wait for the code to be sent, so an unknown number fails right away
+	select {
+	case <-session.sent:
+	case <-time.After(15 * time.Second):
+	}
+
+	m.mu.RLock()
+	currentState := *session.state
+	m.mu.RUnlock()
+
+	return &currentState, nil
+}
+
+// GetStatus returns the current status of a phone auth session started by
+// ownerID
+func (m *PhoneAuthManager) GetStatus(token string, ownerID int64) (*PhoneAuthState, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[token]
+	if !ok || session.ownerID != ownerID {
+		return nil, false
+	}
+
+	// Sessions waiting for input expire, finished ones keep their status
+	switch session.state.Status {
+	case "pending", "code_required", "password_required":
+		if time.Now().After(session.state.ExpiresAt) {
+			session.state.Status = "expired"
+			session.cancel()
+		}
+	}
+
+	stateCopy := *session.state
+	return &stateCopy, true
+}
+
+// SubmitCode submits the login code for a session started by ownerID
+func (m *PhoneAuthManager) SubmitCode(token string, ownerID int64, code string) error {
+	session, status, ok := m.lookup(token, ownerID)
+	if !ok {
+		return fmt.Errorf("session not found")
+	}
+
+	if status == "locked" {
+		return ErrCodeLocked
+	}
+	if status != "code_required" {
+		return fmt.Errorf("code not required")
+	}
+
+	select {
+	case session.codeCh <- code:
+		return nil
+	default:
+		return fmt.Errorf("code channel full")
+	}
+}
+
+// SubmitPassword submits the 2FA password for a session started by ownerID
+func (m *PhoneAuthManager) SubmitPassword(token string, ownerID int64, password string) error {
+	session, status, ok := m.lookup(token, ownerID)
+	if !ok {
+		return fmt.Errorf("session not found")
+	}
+
+	if status == "locked" {
+		return ErrPasswordLocked
+	}
+	if status != "password_required" {
+		return fmt.Errorf("password not required")
+	}
+
+	select {
+	case session.passwordCh <- password:
+		return nil
+	default:
+		return fmt.Errorf("password channel full")
+	}
+}
+
+// lookup returns the session started by ownerID and its current status
+func (m *PhoneAuthManager) lookup(token string, ownerID int64) (*phoneSession, string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[token]
+	if !ok || session.ownerID != ownerID {
+		return nil, "", false
+	}
+	return session, session.state.Status, true
+}
+
+// CancelAuth cancels an ongoing phone auth session started by ownerID
+func (m *PhoneAuthManager) CancelAuth(token string, ownerID int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session, ok := m.sessions[token]; ok && session.ownerID == ownerID {
+		session.cancel()
+		delete(m.sessions, token)
+	}
+}
+
+func (m *PhoneAuthManager) runPhoneAuth(ctx context.Context, session *phoneSession, phone string) {
+	markSent := func() { session.sentOnce.Do(func() { close(session.sent) }) }
+	defer markSent()
+
+	// Keep session for 30 seconds after completion so frontend can fetch final status
+	defer func() {
+		go func() {
+			time.Sleep(30 * time.Second)
+			m.mu.Lock()
+			delete(m.sessions, session.state.Token)
+			m.mu.Unlock()
+		}()
+	}()
+
+	// Ensure data directory exists
+	if err := os.MkdirAll(m.store.DataDir(), 0700); err != nil {
+		slog.Error("failed to create session directory", "error", err)
+		m.setError("Failed to create session directory", session)
+		return
+	}
+
+	// Use in-memory session storage during auth - will save to file only on success
+	session.memorySession = &memorySession{}
+
+	client := telegram.NewClient(m.appID, m.appHash, telegram.Options{
+		SessionStorage: session.memorySession,
+	})
+
+	err := tgclient.Run(ctx, client, func(ctx context.Context) error {
+		sentCode, err := client.Auth().SendCode(ctx, phone, auth.SendCodeOptions{})
+		if err != nil {
+			if tgerr.Is(err, "PHONE_NUMBER_INVALID") {
+				m.setError("Invalid phone number", session)
+			}
+			return fmt.Errorf("send code: %w", err)
+		}
+
+		switch s := sentCode.(type) {
+		case *tg.AuthSentCode:
+			m.mu.Lock()
+			session.state.Status = "code_required"
+			session.state.CodeVia = sentCodeVia(s.Type)
+			m.mu.Unlock()
+			markSent()
+
+			return m.handleCode(ctx, client, session, phone, s.PhoneCodeHash)
+		case *tg.AuthSentCodeSuccess:
+			// Telegram logged in without a code
+			markSent()
+			authAuth, ok := s.Authorization.(*tg.AuthAuthorization)
+			if !ok {
+				m.setError("This phone number has no Telegram account", session)
+				return fmt.Errorf("unexpected authorization type: %T", s.Authorization)
+			}
+			return m.handleLoginSuccess(ctx, client, session, authAuth)
+		default:
+			return fmt.Errorf("unexpected sent code type: %T", sentCode)
+		}
+	})
+
+	// After client.Run() completes, save session to file if login was successful
+	if session.state.Status == "success" && session.state.Account != nil {
+		saveSession(m.store, session.memorySession, session.state.Account.ID)
+	}
+
+	if err != nil && session.state.Status != "success" {
+		slog.Error("phone auth error", "error", err)
+		m.mu.Lock()
+		if session.state.Status != "expired" && session.state.Status != "locked" {
+			session.state.Status = "error"
+			if session.state.Error == "" {
+				session.state.Error = err.Error()
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// handleCode waits for the login code and signs in with it. Every invalid
+// code asks again until the attempts run out.
+func (m *PhoneAuthManager) handleCode(ctx context.Context, client *telegram.Client, session *phoneSession, phone, codeHash string) error {
+	for {
+		m.mu.Lock()
+		session.state.ExpiresAt = time.Now().Add(5 * time.Minute)
+		m.mu.Unlock()
+
+		slog.Info("waiting for login code")
+
+		select {
+		case code := <-session.codeCh:
+			authAuth, err := client.Auth().SignIn(ctx, phone, code, codeHash)
+			switch {
+			case errors.Is(err, auth.ErrPasswordAuthNeeded):
+				slog.Info("2FA password required")
+				return m.handle2FA(ctx, client, session)
+			case tgerr.Is(err, "PHONE_CODE_INVALID", "PHONE_CODE_EMPTY"):
+				m.mu.Lock()
+				session.codeFailures++
+				if session.codeFailures >= maxCodeAttempts {
+					session.state.Status = "locked"
+					session.state.Error = "Too many invalid codes, start a new login"
+					m.mu.Unlock()
+					return ErrCodeLocked
+				}
+				session.state.Error = fmt.Sprintf("Invalid code, %d attempts left", maxCodeAttempts-session.codeFailures)
+				m.mu.Unlock()
+				continue
+			case tgerr.Is(err, "PHONE_CODE_EXPIRED"):
+				m.mu.Lock()
+				session.state.Status = "expired"
+				session.state.Error = "The code has expired, start a new login"
+				m.mu.Unlock()
+				return fmt.Errorf("sign in: %w", err)
+			}
+			var signUpRequired *auth.SignUpRequired
+			if errors.As(err, &signUpRequired) {
+				m.setError("This phone number has no Telegram account", session)
+				return err
+			}
+			if err != nil {
+				return fmt.Errorf("sign in: %w", err)
+			}
+			return m.handleLoginSuccess(ctx, client, session, authAuth)
+
+		case <-time.After(5 * time.Minute):
+			m.mu.Lock()
+			session.state.Status = "expired"
+			session.state.Error = "Code input timed out"
+			m.mu.Unlock()
+			return fmt.Errorf("code timeout")
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handle2FA waits for the 2FA password. Every invalid password asks again
+// until the attempts run out.
+func (m *PhoneAuthManager) handle2FA(ctx context.Context, client *telegram.Client, session *phoneSession) error {
+	for {
+		m.mu.Lock()
+		session.state.Status = "password_required"
+		session.state.ExpiresAt = time.Now().Add(5 * time.Minute) // Extend expiry
+		m.mu.Unlock()
+
+		slog.Info("waiting for password input")
+
+		select {
+		case password := <-session.passwordCh:
+			authAuth, err := client.Auth().Password(ctx, password)
+			if errors.Is(err, auth.ErrPasswordInvalid) {
+				m.mu.Lock()
+				session.passwordFailures++
+				if session.passwordFailures >= maxPasswordAttempts {
+					session.state.Status = "locked"
+					session.state.Error = "Too many invalid passwords, start a new login"
+					m.mu.Unlock()
+					return ErrPasswordLocked
+				}
+				session.state.Error = fmt.Sprintf("Invalid password, %d attempts left", maxPasswordAttempts-session.passwordFailures)
+				m.mu.Unlock()
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("check password: %w", err)
+			}
+			return m.handleLoginSuccess(ctx, client, session, authAuth)
+
+		case <-time.After(5 * time.Minute):
+			m.mu.Lock()
+			session.state.Status = "expired"
+			session.state.Error = "Password input timed out"
+			m.mu.Unlock()
+			return fmt.Errorf("password timeout")
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *PhoneAuthManager) handleLoginSuccess(ctx context.Context, client *telegram.Client, session *phoneSession, authAuth *tg.AuthAuthorization) error {
+	user, ok := authAuth.User.AsNotEmpty()
+	if !ok {
+		return fmt.Errorf("empty user")
+	}
+
+	slog.Info("login successful", "user_id", user.ID, "username", user.Username)
+
+	account, err := linkAccount(ctx, client, m.store, session.workspaceID, user)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	session.state.Status = "success"
+	session.state.Error = ""
+	session.state.Account = account
+	m.mu.Unlock()
+
+	slog.Info("account created successfully", "account_id", account.ID)
+
+	return nil
+}
+
+func (m *PhoneAuthManager) setError(message string, session *phoneSession) {
+	m.mu.Lock()
+	session.state.Status = "error"
+	session.state.Error = message
+	m.mu.Unlock()
+}
+
+// sentCodeVia names where Telegram delivered the login code
+func sentCodeVia(t tg.AuthSentCodeTypeClass) string {
+	switch t.(type) {
+	case *tg.AuthSentCodeTypeApp:
+		return "app"
+	case *tg.AuthSentCodeTypeSMS, *tg.AuthSentCodeTypeSMSWord, *tg.AuthSentCodeTypeSMSPhrase, *tg.AuthSentCodeTypeFirebaseSMS:
+		return "sms"
+	case *tg.AuthSentCodeTypeCall, *tg.AuthSentCodeTypeFlashCall, *tg.AuthSentCodeTypeMissedCall:
+		return "call"
+	case *tg.AuthSentCodeTypeEmailCode:
+		return "email"
+	case *tg.AuthSentCodeTypeFragmentSMS:
+		return "fragment"
+	default:
+		return ""
+	}
+}
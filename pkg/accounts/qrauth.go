@@ -3,6 +3,7 @@ package accounts
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -16,12 +17,14 @@ import (
 	"github.com/gotd/td/tg"
 	"github.com/gotd/td/tgerr"
 	"rsc.io/qr"
+
+	tgclient "github.com/soluchok/tgsender/pkg/telegram"
 )
 
 // QRAuthState represents the state of a QR authentication session
 type QRAuthState struct {
 	Token     string    `json:"token"`
-	Status    string    `json:"status"` // pending, scanning, password_required, success, error, expired
+	Status    string    `json:"status"` // pending, scanning, password_required, success, error, expired, locked
 	QRURL     string    `json:"qr_url,omitempty"`
 	Error     string    `json:"error,omitempty"`
 	Account   *Account  `json:"account,omitempty"`
@@ -59,6 +62,13 @@ func (m *memorySession) SaveToFile(path string) error {
 	return os.WriteFile(path, m.data, 0600)
 }
 
+// maxPasswordAttempts is how many invalid 2FA passwords lock a QR session
+const maxPasswordAttempts = 5
+
+// ErrPasswordLocked is returned for QR sessions locked after too many invalid
+// 2FA passwords
+var ErrPasswordLocked = errors.New("too many invalid passwords, start a new login")
+
 // QRAuthManager manages QR code authentication sessions
 type QRAuthManager struct {
 	mu       sync.RWMutex
@@ -69,12 +79,14 @@ type QRAuthManager struct {
 }
 
 type qrSession struct {
-	state         *QRAuthState
-	ownerID       int64
-	cancel        context.CancelFunc
-	client        *telegram.Client
-	memorySession *memorySession // In-memory session storage
-	passwordCh    chan string    // Channel to receive 2FA password
+	state            *QRAuthState
+	ownerID          int64 // User who started the session
+	workspaceID      int64 // Workspace the linked account will belong to
+	cancel           context.CancelFunc
+	client           *telegram.Client
+	memorySession    *memorySession // In-memory session storage
+	passwordCh       chan string    // Channel to receive 2FA password
+	passwordFailures int            // Invalid 2FA passwords so far
 }
 
 // NewQRAuthManager creates a new QR auth manager
@@ -87,8 +99,9 @@ func NewQRAuthManager(store *Store, appID int, appHash string) *QRAuthManager {
 	}
 }
 
-// StartAuth initiates a new QR authentication session
-func (m *QRAuthManager) StartAuth(ownerID int64) (*QRAuthState, error) {
+// StartAuth initiates a new QR authentication session. The linked account
+// will belong to workspaceID.
+func (m *QRAuthManager) StartAuth(ownerID, workspaceID int64) (*QRAuthState, error) {
 	token, err := generateID()
 	if err != nil {
 		return nil, err
@@ -103,10 +116,11 @@ func (m *QRAuthManager) StartAuth(ownerID int64) (*QRAuthState, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 
 	session := &qrSession{
-		state:      state,
-		ownerID:    ownerID,
-		cancel:     cancel,
-		passwordCh: make(chan string, 1),
+		state:       state,
+		ownerID:     ownerID,
+		workspaceID: workspaceID,
+		cancel:      cancel,
+		passwordCh:  make(chan string, 1),
 	}
 
 	m.mu.Lock()
@@ -126,13 +140,13 @@ func (m *QRAuthManager) StartAuth(ownerID int64) (*QRAuthState, error) {
 	return &currentState, nil
 }
 
-// GetStatus returns the current status of a QR auth session
-func (m *QRAuthManager) GetStatus(token string) (*QRAuthState, bool) {
+// GetStatus returns the current status of a QR auth session started by ownerID
+func (m *QRAuthManager) GetStatus(token string, ownerID int64) (*QRAuthState, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	session, ok := m.sessions[token]
-	if !ok {
+	if !ok || session.ownerID != ownerID {
 		return nil, false
 	}
 
@@ -148,19 +162,24 @@ func (m *QRAuthManager) GetStatus(token string) (*QRAuthState, bool) {
 	return &stateCopy, true
 }
 
-// SubmitPassword submits the 2FA password for a session
-func (m *QRAuthManager) SubmitPassword(token, password string) error {
+// SubmitPassword submits the 2FA password for a session started by ownerID
+func (m *QRAuthManager) SubmitPassword(token string, ownerID int64, password string) error {
 	m.mu.RLock()
 	session, ok := m.sessions[token]
+	var status string
+	if ok {
+		status = session.state.Status
+	}
 	m.mu.RUnlock()
 
-	if !ok {
+	if !ok || session.ownerID != ownerID {
 		return fmt.Errorf("session not found")
 	}
 
-	//scanning
-	fmt.Println("session.state.Status", session.state.Status)
-	if session.state.Status != "password_required" {
+	if status == "locked" {
+		return ErrPasswordLocked
+	}
+	if status != "password_required" {
 		return fmt.Errorf("password not required")
 	}
 
@@ -172,12 +191,12 @@ func (m *QRAuthManager) SubmitPassword(token, password string) error {
 	}
 }
 
-// CancelAuth cancels an ongoing QR auth session
-func (m *QRAuthManager) CancelAuth(token string) {
+// CancelAuth cancels an ongoing QR auth session started by ownerID
+func (m *QRAuthManager) CancelAuth(token string, ownerID int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if session, ok := m.sessions[token]; ok {
+	if session, ok := m.sessions[token]; ok && session.ownerID == ownerID {
 		session.cancel()
 		delete(m.sessions, token)
 	}
@@ -195,8 +214,8 @@ func (m *QRAuthManager) runQRAuth(ctx context.Context, session *qrSession) {
 		}()
 	}()
 
-	// Ensure .data directory exists
-	if err := os.MkdirAll(".data", 0700); err != nil {
+	// Ensure data directory exists
+	if err := os.MkdirAll(m.store.DataDir(), 0700); err != nil {
 		slog.Error("failed to create session directory", "error", err)
 		m.mu.Lock()
 		session.state.Status = "error"
@@ -229,7 +248,7 @@ func (m *QRAuthManager) runQRAuth(ctx context.Context, session *qrSession) {
 	})
 	session.client = client
 
-	err := client.Run(ctx, func(ctx context.Context) error {
+	err := tgclient.Run(ctx, client, func(ctx context.Context) error {
 		for {
 			slog.Info("exporting login token")
 
@@ -312,18 +331,13 @@ func (m *QRAuthManager) runQRAuth(ctx context.Context, session *qrSession) {
 
 	// After client.Run() completes, save session to file if login was successful
 	if session.state.Status == "success" && session.state.Account != nil {
-		sessionPath := fmt.Sprintf(".data/account_%s.json", session.state.Account.ID)
-		if err := session.memorySession.SaveToFile(sessionPath); err != nil {
-			slog.Error("failed to save session file", "error", err)
-		} else {
-			slog.Info("session saved to file", "path", sessionPath)
-		}
+		saveSession(m.store, session.memorySession, session.state.Account.ID)
 	}
 
 	if err != nil && session.state.Status != "success" {
 		slog.Error("QR auth error", "error", err)
 		m.mu.Lock()
-		if session.state.Status != "expired" && session.state.Status != "password_required" {
+		if session.state.Status != "expired" && session.state.Status != "password_required" && session.state.Status != "locked" {
 			session.state.Status = "error"
 			if session.state.Error == "" {
 				session.state.Error = err.Error()
@@ -370,104 +384,98 @@ func (m *QRAuthManager) handleTokenImport(ctx context.Context, client *telegram.
 }
 
 func (m *QRAuthManager) handle2FA(ctx context.Context, client *telegram.Client, session *qrSession) error {
-	// Get password settings
-	pwd, err := client.API().AccountGetPassword(ctx)
-	if err != nil {
-		return fmt.Errorf("get password settings: %w", err)
-	}
-
-	// Update state to request password
-	m.mu.Lock()
-	session.state.Status = "password_required"
-	session.state.ExpiresAt = time.Now().Add(5 * time.Minute) // Extend expiry
-	m.mu.Unlock()
-
-	slog.Info("waiting for password input")
-
-	// Wait for password from user
-	select {
-	case password := <-session.passwordCh:
-		slog.Info("password received, checking...")
-
-		// Compute SRP password using gotd's auth helper
-		srpAnswer, err := auth.PasswordHash(
-			[]byte(password),
-			pwd.SRPID,
-			pwd.SRPB,
-			pwd.SecureRandom,
-			pwd.CurrentAlgo,
-		)
+	// Every invalid password asks again, with fresh SRP parameters, until the
+	// attempts run out
+	for {
+		// Get password settings
+		pwd, err := client.API().AccountGetPassword(ctx)
 		if err != nil {
-			m.mu.Lock()
-			session.state.Status = "error"
-			session.state.Error = "Failed to process password"
-			m.mu.Unlock()
-			return fmt.Errorf("compute SRP: %w", err)
+			return fmt.Errorf("get password settings: %w", err)
 		}
 
-		// Check password
-		authResult, err := client.API().AuthCheckPassword(ctx, srpAnswer)
-		if err != nil {
-			if tgerr.Is(err, "PASSWORD_HASH_INVALID") {
+		// Update state to request password
+		m.mu.Lock()
+		session.state.Status = "password_required"
+		session.state.ExpiresAt = time.Now().Add(5 * time.Minute) // Extend expiry
+		m.mu.Unlock()
+
+		slog.Info("waiting for password input")
+
+		// Wait for password from user
+		select {
+		case password := <-session.passwordCh:
+			slog.Info("password received, checking...")
+
+			// Compute SRP password using gotd's auth helper
+			srpAnswer, err := auth.PasswordHash(
+				[]byte(password),
+				pwd.SRPID,
+				pwd.SRPB,
+				pwd.SecureRandom,
+				pwd.CurrentAlgo,
+			)
+			if err != nil {
 				m.mu.Lock()
 				session.state.Status = "error"
-				session.state.Error = "Invalid password"
+				session.state.Error = "Failed to process password"
 				m.mu.Unlock()
-				return fmt.Errorf("invalid password")
+				return fmt.Errorf("compute SRP: %w", err)
 			}
-			return fmt.Errorf("check password: %w", err)
-		}
 
-		// Get user from auth result
-		authAuth, ok := authResult.(*tg.AuthAuthorization)
-		if !ok {
-			return fmt.Errorf("unexpected auth result type: %T", authResult)
-		}
+			// Check password
+			authResult, err := client.API().AuthCheckPassword(ctx, srpAnswer)
+			if err != nil {
+				if tgerr.Is(err, "PASSWORD_HASH_INVALID") {
+					m.mu.Lock()
+					session.passwordFailures++
+					if session.passwordFailures >= maxPasswordAttempts {
+						session.state.Status = "locked"
+						session.state.Error = "Too many invalid passwords, start a new login"
+						m.mu.Unlock()
+						return ErrPasswordLocked
+					}
+					session.state.Error = fmt.Sprintf("Invalid password, %d attempts left", maxPasswordAttempts-session.passwordFailures)
+					m.mu.Unlock()
+					continue
+				}
+				return fmt.Errorf("check password: %w", err)
+			}
 
-		user, ok := authAuth.User.AsNotEmpty()
-		if !ok {
-			return fmt.Errorf("empty user after 2FA")
-		}
+			// Get user from auth result
+			authAuth, ok := authResult.(*tg.AuthAuthorization)
+			if !ok {
+				return fmt.Errorf("unexpected auth result type: %T", authResult)
+			}
 
-		slog.Info("2FA successful", "user_id", user.ID)
-
-		// Download profile photo
-		photoURL := downloadProfilePhoto(ctx, client, user)
-
-		// Create account with TelegramID as the account ID
-		// Note: Session file will be renamed after client.Run() completes
-		account := &Account{
-			ID:         fmt.Sprintf("%d", user.ID),
-			OwnerID:    session.ownerID,
-			TelegramID: user.ID,
-			Phone:      user.Phone,
-			FirstName:  user.FirstName,
-			LastName:   user.LastName,
-			Username:   user.Username,
-			PhotoURL:   photoURL,
-			IsActive:   true,
-		}
+			user, ok := authAuth.User.AsNotEmpty()
+			if !ok {
+				return fmt.Errorf("empty user after 2FA")
+			}
 
-		if err := m.store.Create(account); err != nil {
-			return fmt.Errorf("save account: %w", err)
-		}
+			slog.Info("2FA successful", "user_id", user.ID)
 
-		m.mu.Lock()
-		session.state.Status = "success"
-		session.state.Account = account
-		m.mu.Unlock()
+			account, err := linkAccount(ctx, client, m.store, session.workspaceID, user)
+			if err != nil {
+				return err
+			}
 
-		return nil
+			m.mu.Lock()
+			session.state.Status = "success"
+			session.state.Account = account
+			m.mu.Unlock()
 
-	case <-time.After(5 * time.Minute):
-		m.mu.Lock()
-		session.state.Status = "expired"
-		session.state.Error = "Password input timed out"
-		m.mu.Unlock()
-		return fmt.Errorf("password timeout")
+			return nil
 
-	case <-ctx.Done():
-		return ctx.Err()
+		case <-time.After(5 * time.Minute):
+			m.mu.Lock()
+			session.state.Status = "expired"
+			session.state.Error = "Password input timed out"
+			m.mu.Unlock()
+			return fmt.Errorf("password timeout")
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 }
 
@@ -484,14 +492,32 @@ func (m *QRAuthManager) handleLoginSuccess(ctx context.Context, client *telegram
 
 	slog.Info("login successful", "user_id", user.ID, "username", user.Username)
 
+	account, err := linkAccount(ctx, client, m.store, session.workspaceID, user)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	session.state.Status = "success"
+	session.state.Account = account
+	m.mu.Unlock()
+
+	slog.Info("account created successfully", "account_id", account.ID)
+
+	return nil
+}
+
+// linkAccount stores the account of a user who has just logged in on client,
+// in workspaceID. The session is written by saveSession once the client has
+// stopped.
+func linkAccount(ctx context.Context, client *telegram.Client, store *Store, workspaceID int64, user *tg.User) (*Account, error) {
 	// Download profile photo
 	photoURL := downloadProfilePhoto(ctx, client, user)
 
 	// Create account with TelegramID as the account ID
-	// Note: Session file will be renamed after client.Run() completes
 	account := &Account{
 		ID:         fmt.Sprintf("%d", user.ID),
-		OwnerID:    session.ownerID,
+		OwnerID:    workspaceID,
 		TelegramID: user.ID,
 		Phone:      user.Phone,
 		FirstName:  user.FirstName,
@@ -501,19 +527,21 @@ func (m *QRAuthManager) handleLoginSuccess(ctx context.Context, client *telegram
 		IsActive:   true,
 	}
 
-	// Save account
-	if err := m.store.Create(account); err != nil {
-		return fmt.Errorf("save account: %w", err)
+	if err := store.Create(account); err != nil {
+		return nil, fmt.Errorf("save account: %w", err)
 	}
+	return account, nil
+}
 
-	m.mu.Lock()
-	session.state.Status = "success"
-	session.state.Account = account
-	m.mu.Unlock()
-
-	slog.Info("account created successfully", "account_id", account.ID)
-
-	return nil
+// saveSession writes the in-memory session of a finished login to the
+// session file of accountID
+func saveSession(store *Store, session *memorySession, accountID string) {
+	sessionPath := store.SessionPath(accountID)
+	if err := session.SaveToFile(sessionPath); err != nil {
+		slog.Error("failed to save session file", "error", err)
+		return
+	}
+	slog.Info("session saved to file", "path", sessionPath)
 }
 
 func generateQRCode(url string) (string, error) {
@@ -11,10 +11,12 @@ import (
 	"github.com/gotd/td/telegram/message"
 	"github.com/gotd/td/tg"
 
+	"github.com/soluchok/tgsender/pkg/metrics"
 	tgclient "github.com/soluchok/tgsender/pkg/telegram"
+	"github.com/soluchok/tgsender/pkg/webhooks"
 )
 
-const spamCacheTTL = 10 * time.Minute
+const defaultSpamCacheTTL = 10 * time.Minute
 
 // SpamStatus represents the spam check result
 type SpamStatus struct {
@@ -33,23 +35,40 @@ type cachedSpamStatus struct {
 
 // SpamChecker checks if an account is in Telegram's spam filter
 type SpamChecker struct {
-	store   *Store
-	appID   int
-	appHash string
-	cache   map[string]*cachedSpamStatus
-	mu      sync.RWMutex
+	store    *Store
+	appID    int
+	appHash  string
+	cacheTTL time.Duration
+	cache    map[string]*cachedSpamStatus
+	limited  map[string]bool // account ID -> limited at the last check
+	mu       sync.RWMutex
+	webhooks *webhooks.Dispatcher
 }
 
 // NewSpamChecker creates a new spam checker
 func NewSpamChecker(store *Store, appID int, appHash string) *SpamChecker {
 	return &SpamChecker{
-		store:   store,
-		appID:   appID,
-		appHash: appHash,
-		cache:   make(map[string]*cachedSpamStatus),
+		store:    store,
+		appID:    appID,
+		appHash:  appHash,
+		cacheTTL: defaultSpamCacheTTL,
+		cache:    make(map[string]*cachedSpamStatus),
+		limited:  make(map[string]bool),
 	}
 }
 
+// WithCacheTTL sets how long spam check results are cached
+func (s *SpamChecker) WithCacheTTL(ttl time.Duration) *SpamChecker {
+	s.cacheTTL = ttl
+	return s
+}
+
+// WithWebhooks reports accounts that became limited to webhooks
+func (s *SpamChecker) WithWebhooks(dispatcher *webhooks.Dispatcher) *SpamChecker {
+	s.webhooks = dispatcher
+	return s
+}
+
 // CheckSpamStatus returns cached status or fetches fresh status from @SpamBot
 func (s *SpamChecker) CheckSpamStatus(ctx context.Context, accountID string, forceRefresh bool) (*SpamStatus, error) {
 	// Check cache first (unless force refresh)
@@ -67,17 +86,39 @@ func (s *SpamChecker) CheckSpamStatus(ctx context.Context, accountID string, for
 	// Fetch fresh status
 	status, err := s.fetchSpamStatus(ctx, accountID)
 	if err != nil {
+		metrics.SpamChecks.WithLabelValues(accountID, "error").Inc()
 		return nil, err
 	}
 
+	if status.IsLimited {
+		metrics.SpamChecks.WithLabelValues(accountID, "limited").Inc()
+	} else {
+		metrics.SpamChecks.WithLabelValues(accountID, "free").Inc()
+	}
+
 	// Cache the result
 	s.mu.Lock()
 	s.cache[accountID] = &cachedSpamStatus{
 		status:    status,
-		expiresAt: time.Now().Add(spamCacheTTL),
+		expiresAt: time.Now().Add(s.cacheTTL),
 	}
+	newlyLimited := status.IsLimited && !s.limited[accountID]
+	s.limited[accountID] = status.IsLimited
 	s.mu.Unlock()
 
+	if newlyLimited {
+		var phone string
+		if account, ok := s.store.Get(accountID); ok {
+			phone = account.Phone
+		}
+		s.webhooks.Emit(accountID, webhooks.EventSpamLimited, webhooks.SpamData{
+			AccountID:    accountID,
+			Phone:        phone,
+			LimitedUntil: status.LimitedUntil,
+			Message:      status.Message,
+		})
+	}
+
 	return status, nil
 }
 
@@ -89,7 +130,7 @@ func (s *SpamChecker) fetchSpamStatus(ctx context.Context, accountID string) (*S
 		return nil, fmt.Errorf("account not found")
 	}
 
-	sessionPath := ".data/account_" + accountID + ".json"
+	sessionPath := s.store.SessionPath(accountID)
 
 	client, err := tgclient.CreateClient(s.appID, s.appHash, sessionPath, account.ProxyURL)
 	if err != nil {
@@ -98,7 +139,7 @@ func (s *SpamChecker) fetchSpamStatus(ctx context.Context, accountID string) (*S
 
 	var status *SpamStatus
 
-	err = client.Run(ctx, func(ctx context.Context) error {
+	err = tgclient.Run(ctx, client, func(ctx context.Context) error {
 		api := client.API()
 
 		// Resolve @SpamBot username
@@ -5,18 +5,21 @@ import (
 	"encoding/base64"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/gotd/td/telegram/downloader"
 	"github.com/gotd/td/tg"
 
 	tgclient "github.com/soluchok/tgsender/pkg/telegram"
+	"github.com/soluchok/tgsender/pkg/webhooks"
 )
 
 // Validator checks if Telegram sessions are still valid
 type Validator struct {
-	store   *Store
-	appID   int
-	appHash string
+	store    *Store
+	appID    int
+	appHash  string
+	webhooks *webhooks.Dispatcher
 }
 
 // NewValidator creates a new session validator
@@ -28,33 +31,59 @@ func NewValidator(store *Store, appID int, appHash string) *Validator {
 	}
 }
 
+// WithWebhooks reports revoked sessions to webhooks
+func (v *Validator) WithWebhooks(dispatcher *webhooks.Dispatcher) *Validator {
+	v.webhooks = dispatcher
+	return v
+}
+
+// Reasons an account is inactive
+const (
+	ReasonSessionRevoked = "session_revoked" // The session was logged out or its key is unknown
+	ReasonDeactivated    = "deactivated"     // Telegram deleted or banned the user
+)
+
 // ValidationResult contains the result of session validation
 type ValidationResult struct {
 	IsValid  bool
+	Reason   string // Why the session is invalid, one of the Reason constants
 	PhotoURL string
 }
 
+// invalidReason returns why an error means the session is no longer valid, or
+// "" if the error says nothing about the session
+func invalidReason(err error) string {
+	errStr := err.Error()
+	switch {
+	case strings.Contains(errStr, "USER_DEACTIVATED"):
+		return ReasonDeactivated
+	case strings.Contains(errStr, "AUTH_KEY_UNREGISTERED"),
+		strings.Contains(errStr, "SESSION_REVOKED"):
+		return ReasonSessionRevoked
+	default:
+		return ""
+	}
+}
+
 // ValidateSession checks if an account's Telegram session is still valid
 // and fetches the profile photo if available
 func (v *Validator) ValidateSession(ctx context.Context, account *Account) (*ValidationResult, error) {
 	result := &ValidationResult{}
 
 	// Use account ID (which is the TelegramID) for session path
-	sessionPath := ".data/account_" + account.ID + ".json"
+	sessionPath := v.store.SessionPath(account.ID)
 
 	client, err := tgclient.CreateClient(v.appID, v.appHash, sessionPath, account.ProxyURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
 
-	err = client.Run(ctx, func(ctx context.Context) error {
+	err = tgclient.Run(ctx, client, func(ctx context.Context) error {
 		// Try to get self - if this succeeds, session is valid
 		self, err := client.Self(ctx)
 		if err != nil {
-			errStr := err.Error()
-			if strings.Contains(errStr, "AUTH_KEY_UNREGISTERED") ||
-				strings.Contains(errStr, "SESSION_REVOKED") ||
-				strings.Contains(errStr, "USER_DEACTIVATED") {
+			if reason := invalidReason(err); reason != "" {
+				result.Reason = reason
 				return nil // Session invalid, but not an error
 			}
 			return err
@@ -99,31 +128,48 @@ func (v *Validator) ValidateSession(ctx context.Context, account *Account) (*Val
 
 // ValidateAndUpdateStatus validates a session and updates the account's status and photo
 func (v *Validator) ValidateAndUpdateStatus(ctx context.Context, accountID string) (*ValidationResult, error) {
-	account, ok := v.store.Get(accountID)
+	return v.validateAndUpdate(ctx, accountID, SourceRequest)
+}
+
+// validateAndUpdate validates a session, saves the outcome and records and
+// reports status changes as noticed by source
+func (v *Validator) validateAndUpdate(ctx context.Context, accountID, source string) (*ValidationResult, error) {
+	stored, ok := v.store.Get(accountID)
 	if !ok {
 		return nil, fmt.Errorf("account not found")
 	}
 
-	result, err := v.ValidateSession(ctx, account)
+	result, err := v.ValidateSession(ctx, stored)
 	if err != nil {
 		return nil, err
 	}
 
-	// Update account if anything changed
-	needsUpdate := false
-	if account.IsActive != result.IsValid {
-		account.IsActive = result.IsValid
-		needsUpdate = true
+	now := time.Now()
+	changed, err := v.store.SetHealth(accountID, result.IsValid, result.Reason, now, result.PhotoURL)
+	if err != nil {
+		return result, fmt.Errorf("failed to update account: %w", err)
 	}
-	if result.PhotoURL != "" && account.PhotoURL != result.PhotoURL {
-		account.PhotoURL = result.PhotoURL
-		needsUpdate = true
+
+	if !changed {
+		return result, nil
 	}
 
-	if needsUpdate {
-		if err := v.store.Update(account); err != nil {
-			return result, fmt.Errorf("failed to update account: %w", err)
-		}
+	if err := v.store.RecordStatusChange(&StatusChange{
+		AccountID: accountID,
+		IsActive:  result.IsValid,
+		Reason:    result.Reason,
+		Source:    source,
+		ChangedAt: now,
+	}); err != nil {
+		return result, fmt.Errorf("failed to record status change: %w", err)
+	}
+
+	data := webhooks.AccountData{AccountID: accountID, Phone: stored.Phone}
+	switch result.Reason {
+	case ReasonSessionRevoked:
+		v.webhooks.Emit(accountID, webhooks.EventSessionRevoked, data)
+	case ReasonDeactivated:
+		v.webhooks.Emit(accountID, webhooks.EventAccountDeactivated, data)
 	}
 
 	return result, nil
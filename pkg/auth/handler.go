@@ -1,11 +1,16 @@
 package auth
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -110,6 +115,7 @@ func generateToken(length int) (string, error) {
 // Handler provides HTTP handlers for authentication
 type Handler struct {
 	store    *SessionStore
+	tokens   *TokenStore
 	botToken string
 	maxAge   time.Duration
 }
@@ -123,6 +129,12 @@ func NewHandler(botToken string, sessionTTL, authMaxAge time.Duration) *Handler
 	}
 }
 
+// WithTokenStore enables API tokens
+func (h *Handler) WithTokenStore(tokens *TokenStore) *Handler {
+	h.tokens = tokens
+	return h
+}
+
 // HandleTelegramAuth handles POST /api/auth/telegram
 func (h *Handler) HandleTelegramAuth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -211,6 +223,213 @@ func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// tokenKey is the request context key of an accepted API token
+type tokenKey struct{}
+
+// AllowTokens lets requests to next authenticate with an API token that has
+// the scope, sent as "Authorization: Bearer <token>". Every accepted request
+// is recorded. Requests without the header fall through to the session cookie.
+func (h *Handler) AllowTokens(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || h.tokens == nil {
+			next(w, r)
+			return
+		}
+
+		token, err := h.tokens.Authenticate(secret)
+		if err != nil {
+			writeJSONError(w, "Invalid or expired API token", http.StatusUnauthorized)
+			return
+		}
+		if !token.HasScope(scope) {
+			writeJSONError(w, fmt.Sprintf("API token lacks the %s scope", scope), http.StatusForbidden)
+			return
+		}
+
+		if err := h.tokens.RecordUse(&TokenUse{
+			TokenID:    token.ID,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RemoteAddr: r.RemoteAddr,
+			UsedAt:     time.Now(),
+		}); err != nil {
+			slog.Error("failed to record API token use", "token_id", token.ID, "error", err)
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, token)))
+	}
+}
+
+// OwnerID returns the user a request is made by: the owner of the API token
+// accepted by AllowTokens, or the user of the session cookie.
+func (h *Handler) OwnerID(r *http.Request) (int64, bool) {
+	if token, ok := r.Context().Value(tokenKey{}).(*APIToken); ok {
+		return token.OwnerID, true
+	}
+
+	session, ok := h.getSession(r)
+	if !ok || session.User == nil {
+		return 0, false
+	}
+	return session.User.ID, true
+}
+
+// SessionKey identifies the session a request is made in: the API token
+// accepted by AllowTokens or the session cookie. Rate limits count per key.
+func (h *Handler) SessionKey(r *http.Request) (string, bool) {
+	if token, ok := r.Context().Value(tokenKey{}).(*APIToken); ok {
+		return "token:" + token.ID, true
+	}
+
+	session, ok := h.getSession(r)
+	if !ok {
+		return "", false
+	}
+	return "session:" + HashToken(session.Token), true
+}
+
+// tokenView is a token as returned by the API. The hash is never shown and
+// the secret only when the token was just created.
+type tokenView struct {
+	*APIToken
+	Hash  string `json:"hash,omitempty"`
+	Token string `json:"token,omitempty"`
+}
+
+// tokenRequest is the body of token create requests
+type tokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// HandleListTokens handles GET /api/tokens
+func (h *Handler) HandleListTokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := h.getSession(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	tokens := h.tokens.GetByOwner(session.User.ID)
+	views := make([]tokenView, 0, len(tokens))
+	for _, t := range tokens {
+		views = append(views, tokenView{APIToken: t})
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"tokens": views,
+		"scopes": Scopes,
+	}, http.StatusOK)
+}
+
+// HandleCreateToken handles POST /api/tokens
+// The response is the only one that contains the token
+func (h *Handler) HandleCreateToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	session, ok := h.getSession(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req tokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token := &APIToken{
+		OwnerID:   session.User.ID,
+		Name:      strings.TrimSpace(req.Name),
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(req.Scopes))),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := token.Validate(); err != nil {
+		writeJSONError(w, fmt.Sprintf("Invalid token: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	token, secret, err := h.tokens.Create(token)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to save token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, tokenView{APIToken: token, Token: secret}, http.StatusOK)
+}
+
+// HandleDeleteToken handles DELETE /api/tokens/{id}
+func (h *Handler) HandleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok := h.ownToken(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.tokens.Delete(token.ID); err != nil && !errors.Is(err, ErrTokenNotFound) {
+		writeJSONError(w, fmt.Sprintf("Failed to delete token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Token revoked"}, http.StatusOK)
+}
+
+// HandleListTokenUses handles GET /api/tokens/{id}/uses
+// Returns the latest requests made with the token, newest first
+func (h *Handler) HandleListTokenUses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, ok := h.ownToken(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"uses": h.tokens.Uses(token.ID),
+	}, http.StatusOK)
+}
+
+// ownToken loads the token in the path and checks that it belongs to the
+// caller's session. It writes the error response if not.
+func (h *Handler) ownToken(w http.ResponseWriter, r *http.Request) (*APIToken, bool) {
+	session, ok := h.getSession(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	token, ok := h.tokens.Get(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, "Token not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if token.OwnerID != session.User.ID {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return nil, false
+	}
+
+	return token, true
+}
+
 func (h *Handler) getSession(r *http.Request) (*Session, bool) {
 	cookie, err := r.Cookie("session_token")
 	if err != nil {
@@ -0,0 +1,368 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scopes an API token can be granted. Routes that no scope covers, such as
+// token and webhook management, only accept the session cookie.
+const (
+	ScopeContactsRead = "contacts:read" // List and export contacts, segments and bot subscribers
+	ScopeSend         = "send"          // Start, follow and cancel send jobs, upload media, read templates and delivery reports
+	ScopeAccounts     = "accounts"      // Link, validate, configure and remove accounts
+)
+
+// Scopes are the scopes tokens can be granted
+var Scopes = []string{ScopeContactsRead, ScopeSend, ScopeAccounts}
+
+// tokenPrefix starts every API token, so leaked tokens are easy to recognize
+const tokenPrefix = "tgs_"
+
+// maxTokenUses is how many uses are kept per token
+const maxTokenUses = 100
+
+// usesFlushInterval is how often recorded uses are saved by Run
+const usesFlushInterval = 10 * time.Second
+
+// Errors returned by the token store
+var (
+	ErrTokenNotFound = errors.New("API token not found")
+	ErrTokenExpired  = errors.New("API token expired")
+)
+
+// APIToken gives programs access to the API on behalf of its owner. Only a
+// hash of the secret is stored.
+type APIToken struct {
+	ID         string     `json:"id"`
+	OwnerID    int64      `json:"owner_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Prefix     string     `json:"prefix"` // Start of the secret, to tell tokens apart
+	Hash       string     `json:"hash"`   // Hex SHA-256 of the secret
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // Never expires if nil
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	UseCount   int        `json:"use_count"`
+}
+
+// Validate checks a token before it is saved
+func (t *APIToken) Validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return errors.New("name is required")
+	}
+	if len(t.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range t.Scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	if t.ExpiresAt != nil && !t.ExpiresAt.After(time.Now()) {
+		return errors.New("expires_at must be in the future")
+	}
+	return nil
+}
+
+// HasScope reports whether the token was granted a scope
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+// TokenUse records one request authenticated with a token
+type TokenUse struct {
+	TokenID    string    `json:"token_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	RemoteAddr string    `json:"remote_addr"`
+	UsedAt     time.Time `json:"used_at"`
+}
+
+// TokenStore persists API tokens and their latest uses
+type TokenStore struct {
+	mu      sync.RWMutex
+	dataDir string
+	tokens  map[string]*APIToken // token ID -> token
+	byHash  map[string]string    // secret hash -> token ID
+	uses    []*TokenUse
+	unsaved bool // Uses were recorded since the last save
+}
+
+// NewTokenStore creates a new token store
+func NewTokenStore(dataDir string) (*TokenStore, error) {
+	store := &TokenStore{
+		dataDir: dataDir,
+		tokens:  make(map[string]*APIToken),
+		byHash:  make(map[string]string),
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("failed to load API tokens: %w", err)
+	}
+
+	return store, nil
+}
+
+// Create saves a new token and returns it with its secret. The secret
+// cannot be read back later.
+func (s *TokenStore) Create(t *APIToken) (*APIToken, string, error) {
+	secret, err := generateToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret = tokenPrefix + strings.TrimRight(secret, "=")
+
+	id, err := generateID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokenCopy := *t
+	tokenCopy.ID = id
+	tokenCopy.Prefix = secret[:len(tokenPrefix)+6]
+	tokenCopy.Hash = HashToken(secret)
+	tokenCopy.CreatedAt = time.Now()
+	tokenCopy.LastUsedAt = nil
+	tokenCopy.UseCount = 0
+	s.tokens[id] = &tokenCopy
+	s.byHash[tokenCopy.Hash] = id
+
+	if err := s.saveTokens(); err != nil {
+		return nil, "", err
+	}
+
+	result := tokenCopy
+	return &result, secret, nil
+}
+
+// Get returns a token by ID
+func (s *TokenStore) Get(id string) (*APIToken, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return nil, false
+	}
+	tokenCopy := *t
+	return &tokenCopy, true
+}
+
+// GetByOwner returns the tokens of an owner, newest first
+func (s *TokenStore) GetByOwner(ownerID int64) []*APIToken {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]*APIToken, 0)
+	for _, t := range s.tokens {
+		if t.OwnerID == ownerID {
+			tokenCopy := *t
+			tokens = append(tokens, &tokenCopy)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens
+}
+
+// Delete revokes a token and drops its uses
+func (s *TokenStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[id]
+	if !ok {
+		return ErrTokenNotFound
+	}
+
+	delete(s.tokens, id)
+	delete(s.byHash, t.Hash)
+	s.uses = slices.DeleteFunc(s.uses, func(u *TokenUse) bool {
+		return u.TokenID == id
+	})
+
+	if err := s.saveTokens(); err != nil {
+		return err
+	}
+	return s.saveUses()
+}
+
+// Authenticate returns the token a secret belongs to
+func (s *TokenStore) Authenticate(secret string) (*APIToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.byHash[HashToken(secret)]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+
+	t := s.tokens[id]
+	if t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt) {
+		return nil, ErrTokenExpired
+	}
+
+	tokenCopy := *t
+	return &tokenCopy, nil
+}
+
+// RecordUse logs a request made with a token. Only the latest uses of each
+// token are kept. Uses are saved by FlushUses rather than on every request.
+func (s *TokenStore) RecordUse(use *TokenUse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[use.TokenID]
+	if !ok {
+		return ErrTokenNotFound
+	}
+
+	useCopy := *use
+	t.LastUsedAt = &useCopy.UsedAt
+	t.UseCount++
+	s.uses = append(s.uses, &useCopy)
+
+	count := 0
+	for i := len(s.uses) - 1; i >= 0; i-- {
+		if s.uses[i].TokenID != use.TokenID {
+			continue
+		}
+		if count++; count > maxTokenUses {
+			s.uses = slices.Delete(s.uses, i, i+1)
+		}
+	}
+
+	s.unsaved = true
+	return nil
+}
+
+// FlushUses saves the uses recorded since the last save
+func (s *TokenStore) FlushUses() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.unsaved {
+		return nil
+	}
+	if err := s.saveTokens(); err != nil {
+		return err
+	}
+	if err := s.saveUses(); err != nil {
+		return err
+	}
+	s.unsaved = false
+	return nil
+}
+
+// Run saves recorded uses periodically until ctx is done
+func (s *TokenStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(usesFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.FlushUses(); err != nil {
+				slog.Error("failed to save API token uses", "error", err)
+			}
+		}
+	}
+}
+
+// Uses returns the latest uses of a token, newest first
+func (s *TokenStore) Uses(tokenID string) []*TokenUse {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	uses := make([]*TokenUse, 0)
+	for i := len(s.uses) - 1; i >= 0; i-- {
+		if s.uses[i].TokenID == tokenID {
+			useCopy := *s.uses[i]
+			uses = append(uses, &useCopy)
+		}
+	}
+	return uses
+}
+
+// HashToken returns the stored form of a token secret
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateID() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+func (s *TokenStore) load() error {
+	var tokens []*APIToken
+	if err := readFile(filepath.Join(s.dataDir, "api_tokens.json"), &tokens); err != nil {
+		return err
+	}
+	for _, t := range tokens {
+		s.tokens[t.ID] = t
+		s.byHash[t.Hash] = t.ID
+	}
+
+	return readFile(filepath.Join(s.dataDir, "api_token_uses.json"), &s.uses)
+}
+
+func (s *TokenStore) saveTokens() error {
+	tokens := make([]*APIToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+	return writeFile(filepath.Join(s.dataDir, "api_tokens.json"), tokens)
+}
+
+func (s *TokenStore) saveUses() error {
+	return writeFile(filepath.Join(s.dataDir, "api_token_uses.json"), s.uses)
+}
+
+func readFile(filePath string, v any) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeFile(filePath string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0600)
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordUseSavedOnFlush(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := NewTokenStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := store.Create(&APIToken{OwnerID: 1, Name: "ci", Scopes: []string{ScopeSend}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := store.RecordUse(&TokenUse{TokenID: token.ID, Method: "GET", Path: "/api/jobs", UsedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := store.Get(token.ID); got.UseCount != 3 || len(store.Uses(token.ID)) != 3 {
+		t.Fatalf("uses were not recorded: %+v", got)
+	}
+
+	// Recorded uses stay in memory until flushed
+	reloaded, err := NewTokenStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reloaded.Get(token.ID); got.UseCount != 0 || len(reloaded.Uses(token.ID)) != 0 {
+		t.Fatalf("uses were saved before the flush: %+v", got)
+	}
+
+	if err := store.FlushUses(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err = NewTokenStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reloaded.Get(token.ID); got.UseCount != 3 || got.LastUsedAt == nil || len(reloaded.Uses(token.ID)) != 3 {
+		t.Fatalf("uses were not saved: %+v", got)
+	}
+}
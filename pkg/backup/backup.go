@@ -0,0 +1,333 @@
+// Package backup writes the files of a data directory into one
+// passphrase-encrypted archive and restores them. The archive holds a
+// manifest with the size and SHA-256 checksum of every file.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FormatVersion is the manifest version written by Create
+const FormatVersion = 1
+
+// manifestName is the first entry of the archive; files follow under dataPrefix
+const (
+	manifestName = "manifest.json"
+	dataPrefix   = "data/"
+)
+
+// lockFile is serve's lock, which is never backed up or restored
+const lockFile = "serve.pid"
+
+// Snapshots are read until two passes in a row agree
+const (
+	snapshotAttempts = 5
+	snapshotPause    = 200 * time.Millisecond
+)
+
+// Errors returned by the backup functions
+var (
+	ErrWrongPassphrase = errors.New("wrong passphrase or damaged archive")
+	ErrChecksum        = errors.New("archive does not match its manifest")
+	ErrNotEmpty        = errors.New("data directory is not empty")
+	ErrInconsistent    = errors.New("data directory kept changing while it was read, try again")
+)
+
+// Manifest describes the contents of an archive
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []File    `json:"files"`
+}
+
+// File is one file of the data directory
+type File struct {
+	Path   string `json:"path"` // Slash separated, relative to the data directory
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Archive is a decrypted and verified backup
+type Archive struct {
+	Manifest *Manifest
+	files    map[string][]byte
+}
+
+// Create writes an encrypted archive of the files in dataDir to w. The
+// directory may be in use by serve: it is read until two passes in a row
+// return the same files, and JSON files must be complete.
+func Create(w io.Writer, dataDir string, passphrase []byte) (*Manifest, error) {
+	files, err := snapshot(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{Version: FormatVersion, CreatedAt: time.Now().UTC(), Files: make([]File, 0, len(files))}
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, File{Path: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+
+	plain, err := pack(manifest, files)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := seal(plain, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(sealed); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// Open decrypts an archive and verifies every file against the manifest
+func Open(r io.Reader, passphrase []byte) (*Archive, error) {
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	plain, err := unseal(sealed, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, files, err := unpack(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.Version != FormatVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", manifest.Version)
+	}
+
+	if len(files) != len(manifest.Files) {
+		return nil, fmt.Errorf("%w: it lists %d files but holds %d", ErrChecksum, len(manifest.Files), len(files))
+	}
+	for _, f := range manifest.Files {
+		data, ok := files[f.Path]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is missing", ErrChecksum, f.Path)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != f.Size || hex.EncodeToString(sum[:]) != f.SHA256 {
+			return nil, fmt.Errorf("%w: %s has changed", ErrChecksum, f.Path)
+		}
+	}
+
+	return &Archive{Manifest: manifest, files: files}, nil
+}
+
+// Restore writes the files of the archive into dataDir. A data directory
+// that already has files is only replaced with force; it is then moved aside
+// and the returned path tells where to.
+func (a *Archive) Restore(dataDir string, force bool) (string, error) {
+	var movedTo string
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read data directory: %w", err)
+	}
+	if len(entries) > 0 {
+		if !force {
+			return "", fmt.Errorf("%w: %s", ErrNotEmpty, dataDir)
+		}
+
+		movedTo = fmt.Sprintf("%s.before-restore-%s", filepath.Clean(dataDir), time.Now().Format("20060102-150405"))
+		if err := os.Rename(dataDir, movedTo); err != nil {
+			return "", fmt.Errorf("failed to move the current data aside: %w", err)
+		}
+	}
+
+	for _, f := range a.Manifest.Files {
+		target := filepath.Join(dataDir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return movedTo, fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(target, a.files[f.Path], 0600); err != nil {
+			return movedTo, fmt.Errorf("failed to restore %s: %w", f.Path, err)
+		}
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return movedTo, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	return movedTo, nil
+}
+
+// snapshot reads every file of dataDir until two passes in a row agree
+func snapshot(dataDir string) (map[string][]byte, error) {
+	previous, err := readAll(dataDir)
+	if err != nil && !errors.Is(err, errPartialWrite) {
+		return nil, err
+	}
+
+	for attempt := 1; attempt < snapshotAttempts; attempt++ {
+		time.Sleep(snapshotPause)
+
+		current, currentErr := readAll(dataDir)
+		if err == nil && currentErr == nil && sameFiles(previous, current) {
+			return current, nil
+		}
+		if currentErr != nil && !errors.Is(currentErr, errPartialWrite) {
+			return nil, currentErr
+		}
+		previous, err = current, currentErr
+	}
+	return nil, ErrInconsistent
+}
+
+// errPartialWrite is returned for JSON files caught in the middle of a write
+var errPartialWrite = errors.New("incomplete JSON file")
+
+// readAll reads the files of dataDir, keyed by their slash separated path
+func readAll(dataDir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dataDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dataDir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == lockFile {
+			return nil
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(name, ".json") && !json.Valid(data) {
+			return fmt.Errorf("%w: %s", errPartialWrite, name)
+		}
+		files[name] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+	return files, nil
+}
+
+func sameFiles(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, data := range a {
+		if other, ok := b[name]; !ok || !bytes.Equal(data, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// pack writes the manifest and the files into a gzipped tar
+func pack(manifest *Manifest, files map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	write := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: manifest.CreatedAt}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := write(manifestName, manifestData); err != nil {
+		return nil, fmt.Errorf("failed to pack manifest: %w", err)
+	}
+	for _, f := range manifest.Files {
+		if err := write(dataPrefix+f.Path, files[f.Path]); err != nil {
+			return nil, fmt.Errorf("failed to pack %s: %w", f.Path, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unpack reads the manifest and the files of a gzipped tar. Paths that could
+// point outside of the data directory are rejected.
+func unpack(plain []byte) (*Manifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(plain))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unpack archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	var manifest *Manifest
+	files := make(map[string][]byte)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unpack archive: %w", err)
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unpack %s: %w", hdr.Name, err)
+		}
+
+		if hdr.Name == manifestName {
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return nil, nil, fmt.Errorf("failed to read manifest: %w", err)
+			}
+			continue
+		}
+
+		name, ok := strings.CutPrefix(hdr.Name, dataPrefix)
+		if !ok || !filepath.IsLocal(filepath.FromSlash(name)) || path.Clean(name) != name || name == lockFile {
+			return nil, nil, fmt.Errorf("archive holds an unexpected entry %q", hdr.Name)
+		}
+		files[name] = data
+	}
+
+	if manifest == nil {
+		return nil, nil, errors.New("archive has no manifest")
+	}
+	return manifest, files, nil
+}
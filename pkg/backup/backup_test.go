@@ -0,0 +1,110 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	dataDir := t.TempDir()
+	writeFiles(t, dataDir, map[string]string{
+		"accounts.json":     `[{"id":"5001"}]`,
+		"contacts.json":     `[]`,
+		"account_5001.json": `{"session":"x"}`,
+		"media/photo.png":   "\x89PNG",
+		"serve.pid":         "1234",
+	})
+
+	var archive bytes.Buffer
+	manifest, err := Create(&archive, dataDir, []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("failed to create backup: %v", err)
+	}
+	if len(manifest.Files) != 4 || manifest.Files[0].Path != "account_5001.json" {
+		t.Fatalf("unexpected manifest: %+v", manifest.Files)
+	}
+	if bytes.Contains(archive.Bytes(), []byte("5001")) {
+		t.Fatal("archive is not encrypted")
+	}
+
+	if _, err := Open(bytes.NewReader(archive.Bytes()), []byte("wrong horse")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("wrong passphrase: got %v", err)
+	}
+	if _, err := Open(strings.NewReader("PK\x03\x04 not a backup at all, just some zip"), []byte("correct horse")); !errors.Is(err, ErrNotArchive) {
+		t.Fatalf("other file: got %v", err)
+	}
+
+	tampered := bytes.Clone(archive.Bytes())
+	tampered[len(tampered)-1] ^= 1
+	if _, err := Open(bytes.NewReader(tampered), []byte("correct horse")); !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("tampered archive: got %v", err)
+	}
+
+	a, err := Open(bytes.NewReader(archive.Bytes()), []byte("correct horse"))
+	if err != nil {
+		t.Fatalf("failed to open backup: %v", err)
+	}
+
+	// Live data is only replaced with force, and kept aside
+	target := t.TempDir()
+	writeFiles(t, target, map[string]string{"accounts.json": `[{"id":"9999"}]`})
+	if _, err := a.Restore(target, false); !errors.Is(err, ErrNotEmpty) {
+		t.Fatalf("restore over live data: got %v", err)
+	}
+
+	movedTo, err := a.Restore(target, true)
+	if err != nil {
+		t.Fatalf("forced restore failed: %v", err)
+	}
+	if old, err := os.ReadFile(filepath.Join(movedTo, "accounts.json")); err != nil || string(old) != `[{"id":"9999"}]` {
+		t.Fatalf("previous data was not kept: %q %v", old, err)
+	}
+
+	for name, want := range map[string]string{"accounts.json": `[{"id":"5001"}]`, "media/photo.png": "\x89PNG"} {
+		got, err := os.ReadFile(filepath.Join(target, filepath.FromSlash(name)))
+		if err != nil || string(got) != want {
+			t.Errorf("%s: got %q %v", name, got, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, "serve.pid")); !os.IsNotExist(err) {
+		t.Error("the serve lock was restored")
+	}
+}
+
+func TestCreateWaitsForCompleteFiles(t *testing.T) {
+	dataDir := t.TempDir()
+	writeFiles(t, dataDir, map[string]string{"jobs.json": `[{"id":`})
+
+	if _, err := Create(&bytes.Buffer{}, dataDir, []byte("pass")); !errors.Is(err, ErrInconsistent) {
+		t.Fatalf("expected a half written file to be refused, got %v", err)
+	}
+}
+
+func TestUnpackRejectsEscapingPaths(t *testing.T) {
+	manifest := &Manifest{Version: FormatVersion, Files: []File{{Path: "../evil.json"}}}
+	plain, err := pack(manifest, map[string][]byte{"../evil.json": []byte("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := unpack(plain); err == nil {
+		t.Fatal("expected an error for a path outside the data directory")
+	}
+}
@@ -0,0 +1,95 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// An encrypted archive starts with a header of magic, the PBKDF2 iteration
+// count, salt and nonce, followed by the AES-256-GCM sealed gzipped tar. The
+// header is authenticated along with the contents.
+const (
+	magic         = "TGSBACKUP1"
+	kdfIterations = 600_000
+	saltSize      = 16
+	keySize       = 32
+	headerSize    = len(magic) + 4 + saltSize + 12
+)
+
+// ErrNotArchive is returned for files that are not tgsender backups
+var ErrNotArchive = errors.New("not a tgsender backup")
+
+// seal encrypts plain with a key derived from passphrase
+func seal(plain, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = binary.BigEndian.AppendUint32(header, kdfIterations)
+
+	salt := make([]byte, saltSize)
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header = append(header, salt...)
+	header = append(header, nonce...)
+
+	aead, err := newAEAD(passphrase, salt, kdfIterations)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, plain, header), nil
+}
+
+// unseal decrypts an archive written by seal
+func unseal(sealed, passphrase []byte) ([]byte, error) {
+	if len(sealed) < headerSize || !bytes.HasPrefix(sealed, []byte(magic)) {
+		return nil, ErrNotArchive
+	}
+
+	header := sealed[:headerSize]
+	iterations := binary.BigEndian.Uint32(header[len(magic):])
+	salt := header[len(magic)+4 : len(magic)+4+saltSize]
+	nonce := header[len(magic)+4+saltSize:]
+
+	if iterations == 0 || iterations > 10*kdfIterations {
+		return nil, fmt.Errorf("%w: unexpected key derivation cost", ErrNotArchive)
+	}
+
+	aead, err := newAEAD(passphrase, salt, int(iterations))
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := aead.Open(nil, nonce, sealed[headerSize:], header)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return plain, nil
+}
+
+func newAEAD(passphrase, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, iterations, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// ReadPassphrase returns the passphrase in file, or asks for it on the
+// terminal if file is empty. A file of "-" is read from in. With confirm the
+// terminal asks twice, for new archives.
+func ReadPassphrase(file string, in io.Reader, confirm bool) ([]byte, error) {
+	var passphrase []byte
+	switch file {
+	case "":
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return nil, errors.New("no terminal to ask for the passphrase, use --passphrase-file")
+		}
+
+		var err error
+		if passphrase, err = prompt(fd, "Passphrase: "); err != nil {
+			return nil, err
+		}
+		if confirm {
+			again, err := prompt(fd, "Repeat passphrase: ")
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(passphrase, again) {
+				return nil, errors.New("passphrases do not match")
+			}
+		}
+	case "-":
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		passphrase = data
+	default:
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		passphrase = data
+	}
+
+	// Files usually end with a newline that is not part of the passphrase
+	passphrase = bytes.TrimRight(passphrase, "\r\n")
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	return passphrase, nil
+}
+
+func prompt(fd int, label string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, label)
+	defer fmt.Fprintln(os.Stderr)
+
+	passphrase, err := term.ReadPassword(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return passphrase, nil
+}
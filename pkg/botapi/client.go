@@ -0,0 +1,254 @@
+// Package botapi delivers messages through the Telegram Bot API to users who
+// started the bot.
+package botapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultAPIURL = "https://api.telegram.org"
+
+// Client is a Telegram Bot API client
+type Client struct {
+	token      string
+	apiURL     string
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	username string // cached from getMe
+}
+
+// NewClient creates a new Bot API client
+func NewClient(token string) *Client {
+	return &Client{
+		token:  token,
+		apiURL: defaultAPIURL,
+		httpClient: &http.Client{
+			Timeout: 60 * time.Second, // Longer than the long-poll timeout
+		},
+	}
+}
+
+// WithAPIURL sets a custom Bot API server, e.g. a local fake in tests
+func (c *Client) WithAPIURL(apiURL string) *Client {
+	c.apiURL = strings.TrimRight(apiURL, "/")
+	return c
+}
+
+// User is a Telegram user or bot
+type User struct {
+	ID        int64  `json:"id"`
+	IsBot     bool   `json:"is_bot"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+// Chat is a Telegram chat
+type Chat struct {
+	ID        int64  `json:"id"`
+	Type      string `json:"type"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Username  string `json:"username,omitempty"`
+}
+
+// Message is a Telegram message
+type Message struct {
+	MessageID int    `json:"message_id"`
+	From      *User  `json:"from,omitempty"`
+	Chat      Chat   `json:"chat"`
+	Date      int64  `json:"date"`
+	Text      string `json:"text,omitempty"`
+}
+
+// ChatMember describes a user's membership in a chat
+type ChatMember struct {
+	Status string `json:"status"` // "member", "kicked", ...
+}
+
+// ChatMemberUpdated is sent when a user blocks or unblocks the bot
+type ChatMemberUpdated struct {
+	Chat          Chat       `json:"chat"`
+	From          User       `json:"from"`
+	Date          int64      `json:"date"`
+	NewChatMember ChatMember `json:"new_chat_member"`
+}
+
+// Update is an incoming update
+type Update struct {
+	UpdateID     int64              `json:"update_id"`
+	Message      *Message           `json:"message,omitempty"`
+	MyChatMember *ChatMemberUpdated `json:"my_chat_member,omitempty"`
+}
+
+// Error is an error returned by the Bot API
+type Error struct {
+	Code        int
+	Description string
+	RetryAfter  int // Seconds to wait before retrying, set for 429 errors
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("bot api error %d: %s", e.Code, e.Description)
+}
+
+// response is the envelope of every Bot API response
+type response struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  *struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters,omitempty"`
+}
+
+// GetMe returns the bot's own user
+func (c *Client) GetMe(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.call(ctx, "getMe", struct{}{}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Username returns the bot's username, asking the API only once
+func (c *Client) Username(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.username != "" {
+		return c.username, nil
+	}
+
+	me, err := c.GetMe(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	c.username = me.Username
+	return c.username, nil
+}
+
+// SendMessage sends a text message to a chat
+func (c *Client) SendMessage(ctx context.Context, chatID int64, text string) (*Message, error) {
+	params := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+
+	var msg Message
+	if err := c.call(ctx, "sendMessage", params, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// SendHTMLMessage sends a message formatted with Telegram's HTML subset
+func (c *Client) SendHTMLMessage(ctx context.Context, chatID int64, html string) (*Message, error) {
+	params := map[string]interface{}{
+		"chat_id":    chatID,
+		"text":       html,
+		"parse_mode": "HTML",
+	}
+
+	var msg Message
+	if err := c.call(ctx, "sendMessage", params, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// GetUpdates long-polls for updates after offset
+func (c *Client) GetUpdates(ctx context.Context, offset int64, timeout time.Duration) ([]Update, error) {
+	params := map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(timeout.Seconds()),
+		"allowed_updates": []string{"message", "my_chat_member"},
+	}
+
+	var updates []Update
+	if err := c.call(ctx, "getUpdates", params, &updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// SetWebhook makes Telegram push updates to url, signed with secret
+func (c *Client) SetWebhook(ctx context.Context, url, secret string) error {
+	params := map[string]interface{}{
+		"url":             url,
+		"secret_token":    secret,
+		"allowed_updates": []string{"message", "my_chat_member"},
+	}
+	return c.call(ctx, "setWebhook", params, nil)
+}
+
+// DeleteWebhook switches the bot back to getUpdates
+func (c *Client) DeleteWebhook(ctx context.Context) error {
+	return c.call(ctx, "deleteWebhook", struct{}{}, nil)
+}
+
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	jsonData, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/bot%s/%s", c.apiURL, c.token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		// The URL contains the token; don't let it leak into logs
+		return fmt.Errorf("failed to call %s: %w", method, redactToken(err, c.token))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var apiResp response
+	if err := json.Unmarshal(body, &apiResp); err != nil {
+		return fmt.Errorf("failed to parse %s response (status %d): %w", method, resp.StatusCode, err)
+	}
+
+	if !apiResp.OK {
+		apiErr := &Error{Code: apiResp.ErrorCode, Description: apiResp.Description}
+		if apiResp.Parameters != nil {
+			apiErr.RetryAfter = apiResp.Parameters.RetryAfter
+		}
+		return apiErr
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(apiResp.Result, result); err != nil {
+		return fmt.Errorf("failed to parse %s result: %w", method, err)
+	}
+	return nil
+}
+
+func redactToken(err error, token string) error {
+	if token == "" {
+		return err
+	}
+	return fmt.Errorf("%s", strings.ReplaceAll(err.Error(), token, "<token>"))
+}
@@ -0,0 +1,102 @@
+package botapi
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/soluchok/tgsender/pkg/accounts"
+	"github.com/soluchok/tgsender/pkg/auth"
+	"github.com/soluchok/tgsender/pkg/workspaces"
+)
+
+// Handler provides HTTP handlers for bot subscribers
+type Handler struct {
+	client       *Client
+	subscribers  *SubscriberStore
+	accountStore *accounts.Store
+	auth         *auth.Handler
+	workspaces   *workspaces.Store
+}
+
+// NewHandler creates a new bot subscriber handler
+func NewHandler(client *Client, subscribers *SubscriberStore, accountStore *accounts.Store, authHandler *auth.Handler) *Handler {
+	return &Handler{
+		client:       client,
+		subscribers:  subscribers,
+		accountStore: accountStore,
+		auth:         authHandler,
+	}
+}
+
+// WithWorkspaces lets members of an account's team workspace use its bot subscribers
+func (h *Handler) WithWorkspaces(store *workspaces.Store) *Handler {
+	h.workspaces = store
+	return h
+}
+
+// HandleListSubscribers handles GET /api/accounts/{id}/bot/subscribers
+func (h *Handler) HandleListSubscribers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	accountID := r.PathValue("id")
+	account, ok := h.accountStore.Get(accountID)
+	if !ok {
+		writeJSONError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleViewer) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	subscribers := h.subscribers.GetByAccount(account.ID, false)
+	active := 0
+	for _, sub := range subscribers {
+		if sub.Subscribed {
+			active++
+		}
+	}
+
+	resp := map[string]interface{}{
+		"subscribers": subscribers,
+		"total":       len(subscribers),
+		"active":      active,
+	}
+
+	// The start link is what recipients open to subscribe to this account
+	username, err := h.client.Username(r.Context())
+	if err != nil {
+		slog.Warn("failed to look up bot username", "error", err)
+	} else if username != "" {
+		resp["start_link"] = "https://t.me/" + username + "?start=" + url.QueryEscape(account.ID)
+	}
+
+	writeJSON(w, resp, http.StatusOK)
+}
+
+func (h *Handler) getOwnerID(r *http.Request) (int64, bool) {
+	return h.auth.OwnerID(r)
+}
+
+// Helper functions for JSON responses
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeJSONError(w http.ResponseWriter, message string, status int) {
+	writeJSON(w, map[string]string{"error": message}, status)
+}
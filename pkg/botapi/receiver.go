@@ -0,0 +1,225 @@
+package botapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/accounts"
+	"github.com/soluchok/tgsender/pkg/webhooks"
+)
+
+const (
+	pollTimeout       = 30 * time.Second
+	minRetryDelay     = 5 * time.Second
+	maxRetryDelay     = 5 * time.Minute
+	secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+)
+
+const (
+	subscribedReply   = "You are subscribed. Send /stop to unsubscribe."
+	unsubscribedReply = "You are unsubscribed and will not receive further messages. Send /start to subscribe again."
+	startLinkReply    = "Please use the subscription link you were given to subscribe."
+)
+
+// Receiver turns bot updates into subscriptions: /start subscribes the user
+// to the account named in the start link, /stop or blocking the bot
+// unsubscribes them
+type Receiver struct {
+	client       *Client
+	subscribers  *SubscriberStore
+	accountStore *accounts.Store
+	webhooks     *webhooks.Dispatcher
+}
+
+// NewReceiver creates a new update receiver
+func NewReceiver(client *Client, subscribers *SubscriberStore, accountStore *accounts.Store) *Receiver {
+	return &Receiver{
+		client:       client,
+		subscribers:  subscribers,
+		accountStore: accountStore,
+	}
+}
+
+// WithWebhooks reports unsubscribes to webhooks
+func (r *Receiver) WithWebhooks(dispatcher *webhooks.Dispatcher) *Receiver {
+	r.webhooks = dispatcher
+	return r
+}
+
+// Poll receives updates with getUpdates until ctx is done
+func (r *Receiver) Poll(ctx context.Context) {
+	// getUpdates does not work while a webhook is set
+	if err := r.client.DeleteWebhook(ctx); err != nil {
+		slog.Warn("failed to delete bot webhook", "error", err)
+	}
+
+	var offset int64
+	delay := minRetryDelay
+
+	for {
+		updates, err := r.client.GetUpdates(ctx, offset, pollTimeout)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.Warn("failed to get bot updates",
+				slog.Any("error", err),
+				slog.Duration("retry_in", delay),
+			)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+
+			delay = min(delay*2, maxRetryDelay)
+			continue
+		}
+		delay = minRetryDelay
+
+		for _, update := range updates {
+			r.HandleUpdate(ctx, update)
+			offset = update.UpdateID + 1
+		}
+	}
+}
+
+// RegisterWebhook points the bot's webhook at url
+func (r *Receiver) RegisterWebhook(ctx context.Context, url, secret string) error {
+	return r.client.SetWebhook(ctx, url, secret)
+}
+
+// WebhookHandler returns the handler for updates pushed by Telegram. Requests
+// without the secret the webhook was registered with are rejected.
+func (r *Receiver) WebhookHandler(secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		got := req.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(secret)) != 1 {
+			writeJSONError(w, "Invalid secret token", http.StatusUnauthorized)
+			return
+		}
+
+		var update Update
+		if err := json.NewDecoder(req.Body).Decode(&update); err != nil {
+			writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		r.HandleUpdate(req.Context(), update)
+		writeJSON(w, map[string]string{"message": "OK"}, http.StatusOK)
+	}
+}
+
+// HandleUpdate applies a single update
+func (r *Receiver) HandleUpdate(ctx context.Context, update Update) {
+	switch {
+	case update.Message != nil:
+		r.handleMessage(ctx, update.Message)
+	case update.MyChatMember != nil:
+		// Users who block the bot can no longer be messaged
+		if update.MyChatMember.NewChatMember.Status == "kicked" {
+			r.unsubscribe(update.MyChatMember.Chat.ID, webhooks.OptOutBlocked)
+		}
+	}
+}
+
+func (r *Receiver) handleMessage(ctx context.Context, msg *Message) {
+	if msg.Chat.Type != "private" || msg.From == nil {
+		return
+	}
+
+	command, payload := parseCommand(msg.Text)
+	switch command {
+	case "/start":
+		r.handleStart(ctx, msg, payload)
+	case "/stop":
+		if r.unsubscribe(msg.Chat.ID, webhooks.OptOutStop) {
+			r.reply(ctx, msg.Chat.ID, unsubscribedReply)
+		}
+	}
+}
+
+func (r *Receiver) handleStart(ctx context.Context, msg *Message, payload string) {
+	// Without a payload, a returning subscriber re-subscribes to the same account
+	accountID := payload
+	if accountID == "" {
+		if sub, ok := r.subscribers.Get(msg.Chat.ID); ok {
+			accountID = sub.AccountID
+		}
+	}
+
+	account, ok := r.accountStore.Get(accountID)
+	if accountID == "" || !ok {
+		r.reply(ctx, msg.Chat.ID, startLinkReply)
+		return
+	}
+
+	if _, err := r.subscribers.Subscribe(msg.Chat.ID, account.ID, *msg.From); err != nil {
+		slog.Error("failed to store bot subscriber",
+			slog.Int64("chat_id", msg.Chat.ID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	slog.Info("bot subscriber added",
+		slog.Int64("chat_id", msg.Chat.ID),
+		slog.String("account_id", account.ID),
+	)
+	r.reply(ctx, msg.Chat.ID, subscribedReply)
+}
+
+func (r *Receiver) unsubscribe(chatID int64, reason string) bool {
+	removed, err := r.subscribers.Unsubscribe(chatID)
+	if err != nil {
+		slog.Error("failed to unsubscribe bot subscriber",
+			slog.Int64("chat_id", chatID),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+
+	if removed {
+		slog.Info("bot subscriber removed", slog.Int64("chat_id", chatID))
+		if sub, ok := r.subscribers.Get(chatID); ok {
+			r.webhooks.Emit(sub.AccountID, webhooks.EventRecipientOptedOut, webhooks.OptOutData{
+				AccountID:    sub.AccountID,
+				Channel:      "bot",
+				SubscriberID: chatID,
+				Reason:       reason,
+			})
+		}
+	}
+	return removed
+}
+
+func (r *Receiver) reply(ctx context.Context, chatID int64, text string) {
+	if _, err := r.client.SendMessage(ctx, chatID, text); err != nil {
+		slog.Warn("failed to answer bot command",
+			slog.Int64("chat_id", chatID),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// parseCommand splits "/start@my_bot payload" into "/start" and "payload"
+func parseCommand(text string) (string, string) {
+	if !strings.HasPrefix(text, "/") {
+		return "", ""
+	}
+
+	command, payload, _ := strings.Cut(strings.TrimSpace(text), " ")
+	command, _, _ = strings.Cut(command, "@")
+	return strings.ToLower(command), strings.TrimSpace(payload)
+}
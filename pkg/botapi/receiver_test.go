@@ -0,0 +1,109 @@
+package botapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soluchok/tgsender/pkg/accounts"
+)
+
+const testAccountID = "5001"
+
+// newTestReceiver builds a receiver against a fake Bot API that answers every
+// method with response.
+func newTestReceiver(t *testing.T, response map[string]any) (*Receiver, *SubscriberStore) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	dataDir := t.TempDir()
+	data, _ := json.Marshal([]*accounts.Account{{ID: testAccountID, OwnerID: 1, IsActive: true}})
+	if err := os.WriteFile(filepath.Join(dataDir, "accounts.json"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	accountStore, err := accounts.NewStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscribers, err := NewSubscriberStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient("token").WithAPIURL(server.URL)
+	return NewReceiver(client, subscribers, accountStore), subscribers
+}
+
+func command(chatID int64, text string) Update {
+	return Update{Message: &Message{
+		From: &User{ID: chatID, FirstName: "Erin"},
+		Chat: Chat{ID: chatID, Type: "private"},
+		Text: text,
+	}}
+}
+
+func TestReceiverSubscriptions(t *testing.T) {
+	receiver, subscribers := newTestReceiver(t, map[string]any{"ok": true, "result": Message{}})
+	ctx := context.Background()
+
+	// A start link for an unknown account does not subscribe
+	receiver.HandleUpdate(ctx, command(1, "/start 9999"))
+	if _, ok := subscribers.Get(1); ok {
+		t.Fatal("subscribed to an unknown account")
+	}
+
+	receiver.HandleUpdate(ctx, command(1, "/start@test_bot "+testAccountID))
+	sub, ok := subscribers.Get(1)
+	if !ok || !sub.Subscribed || sub.AccountID != testAccountID || sub.FirstName != "Erin" {
+		t.Fatalf("unexpected subscriber after /start: %+v", sub)
+	}
+
+	receiver.HandleUpdate(ctx, command(1, "/stop"))
+	if sub, _ := subscribers.Get(1); sub.Subscribed || sub.UnsubscribedAt == nil {
+		t.Fatalf("still subscribed after /stop: %+v", sub)
+	}
+
+	// A bare /start brings a returning subscriber back to the same account
+	receiver.HandleUpdate(ctx, command(1, "/start"))
+	if sub, _ := subscribers.Get(1); !sub.Subscribed || sub.AccountID != testAccountID {
+		t.Fatalf("not resubscribed after /start: %+v", sub)
+	}
+
+	receiver.HandleUpdate(ctx, Update{MyChatMember: &ChatMemberUpdated{
+		Chat:          Chat{ID: 1, Type: "private"},
+		NewChatMember: ChatMember{Status: "kicked"},
+	}})
+	if sub, _ := subscribers.Get(1); sub.Subscribed {
+		t.Fatalf("still subscribed after blocking the bot: %+v", sub)
+	}
+
+	if got := subscribers.GetByAccount(testAccountID, true); len(got) != 0 {
+		t.Fatalf("got %d active subscribers, want 0", len(got))
+	}
+}
+
+func TestClientError(t *testing.T) {
+	receiver, _ := newTestReceiver(t, map[string]any{
+		"ok":          false,
+		"error_code":  429,
+		"description": "Too Many Requests: retry after 7",
+		"parameters":  map[string]any{"retry_after": 7},
+	})
+
+	_, err := receiver.client.SendMessage(context.Background(), 1, "hi")
+
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests || apiErr.RetryAfter != 7 {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+}
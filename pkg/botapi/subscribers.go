@@ -0,0 +1,163 @@
+package botapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Subscriber is a Telegram user who started the delivery bot
+type Subscriber struct {
+	ChatID         int64      `json:"chat_id"`
+	AccountID      string     `json:"account_id"` // Account whose link was used to start the bot
+	FirstName      string     `json:"first_name,omitempty"`
+	LastName       string     `json:"last_name,omitempty"`
+	Username       string     `json:"username,omitempty"`
+	Subscribed     bool       `json:"subscribed"`
+	SubscribedAt   time.Time  `json:"subscribed_at"`
+	UnsubscribedAt *time.Time `json:"unsubscribed_at,omitempty"`
+}
+
+// SubscriberStore manages bot subscriber storage
+type SubscriberStore struct {
+	mu          sync.RWMutex
+	dataDir     string
+	subscribers map[int64]*Subscriber // keyed by chat ID
+}
+
+// NewSubscriberStore creates a new subscriber store
+func NewSubscriberStore(dataDir string) (*SubscriberStore, error) {
+	store := &SubscriberStore{
+		dataDir:     dataDir,
+		subscribers: make(map[int64]*Subscriber),
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("failed to load bot subscribers: %w", err)
+	}
+
+	return store, nil
+}
+
+// Subscribe records that a user started the bot from an account's link.
+// Starting the bot again moves the subscriber to the new account.
+func (s *SubscriberStore) Subscribe(chatID int64, accountID string, user User) (*Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscribers[chatID]
+	if !ok {
+		sub = &Subscriber{ChatID: chatID}
+		s.subscribers[chatID] = sub
+	}
+
+	if !sub.Subscribed || sub.AccountID != accountID {
+		sub.SubscribedAt = time.Now()
+	}
+	sub.AccountID = accountID
+	sub.FirstName = user.FirstName
+	sub.LastName = user.LastName
+	sub.Username = user.Username
+	sub.Subscribed = true
+	sub.UnsubscribedAt = nil
+
+	subCopy := *sub
+	return &subCopy, s.save()
+}
+
+// Unsubscribe marks a subscriber as no longer wanting messages. It reports
+// whether the subscriber was subscribed.
+func (s *SubscriberStore) Unsubscribe(chatID int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscribers[chatID]
+	if !ok || !sub.Subscribed {
+		return false, nil
+	}
+
+	now := time.Now()
+	sub.Subscribed = false
+	sub.UnsubscribedAt = &now
+
+	return true, s.save()
+}
+
+// Get returns a copy of a subscriber by chat ID
+func (s *SubscriberStore) Get(chatID int64) (*Subscriber, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sub, ok := s.subscribers[chatID]
+	if !ok {
+		return nil, false
+	}
+	subCopy := *sub
+	return &subCopy, true
+}
+
+// GetByAccount returns the subscribers of an account, newest first
+func (s *SubscriberStore) GetByAccount(accountID string, activeOnly bool) []*Subscriber {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]*Subscriber, 0)
+	for _, sub := range s.subscribers {
+		if sub.AccountID != accountID || (activeOnly && !sub.Subscribed) {
+			continue
+		}
+		subCopy := *sub
+		result = append(result, &subCopy)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SubscribedAt.After(result[j].SubscribedAt)
+	})
+
+	return result
+}
+
+func (s *SubscriberStore) load() error {
+	filePath := filepath.Join(s.dataDir, "bot_subscribers.json")
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var subscribers []*Subscriber
+	if err := json.Unmarshal(data, &subscribers); err != nil {
+		return err
+	}
+
+	for _, sub := range subscribers {
+		s.subscribers[sub.ChatID] = sub
+	}
+
+	return nil
+}
+
+func (s *SubscriberStore) save() error {
+	subscribers := make([]*Subscriber, 0, len(s.subscribers))
+	for _, sub := range s.subscribers {
+		subscribers = append(subscribers, sub)
+	}
+
+	data, err := json.MarshalIndent(subscribers, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(s.dataDir, "bot_subscribers.json")
+	return os.WriteFile(filePath, data, 0600)
+}
@@ -0,0 +1,5 @@
+// Package client is a typed Go client for the tgsender HTTP API, generated
+// from pkg/openapi/openapi.yaml.
+package client
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.4.1 -config oapi-codegen.yaml ../openapi/openapi.yaml
@@ -0,0 +1,31 @@
+package accounts
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/soluchok/tgsender/pkg/datadir"
+)
+
+const (
+	flagDataDirName  = "data-dir"
+	flagDataDirValue = datadir.Default
+	flagDataDirUsage = "Directory of the serve data stores"
+
+	flagJSONName  = "json"
+	flagJSONUsage = "Print JSON instead of a table"
+)
+
+func New() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "accounts",
+		Short: "Work with the accounts linked in serve.",
+	}
+
+	cmd.PersistentFlags().String(flagDataDirName, flagDataDirValue, flagDataDirUsage)
+
+	cmd.AddCommand(newList())
+	cmd.AddCommand(newValidate())
+	cmd.AddCommand(newRemove())
+
+	return cmd
+}
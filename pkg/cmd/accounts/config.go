@@ -0,0 +1,66 @@
+package accounts
+
+import (
+	"errors"
+)
+
+type listConfig struct {
+	DataDir string `mapstructure:"data-dir"`
+	Owner   int64  `mapstructure:"owner"`
+	JSON    bool   `mapstructure:"json"`
+}
+
+func (c *listConfig) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	return nil
+}
+
+type validateConfig struct {
+	AppID   int    `mapstructure:"app-id"`
+	AppHash string `mapstructure:"app-hash"`
+	DataDir string `mapstructure:"data-dir"`
+	JSON    bool   `mapstructure:"json"`
+}
+
+func (c *validateConfig) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if c.AppID == 0 {
+		return errors.New("Telegram's app_id for authentication is missing.")
+	}
+
+	if len(c.AppHash) == 0 {
+		return errors.New("Telegram's app_hash for authentication is missing.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	return nil
+}
+
+type removeConfig struct {
+	DataDir string `mapstructure:"data-dir"`
+}
+
+func (c *removeConfig) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	return nil
+}
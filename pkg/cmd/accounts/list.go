@@ -0,0 +1,90 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	accountstore "github.com/soluchok/tgsender/pkg/accounts"
+)
+
+const (
+	flagOwnerName  = "owner"
+	flagOwnerUsage = "Only list accounts of this workspace ID (the Telegram user ID for personal workspaces)"
+)
+
+func newList() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "list",
+		Short: "List linked accounts.",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagOwnerName, cmd.Flags().Lookup(flagOwnerName))
+			viper.BindPFlag(flagJSONName, cmd.Flags().Lookup(flagJSONName))
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var cfg *listConfig
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			store, err := openStore(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+
+			list := store.List()
+			if cfg.Owner != 0 {
+				list = store.GetByOwner(cfg.Owner)
+			}
+
+			// The OpenAI token is a secret of the account owner
+			redacted := make([]accountstore.Account, 0, len(list))
+			for _, acc := range list {
+				acc := *acc
+				acc.OpenAIToken = ""
+				redacted = append(redacted, acc)
+			}
+
+			if cfg.JSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(redacted)
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tOWNER\tPHONE\tNAME\tUSERNAME\tACTIVE\tCREATED")
+			for _, acc := range redacted {
+				fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%t\t%s\n", acc.ID, acc.OwnerID, acc.Phone,
+					accountName(&acc), acc.Username, acc.IsActive, acc.CreatedAt.Format(time.DateTime))
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().Int64(flagOwnerName, 0, flagOwnerUsage)
+	cmd.Flags().Bool(flagJSONName, false, flagJSONUsage)
+
+	return cmd
+}
+
+// openStore opens the account store of an existing data directory
+func openStore(dataDir string) (*accountstore.Store, error) {
+	if _, err := os.Stat(dataDir); err != nil {
+		return nil, fmt.Errorf("failed to open data directory: %w", err)
+	}
+	return accountstore.NewStore(dataDir)
+}
+
+func accountName(acc *accountstore.Account) string {
+	if acc.LastName == "" {
+		return acc.FirstName
+	}
+	return acc.FirstName + " " + acc.LastName
+}
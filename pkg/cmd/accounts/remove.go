@@ -0,0 +1,52 @@
+package accounts
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/soluchok/tgsender/pkg/datadir"
+)
+
+func newRemove() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "remove <account-id>...",
+		Short: "Remove linked accounts.",
+		Long:  "Removes accounts the way DELETE /api/accounts/{id} does. Refuses to run while serve uses the data directory.",
+		Args:  cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var cfg *removeConfig
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			if err := datadir.New(cfg.DataDir).RequireServeStopped(); err != nil {
+				return err
+			}
+
+			store, err := openStore(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+
+			for _, id := range args {
+				acc, ok := store.Get(id)
+				if !ok {
+					return fmt.Errorf("account %s not found", id)
+				}
+				if err := store.Delete(id, acc.OwnerID); err != nil {
+					return fmt.Errorf("failed to remove account %s: %w", id, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Removed account %s (%s)\n", id, acc.Phone)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,110 @@
+package accounts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	accountstore "github.com/soluchok/tgsender/pkg/accounts"
+	"github.com/soluchok/tgsender/pkg/datadir"
+)
+
+const (
+	flagAppIDName  = "app-id"
+	flagAppIDUsage = "Telegram's app_id"
+
+	flagAppHashName  = "app-hash"
+	flagAppHashUsage = "Telegram's app_hash"
+)
+
+func newValidate() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "validate [account-id...]",
+		Short: "Check that account sessions are still logged in and update their status.",
+		Long:  "Connects to Telegram with the session of each account (all accounts if none are given) and marks accounts whose session was revoked as inactive. Refuses to run while serve uses the data directory; use GET /api/accounts/{id}/validate then.",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagAppIDName, cmd.Flags().Lookup(flagAppIDName))
+			viper.BindPFlag(flagAppHashName, cmd.Flags().Lookup(flagAppHashName))
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagJSONName, cmd.Flags().Lookup(flagJSONName))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var cfg *validateConfig
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			if err := datadir.New(cfg.DataDir).RequireServeStopped(); err != nil {
+				return err
+			}
+
+			store, err := openStore(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+
+			ids := args
+			if len(ids) == 0 {
+				for _, acc := range store.List() {
+					ids = append(ids, acc.ID)
+				}
+			}
+
+			type result struct {
+				ID       string `json:"id"`
+				Phone    string `json:"phone"`
+				IsActive bool   `json:"is_active"`
+				Error    string `json:"error,omitempty"`
+			}
+
+			validator := accountstore.NewValidator(store, cfg.AppID, cfg.AppHash)
+			results := make([]result, 0, len(ids))
+			var failed error
+			for _, id := range ids {
+				acc, ok := store.Get(id)
+				if !ok {
+					return fmt.Errorf("account %s not found", id)
+				}
+
+				res := result{ID: id, Phone: acc.Phone}
+				validation, err := validator.ValidateAndUpdateStatus(cmd.Context(), id)
+				if err != nil {
+					res.Error = err.Error()
+					failed = errors.New("some accounts could not be validated")
+				} else {
+					res.IsActive = validation.IsValid
+				}
+				results = append(results, res)
+			}
+
+			if cfg.JSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(results); err != nil {
+					return err
+				}
+				return failed
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tPHONE\tACTIVE\tERROR")
+			for _, res := range results {
+				fmt.Fprintf(tw, "%s\t%s\t%t\t%s\n", res.ID, res.Phone, res.IsActive, res.Error)
+			}
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+			return failed
+		},
+	}
+
+	cmd.Flags().Int(flagAppIDName, 0, flagAppIDUsage)
+	cmd.Flags().String(flagAppHashName, "", flagAppHashUsage)
+	cmd.Flags().Bool(flagJSONName, false, flagJSONUsage)
+
+	return cmd
+}
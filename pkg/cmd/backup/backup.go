@@ -0,0 +1,105 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/soluchok/tgsender/pkg/backup"
+	"github.com/soluchok/tgsender/pkg/datadir"
+)
+
+const (
+	flagDataDirName  = "data-dir"
+	flagDataDirValue = datadir.Default
+	flagDataDirUsage = "Directory of the serve data stores and Telegram sessions"
+
+	flagOutputName      = "output"
+	flagOutputShorthand = "o"
+	flagOutputValue     = ""
+	flagOutputUsage     = "Archive to write (default tgsender-<time>.backup)"
+
+	flagPassphraseFileName  = "passphrase-file"
+	flagPassphraseFileValue = ""
+	flagPassphraseFileUsage = "File holding the passphrase, - for stdin (asked on the terminal if unset)"
+)
+
+func New() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "backup",
+		Short: "Write the data directory into an encrypted archive.",
+		Long:  "Takes a consistent snapshot of every store, Telegram session and media file in the data directory and writes it into one archive encrypted with a passphrase. The archive has a manifest with the checksum of every file. serve may keep running; files it writes during the backup are read again.",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagOutputName, cmd.Flags().Lookup(flagOutputName))
+			viper.BindPFlag(flagPassphraseFileName, cmd.Flags().Lookup(flagPassphraseFileName))
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var cfg *config
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			output := cfg.Output
+			if output == "" {
+				output = fmt.Sprintf("tgsender-%s.backup", time.Now().Format("20060102-150405"))
+			}
+
+			// An archive inside the data directory would end up in the next backup
+			if rel, err := filepath.Rel(cfg.DataDir, output); err == nil && filepath.IsLocal(rel) {
+				return errors.New("the archive must not be written into the data directory")
+			}
+
+			if _, err := os.Stat(output); err == nil {
+				return fmt.Errorf("%s already exists", output)
+			}
+
+			if _, err := os.Stat(cfg.DataDir); err != nil {
+				return fmt.Errorf("failed to read data directory: %w", err)
+			}
+
+			passphrase, err := backup.ReadPassphrase(cfg.PassphraseFile, cmd.InOrStdin(), true)
+			if err != nil {
+				return err
+			}
+
+			// Written next to the output first, so a failed backup leaves no archive behind
+			out, err := os.OpenFile(output+".partial", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to create archive: %w", err)
+			}
+			defer os.Remove(out.Name())
+
+			manifest, err := backup.Create(out, cfg.DataDir, passphrase)
+			if err != nil {
+				out.Close()
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return fmt.Errorf("failed to write archive: %w", err)
+			}
+
+			if err := os.Rename(out.Name(), output); err != nil {
+				return fmt.Errorf("failed to write archive: %w", err)
+			}
+
+			var size int64
+			for _, f := range manifest.Files {
+				size += f.Size
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Backed up %d files (%d bytes) from %s to %s\n", len(manifest.Files), size, cfg.DataDir, output)
+			return nil
+		},
+	}
+
+	cmd.Flags().String(flagDataDirName, flagDataDirValue, flagDataDirUsage)
+	cmd.Flags().StringP(flagOutputName, flagOutputShorthand, flagOutputValue, flagOutputUsage)
+	cmd.Flags().String(flagPassphraseFileName, flagPassphraseFileValue, flagPassphraseFileUsage)
+
+	return cmd
+}
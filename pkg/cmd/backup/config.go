@@ -0,0 +1,21 @@
+package backup
+
+import "errors"
+
+type config struct {
+	DataDir        string `mapstructure:"data-dir"`
+	Output         string `mapstructure:"output"`
+	PassphraseFile string `mapstructure:"passphrase-file"`
+}
+
+func (c *config) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	return nil
+}
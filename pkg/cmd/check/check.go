@@ -19,6 +19,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/soluchok/tgsender/pkg/datadir"
 	"github.com/soluchok/tgsender/pkg/model"
 	"github.com/soluchok/tgsender/pkg/session"
 	"github.com/soluchok/tgsender/pkg/slices"
@@ -35,6 +36,9 @@ const (
 	flagAuthShorthand = "a"
 	flagAuthUsage     = "Telegram's phone number for authentication (required)"
 
+	flagDataDirName  = "data-dir"
+	flagDataDirUsage = "Directory for Telegram sessions, shared with serve"
+
 	flagPhonesName      = "phones"
 	flagPhonesShorthand = "p"
 	flagPhonesUsage     = "list of comma-separated phones that need to be verified (required)"
@@ -60,6 +64,7 @@ func New() *cobra.Command {
 		PreRun: func(cmd *cobra.Command, args []string) {
 			viper.BindPFlag(flagPhonesName, cmd.PersistentFlags().Lookup(flagPhonesName))
 			viper.BindPFlag(flagAuthName, cmd.PersistentFlags().Lookup(flagAuthName))
+			viper.BindPFlag(flagDataDirName, cmd.PersistentFlags().Lookup(flagDataDirName))
 			viper.BindPFlag(flagAppIDName, cmd.PersistentFlags().Lookup(flagAppIDName))
 			viper.BindPFlag(flagAppHashName, cmd.PersistentFlags().Lookup(flagAppHashName))
 			viper.BindPFlag(flagOutputName, cmd.PersistentFlags().Lookup(flagOutputName))
@@ -116,7 +121,7 @@ func New() *cobra.Command {
 
 			var scanner = bufio.NewScanner(io.MultiReader(readers...))
 
-			store, err := session.Get(cfg.Authentication)
+			store, err := session.Get(cfg.DataDir, cfg.Authentication)
 			if err != nil {
 				return fmt.Errorf("failed to get session: %w", err)
 			}
@@ -171,6 +176,7 @@ func New() *cobra.Command {
 
 	cmd.PersistentFlags().StringSliceP(flagPhonesName, flagPhonesShorthand, nil, flagPhonesUsage)
 	cmd.PersistentFlags().StringP(flagAuthName, flagAuthShorthand, "", flagAuthUsage)
+	cmd.PersistentFlags().String(flagDataDirName, datadir.Default, flagDataDirUsage)
 	cmd.PersistentFlags().Int(flagAppIDName, 0, flagAppIDUsage)
 	cmd.PersistentFlags().String(flagAppHashName, "", flagAppHashUsage)
 	cmd.PersistentFlags().StringP(flagOutputName, flagOutputShorthand, flagOutputValue, flagOutputUsage)
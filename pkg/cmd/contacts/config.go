@@ -0,0 +1,115 @@
+package contacts
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	contactstore "github.com/soluchok/tgsender/pkg/contacts"
+)
+
+type exportConfig struct {
+	DataDir    string   `mapstructure:"data-dir"`
+	Accounts   []string `mapstructure:"account"`
+	Labels     []string `mapstructure:"label"`
+	LabelMode  string   `mapstructure:"label-mode"`
+	Format     string   `mapstructure:"format"`
+	Fields     []string `mapstructure:"fields"`
+	ExcludePII bool     `mapstructure:"exclude-pii"`
+	Output     string   `mapstructure:"output"`
+}
+
+func (c *exportConfig) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	if _, err := contactstore.ParseExportFormat(c.Format); err != nil {
+		return fmt.Errorf("Export format is invalid: %w", err)
+	}
+
+	switch contactstore.LabelMode(c.LabelMode) {
+	case contactstore.LabelsAll, contactstore.LabelsAny:
+	default:
+		return errors.New("label-mode must be all or any.")
+	}
+
+	if len(c.Output) == 0 {
+		return errors.New("output must not be empty.")
+	}
+
+	return nil
+}
+
+type listConfig struct {
+	DataDir   string   `mapstructure:"data-dir"`
+	Accounts  []string `mapstructure:"account"`
+	Search    string   `mapstructure:"search"`
+	Labels    []string `mapstructure:"label"`
+	LabelMode string   `mapstructure:"label-mode"`
+	Valid     string   `mapstructure:"valid"`
+	Delivery  string   `mapstructure:"delivery"`
+	Sort      string   `mapstructure:"sort"`
+	Desc      bool     `mapstructure:"desc"`
+	JSON      bool     `mapstructure:"json"`
+}
+
+func (c *listConfig) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	switch contactstore.LabelMode(c.LabelMode) {
+	case contactstore.LabelsAll, contactstore.LabelsAny:
+	default:
+		return errors.New("label-mode must be all or any.")
+	}
+
+	if len(c.Valid) > 0 {
+		if _, err := strconv.ParseBool(c.Valid); err != nil {
+			return errors.New("valid must be true or false.")
+		}
+	}
+
+	switch c.Delivery {
+	case "", contactstore.DeliverySent, contactstore.DeliveryFailed, contactstore.DeliveryNone:
+	default:
+		return errors.New("delivery must be sent, failed or none.")
+	}
+
+	if _, err := contactstore.ParseSortField(c.Sort); err != nil {
+		return fmt.Errorf("Sort field is invalid: %w", err)
+	}
+
+	return nil
+}
+
+type labelConfig struct {
+	DataDir string   `mapstructure:"data-dir"`
+	Add     []string `mapstructure:"add"`
+	Remove  []string `mapstructure:"remove"`
+}
+
+func (c *labelConfig) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	if len(c.Add) == 0 && len(c.Remove) == 0 {
+		return errors.New("Labels to add or remove are missing.")
+	}
+
+	return nil
+}
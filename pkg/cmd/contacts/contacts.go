@@ -0,0 +1,40 @@
+package contacts
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	contactstore "github.com/soluchok/tgsender/pkg/contacts"
+	"github.com/soluchok/tgsender/pkg/datadir"
+)
+
+const (
+	flagDataDirName  = "data-dir"
+	flagDataDirValue = datadir.Default
+	flagDataDirUsage = "Directory of the serve data stores"
+)
+
+func New() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "contacts",
+		Short: "Work with the contacts stored by serve.",
+	}
+
+	cmd.PersistentFlags().String(flagDataDirName, flagDataDirValue, flagDataDirUsage)
+
+	cmd.AddCommand(newList())
+	cmd.AddCommand(newExport())
+	cmd.AddCommand(newLabel())
+
+	return cmd
+}
+
+// openStore opens the contact store of an existing data directory
+func openStore(dataDir string) (*contactstore.Store, error) {
+	if _, err := os.Stat(dataDir); err != nil {
+		return nil, fmt.Errorf("failed to open data directory: %w", err)
+	}
+	return contactstore.NewStore(dataDir)
+}
@@ -0,0 +1,102 @@
+package contacts
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	contactstore "github.com/soluchok/tgsender/pkg/contacts"
+)
+
+const (
+	flagAccountName  = "account"
+	flagAccountUsage = "Account ID, repeat for several (all accounts if omitted)"
+
+	flagLabelName  = "label"
+	flagLabelUsage = "Only contacts with this label, repeat for several"
+
+	flagLabelModeName  = "label-mode"
+	flagLabelModeValue = "all"
+	flagLabelModeUsage = "How several labels match: all or any"
+
+	flagFormatName  = "format"
+	flagFormatValue = "csv"
+	flagFormatUsage = "Output format: csv, vcard (vCard 4.0) or json"
+
+	flagFieldsName  = "fields"
+	flagFieldsUsage = "Comma separated fields to export, in this order (all if omitted)"
+
+	flagExcludePIIName  = "exclude-pii"
+	flagExcludePIIUsage = "Leave out phone, username and photo"
+
+	flagOutputName      = "output"
+	flagOutputShorthand = "o"
+	flagOutputValue     = "-"
+	flagOutputUsage     = "file name for the output data, - for standard output"
+)
+
+func newExport() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export contacts as CSV, vCard or JSON.",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagAccountName, cmd.Flags().Lookup(flagAccountName))
+			viper.BindPFlag(flagLabelName, cmd.Flags().Lookup(flagLabelName))
+			viper.BindPFlag(flagLabelModeName, cmd.Flags().Lookup(flagLabelModeName))
+			viper.BindPFlag(flagFormatName, cmd.Flags().Lookup(flagFormatName))
+			viper.BindPFlag(flagFieldsName, cmd.Flags().Lookup(flagFieldsName))
+			viper.BindPFlag(flagExcludePIIName, cmd.Flags().Lookup(flagExcludePIIName))
+			viper.BindPFlag(flagOutputName, cmd.Flags().Lookup(flagOutputName))
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var cfg *exportConfig
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			store, err := openStore(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+
+			accountIDs := cfg.Accounts
+			if len(accountIDs) == 0 {
+				accountIDs = store.AccountIDs()
+			}
+
+			format, _ := contactstore.ParseExportFormat(cfg.Format)
+
+			var out io.Writer = cmd.OutOrStdout()
+			if cfg.Output != "-" {
+				file, err := os.OpenFile(cfg.Output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				out = file
+			}
+
+			return store.Export(out, accountIDs, contactstore.ExportOptions{
+				Format:     format,
+				Fields:     cfg.Fields,
+				ExcludePII: cfg.ExcludePII,
+				Labels:     cfg.Labels,
+				LabelMode:  contactstore.LabelMode(cfg.LabelMode),
+			})
+		},
+	}
+
+	cmd.Flags().StringSlice(flagAccountName, nil, flagAccountUsage)
+	cmd.Flags().StringSlice(flagLabelName, nil, flagLabelUsage)
+	cmd.Flags().String(flagLabelModeName, flagLabelModeValue, flagLabelModeUsage)
+	cmd.Flags().String(flagFormatName, flagFormatValue, flagFormatUsage)
+	cmd.Flags().StringSlice(flagFieldsName, nil, flagFieldsUsage)
+	cmd.Flags().Bool(flagExcludePIIName, false, flagExcludePIIUsage)
+	cmd.Flags().StringP(flagOutputName, flagOutputShorthand, flagOutputValue, flagOutputUsage)
+
+	return cmd
+}
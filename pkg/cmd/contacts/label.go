@@ -0,0 +1,80 @@
+package contacts
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/soluchok/tgsender/pkg/datadir"
+)
+
+const (
+	flagAddName  = "add"
+	flagAddUsage = "Label to add, repeat for several"
+
+	flagRemoveName  = "remove"
+	flagRemoveUsage = "Label to remove, repeat for several"
+)
+
+func newLabel() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "label <contact-id>...",
+		Short: "Add labels to contacts or remove them.",
+		Long:  "Changes the labels of contacts. Refuses to run while serve uses the data directory; use PUT /api/contacts/{id}/update then.",
+		Args:  cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagAddName, cmd.Flags().Lookup(flagAddName))
+			viper.BindPFlag(flagRemoveName, cmd.Flags().Lookup(flagRemoveName))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var cfg *labelConfig
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			if err := datadir.New(cfg.DataDir).RequireServeStopped(); err != nil {
+				return err
+			}
+
+			store, err := openStore(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+
+			for _, id := range args {
+				contact, ok := store.Get(id)
+				if !ok {
+					return fmt.Errorf("contact %s not found", id)
+				}
+
+				labels := make([]string, 0, len(contact.Labels)+len(cfg.Add))
+				for _, label := range contact.Labels {
+					if !slices.Contains(cfg.Remove, label) {
+						labels = append(labels, label)
+					}
+				}
+				for _, label := range cfg.Add {
+					if !slices.Contains(labels, label) {
+						labels = append(labels, label)
+					}
+				}
+
+				if err := store.Update(id, contact.FirstName, contact.LastName, labels); err != nil {
+					return fmt.Errorf("failed to label contact %s: %w", id, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Labeled contact %s: %s\n", id, strings.Join(labels, ", "))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSlice(flagAddName, nil, flagAddUsage)
+	cmd.Flags().StringSlice(flagRemoveName, nil, flagRemoveUsage)
+
+	return cmd
+}
@@ -0,0 +1,121 @@
+package contacts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	contactstore "github.com/soluchok/tgsender/pkg/contacts"
+)
+
+const (
+	flagSearchName  = "search"
+	flagSearchUsage = "Only contacts whose name, username or phone contains this text"
+
+	flagValidName  = "valid"
+	flagValidUsage = "Only contacts that are (true) or are not (false) on Telegram"
+
+	flagDeliveryName  = "delivery"
+	flagDeliveryUsage = "Only contacts whose last message was sent, failed, or none for never messaged"
+
+	flagSortName  = "sort"
+	flagSortValue = "name"
+	flagSortUsage = "Order by name, phone, created_at or updated_at"
+
+	flagDescName  = "desc"
+	flagDescUsage = "Reverse the order"
+
+	flagJSONName  = "json"
+	flagJSONUsage = "Print JSON instead of a table"
+)
+
+func newList() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "list",
+		Short: "List contacts, grouped by account.",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagAccountName, cmd.Flags().Lookup(flagAccountName))
+			viper.BindPFlag(flagSearchName, cmd.Flags().Lookup(flagSearchName))
+			viper.BindPFlag(flagLabelName, cmd.Flags().Lookup(flagLabelName))
+			viper.BindPFlag(flagLabelModeName, cmd.Flags().Lookup(flagLabelModeName))
+			viper.BindPFlag(flagValidName, cmd.Flags().Lookup(flagValidName))
+			viper.BindPFlag(flagDeliveryName, cmd.Flags().Lookup(flagDeliveryName))
+			viper.BindPFlag(flagSortName, cmd.Flags().Lookup(flagSortName))
+			viper.BindPFlag(flagDescName, cmd.Flags().Lookup(flagDescName))
+			viper.BindPFlag(flagJSONName, cmd.Flags().Lookup(flagJSONName))
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var cfg *listConfig
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			store, err := openStore(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+
+			sort, _ := contactstore.ParseSortField(cfg.Sort)
+			query := contactstore.Query{
+				Search:    cfg.Search,
+				Labels:    cfg.Labels,
+				LabelMode: contactstore.LabelMode(cfg.LabelMode),
+				Delivery:  cfg.Delivery,
+				Sort:      sort,
+				Desc:      cfg.Desc,
+			}
+			if len(cfg.Valid) > 0 {
+				valid, _ := strconv.ParseBool(cfg.Valid)
+				query.Valid = &valid
+			}
+
+			accountIDs := cfg.Accounts
+			if len(accountIDs) == 0 {
+				accountIDs = store.AccountIDs()
+			}
+
+			contacts := make([]*contactstore.Contact, 0)
+			for _, accountID := range accountIDs {
+				page, err := store.Query(accountID, query)
+				if err != nil {
+					return err
+				}
+				contacts = append(contacts, page.Contacts...)
+			}
+
+			if cfg.JSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(contacts)
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tACCOUNT\tNAME\tPHONE\tUSERNAME\tLABELS\tVALID\tLAST DELIVERY")
+			for _, c := range contacts {
+				name := strings.TrimSpace(c.FirstName + " " + c.LastName)
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%t\t%s\n", c.ID, c.AccountID, name, c.Phone,
+					c.Username, strings.Join(c.Labels, ","), c.IsValid, c.LastDelivery)
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().StringSlice(flagAccountName, nil, flagAccountUsage)
+	cmd.Flags().String(flagSearchName, "", flagSearchUsage)
+	cmd.Flags().StringSlice(flagLabelName, nil, flagLabelUsage)
+	cmd.Flags().String(flagLabelModeName, flagLabelModeValue, flagLabelModeUsage)
+	cmd.Flags().String(flagValidName, "", flagValidUsage)
+	cmd.Flags().String(flagDeliveryName, "", flagDeliveryUsage)
+	cmd.Flags().String(flagSortName, flagSortValue, flagSortUsage)
+	cmd.Flags().Bool(flagDescName, false, flagDescUsage)
+	cmd.Flags().Bool(flagJSONName, false, flagJSONUsage)
+
+	return cmd
+}
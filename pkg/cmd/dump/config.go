@@ -6,6 +6,7 @@ type config struct {
 	AppID          int    `mapstructure:"app-id"`
 	AppHash        string `mapstructure:"app-hash"`
 	Authentication string `mapstructure:"auth"`
+	DataDir        string `mapstructure:"data-dir"`
 	Output         string `mapstructure:"output"`
 }
 
@@ -26,5 +27,9 @@ func (c *config) Validate() error {
 		return errors.New("Telegram's phone number for authentication is missing.")
 	}
 
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
 	return nil
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/soluchok/tgsender/pkg/datadir"
 	"github.com/soluchok/tgsender/pkg/model"
 	"github.com/soluchok/tgsender/pkg/session"
 	"github.com/soluchok/tgsender/pkg/slices"
@@ -31,6 +32,9 @@ const (
 	flagAuthShorthand = "a"
 	flagAuthUsage     = "Telegram's phone number for authentication (required)"
 
+	flagDataDirName  = "data-dir"
+	flagDataDirUsage = "Directory for Telegram sessions, shared with serve"
+
 	flagOutputName      = "output"
 	flagOutputShorthand = "o"
 	flagOutputValue     = "dump.out"
@@ -43,6 +47,7 @@ func New() *cobra.Command {
 		Short: "Download all of the user's contacts.",
 		PreRun: func(cmd *cobra.Command, args []string) {
 			viper.BindPFlag(flagAuthName, cmd.PersistentFlags().Lookup(flagAuthName))
+			viper.BindPFlag(flagDataDirName, cmd.PersistentFlags().Lookup(flagDataDirName))
 			viper.BindPFlag(flagAppIDName, cmd.PersistentFlags().Lookup(flagAppIDName))
 			viper.BindPFlag(flagAppHashName, cmd.PersistentFlags().Lookup(flagAppHashName))
 			viper.BindPFlag(flagOutputName, cmd.PersistentFlags().Lookup(flagOutputName))
@@ -69,7 +74,7 @@ func New() *cobra.Command {
 
 			defer out.Close()
 
-			store, err := session.Get(cfg.Authentication)
+			store, err := session.Get(cfg.DataDir, cfg.Authentication)
 			if err != nil {
 				return fmt.Errorf("failed to get session: %w", err)
 			}
@@ -104,6 +109,7 @@ func New() *cobra.Command {
 	}
 
 	cmd.PersistentFlags().StringP(flagAuthName, flagAuthShorthand, "", flagAuthUsage)
+	cmd.PersistentFlags().String(flagDataDirName, datadir.Default, flagDataDirUsage)
 	cmd.PersistentFlags().Int(flagAppIDName, 0, flagAppIDUsage)
 	cmd.PersistentFlags().String(flagAppHashName, "", flagAppHashUsage)
 	cmd.PersistentFlags().StringP(flagOutputName, flagOutputShorthand, flagOutputValue, flagOutputUsage)
@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/soluchok/tgsender/pkg/datadir"
+)
+
+func newCancel() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "cancel <job-id>...",
+		Short: "Cancel send jobs so they are not resumed.",
+		Long:  "Marks pending, interrupted and failed jobs as cancelled. Refuses to run while serve uses the data directory; use POST /api/accounts/{id}/send/cancel to stop a running job.",
+		Args:  cobra.MinimumNArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var cfg *cancelConfig
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			if err := datadir.New(cfg.DataDir).RequireServeStopped(); err != nil {
+				return err
+			}
+
+			store, err := openStore(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+
+			for _, id := range args {
+				if _, ok := store.Get(id); !ok {
+					return fmt.Errorf("job %s not found", id)
+				}
+				job, err := store.Cancel(id)
+				if err != nil {
+					return fmt.Errorf("failed to cancel job %s: %w", id, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Cancelled job %s (%d sent, %d failed of %d)\n", job.ID, job.Sent, job.Failed, job.Total)
+			}
+			return nil
+		},
+	}
+
+	return cmd
+}
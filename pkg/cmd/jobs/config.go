@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/messages"
+)
+
+type listConfig struct {
+	DataDir  string   `mapstructure:"data-dir"`
+	Accounts []string `mapstructure:"account"`
+	Status   []string `mapstructure:"status"`
+	JSON     bool     `mapstructure:"json"`
+}
+
+func (c *listConfig) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	for _, status := range c.Status {
+		switch messages.JobStatus(status) {
+		case messages.JobStatusPending, messages.JobStatusRunning, messages.JobStatusCompleted,
+			messages.JobStatusFailed, messages.JobStatusCancelled:
+		default:
+			return fmt.Errorf("Job status %q is invalid, use pending, running, completed, failed or cancelled.", status)
+		}
+	}
+
+	return nil
+}
+
+type showConfig struct {
+	DataDir string `mapstructure:"data-dir"`
+	JSON    bool   `mapstructure:"json"`
+}
+
+func (c *showConfig) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	return nil
+}
+
+type cancelConfig struct {
+	DataDir string `mapstructure:"data-dir"`
+}
+
+func (c *cancelConfig) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	return nil
+}
+
+type reportConfig struct {
+	DataDir  string   `mapstructure:"data-dir"`
+	Job      string   `mapstructure:"job"`
+	Accounts []string `mapstructure:"account"`
+	From     string   `mapstructure:"from"`
+	To       string   `mapstructure:"to"`
+	Format   string   `mapstructure:"format"`
+	Table    string   `mapstructure:"table"`
+	Output   string   `mapstructure:"output"`
+}
+
+func (c *reportConfig) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	if c.Job != "" && (c.From != "" || c.To != "") {
+		return errors.New("Use either job or from and to, not both.")
+	}
+
+	if _, _, err := c.period(); err != nil {
+		return err
+	}
+
+	if c.Format != "json" && c.Format != "csv" {
+		return fmt.Errorf("Format %q is invalid, use json or csv.", c.Format)
+	}
+
+	if _, err := messages.ParseReportTable(c.Table); err != nil {
+		return fmt.Errorf("Table %q is invalid, use recipients, accounts or errors.", c.Table)
+	}
+
+	return nil
+}
+
+// period returns the range of job start times to report on. Dates without a
+// time are midnight UTC; to is exclusive.
+func (c *reportConfig) period() (time.Time, time.Time, error) {
+	var from, to time.Time
+	for _, f := range []struct {
+		name  string
+		value string
+		t     *time.Time
+	}{{"From", c.From, &from}, {"To", c.To, &to}} {
+		if f.value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, f.value)
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, f.value)
+		}
+		if err != nil {
+			return from, to, fmt.Errorf("%s date %q is invalid, use a date such as 2026-01-31 or an RFC 3339 time.", f.name, f.value)
+		}
+		*f.t = t
+	}
+	return from, to, nil
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/soluchok/tgsender/pkg/datadir"
+	"github.com/soluchok/tgsender/pkg/messages"
+)
+
+const (
+	flagDataDirName  = "data-dir"
+	flagDataDirValue = datadir.Default
+	flagDataDirUsage = "Directory of the serve data stores"
+
+	flagJSONName  = "json"
+	flagJSONUsage = "Print JSON instead of a table"
+)
+
+func New() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "jobs",
+		Short: "Work with the send jobs of serve.",
+	}
+
+	cmd.PersistentFlags().String(flagDataDirName, flagDataDirValue, flagDataDirUsage)
+
+	cmd.AddCommand(newList())
+	cmd.AddCommand(newShow())
+	cmd.AddCommand(newCancel())
+	cmd.AddCommand(newReport())
+
+	return cmd
+}
+
+// openStore opens the job store of an existing data directory
+func openStore(dataDir string) (*messages.JobStore, error) {
+	if _, err := os.Stat(dataDir); err != nil {
+		return nil, fmt.Errorf("failed to open data directory: %w", err)
+	}
+	return messages.NewJobStore(dataDir)
+}
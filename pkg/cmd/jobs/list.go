@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/soluchok/tgsender/pkg/messages"
+)
+
+const (
+	flagAccountName  = "account"
+	flagAccountUsage = "Only list jobs of this account ID, repeat for several"
+
+	flagStatusName  = "status"
+	flagStatusUsage = "Only list jobs with this status, repeat for several"
+)
+
+func newList() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "list",
+		Short: "List send jobs, most recent first.",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagAccountName, cmd.Flags().Lookup(flagAccountName))
+			viper.BindPFlag(flagStatusName, cmd.Flags().Lookup(flagStatusName))
+			viper.BindPFlag(flagJSONName, cmd.Flags().Lookup(flagJSONName))
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var cfg *listConfig
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			store, err := openStore(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+
+			jobs := make([]*messages.SendJob, 0)
+			for _, job := range store.List() {
+				if len(cfg.Accounts) > 0 && !slices.Contains(cfg.Accounts, job.AccountID) {
+					continue
+				}
+				if len(cfg.Status) > 0 && !slices.Contains(cfg.Status, string(job.Status)) {
+					continue
+				}
+				jobs = append(jobs, job)
+			}
+
+			if cfg.JSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(jobs)
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tACCOUNT\tCHANNEL\tSTATUS\tSENT\tFAILED\tTOTAL\tSTARTED")
+			for _, job := range jobs {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\n", job.ID, job.AccountID, channel(job),
+					job.Status, job.Sent, job.Failed, job.Total, job.StartedAt.Format(time.DateTime))
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().StringSlice(flagAccountName, nil, flagAccountUsage)
+	cmd.Flags().StringSlice(flagStatusName, nil, flagStatusUsage)
+	cmd.Flags().Bool(flagJSONName, false, flagJSONUsage)
+
+	return cmd
+}
+
+func channel(job *messages.SendJob) string {
+	if job.Channel == "" {
+		return messages.ChannelAccount
+	}
+	return job.Channel
+}
@@ -0,0 +1,135 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/soluchok/tgsender/pkg/botapi"
+	"github.com/soluchok/tgsender/pkg/contacts"
+	"github.com/soluchok/tgsender/pkg/inbox"
+	"github.com/soluchok/tgsender/pkg/messages"
+)
+
+const (
+	flagJobName  = "job"
+	flagJobUsage = "Report on this job ID only"
+
+	flagFromName  = "from"
+	flagFromUsage = "Report on jobs started at or after this date or RFC 3339 time"
+
+	flagToName  = "to"
+	flagToUsage = "Report on jobs started before this date or RFC 3339 time"
+
+	flagFormatName  = "format"
+	flagFormatValue = "csv"
+	flagFormatUsage = "Report format: csv or json"
+
+	flagTableName  = "table"
+	flagTableValue = "recipients"
+	flagTableUsage = "Table of a CSV report: recipients, accounts or errors"
+
+	flagOutputName  = "output"
+	flagOutputUsage = "Write the report to this file instead of stdout"
+)
+
+func newReport() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "report",
+		Short: "Report the outcome for every recipient of send jobs.",
+		Long:  "Reports one job, or the jobs started in a date range, including jobs removed from the send history. Rows tell whether each recipient was sent to, the error category of failures, whether they replied or opted out afterwards and the template version used. The JSON report also aggregates by account and by error category; a CSV report has one table, selected with --table.",
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagJobName, cmd.Flags().Lookup(flagJobName))
+			viper.BindPFlag(flagAccountName, cmd.Flags().Lookup(flagAccountName))
+			viper.BindPFlag(flagFromName, cmd.Flags().Lookup(flagFromName))
+			viper.BindPFlag(flagToName, cmd.Flags().Lookup(flagToName))
+			viper.BindPFlag(flagFormatName, cmd.Flags().Lookup(flagFormatName))
+			viper.BindPFlag(flagTableName, cmd.Flags().Lookup(flagTableName))
+			viper.BindPFlag(flagOutputName, cmd.Flags().Lookup(flagOutputName))
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var cfg *reportConfig
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			reporter, err := openReporter(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+
+			from, to, _ := cfg.period()
+			query := messages.ReportQuery{JobID: cfg.Job, From: from, To: to}
+			if len(cfg.Accounts) > 0 {
+				query.AccountIDs = cfg.Accounts
+			}
+			report, err := reporter.Build(query)
+			if errors.Is(err, messages.ErrReportJobNotFound) {
+				return fmt.Errorf("job %s not found", cfg.Job)
+			}
+			if err != nil {
+				return err
+			}
+
+			var out io.Writer = cmd.OutOrStdout()
+			if cfg.Output != "" {
+				f, err := os.OpenFile(cfg.Output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+				if err != nil {
+					return fmt.Errorf("failed to create report file: %w", err)
+				}
+				defer f.Close()
+				out = f
+			}
+
+			if cfg.Format == "json" {
+				encoder := json.NewEncoder(out)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(report)
+			}
+
+			table, _ := messages.ParseReportTable(cfg.Table)
+			return report.WriteCSV(out, table)
+		},
+	}
+
+	cmd.Flags().String(flagJobName, "", flagJobUsage)
+	cmd.Flags().StringSlice(flagAccountName, nil, "Only report on jobs of this account ID, repeat for several")
+	cmd.Flags().String(flagFromName, "", flagFromUsage)
+	cmd.Flags().String(flagToName, "", flagToUsage)
+	cmd.Flags().String(flagFormatName, flagFormatValue, flagFormatUsage)
+	cmd.Flags().String(flagTableName, flagTableValue, flagTableUsage)
+	cmd.Flags().String(flagOutputName, "", flagOutputUsage)
+
+	return cmd
+}
+
+// openReporter opens the stores of an existing data directory a delivery
+// report reads
+func openReporter(dataDir string) (*messages.Reporter, error) {
+	jobStore, err := openStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	contactStore, err := contacts.NewStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	inboxStore, err := inbox.NewStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	subscriberStore, err := botapi.NewSubscriberStore(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return messages.NewReporter(jobStore, contactStore).
+		WithInbox(inboxStore).
+		WithSubscribers(subscriberStore), nil
+}
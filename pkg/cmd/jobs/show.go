@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newShow() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "show <job-id>",
+		Short: "Show a send job and the result for each recipient.",
+		Args:  cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagJSONName, cmd.Flags().Lookup(flagJSONName))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var cfg *showConfig
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			store, err := openStore(cfg.DataDir)
+			if err != nil {
+				return err
+			}
+
+			job, ok := store.Get(args[0])
+			if !ok {
+				return fmt.Errorf("job %s not found", args[0])
+			}
+
+			if cfg.JSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(job)
+			}
+
+			tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintf(tw, "ID:\t%s\n", job.ID)
+			fmt.Fprintf(tw, "Account:\t%s\n", job.AccountID)
+			fmt.Fprintf(tw, "Channel:\t%s\n", channel(job))
+			fmt.Fprintf(tw, "Status:\t%s\n", job.Status)
+			if job.Error != "" {
+				fmt.Fprintf(tw, "Error:\t%s\n", job.Error)
+			}
+			fmt.Fprintf(tw, "Progress:\t%d sent, %d failed of %d\n", job.Sent, job.Failed, job.Total)
+			if job.Template != nil {
+				fmt.Fprintf(tw, "Template:\t%s v%d (%s)\n", job.Template.Name, job.Template.Version, job.Template.Language)
+			}
+			if job.Segment != nil {
+				fmt.Fprintf(tw, "Segment:\t%s\n", job.Segment.Name)
+			}
+			fmt.Fprintf(tw, "Started:\t%s\n", job.StartedAt.Format(time.DateTime))
+			fmt.Fprintf(tw, "Updated:\t%s\n", job.UpdatedAt.Format(time.DateTime))
+			fmt.Fprintf(tw, "Message:\t%s\n", job.Message)
+			if err := tw.Flush(); err != nil {
+				return err
+			}
+
+			if len(job.Results) == 0 {
+				return nil
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout())
+			tw = tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "RECIPIENT\tPHONE\tNAME\tSENT\tERROR")
+			for _, result := range job.Results {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%s\n", result.ContactID, result.Phone, result.Name, result.Success, result.Error)
+			}
+			return tw.Flush()
+		},
+	}
+
+	cmd.Flags().Bool(flagJSONName, false, flagJSONUsage)
+
+	return cmd
+}
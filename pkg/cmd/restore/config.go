@@ -0,0 +1,22 @@
+package restore
+
+import "errors"
+
+type config struct {
+	DataDir        string `mapstructure:"data-dir"`
+	PassphraseFile string `mapstructure:"passphrase-file"`
+	Force          bool   `mapstructure:"force"`
+	VerifyOnly     bool   `mapstructure:"verify-only"`
+}
+
+func (c *config) Validate() error {
+	if c == nil {
+		return errors.New("The configuration is missing. Please ensure that it was properly parsed.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package restore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/soluchok/tgsender/pkg/backup"
+	"github.com/soluchok/tgsender/pkg/datadir"
+)
+
+const (
+	flagDataDirName  = "data-dir"
+	flagDataDirValue = datadir.Default
+	flagDataDirUsage = "Directory to restore the serve data stores and Telegram sessions into"
+
+	flagPassphraseFileName  = "passphrase-file"
+	flagPassphraseFileValue = ""
+	flagPassphraseFileUsage = "File holding the passphrase, - for stdin (asked on the terminal if unset)"
+
+	flagForceName  = "force"
+	flagForceUsage = "Replace a data directory that already has files; they are moved to <data-dir>.before-restore-<time>"
+
+	flagVerifyOnlyName  = "verify-only"
+	flagVerifyOnlyUsage = "Only decrypt the archive and check it against its manifest"
+)
+
+func New() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "restore <archive>",
+		Short: "Restore the data directory from an encrypted archive.",
+		Long:  "Decrypts an archive written by backup and checks every file against its manifest before anything is written. A data directory that already has files is only replaced with --force. Refuses to run while serve uses the data directory.",
+		Args:  cobra.ExactArgs(1),
+		PreRun: func(cmd *cobra.Command, args []string) {
+			viper.BindPFlag(flagDataDirName, cmd.Flags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagPassphraseFileName, cmd.Flags().Lookup(flagPassphraseFileName))
+			viper.BindPFlag(flagForceName, cmd.Flags().Lookup(flagForceName))
+			viper.BindPFlag(flagVerifyOnlyName, cmd.Flags().Lookup(flagVerifyOnlyName))
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var cfg *config
+			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+				return err
+			}
+
+			if !cfg.VerifyOnly {
+				if err := datadir.New(cfg.DataDir).RequireServeStopped(); err != nil {
+					return err
+				}
+			}
+
+			in, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open archive: %w", err)
+			}
+			defer in.Close()
+
+			passphrase, err := backup.ReadPassphrase(cfg.PassphraseFile, cmd.InOrStdin(), false)
+			if err != nil {
+				return err
+			}
+
+			archive, err := backup.Open(in, passphrase)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Archive from %s with %d files is intact\n", archive.Manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), len(archive.Manifest.Files))
+			if cfg.VerifyOnly {
+				return nil
+			}
+
+			movedTo, err := archive.Restore(cfg.DataDir, cfg.Force)
+			if errors.Is(err, backup.ErrNotEmpty) {
+				return fmt.Errorf("%w, pass --force to replace it", err)
+			}
+			if err != nil {
+				return err
+			}
+
+			if movedTo != "" {
+				fmt.Fprintf(out, "Moved the previous data to %s\n", movedTo)
+			}
+			fmt.Fprintf(out, "Restored %d files into %s\n", len(archive.Manifest.Files), cfg.DataDir)
+			return nil
+		},
+	}
+
+	cmd.Flags().String(flagDataDirName, flagDataDirValue, flagDataDirUsage)
+	cmd.Flags().String(flagPassphraseFileName, flagPassphraseFileValue, flagPassphraseFileUsage)
+	cmd.Flags().Bool(flagForceName, false, flagForceUsage)
+	cmd.Flags().Bool(flagVerifyOnlyName, false, flagVerifyOnlyUsage)
+
+	return cmd
+}
@@ -8,8 +8,13 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/soluchok/tgsender/pkg/cmd/accounts"
+	"github.com/soluchok/tgsender/pkg/cmd/backup"
 	"github.com/soluchok/tgsender/pkg/cmd/check"
+	"github.com/soluchok/tgsender/pkg/cmd/contacts"
 	"github.com/soluchok/tgsender/pkg/cmd/dump"
+	"github.com/soluchok/tgsender/pkg/cmd/jobs"
+	"github.com/soluchok/tgsender/pkg/cmd/restore"
 	"github.com/soluchok/tgsender/pkg/cmd/send"
 	"github.com/soluchok/tgsender/pkg/cmd/serve"
 )
@@ -24,6 +29,11 @@ func New() *cobra.Command {
 	cmd.AddCommand(send.New())
 	cmd.AddCommand(dump.New())
 	cmd.AddCommand(serve.New())
+	cmd.AddCommand(contacts.New())
+	cmd.AddCommand(accounts.New())
+	cmd.AddCommand(jobs.New())
+	cmd.AddCommand(backup.New())
+	cmd.AddCommand(restore.New())
 
 	return cmd
 }
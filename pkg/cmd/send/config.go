@@ -1,13 +1,21 @@
 package send
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/soluchok/tgsender/pkg/messages"
+)
 
 type config struct {
-	AppID          int    `mapstructure:"app-id"`
-	AppHash        string `mapstructure:"app-hash"`
-	Authentication string `mapstructure:"auth"`
-	Input          string `mapstructure:"input"`
-	Message        string `mapstructure:"message"`
+	AppID          int      `mapstructure:"app-id"`
+	AppHash        string   `mapstructure:"app-hash"`
+	Authentication string   `mapstructure:"auth"`
+	DataDir        string   `mapstructure:"data-dir"`
+	Input          string   `mapstructure:"input"`
+	Message        string   `mapstructure:"message"`
+	Format         string   `mapstructure:"format"`
+	Attach         []string `mapstructure:"attach"`
 }
 
 func (c *config) Validate() error {
@@ -27,9 +35,26 @@ func (c *config) Validate() error {
 		return errors.New("Telegram's phone number for authentication is missing.")
 	}
 
-	if len(c.Message) == 0 {
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	if len(c.Message) == 0 && len(c.Attach) == 0 {
 		return errors.New("Message is missing.")
 	}
 
+	format, err := messages.ParseFormat(c.Format)
+	if err != nil {
+		return fmt.Errorf("Message format is invalid: %w", err)
+	}
+
+	if _, err := format.Styled(c.Message); err != nil {
+		return fmt.Errorf("Message is invalid: %w", err)
+	}
+
+	if len(c.Attach) > messages.MaxAttachments {
+		return fmt.Errorf("At most %d attachments can be sent.", messages.MaxAttachments)
+	}
+
 	return nil
 }
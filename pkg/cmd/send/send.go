@@ -20,6 +20,8 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/soluchok/tgsender/pkg/datadir"
+	"github.com/soluchok/tgsender/pkg/messages"
 	"github.com/soluchok/tgsender/pkg/model"
 	"github.com/soluchok/tgsender/pkg/session"
 )
@@ -35,6 +37,9 @@ const (
 	flagAuthShorthand = "a"
 	flagAuthUsage     = "Telegram's phone number for authentication (required)"
 
+	flagDataDirName  = "data-dir"
+	flagDataDirUsage = "Directory for Telegram sessions, shared with serve"
+
 	flagInputName  = "input"
 	flagInputValue = "users.out"
 	flagInputUsage = "input's data file name (required)"
@@ -42,7 +47,14 @@ const (
 	flagMessageName      = "message"
 	flagMessageShorthand = "m"
 	flagMessageValue     = ""
-	flagMessageUsage     = "Text that will be sent to the intended users (required)"
+	flagMessageUsage     = "Text that will be sent to the intended users (required unless attaching files)"
+
+	flagFormatName  = "format"
+	flagFormatValue = "plain"
+	flagFormatUsage = "Markup of the message: plain, markdown or html"
+
+	flagAttachName  = "attach"
+	flagAttachUsage = "File to send with the message, repeat for an album (up to 10)"
 )
 
 func New() *cobra.Command {
@@ -51,10 +63,13 @@ func New() *cobra.Command {
 		Short: "Send a message to the Telegram users.",
 		PreRun: func(cmd *cobra.Command, args []string) {
 			viper.BindPFlag(flagAuthName, cmd.PersistentFlags().Lookup(flagAuthName))
+			viper.BindPFlag(flagDataDirName, cmd.PersistentFlags().Lookup(flagDataDirName))
 			viper.BindPFlag(flagAppIDName, cmd.PersistentFlags().Lookup(flagAppIDName))
 			viper.BindPFlag(flagAppHashName, cmd.PersistentFlags().Lookup(flagAppHashName))
 			viper.BindPFlag(flagInputName, cmd.PersistentFlags().Lookup(flagInputName))
 			viper.BindPFlag(flagMessageName, cmd.PersistentFlags().Lookup(flagMessageName))
+			viper.BindPFlag(flagFormatName, cmd.PersistentFlags().Lookup(flagFormatName))
+			viper.BindPFlag(flagAttachName, cmd.PersistentFlags().Lookup(flagAttachName))
 		},
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			var total atomic.Int64
@@ -65,6 +80,17 @@ func New() *cobra.Command {
 				return err
 			}
 
+			format, _ := messages.ParseFormat(cfg.Format)
+
+			var media = make([]messages.Media, 0, len(cfg.Attach))
+			for _, path := range cfg.Attach {
+				m, err := messages.MediaFromFile(path)
+				if err != nil {
+					return fmt.Errorf("failed to attach file: %w", err)
+				}
+				media = append(media, m)
+			}
+
 			in, err := os.OpenFile(cfg.Input, os.O_RDWR, 0666)
 			if err != nil {
 				return err
@@ -72,7 +98,7 @@ func New() *cobra.Command {
 
 			defer in.Close()
 
-			store, err := session.Get(cfg.Authentication)
+			store, err := session.Get(cfg.DataDir, cfg.Authentication)
 			if err != nil {
 				return fmt.Errorf("failed to get session: %w", err)
 			}
@@ -94,6 +120,12 @@ func New() *cobra.Command {
 					return err
 				}
 
+				// Upload attachments once and send the same media to every user
+				media, err := messages.PrepareMedia(ctx, client.API(), media)
+				if err != nil {
+					return err
+				}
+
 				var scanner = bufio.NewScanner(in)
 				for scanner.Scan() {
 					var user *model.User
@@ -115,7 +147,7 @@ func New() *cobra.Command {
 
 					total.Add(1)
 					successful.Add(1)
-					if err := send(ctx, sender, &peer, cfg.Message, user.Username); err != nil {
+					if err := send(ctx, sender, &peer, cfg.Message, format, media, user.Username); err != nil {
 						successful.Add(-1)
 						slog.Error("failed to send message", slog.Int64("user_id", user.ID), slog.String("username", user.Username), slog.String("error", err.Error()))
 					}
@@ -127,16 +159,19 @@ func New() *cobra.Command {
 	}
 
 	cmd.PersistentFlags().StringP(flagAuthName, flagAuthShorthand, "", flagAuthUsage)
+	cmd.PersistentFlags().String(flagDataDirName, datadir.Default, flagDataDirUsage)
 	cmd.PersistentFlags().Int(flagAppIDName, 0, flagAppIDUsage)
 	cmd.PersistentFlags().String(flagAppHashName, "", flagAppHashUsage)
 	cmd.PersistentFlags().String(flagInputName, flagInputValue, flagInputUsage)
 	cmd.PersistentFlags().StringP(flagMessageName, flagMessageShorthand, flagMessageValue, flagMessageUsage)
+	cmd.PersistentFlags().String(flagFormatName, flagFormatValue, flagFormatUsage)
+	cmd.PersistentFlags().StringSlice(flagAttachName, nil, flagAttachUsage)
 
 	return cmd
 }
 
-func send(ctx context.Context, sender *message.Sender, peer tg.InputPeerClass, m, username string) error {
-	_, err := sender.To(peer).Text(ctx, m)
+func send(ctx context.Context, sender *message.Sender, peer tg.InputPeerClass, m string, format messages.Format, media []messages.Media, username string) error {
+	_, err := messages.Deliver(ctx, sender.To(peer), m, format, media)
 	if err == nil {
 		return nil
 	}
@@ -147,12 +182,12 @@ func send(ctx context.Context, sender *message.Sender, peer tg.InputPeerClass, m
 			return err
 		}
 
-		return send(ctx, sender, peer, m, "")
+		return send(ctx, sender, peer, m, format, media, "")
 	}
 
 	flood, err := tgerr.FloodWait(ctx, err)
 	if flood {
-		return send(ctx, sender, peer, m, username)
+		return send(ctx, sender, peer, m, format, media, username)
 	}
 
 	return err
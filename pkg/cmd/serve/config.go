@@ -1,15 +1,60 @@
 package serve
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/ratelimit"
+)
 
 type config struct {
-	AppID      int    `mapstructure:"app-id"`
-	AppHash    string `mapstructure:"app-hash"`
-	BotToken   string `mapstructure:"bot-token"`
-	ListenAddr string `mapstructure:"listen-addr"`
-	StaticDir  string `mapstructure:"static-dir"`
+	AppID           int           `mapstructure:"app-id"`
+	AppHash         string        `mapstructure:"app-hash"`
+	BotToken        string        `mapstructure:"bot-token"`
+	ListenAddr      string        `mapstructure:"listen-addr"`
+	StaticDir       string        `mapstructure:"static-dir"`
+	MetricsToken    string        `mapstructure:"metrics-token"`
+	DataDir         string        `mapstructure:"data-dir"`
+	SessionTTL      time.Duration `mapstructure:"session-ttl"`
+	AuthMaxAge      time.Duration `mapstructure:"auth-max-age"`
+	SpamCacheTTL    time.Duration `mapstructure:"spam-cache-ttl"`
+	ImportTimeout   time.Duration `mapstructure:"import-timeout"`
+	JobCleanupDelay time.Duration `mapstructure:"job-cleanup-delay"`
+	InboxListener   bool          `mapstructure:"inbox-listener"`
+
+	WebhookMaxAttempts  int           `mapstructure:"webhook-max-attempts"`
+	WebhookRetryDelay   time.Duration `mapstructure:"webhook-retry-delay"`
+	WebhookAllowPrivate bool          `mapstructure:"webhook-allow-private"`
+
+	HealthCheckInterval    time.Duration `mapstructure:"health-check-interval"`
+	HealthCheckJitter      time.Duration `mapstructure:"health-check-jitter"`
+	HealthCheckConcurrency int           `mapstructure:"health-check-concurrency"`
+
+	RateLimitLogin        string `mapstructure:"rate-limit-login"`
+	RateLimitPassword     string `mapstructure:"rate-limit-password"`
+	RateLimitCheckNumbers string `mapstructure:"rate-limit-check-numbers"`
+	RateLimitTestProxy    string `mapstructure:"rate-limit-test-proxy"`
+	RateLimitIPHeader     string `mapstructure:"rate-limit-ip-header"`
+
+	DeliveryBotToken string `mapstructure:"delivery-bot-token"`
+	BotAPIURL        string `mapstructure:"bot-api-url"`
+	BotUpdates       string `mapstructure:"bot-updates"`
+	BotWebhookURL    string `mapstructure:"bot-webhook-url"`
+	BotWebhookSecret string `mapstructure:"bot-webhook-secret"`
+
+	ReadyStuckAfter time.Duration `mapstructure:"ready-stuck-after"`
+
+	TracingEndpoint    string  `mapstructure:"tracing-endpoint"`
+	TracingInsecure    bool    `mapstructure:"tracing-insecure"`
+	TracingSampleRatio float64 `mapstructure:"tracing-sample-ratio"`
 }
 
+// webhookSecretPattern is the character set Telegram allows in a webhook secret
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
 func (c *config) Validate() error {
 	if c.AppID == 0 {
 		return errors.New("Telegram's app_id for authentication is missing.")
@@ -23,5 +68,148 @@ func (c *config) Validate() error {
 		return errors.New("Telegram's bot_token for OAuth authentication is missing.")
 	}
 
+	if len(c.ListenAddr) == 0 {
+		return errors.New("listen-addr must not be empty.")
+	}
+
+	if len(c.DataDir) == 0 {
+		return errors.New("data-dir must not be empty.")
+	}
+
+	if c.SessionTTL <= 0 {
+		return errors.New("session-ttl must be positive.")
+	}
+
+	if c.AuthMaxAge <= 0 {
+		return errors.New("auth-max-age must be positive.")
+	}
+
+	if c.SpamCacheTTL < 0 {
+		return errors.New("spam-cache-ttl must not be negative.")
+	}
+
+	if c.ImportTimeout <= 0 {
+		return errors.New("import-timeout must be positive.")
+	}
+
+	if c.JobCleanupDelay < 0 {
+		return errors.New("job-cleanup-delay must not be negative.")
+	}
+
+	if c.WebhookMaxAttempts < 1 {
+		return errors.New("webhook-max-attempts must be at least 1.")
+	}
+
+	if c.WebhookRetryDelay <= 0 {
+		return errors.New("webhook-retry-delay must be positive.")
+	}
+
+	if c.HealthCheckInterval < 0 {
+		return errors.New("health-check-interval must not be negative.")
+	}
+
+	if c.HealthCheckInterval > 0 && c.HealthCheckJitter < 0 {
+		return errors.New("health-check-jitter must not be negative.")
+	}
+
+	if c.HealthCheckInterval > 0 && c.HealthCheckConcurrency < 1 {
+		return errors.New("health-check-concurrency must be at least 1.")
+	}
+
+	if _, err := c.RateLimits(); err != nil {
+		return err
+	}
+
+	if len(c.BotAPIURL) == 0 {
+		return errors.New("bot-api-url must not be empty.")
+	}
+
+	switch c.BotUpdates {
+	case botUpdatesOff, botUpdatesPoll:
+	case botUpdatesWebhook:
+		if len(c.BotWebhookURL) == 0 {
+			return errors.New("bot-webhook-url is required with bot-updates=webhook.")
+		}
+		if !webhookSecretPattern.MatchString(c.BotWebhookSecret) {
+			return errors.New("bot-webhook-secret must be 1-256 characters of A-Z, a-z, 0-9, _ and -.")
+		}
+	default:
+		return errors.New("bot-updates must be one of off, poll or webhook.")
+	}
+
+	if c.ReadyStuckAfter <= 0 {
+		return errors.New("ready-stuck-after must be positive.")
+	}
+
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		return errors.New("tracing-sample-ratio must be between 0 and 1.")
+	}
+
 	return nil
 }
+
+// RateLimits returns the limit of every rate limited route group
+func (c *config) RateLimits() (map[string]ratelimit.Limit, error) {
+	specs := map[string]struct{ flag, value string }{
+		rateGroupLogin:        {flagRateLimitLoginName, c.RateLimitLogin},
+		rateGroupPassword:     {flagRateLimitPasswordName, c.RateLimitPassword},
+		rateGroupCheckNumbers: {flagRateLimitCheckNumbersName, c.RateLimitCheckNumbers},
+		rateGroupTestProxy:    {flagRateLimitTestProxyName, c.RateLimitTestProxy},
+	}
+
+	limits := make(map[string]ratelimit.Limit, len(specs))
+	for group, spec := range specs {
+		limit, err := ratelimit.ParseLimit(spec.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w.", spec.flag, err)
+		}
+		limits[group] = limit
+	}
+	return limits, nil
+}
+
+// LogValue implements slog.LogValuer, redacting secrets
+func (c *config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int(flagAppIDName, c.AppID),
+		slog.String(flagAppHashName, redact(c.AppHash)),
+		slog.String(flagBotTokenName, redact(c.BotToken)),
+		slog.String(flagListenAddrName, c.ListenAddr),
+		slog.String(flagStaticDirName, c.StaticDir),
+		slog.String(flagMetricsTokenName, redact(c.MetricsToken)),
+		slog.String(flagDataDirName, c.DataDir),
+		slog.Duration(flagSessionTTLName, c.SessionTTL),
+		slog.Duration(flagAuthMaxAgeName, c.AuthMaxAge),
+		slog.Duration(flagSpamCacheTTLName, c.SpamCacheTTL),
+		slog.Duration(flagImportTimeoutName, c.ImportTimeout),
+		slog.Duration(flagJobCleanupDelayName, c.JobCleanupDelay),
+		slog.Bool(flagInboxListenerName, c.InboxListener),
+		slog.Int(flagWebhookMaxAttemptsName, c.WebhookMaxAttempts),
+		slog.Duration(flagWebhookRetryDelayName, c.WebhookRetryDelay),
+		slog.Bool(flagWebhookAllowPrivateName, c.WebhookAllowPrivate),
+		slog.Duration(flagHealthCheckIntervalName, c.HealthCheckInterval),
+		slog.Duration(flagHealthCheckJitterName, c.HealthCheckJitter),
+		slog.Int(flagHealthCheckConcurrencyName, c.HealthCheckConcurrency),
+		slog.String(flagRateLimitLoginName, c.RateLimitLogin),
+		slog.String(flagRateLimitPasswordName, c.RateLimitPassword),
+		slog.String(flagRateLimitCheckNumbersName, c.RateLimitCheckNumbers),
+		slog.String(flagRateLimitTestProxyName, c.RateLimitTestProxy),
+		slog.String(flagRateLimitIPHeaderName, c.RateLimitIPHeader),
+		slog.String(flagDeliveryBotTokenName, redact(c.DeliveryBotToken)),
+		slog.String(flagBotAPIURLName, c.BotAPIURL),
+		slog.String(flagBotUpdatesName, c.BotUpdates),
+		slog.String(flagBotWebhookURLName, c.BotWebhookURL),
+		slog.String(flagBotWebhookSecretName, redact(c.BotWebhookSecret)),
+		slog.Duration(flagReadyStuckAfterName, c.ReadyStuckAfter),
+		slog.String(flagTracingEndpointName, c.TracingEndpoint),
+		slog.Bool(flagTracingInsecureName, c.TracingInsecure),
+		slog.Float64(flagTracingSampleRatioName, c.TracingSampleRatio),
+	)
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[redacted]"
+}
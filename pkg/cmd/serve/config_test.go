@@ -0,0 +1,146 @@
+package serve
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// newViper mirrors how root and serve set up viper: env overrides with
+// dashes mapped to underscores and every serve flag bound.
+func newViper(t *testing.T) *viper.Viper {
+	t.Helper()
+
+	v := viper.New()
+	v.AutomaticEnv()
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	if err := v.BindPFlags(New().PersistentFlags()); err != nil {
+		t.Fatalf("failed to bind flags: %v", err)
+	}
+	return v
+}
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"serve.yaml", `
+app-id: 42
+app-hash: hash
+bot-token: "1:token"
+data-dir: /var/lib/tgsender
+session-ttl: 12h
+spam-cache-ttl: 1m
+`},
+		{"serve.toml", `
+app-id = 42
+app-hash = "hash"
+bot-token = "1:token"
+data-dir = "/var/lib/tgsender"
+session-ttl = "12h"
+spam-cache-ttl = "1m"
+`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := newViper(t)
+			v.Set(flagConfigName, writeConfigFile(t, tc.name, tc.content))
+
+			cfg, err := loadConfig(v)
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+
+			if cfg.AppID != 42 || cfg.DataDir != "/var/lib/tgsender" || cfg.SessionTTL != 12*time.Hour || cfg.SpamCacheTTL != time.Minute {
+				t.Fatalf("config file values were not applied: %+v", cfg)
+			}
+
+			// Keys missing from the file keep their flag defaults
+			if cfg.AuthMaxAge != flagAuthMaxAgeValue || cfg.ImportTimeout != flagImportTimeoutValue || cfg.ListenAddr != flagListenAddrValue {
+				t.Fatalf("defaults were not applied: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadConfigEnvOverridesFile(t *testing.T) {
+	t.Setenv("SESSION_TTL", "30m")
+	t.Setenv("JOB_CLEANUP_DELAY", "1s")
+
+	v := newViper(t)
+	v.Set(flagConfigName, writeConfigFile(t, "serve.yaml", "app-id: 42\napp-hash: hash\nbot-token: token\nsession-ttl: 12h\n"))
+
+	cfg, err := loadConfig(v)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+
+	if cfg.SessionTTL != 30*time.Minute || cfg.JobCleanupDelay != time.Second {
+		t.Fatalf("environment did not override the file: %+v", cfg)
+	}
+}
+
+func TestLoadConfigValidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"missing app id", "app-hash: hash\nbot-token: token\n"},
+		{"empty data dir", "app-id: 1\napp-hash: hash\nbot-token: token\ndata-dir: ''\n"},
+		{"zero session ttl", "app-id: 1\napp-hash: hash\nbot-token: token\nsession-ttl: 0s\n"},
+		{"negative cleanup delay", "app-id: 1\napp-hash: hash\nbot-token: token\njob-cleanup-delay: -1m\n"},
+		{"bad duration", "app-id: 1\napp-hash: hash\nbot-token: token\nimport-timeout: soon\n"},
+		{"negative health check interval", "app-id: 1\napp-hash: hash\nbot-token: token\nhealth-check-interval: -1h\n"},
+		{"no health check concurrency", "app-id: 1\napp-hash: hash\nbot-token: token\nhealth-check-concurrency: 0\n"},
+		{"malformed rate limit", "app-id: 1\napp-hash: hash\nbot-token: token\nrate-limit-password: 5 per minute\n"},
+		{"unknown bot updates mode", "app-id: 1\napp-hash: hash\nbot-token: token\nbot-updates: push\n"},
+		{"webhook without secret", "app-id: 1\napp-hash: hash\nbot-token: token\nbot-updates: webhook\nbot-webhook-url: https://example.com/api/bot/webhook\n"},
+		{"sample ratio above one", "app-id: 1\napp-hash: hash\nbot-token: token\ntracing-sample-ratio: 1.5\n"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := newViper(t)
+			v.Set(flagConfigName, writeConfigFile(t, "serve.yaml", tc.content))
+
+			if _, err := loadConfig(v); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestConfigLogRedactsSecrets(t *testing.T) {
+	cfg := &config{AppID: 42, AppHash: "app-secret", BotToken: "bot-secret", MetricsToken: "metrics-secret", DataDir: "/data", DeliveryBotToken: "delivery-secret", BotWebhookSecret: "signing-secret"}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewTextHandler(&buf, nil)).Info("effective config", "config", cfg)
+
+	out := buf.String()
+	for _, secret := range []string{"app-secret", "bot-secret", "metrics-secret", "delivery-secret", "signing-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output leaks %q: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "config.data-dir=/data") || !strings.Contains(out, "config.app-id=42") {
+		t.Errorf("log output is missing config values: %s", out)
+	}
+}
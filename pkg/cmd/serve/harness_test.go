@@ -0,0 +1,424 @@
+package serve
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/accounts"
+	"github.com/soluchok/tgsender/pkg/auth"
+	"github.com/soluchok/tgsender/pkg/botapi"
+	"github.com/soluchok/tgsender/pkg/contacts"
+	"github.com/soluchok/tgsender/pkg/inbox"
+	"github.com/soluchok/tgsender/pkg/messages"
+	"github.com/soluchok/tgsender/pkg/webhooks"
+	"github.com/soluchok/tgsender/pkg/workspaces"
+)
+
+const testBotToken = "123456:test-bot-token"
+
+// Fixture identities. Owner A and owner B each have one account, one contact
+// one finished send job, one unread conversation, one webhook and one API token, so every route can be exercised against both
+// the caller's own resources and somebody else's.
+const (
+	ownerA int64 = 1001
+	ownerB int64 = 2002
+
+	accountA = "5001"
+	accountB = "6001"
+
+	contactA = "contact-a"
+	contactB = "contact-b"
+
+	jobA = "job-a"
+	jobB = "job-b"
+
+	// jobInterrupted is owner A's bot job that failed before reaching its recipient
+	jobInterrupted = "job-a-interrupted"
+
+	subscriberA int64 = 9001
+	subscriberB int64 = 9002
+
+	templateA = "template-a"
+	templateB = "template-b"
+
+	segmentA = "segment-a"
+	segmentB = "segment-b"
+
+	webhookA = "webhook-a"
+	webhookB = "webhook-b"
+
+	// testWebhookSecret signs deliveries to the fixture webhooks
+	testWebhookSecret = "whsec_test"
+
+	// API tokens and their secrets. Owner A's token may only read contacts.
+	tokenA             = "token-a"
+	tokenB             = "token-b"
+	tokenExpired       = "token-a-expired"
+	tokenSecretA       = "tgs_secret-a"
+	tokenSecretB       = "tgs_secret-b"
+	tokenSecretExpired = "tgs_secret-expired"
+
+	// workspaceTeam is owner B's team workspace, where owner A is a viewer.
+	// It has one account and an open operator invite.
+	workspaceTeam int64 = -3003
+	accountTeam         = "7501"
+	inviteTeam          = "invite-team"
+)
+
+// testServer is the full serve handler running against a temporary data directory.
+type testServer struct {
+	t       *testing.T
+	dataDir string
+	handler http.Handler
+	bot     *fakeBotAPI
+	hooks   *fakeWebhookReceiver
+}
+
+// newTestServer seeds a temporary data directory with fixtures and builds the handler on top of it.
+// Options adjust the serve configuration before the handler is built.
+func newTestServer(t *testing.T, opts ...func(*config)) *testServer {
+	t.Helper()
+
+	dataDir := t.TempDir()
+	now := time.Now()
+
+	writeFixture(t, dataDir, "accounts.json", []*accounts.Account{
+		{ID: accountA, OwnerID: ownerA, TelegramID: 5001, Phone: "+10000000001", FirstName: "Alice", IsActive: true, CreatedAt: now},
+		{ID: accountB, OwnerID: ownerB, TelegramID: 6001, Phone: "+20000000001", FirstName: "Bob", IsActive: true, CreatedAt: now},
+		{ID: accountTeam, OwnerID: workspaceTeam, TelegramID: 7501, Phone: "+30000000001", FirstName: "Support", IsActive: true, CreatedAt: now},
+	})
+	writeFixture(t, dataDir, "contacts.json", []*contacts.Contact{
+		{ID: contactA, AccountID: accountA, TelegramID: 7001, AccessHash: 1, Phone: "+10000000002", FirstName: "Carol", IsValid: true, CreatedAt: now, UpdatedAt: now},
+		{ID: contactB, AccountID: accountB, TelegramID: 8001, AccessHash: 2, Phone: "+20000000002", FirstName: "Dave", IsValid: true, CreatedAt: now, UpdatedAt: now},
+	})
+	writeFixture(t, dataDir, "jobs.json", []*messages.SendJob{
+		{ID: jobA, AccountID: accountA, Status: messages.JobStatusCompleted, Message: "hi", Total: 1, Sent: 1, Results: []messages.RecipientResult{{ContactID: contactA, Phone: "+10000000002", Name: "Carol", Success: true, At: now.Add(-time.Minute)}}, ContactIDs: []string{contactA}, StartedAt: now.Add(-time.Minute), UpdatedAt: now},
+		{ID: jobB, AccountID: accountB, Status: messages.JobStatusCompleted, Message: "hi", Total: 1, Sent: 1, Results: []messages.RecipientResult{}, ContactIDs: []string{contactB}, StartedAt: now, UpdatedAt: now},
+		{ID: jobInterrupted, AccountID: accountA, Status: messages.JobStatusFailed, Message: "**Hi** {{.FirstName}}", Format: messages.FormatMarkdown, Total: 1, Results: []messages.RecipientResult{}, Channel: messages.ChannelBot, SubscriberIDs: []int64{subscriberA}, Error: "server restarted while job was running", StartedAt: now, UpdatedAt: now},
+	})
+
+	writeFixture(t, dataDir, "conversations.json", []*inbox.Conversation{
+		{AccountID: accountA, ContactID: contactA, UpdatedAt: now, Messages: []*inbox.Message{
+			{ID: "message-a", TelegramMessageID: 1, Direction: inbox.DirectionIncoming, Text: "hello", Date: now},
+		}},
+		{AccountID: accountB, ContactID: contactB, UpdatedAt: now, Messages: []*inbox.Message{
+			{ID: "message-b", TelegramMessageID: 1, Direction: inbox.DirectionIncoming, Text: "hello", Date: now},
+		}},
+	})
+
+	writeFixture(t, dataDir, "bot_subscribers.json", []*botapi.Subscriber{
+		{ChatID: subscriberA, AccountID: accountA, FirstName: "Erin", Subscribed: true, SubscribedAt: now},
+		{ChatID: subscriberB, AccountID: accountB, FirstName: "Frank", Subscribed: true, SubscribedAt: now},
+	})
+
+	writeFixture(t, dataDir, "templates.json", []*messages.Template{
+		{ID: templateA, OwnerID: ownerA, Name: "Welcome", CreatedAt: now, UpdatedAt: now, Versions: []*messages.TemplateVersion{
+			{Version: 1, Format: messages.FormatPlain, DefaultLanguage: "en", Variants: map[string]string{"en": "Hi {{.FirstName}}"}, Variables: []string{"FirstName"}, CreatedAt: now},
+			{Version: 2, Format: messages.FormatMarkdown, DefaultLanguage: "en", Variants: map[string]string{"en": "**Hi** {{.FirstName}}", "uk": "**Привіт** {{.FirstName}}"}, Variables: []string{"FirstName"}, CreatedAt: now},
+		}},
+		{ID: templateB, OwnerID: ownerB, Name: "Welcome", CreatedAt: now, UpdatedAt: now, Versions: []*messages.TemplateVersion{
+			{Version: 1, Format: messages.FormatPlain, DefaultLanguage: "en", Variants: map[string]string{"en": "Hello"}, Variables: []string{}, CreatedAt: now},
+		}},
+	})
+
+	writeFixture(t, dataDir, "segments.json", []*contacts.Segment{
+		{ID: segmentA, OwnerID: ownerA, Name: "Everyone", CreatedAt: now, UpdatedAt: now},
+		{ID: segmentB, OwnerID: ownerB, Name: "Everyone", CreatedAt: now, UpdatedAt: now},
+	})
+
+	expired := now.Add(-time.Hour)
+	writeFixture(t, dataDir, "api_tokens.json", []*auth.APIToken{
+		{ID: tokenA, OwnerID: ownerA, Name: "CRM", Scopes: []string{auth.ScopeContactsRead}, Prefix: tokenSecretA[:10], Hash: auth.HashToken(tokenSecretA), CreatedAt: now},
+		{ID: tokenB, OwnerID: ownerB, Name: "CRM", Scopes: auth.Scopes, Prefix: tokenSecretB[:10], Hash: auth.HashToken(tokenSecretB), CreatedAt: now},
+		{ID: tokenExpired, OwnerID: ownerA, Name: "Old", Scopes: auth.Scopes, Prefix: tokenSecretExpired[:10], Hash: auth.HashToken(tokenSecretExpired), CreatedAt: expired, ExpiresAt: &expired},
+	})
+
+	writeFixture(t, dataDir, "workspaces.json", []*workspaces.Workspace{
+		{ID: workspaceTeam, Name: "Support", CreatedAt: now, UpdatedAt: now, Members: []*workspaces.Member{
+			{UserID: ownerB, Role: workspaces.RoleAdmin, JoinedAt: now},
+			{UserID: ownerA, Role: workspaces.RoleViewer, JoinedAt: now},
+		}},
+	})
+	writeFixture(t, dataDir, "workspace_invites.json", []*workspaces.Invite{
+		{Code: inviteTeam, WorkspaceID: workspaceTeam, Role: workspaces.RoleOperator, CreatedBy: ownerB, CreatedAt: now, ExpiresAt: now.Add(time.Hour)},
+	})
+
+	bot := newFakeBotAPI(t)
+	hooks := newFakeWebhookReceiver(t)
+
+	// Fixture webhooks only subscribe to cancellations, so other tests don't leave deliveries behind
+	writeFixture(t, dataDir, "webhooks.json", []*webhooks.Endpoint{
+		{ID: webhookA, OwnerID: ownerA, URL: hooks.server.URL + "/a", Events: []string{webhooks.EventJobCancelled}, Active: true, Secret: testWebhookSecret, CreatedAt: now, UpdatedAt: now},
+		{ID: webhookB, OwnerID: ownerB, URL: hooks.server.URL + "/b", Events: []string{webhooks.EventJobCancelled}, Active: true, Secret: testWebhookSecret, CreatedAt: now, UpdatedAt: now},
+	})
+
+	cfg := &config{
+		AppID:           1,
+		AppHash:         "test-app-hash",
+		BotToken:        testBotToken,
+		ListenAddr:      flagListenAddrValue,
+		DataDir:         dataDir,
+		SessionTTL:      flagSessionTTLValue,
+		AuthMaxAge:      flagAuthMaxAgeValue,
+		SpamCacheTTL:    flagSpamCacheTTLValue,
+		ImportTimeout:   flagImportTimeoutValue,
+		JobCleanupDelay: flagJobCleanupDelayValue,
+		BotAPIURL:       bot.server.URL,
+		BotUpdates:      botUpdatesOff,
+
+		WebhookMaxAttempts: 2,
+		WebhookRetryDelay:  10 * time.Millisecond,
+		// The fake receiver listens on loopback
+		WebhookAllowPrivate: true,
+		ReadyStuckAfter:     flagReadyStuckAfterValue,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+
+	handler, shutdown, err := newHandler(cfg)
+	if err != nil {
+		t.Fatalf("failed to build handler: %v", err)
+	}
+	t.Cleanup(shutdown)
+
+	return &testServer{t: t, dataDir: dataDir, handler: handler, bot: bot, hooks: hooks}
+}
+
+// fakeBotAPI is a minimal Telegram Bot API server that records sent messages.
+type fakeBotAPI struct {
+	server *httptest.Server
+
+	mu   sync.Mutex
+	sent []botapi.Message
+}
+
+func newFakeBotAPI(t *testing.T) *fakeBotAPI {
+	t.Helper()
+
+	bot := &fakeBotAPI{}
+	bot.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/bot"+testBotToken+"/") {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"ok": false, "error_code": 401, "description": "Unauthorized"})
+			return
+		}
+
+		var result any = true
+		switch strings.TrimPrefix(r.URL.Path, "/bot"+testBotToken+"/") {
+		case "getMe":
+			result = botapi.User{ID: 1, IsBot: true, FirstName: "Test", Username: "test_bot"}
+		case "getUpdates":
+			result = []botapi.Update{}
+		case "sendMessage":
+			var req struct {
+				ChatID int64  `json:"chat_id"`
+				Text   string `json:"text"`
+			}
+			json.NewDecoder(r.Body).Decode(&req)
+
+			bot.mu.Lock()
+			msg := botapi.Message{MessageID: len(bot.sent) + 1, Chat: botapi.Chat{ID: req.ChatID, Type: "private"}, Text: req.Text}
+			bot.sent = append(bot.sent, msg)
+			bot.mu.Unlock()
+			result = msg
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{"ok": true, "result": result})
+	}))
+	t.Cleanup(bot.server.Close)
+
+	return bot
+}
+
+// messages returns the messages sent so far.
+func (b *fakeBotAPI) messages() []botapi.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]botapi.Message(nil), b.sent...)
+}
+
+// fakeWebhookReceiver records the events delivered to the fixture webhooks.
+type fakeWebhookReceiver struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	received []receivedEvent
+}
+
+// receivedEvent is a delivered event and whether its signature was valid
+type receivedEvent struct {
+	path     string
+	event    webhooks.Event
+	verified bool
+}
+
+func newFakeWebhookReceiver(t *testing.T) *fakeWebhookReceiver {
+	t.Helper()
+
+	hooks := &fakeWebhookReceiver{}
+	hooks.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var event webhooks.Event
+		json.Unmarshal(body, &event)
+
+		signature := r.Header.Get(webhooks.HeaderSignature)
+		ts, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+		unix, _ := strconv.ParseInt(ts, 10, 64)
+		verified := signature == webhooks.Sign(testWebhookSecret, time.Unix(unix, 0), body)
+
+		hooks.mu.Lock()
+		hooks.received = append(hooks.received, receivedEvent{path: r.URL.Path, event: event, verified: verified})
+		hooks.mu.Unlock()
+	}))
+	t.Cleanup(hooks.server.Close)
+
+	return hooks
+}
+
+// events returns the events received so far.
+func (h *fakeWebhookReceiver) events() []receivedEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]receivedEvent(nil), h.received...)
+}
+
+func writeFixture(t *testing.T, dataDir, name string, v any) {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal %s: %v", name, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dataDir, name), data, 0600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
+
+// login signs in as userID through the Telegram Login Widget route and returns the session cookie.
+func (s *testServer) login(userID int64) *http.Cookie {
+	s.t.Helper()
+
+	user := auth.TelegramUser{
+		ID:        userID,
+		FirstName: "User",
+		AuthDate:  time.Now().Unix(),
+	}
+	user.Hash = signTelegramUser(user)
+
+	body, _ := json.Marshal(user)
+	rec := s.do(http.MethodPost, "/api/auth/telegram", string(body), nil)
+	if rec.Code != http.StatusOK {
+		s.t.Fatalf("login failed: %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "session_token" {
+			return cookie
+		}
+	}
+
+	s.t.Fatal("login did not set a session cookie")
+	return nil
+}
+
+// do performs a request against the handler, optionally authenticated with cookie.
+func (s *testServer) do(method, path, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	return s.doWithHeader(method, path, body, cookie, nil)
+}
+
+// doWithHeader is like do but also sets the given request headers.
+func (s *testServer) doWithHeader(method, path, body string, cookie *http.Cookie, header http.Header) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	switch {
+	case strings.HasPrefix(body, "--"+uploadBoundary):
+		req.Header.Set("Content-Type", "multipart/form-data; boundary="+uploadBoundary)
+	case body != "":
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// uploadBoundary separates the parts of bodies built by uploadBody
+const uploadBoundary = "tgsender-test-upload"
+
+// uploadBody builds a multipart body holding one file in the "file" field.
+// do sends bodies that start with the boundary as multipart/form-data.
+func uploadBody(fileName, content string) string {
+	return "--" + uploadBoundary + "\r\n" +
+		`Content-Disposition: form-data; name="file"; filename="` + fileName + `"` + "\r\n" +
+		"Content-Type: application/octet-stream\r\n\r\n" +
+		content + "\r\n" +
+		"--" + uploadBoundary + "--\r\n"
+}
+
+// signTelegramUser computes the Login Widget hash the same way Telegram does.
+func signTelegramUser(user auth.TelegramUser) string {
+	checkString := "auth_date=" + strconv.FormatInt(user.AuthDate, 10) +
+		"\nfirst_name=" + user.FirstName +
+		"\nid=" + strconv.FormatInt(user.ID, 10)
+
+	secretKey := sha256.Sum256([]byte(testBotToken))
+	h := hmac.New(sha256.New, secretKey[:])
+	h.Write([]byte(checkString))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// decodeObject decodes a JSON object response body.
+func decodeObject(t *testing.T, rec *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not a JSON object: %v: %s", err, rec.Body.String())
+	}
+	return body
+}
+
+// assertKeys fails the test if any of keys is missing from body.
+func assertKeys(t *testing.T, body map[string]any, keys ...string) {
+	t.Helper()
+
+	for _, key := range keys {
+		if _, ok := body[key]; !ok {
+			t.Errorf("response is missing %q: %v", key, body)
+		}
+	}
+}
@@ -0,0 +1,1252 @@
+package serve
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/soluchok/tgsender/pkg/auth"
+	"github.com/soluchok/tgsender/pkg/client"
+	"github.com/soluchok/tgsender/pkg/health"
+	"github.com/soluchok/tgsender/pkg/messages"
+	"github.com/soluchok/tgsender/pkg/openapi"
+	"github.com/soluchok/tgsender/pkg/workspaces"
+)
+
+// route describes one API endpoint as a client calls it: the accepted method,
+// a concrete path and a body that passes decoding.
+type route struct {
+	name   string
+	method string
+	path   string
+	body   string
+}
+
+// protectedRoutes lists every route that requires an authenticated session.
+// Paths target owner A's own resources.
+var protectedRoutes = []route{
+	{"auth me", http.MethodGet, "/api/auth/me", ""},
+	{"list tokens", http.MethodGet, "/api/tokens", ""},
+	{"create token", http.MethodPost, "/api/tokens", `{"name":"CI","scopes":["send"]}`},
+	{"delete token", http.MethodDelete, "/api/tokens/" + tokenA, ""},
+	{"list token uses", http.MethodGet, "/api/tokens/" + tokenA + "/uses", ""},
+	{"list workspaces", http.MethodGet, "/api/workspaces", ""},
+	{"create workspace", http.MethodPost, "/api/workspaces", `{"name":"Sales"}`},
+	{"get workspace", http.MethodGet, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10), ""},
+	{"update workspace member", http.MethodPut, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/members/" + strconv.FormatInt(ownerA, 10), `{"role":"operator"}`},
+	{"remove workspace member", http.MethodDelete, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/members/" + strconv.FormatInt(ownerA, 10), ""},
+	{"list workspace invites", http.MethodGet, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/invites", ""},
+	{"create workspace invite", http.MethodPost, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/invites", `{"role":"viewer"}`},
+	{"delete workspace invite", http.MethodDelete, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/invites/" + inviteTeam, ""},
+	{"accept workspace invite", http.MethodPost, "/api/invites/" + inviteTeam + "/accept", ""},
+	{"list accounts", http.MethodGet, "/api/accounts", ""},
+	{"delete account", http.MethodDelete, "/api/accounts/" + accountA, ""},
+	{"validate account", http.MethodGet, "/api/accounts/" + accountA + "/validate", ""},
+	{"spam status", http.MethodGet, "/api/accounts/" + accountA + "/spam-status", ""},
+	{"account status history", http.MethodGet, "/api/accounts/" + accountA + "/status-history", ""},
+	{"get settings", http.MethodGet, "/api/accounts/" + accountA + "/settings", ""},
+	{"update settings", http.MethodPut, "/api/accounts/" + accountA + "/settings", `{}`},
+	{"test proxy", http.MethodPost, "/api/accounts/" + accountA + "/test-proxy", `{"proxy_url":"socks5://127.0.0.1:1080"}`},
+	{"qr start", http.MethodPost, "/api/accounts/qr/start", ""},
+	{"qr status", http.MethodGet, "/api/accounts/qr/status?token=unknown", ""},
+	{"qr cancel", http.MethodPost, "/api/accounts/qr/cancel", `{"token":"unknown"}`},
+	{"qr password", http.MethodPost, "/api/accounts/qr/password", `{"token":"unknown","password":"secret"}`},
+	{"phone start", http.MethodPost, "/api/accounts/phone/start", `{"phone":"+15550100"}`},
+	{"phone status", http.MethodGet, "/api/accounts/phone/status?token=unknown", ""},
+	{"phone code", http.MethodPost, "/api/accounts/phone/code", `{"token":"unknown","code":"12345"}`},
+	{"phone password", http.MethodPost, "/api/accounts/phone/password", `{"token":"unknown","password":"secret"}`},
+	{"phone cancel", http.MethodPost, "/api/accounts/phone/cancel", `{"token":"unknown"}`},
+	{"check numbers", http.MethodPost, "/api/accounts/" + accountA + "/check-numbers", `{"phones":["+10000000003"]}`},
+	{"list contacts", http.MethodGet, "/api/accounts/" + accountA + "/contacts", ""},
+	{"import chats", http.MethodPost, "/api/accounts/" + accountA + "/import-chats", ""},
+	{"import chats status", http.MethodGet, "/api/accounts/" + accountA + "/import-chats/status", ""},
+	{"import events", http.MethodGet, "/api/accounts/" + accountA + "/import-chats/events?job_id=missing", ""},
+	{"import contacts", http.MethodPost, "/api/accounts/" + accountA + "/import-contacts", ""},
+	{"import file", http.MethodPost, "/api/accounts/" + accountA + "/import-file", `{"contacts":[{"phone":"+10000000003"}]}`},
+	{"export contacts", http.MethodPost, "/api/contacts/export", `{"account_ids":["` + accountA + `"]}`},
+	{"delete contact", http.MethodDelete, "/api/contacts/" + contactA, ""},
+	{"update contact", http.MethodPut, "/api/contacts/" + contactA + "/update", `{"first_name":"Carol"}`},
+	{"send", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"contact_ids":["` + contactA + `"],"message":"hi"}`},
+	{"send status", http.MethodGet, "/api/accounts/" + accountA + "/send/status?job_id=" + jobA, ""},
+	{"send events", http.MethodGet, "/api/accounts/" + accountA + "/send/events?job_id=" + jobA, ""},
+	{"send history", http.MethodGet, "/api/accounts/" + accountA + "/send/history", ""},
+	{"resume send", http.MethodPost, "/api/accounts/" + accountA + "/send/resume", `{"job_id":"` + jobInterrupted + `"}`},
+	{"cancel send", http.MethodPost, "/api/accounts/" + accountA + "/send/cancel", `{"job_id":"` + jobInterrupted + `"}`},
+	{"upload media", http.MethodPost, "/api/accounts/" + accountA + "/media", uploadBody("photo.png", "png")},
+	{"list inbox", http.MethodGet, "/api/accounts/" + accountA + "/inbox", ""},
+	{"get inbox thread", http.MethodGet, "/api/accounts/" + accountA + "/inbox/" + contactA, ""},
+	{"mark inbox thread read", http.MethodPost, "/api/accounts/" + accountA + "/inbox/" + contactA + "/read", ""},
+	{"reply to inbox thread", http.MethodPost, "/api/accounts/" + accountA + "/inbox/" + contactA + "/reply", `{"text":"hi"}`},
+	{"list bot subscribers", http.MethodGet, "/api/accounts/" + accountA + "/bot/subscribers", ""},
+	{"list templates", http.MethodGet, "/api/templates", ""},
+	{"get quiet hours", http.MethodGet, "/api/quiet-hours", ""},
+	{"update quiet hours", http.MethodPut, "/api/quiet-hours", `{"enabled":true,"start":"21:00","end":"09:00"}`},
+	{"delivery report", http.MethodGet, "/api/reports/delivery", ""},
+	{"create template", http.MethodPost, "/api/templates", `{"name":"Reminder","variants":{"en":"Hi"}}`},
+	{"get template", http.MethodGet, "/api/templates/" + templateA, ""},
+	{"add template version", http.MethodPost, "/api/templates/" + templateA + "/versions", `{"variants":{"en":"Hey"}}`},
+	{"delete template", http.MethodDelete, "/api/templates/" + templateA, ""},
+	{"list segments", http.MethodGet, "/api/segments", ""},
+	{"create segment", http.MethodPost, "/api/segments", `{"name":"VIP","filter":{"labels":["vip"]}}`},
+	{"get segment", http.MethodGet, "/api/segments/" + segmentA, ""},
+	{"update segment", http.MethodPut, "/api/segments/" + segmentA, `{"name":"Everyone"}`},
+	{"delete segment", http.MethodDelete, "/api/segments/" + segmentA, ""},
+	{"preview segment", http.MethodGet, "/api/accounts/" + accountA + "/segments/" + segmentA + "/preview", ""},
+	{"list webhooks", http.MethodGet, "/api/webhooks", ""},
+	{"create webhook", http.MethodPost, "/api/webhooks", `{"url":"https://example.com/hook"}`},
+	{"get webhook", http.MethodGet, "/api/webhooks/" + webhookA, ""},
+	{"update webhook", http.MethodPut, "/api/webhooks/" + webhookA, `{"url":"https://example.com/hook"}`},
+	{"delete webhook", http.MethodDelete, "/api/webhooks/" + webhookA, ""},
+	{"list webhook deliveries", http.MethodGet, "/api/webhooks/" + webhookA + "/deliveries", ""},
+	{"test webhook", http.MethodPost, "/api/webhooks/" + webhookA + "/test", ""},
+}
+
+func TestRoutesRejectWrongMethod(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	routes := append([]route{
+		{"telegram auth", http.MethodPost, "/api/auth/telegram", ""},
+		{"logout", http.MethodPost, "/api/auth/logout", ""},
+	}, protectedRoutes...)
+
+	for _, tc := range routes {
+		t.Run(tc.name, func(t *testing.T) {
+			// No route accepts PATCH, and some paths serve both GET and POST
+			method := http.MethodPatch
+
+			rec := srv.do(method, tc.path, tc.body, cookie)
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("%s %s: got status %d, want %d", method, tc.path, rec.Code, http.StatusMethodNotAllowed)
+			}
+		})
+	}
+}
+
+func TestRoutesRequireAuthentication(t *testing.T) {
+	srv := newTestServer(t)
+
+	invalid := &http.Cookie{Name: "session_token", Value: "not-a-session"}
+
+	for _, tc := range protectedRoutes {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, cookie := range []*http.Cookie{nil, invalid} {
+				rec := srv.do(tc.method, tc.path, tc.body, cookie)
+				if rec.Code != http.StatusUnauthorized {
+					t.Fatalf("%s %s: got status %d, want %d", tc.method, tc.path, rec.Code, http.StatusUnauthorized)
+				}
+				assertKeys(t, decodeObject(t, rec), "error")
+			}
+		})
+	}
+}
+
+func TestRoutesDenyCrossOwnerAccess(t *testing.T) {
+	tests := []struct {
+		route
+		want int
+	}{
+		{route{"delete account", http.MethodDelete, "/api/accounts/" + accountB, ""}, http.StatusForbidden},
+		{route{"validate account", http.MethodGet, "/api/accounts/" + accountB + "/validate", ""}, http.StatusForbidden},
+		{route{"spam status", http.MethodGet, "/api/accounts/" + accountB + "/spam-status", ""}, http.StatusForbidden},
+		{route{"account status history", http.MethodGet, "/api/accounts/" + accountB + "/status-history", ""}, http.StatusForbidden},
+		{route{"get settings", http.MethodGet, "/api/accounts/" + accountB + "/settings", ""}, http.StatusForbidden},
+		{route{"update settings", http.MethodPut, "/api/accounts/" + accountB + "/settings", `{"openai_token":"stolen"}`}, http.StatusForbidden},
+		{route{"test proxy", http.MethodPost, "/api/accounts/" + accountB + "/test-proxy", `{}`}, http.StatusForbidden},
+		{route{"check numbers", http.MethodPost, "/api/accounts/" + accountB + "/check-numbers", `{"phones":["+1"]}`}, http.StatusForbidden},
+		{route{"list contacts", http.MethodGet, "/api/accounts/" + accountB + "/contacts", ""}, http.StatusForbidden},
+		{route{"import chats", http.MethodPost, "/api/accounts/" + accountB + "/import-chats", ""}, http.StatusForbidden},
+		{route{"import chats status", http.MethodGet, "/api/accounts/" + accountB + "/import-chats/status", ""}, http.StatusForbidden},
+		{route{"import events", http.MethodGet, "/api/accounts/" + accountB + "/import-chats/events?job_id=missing", ""}, http.StatusForbidden},
+		{route{"import contacts", http.MethodPost, "/api/accounts/" + accountB + "/import-contacts", ""}, http.StatusForbidden},
+		{route{"import file", http.MethodPost, "/api/accounts/" + accountB + "/import-file", `{"contacts":[]}`}, http.StatusForbidden},
+		{route{"export contacts", http.MethodPost, "/api/contacts/export", `{"account_ids":["` + accountA + `","` + accountB + `"]}`}, http.StatusForbidden},
+		{route{"delete contact", http.MethodDelete, "/api/contacts/" + contactB, ""}, http.StatusForbidden},
+		{route{"update contact", http.MethodPut, "/api/contacts/" + contactB + "/update", `{"first_name":"Mallory"}`}, http.StatusForbidden},
+		{route{"send", http.MethodPost, "/api/accounts/" + accountB + "/send", `{"contact_ids":["` + contactB + `"],"message":"hi"}`}, http.StatusForbidden},
+		{route{"send status", http.MethodGet, "/api/accounts/" + accountB + "/send/status?job_id=" + jobB, ""}, http.StatusForbidden},
+		{route{"send status foreign job", http.MethodGet, "/api/accounts/" + accountA + "/send/status?job_id=" + jobB, ""}, http.StatusNotFound},
+		{route{"send events", http.MethodGet, "/api/accounts/" + accountB + "/send/events?job_id=" + jobB, ""}, http.StatusForbidden},
+		{route{"send events foreign job", http.MethodGet, "/api/accounts/" + accountA + "/send/events?job_id=" + jobB, ""}, http.StatusNotFound},
+		{route{"send history", http.MethodGet, "/api/accounts/" + accountB + "/send/history", ""}, http.StatusForbidden},
+		{route{"delivery report foreign job", http.MethodGet, "/api/reports/delivery?job_id=" + jobB, ""}, http.StatusNotFound},
+		{route{"delivery report foreign account", http.MethodGet, "/api/reports/delivery?account_id=" + accountB, ""}, http.StatusNotFound},
+		{route{"resume send", http.MethodPost, "/api/accounts/" + accountB + "/send/resume", `{"job_id":"` + jobB + `"}`}, http.StatusForbidden},
+		{route{"resume foreign job", http.MethodPost, "/api/accounts/" + accountA + "/send/resume", `{"job_id":"` + jobB + `"}`}, http.StatusNotFound},
+		{route{"cancel send", http.MethodPost, "/api/accounts/" + accountB + "/send/cancel", `{"job_id":"` + jobB + `"}`}, http.StatusForbidden},
+		{route{"cancel foreign job", http.MethodPost, "/api/accounts/" + accountA + "/send/cancel", `{"job_id":"` + jobB + `"}`}, http.StatusNotFound},
+		{route{"upload media", http.MethodPost, "/api/accounts/" + accountB + "/media", uploadBody("photo.png", "png")}, http.StatusForbidden},
+		{route{"qr status", http.MethodGet, "/api/accounts/qr/status?token=unknown", ""}, http.StatusNotFound},
+		{route{"phone status", http.MethodGet, "/api/accounts/phone/status?token=unknown", ""}, http.StatusNotFound},
+		{route{"list inbox", http.MethodGet, "/api/accounts/" + accountB + "/inbox", ""}, http.StatusForbidden},
+		{route{"get inbox thread", http.MethodGet, "/api/accounts/" + accountB + "/inbox/" + contactB, ""}, http.StatusForbidden},
+		{route{"get inbox thread foreign contact", http.MethodGet, "/api/accounts/" + accountA + "/inbox/" + contactB, ""}, http.StatusNotFound},
+		{route{"mark inbox thread read", http.MethodPost, "/api/accounts/" + accountB + "/inbox/" + contactB + "/read", ""}, http.StatusForbidden},
+		{route{"reply to inbox thread", http.MethodPost, "/api/accounts/" + accountB + "/inbox/" + contactB + "/reply", `{"text":"hi"}`}, http.StatusForbidden},
+		{route{"reply to foreign contact", http.MethodPost, "/api/accounts/" + accountA + "/inbox/" + contactB + "/reply", `{"text":"hi"}`}, http.StatusNotFound},
+		{route{"list bot subscribers", http.MethodGet, "/api/accounts/" + accountB + "/bot/subscribers", ""}, http.StatusForbidden},
+		{route{"get template", http.MethodGet, "/api/templates/" + templateB, ""}, http.StatusForbidden},
+		{route{"add template version", http.MethodPost, "/api/templates/" + templateB + "/versions", `{"variants":{"en":"Mine now"}}`}, http.StatusForbidden},
+		{route{"delete template", http.MethodDelete, "/api/templates/" + templateB, ""}, http.StatusForbidden},
+		{route{"get segment", http.MethodGet, "/api/segments/" + segmentB, ""}, http.StatusForbidden},
+		{route{"update segment", http.MethodPut, "/api/segments/" + segmentB, `{"name":"Mine now"}`}, http.StatusForbidden},
+		{route{"delete segment", http.MethodDelete, "/api/segments/" + segmentB, ""}, http.StatusForbidden},
+		{route{"preview foreign segment", http.MethodGet, "/api/accounts/" + accountA + "/segments/" + segmentB + "/preview", ""}, http.StatusForbidden},
+		{route{"preview segment on foreign account", http.MethodGet, "/api/accounts/" + accountB + "/segments/" + segmentA + "/preview", ""}, http.StatusForbidden},
+		{route{"delete token", http.MethodDelete, "/api/tokens/" + tokenB, ""}, http.StatusForbidden},
+		{route{"list token uses", http.MethodGet, "/api/tokens/" + tokenB + "/uses", ""}, http.StatusForbidden},
+		{route{"get foreign workspace", http.MethodGet, "/api/workspaces/" + strconv.FormatInt(ownerB, 10), ""}, http.StatusNotFound},
+		{route{"update member as viewer", http.MethodPut, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/members/" + strconv.FormatInt(ownerA, 10), `{"role":"admin"}`}, http.StatusForbidden},
+		{route{"remove member as viewer", http.MethodDelete, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/members/" + strconv.FormatInt(ownerB, 10), ""}, http.StatusForbidden},
+		{route{"list invites as viewer", http.MethodGet, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/invites", ""}, http.StatusForbidden},
+		{route{"create invite as viewer", http.MethodPost, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/invites", `{"role":"admin"}`}, http.StatusForbidden},
+		{route{"delete invite as viewer", http.MethodDelete, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/invites/" + inviteTeam, ""}, http.StatusForbidden},
+		{route{"send as viewer", http.MethodPost, "/api/accounts/" + accountTeam + "/send", `{"contact_ids":["` + contactB + `"],"message":"hi"}`}, http.StatusForbidden},
+		{route{"delete account as viewer", http.MethodDelete, "/api/accounts/" + accountTeam, ""}, http.StatusForbidden},
+		{route{"get settings as viewer", http.MethodGet, "/api/accounts/" + accountTeam + "/settings", ""}, http.StatusForbidden},
+		{route{"get webhook", http.MethodGet, "/api/webhooks/" + webhookB, ""}, http.StatusForbidden},
+		{route{"update webhook", http.MethodPut, "/api/webhooks/" + webhookB, `{"url":"https://attacker.example/hook"}`}, http.StatusForbidden},
+		{route{"delete webhook", http.MethodDelete, "/api/webhooks/" + webhookB, ""}, http.StatusForbidden},
+		{route{"list webhook deliveries", http.MethodGet, "/api/webhooks/" + webhookB + "/deliveries", ""}, http.StatusForbidden},
+		{route{"test webhook", http.MethodPost, "/api/webhooks/" + webhookB + "/test", ""}, http.StatusForbidden},
+		{route{"send foreign segment", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"segment_id":"` + segmentB + `","message":"hi"}`}, http.StatusBadRequest},
+		{route{"send foreign template", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"channel":"bot","template_id":"` + templateB + `"}`}, http.StatusBadRequest},
+		{route{"send to foreign bot subscriber", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"channel":"bot","subscriber_ids":[` + strconv.FormatInt(subscriberB, 10) + `],"message":"hi"}`}, http.StatusBadRequest},
+	}
+
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := srv.do(tc.method, tc.path, tc.body, cookie)
+			if rec.Code != tc.want {
+				t.Fatalf("%s %s: got status %d, want %d: %s", tc.method, tc.path, rec.Code, tc.want, rec.Body.String())
+			}
+			assertKeys(t, decodeObject(t, rec), "error")
+		})
+	}
+
+	// Nothing owned by B may have changed.
+	bob := srv.login(ownerB)
+
+	rec := srv.do(http.MethodGet, "/api/accounts", "", bob)
+	var list struct {
+		Accounts []struct {
+			ID string `json:"id"`
+		} `json:"accounts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Accounts) != 1 || list.Accounts[0].ID != accountB {
+		t.Fatalf("owner B accounts changed: %s", rec.Body.String())
+	}
+
+	rec = srv.do(http.MethodGet, "/api/accounts/"+accountB+"/settings", "", bob)
+	if body := decodeObject(t, rec); body["openai_token"] != "" {
+		t.Fatalf("owner B settings changed: %v", body)
+	}
+
+	rec = srv.do(http.MethodGet, "/api/accounts/"+accountB+"/contacts", "", bob)
+	if body := decodeObject(t, rec); body["count"] != float64(1) {
+		t.Fatalf("owner B contacts changed: %v", body)
+	}
+}
+
+func TestRoutesResponseShapes(t *testing.T) {
+	tests := []struct {
+		route
+		want int
+		keys []string
+	}{
+		{route{"health", http.MethodGet, "/api/health", ""}, http.StatusOK, []string{"status"}},
+		{route{"ready", http.MethodGet, "/api/ready", ""}, http.StatusOK, []string{"status", "checks"}},
+		{route{"auth me", http.MethodGet, "/api/auth/me", ""}, http.StatusOK, []string{"id", "first_name", "auth_date"}},
+		{route{"list accounts", http.MethodGet, "/api/accounts", ""}, http.StatusOK, []string{"accounts"}},
+		{route{"account status history", http.MethodGet, "/api/accounts/" + accountA + "/status-history", ""}, http.StatusOK, []string{"history"}},
+		{route{"missing account status history", http.MethodGet, "/api/accounts/missing/status-history", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"get settings", http.MethodGet, "/api/accounts/" + accountA + "/settings", ""}, http.StatusOK, []string{"has_openai_token", "openai_token", "proxy_url"}},
+		{route{"update settings", http.MethodPut, "/api/accounts/" + accountA + "/settings", `{"openai_token":"sk-test"}`}, http.StatusOK, []string{"account", "proxy_changed"}},
+		{route{"update settings bad proxy", http.MethodPut, "/api/accounts/" + accountA + "/settings", `{"proxy_url":"ftp://host"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"list contacts", http.MethodGet, "/api/accounts/" + accountA + "/contacts", ""}, http.StatusOK, []string{"contacts", "count"}},
+		{route{"list contacts page", http.MethodGet, "/api/accounts/" + accountA + "/contacts?q=carol&sort=created_at&order=desc&limit=1", ""}, http.StatusOK, []string{"contacts", "count", "total"}},
+		{route{"list contacts bad cursor", http.MethodGet, "/api/accounts/" + accountA + "/contacts?cursor=garbage", ""}, http.StatusBadRequest, []string{"error"}},
+		{route{"list contacts bad date", http.MethodGet, "/api/accounts/" + accountA + "/contacts?created_after=yesterday", ""}, http.StatusBadRequest, []string{"error"}},
+		{route{"list missing account contacts", http.MethodGet, "/api/accounts/missing/contacts", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"import chats status", http.MethodGet, "/api/accounts/" + accountA + "/import-chats/status", ""}, http.StatusOK, []string{"active"}},
+		{route{"import chats status unknown job", http.MethodGet, "/api/accounts/" + accountA + "/import-chats/status?job_id=missing", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"update contact", http.MethodPut, "/api/contacts/" + contactA + "/update", `{"first_name":"Caroline","labels":["vip"]}`}, http.StatusOK, []string{"id", "account_id", "first_name", "labels"}},
+		{route{"update contact time zone", http.MethodPut, "/api/contacts/" + contactA + "/update", `{"first_name":"Caroline","time_zone":"Europe/Kyiv"}`}, http.StatusOK, []string{"id", "time_zone"}},
+		{route{"update contact unknown time zone", http.MethodPut, "/api/contacts/" + contactA + "/update", `{"first_name":"Caroline","time_zone":"Mars/Olympus"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"check numbers empty", http.MethodPost, "/api/accounts/" + accountA + "/check-numbers", `{}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"import file empty", http.MethodPost, "/api/accounts/" + accountA + "/import-file", `{"contacts":[]}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"send without contacts", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"message":"hi"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"send without message", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"contact_ids":["` + contactA + `"]}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"send status", http.MethodGet, "/api/accounts/" + accountA + "/send/status?job_id=" + jobA, ""}, http.StatusOK, []string{"id", "account_id", "status", "total", "sent", "failed", "results"}},
+		{route{"send status without job", http.MethodGet, "/api/accounts/" + accountA + "/send/status", ""}, http.StatusBadRequest, []string{"error"}},
+		{route{"send history", http.MethodGet, "/api/accounts/" + accountA + "/send/history", ""}, http.StatusOK, []string{"jobs"}},
+		{route{"send events without job", http.MethodGet, "/api/accounts/" + accountA + "/send/events", ""}, http.StatusBadRequest, []string{"error"}},
+		{route{"list inbox", http.MethodGet, "/api/accounts/" + accountA + "/inbox", ""}, http.StatusOK, []string{"threads", "unread"}},
+		{route{"get inbox thread", http.MethodGet, "/api/accounts/" + accountA + "/inbox/" + contactA, ""}, http.StatusOK, []string{"contact", "messages"}},
+		{route{"list bot subscribers", http.MethodGet, "/api/accounts/" + accountA + "/bot/subscribers", ""}, http.StatusOK, []string{"subscribers", "total", "active", "start_link"}},
+		{route{"send scheduled too far ahead", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"contact_ids":["` + contactA + `"],"message":"hi","scheduled_at":"2999-01-01T00:00:00Z"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"send unknown channel", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"channel":"sms","message":"hi"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"send unknown format", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"contact_ids":["` + contactA + `"],"message":"hi","format":"rtf"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"send broken html", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"contact_ids":["` + contactA + `"],"message":"<b>hi</i>","format":"html"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"send unknown media", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"contact_ids":["` + contactA + `"],"media_ids":["missing"]}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"resume completed job", http.MethodPost, "/api/accounts/" + accountA + "/send/resume", `{"job_id":"` + jobA + `"}`}, http.StatusConflict, []string{"error"}},
+		{route{"cancel completed job", http.MethodPost, "/api/accounts/" + accountA + "/send/cancel", `{"job_id":"` + jobA + `"}`}, http.StatusConflict, []string{"error"}},
+		{route{"upload media", http.MethodPost, "/api/accounts/" + accountA + "/media", uploadBody("photo.png", "png")}, http.StatusOK, []string{"id", "account_id", "kind", "file_name", "mime_type", "size", "created_at"}},
+		{route{"list templates", http.MethodGet, "/api/templates", ""}, http.StatusOK, []string{"templates", "variables"}},
+		{route{"get quiet hours", http.MethodGet, "/api/quiet-hours", ""}, http.StatusOK, []string{"owner_id", "enabled", "start", "end", "time_zone"}},
+		{route{"update quiet hours", http.MethodPut, "/api/quiet-hours", `{"enabled":true,"start":"21:00","end":"09:00","time_zone":"Europe/Berlin"}`}, http.StatusOK, []string{"owner_id", "enabled", "start", "end", "time_zone", "updated_at"}},
+		{route{"update quiet hours empty window", http.MethodPut, "/api/quiet-hours", `{"enabled":true,"start":"21:00","end":"21:00"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"update quiet hours unknown time zone", http.MethodPut, "/api/quiet-hours", `{"enabled":true,"start":"21:00","end":"09:00","time_zone":"Nowhere"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"delivery report", http.MethodGet, "/api/reports/delivery?from=2020-01-01T00:00:00Z", ""}, http.StatusOK, []string{"generated_at", "from", "jobs", "recipients", "by_account", "by_error"}},
+		{route{"delivery report bad date", http.MethodGet, "/api/reports/delivery?from=last-week", ""}, http.StatusBadRequest, []string{"error"}},
+		{route{"delivery report unknown table", http.MethodGet, "/api/reports/delivery?format=csv&table=contacts", ""}, http.StatusBadRequest, []string{"error"}},
+		{route{"delivery report unknown job", http.MethodGet, "/api/reports/delivery?job_id=missing", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"create template", http.MethodPost, "/api/templates", `{"name":"Reminder","format":"markdown","default_language":"en","variants":{"en":"Hi {{.Name}}","de":"Hallo {{.Name}}"}}`}, http.StatusOK, []string{"id", "owner_id", "name", "versions", "created_at", "updated_at"}},
+		{route{"create template unknown variable", http.MethodPost, "/api/templates", `{"name":"Typo","variants":{"en":"Hi {{.Frist}}"}}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"create template without default", http.MethodPost, "/api/templates", `{"name":"Two","variants":{"en":"Hi","de":"Hallo"}}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"create template duplicate name", http.MethodPost, "/api/templates", `{"name":"welcome","variants":{"en":"Hi"}}`}, http.StatusConflict, []string{"error"}},
+		{route{"get template", http.MethodGet, "/api/templates/" + templateA, ""}, http.StatusOK, []string{"id", "owner_id", "name", "versions"}},
+		{route{"get missing template", http.MethodGet, "/api/templates/missing", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"send template and message", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"channel":"bot","template_id":"` + templateA + `","message":"hi"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"send missing template version", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"channel":"bot","template_id":"` + templateA + `","template_version":9}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"send missing template language", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"channel":"bot","template_id":"` + templateA + `","language":"fr"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"add template version", http.MethodPost, "/api/templates/" + templateA + "/versions", `{"name":"Greeting","variants":{"en":"Hey {{.FirstName}}"}}`}, http.StatusOK, []string{"id", "name", "versions"}},
+		{route{"delete template", http.MethodDelete, "/api/templates/" + templateA, ""}, http.StatusOK, []string{"message"}},
+		{route{"list segments", http.MethodGet, "/api/segments", ""}, http.StatusOK, []string{"segments"}},
+		{route{"create segment", http.MethodPost, "/api/segments", `{"name":"Recent","filter":{"labels":["vip","chat"],"label_mode":"any","created_after":"2024-01-01T00:00:00Z"},"exclude_delivery":["failed"]}`}, http.StatusOK, []string{"id", "owner_id", "name", "filter", "exclude_delivery"}},
+		{route{"create segment duplicate name", http.MethodPost, "/api/segments", `{"name":"everyone"}`}, http.StatusConflict, []string{"error"}},
+		{route{"create segment bad delivery", http.MethodPost, "/api/segments", `{"name":"Odd","exclude_delivery":["bounced"]}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"get segment", http.MethodGet, "/api/segments/" + segmentA, ""}, http.StatusOK, []string{"id", "name", "filter"}},
+		{route{"get missing segment", http.MethodGet, "/api/segments/missing", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"update segment", http.MethodPut, "/api/segments/" + segmentA, `{"name":"All contacts","filter":{"q":"carol"}}`}, http.StatusOK, []string{"id", "name", "filter", "updated_at"}},
+		{route{"preview segment", http.MethodGet, "/api/accounts/" + accountA + "/segments/" + segmentA + "/preview", ""}, http.StatusOK, []string{"segment_id", "account_id", "count", "matched", "suppressed", "excluded"}},
+		{route{"send segment and contacts", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"segment_id":"` + segmentA + `","contact_ids":["` + contactA + `"],"message":"hi"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"send segment with bot", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"channel":"bot","segment_id":"` + segmentA + `","message":"hi"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"delete segment", http.MethodDelete, "/api/segments/" + segmentA, ""}, http.StatusOK, []string{"message"}},
+		{route{"list tokens", http.MethodGet, "/api/tokens", ""}, http.StatusOK, []string{"tokens", "scopes"}},
+		{route{"create token", http.MethodPost, "/api/tokens", `{"name":"CI","scopes":["send","contacts:read"],"expires_at":"2099-01-01T00:00:00Z"}`}, http.StatusOK, []string{"id", "owner_id", "name", "scopes", "prefix", "token", "created_at", "expires_at"}},
+		{route{"create token without scopes", http.MethodPost, "/api/tokens", `{"name":"CI","scopes":[]}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"create expired token", http.MethodPost, "/api/tokens", `{"name":"CI","scopes":["send"],"expires_at":"2001-01-01T00:00:00Z"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"list token uses", http.MethodGet, "/api/tokens/" + tokenA + "/uses", ""}, http.StatusOK, []string{"uses"}},
+		{route{"delete missing token", http.MethodDelete, "/api/tokens/missing", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"delete token", http.MethodDelete, "/api/tokens/" + tokenA, ""}, http.StatusOK, []string{"message"}},
+		{route{"list workspaces", http.MethodGet, "/api/workspaces", ""}, http.StatusOK, []string{"workspaces", "roles"}},
+		{route{"create workspace", http.MethodPost, "/api/workspaces", `{"name":"Sales"}`}, http.StatusOK, []string{"id", "name", "personal", "members", "role", "created_at"}},
+		{route{"create workspace without name", http.MethodPost, "/api/workspaces", `{"name":" "}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"get workspace", http.MethodGet, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10), ""}, http.StatusOK, []string{"id", "name", "members", "role"}},
+		{route{"get personal workspace", http.MethodGet, "/api/workspaces/" + strconv.FormatInt(ownerA, 10), ""}, http.StatusOK, []string{"id", "name", "personal", "members", "role"}},
+		{route{"get missing workspace", http.MethodGet, "/api/workspaces/-1", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"invite to personal workspace", http.MethodPost, "/api/workspaces/" + strconv.FormatInt(ownerA, 10) + "/invites", `{"role":"viewer"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"accept invite as member", http.MethodPost, "/api/invites/" + inviteTeam + "/accept", ""}, http.StatusConflict, []string{"error"}},
+		{route{"accept missing invite", http.MethodPost, "/api/invites/missing/accept", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"list team contacts", http.MethodGet, "/api/accounts/" + accountTeam + "/contacts", ""}, http.StatusOK, []string{"contacts", "count"}},
+		{route{"team account status history", http.MethodGet, "/api/accounts/" + accountTeam + "/status-history", ""}, http.StatusOK, []string{"history"}},
+		{route{"leave workspace", http.MethodDelete, "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/members/" + strconv.FormatInt(ownerA, 10), ""}, http.StatusOK, []string{"message"}},
+		{route{"list webhooks", http.MethodGet, "/api/webhooks", ""}, http.StatusOK, []string{"webhooks", "events"}},
+		{route{"create webhook", http.MethodPost, "/api/webhooks", `{"url":"https://example.com/hook","description":"CRM","events":["job.completed","recipient.opted_out"]}`}, http.StatusOK, []string{"id", "owner_id", "url", "events", "active", "secret", "created_at"}},
+		{route{"create webhook bad url", http.MethodPost, "/api/webhooks", `{"url":"ftp://example.com"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"create webhook unknown event", http.MethodPost, "/api/webhooks", `{"url":"https://example.com/hook","events":["job.started"]}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"get webhook", http.MethodGet, "/api/webhooks/" + webhookA, ""}, http.StatusOK, []string{"id", "url", "events", "active"}},
+		{route{"get missing webhook", http.MethodGet, "/api/webhooks/missing", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"test webhook", http.MethodPost, "/api/webhooks/" + webhookA + "/test", ""}, http.StatusOK, []string{"id", "endpoint_id", "event", "status", "attempts", "response_status"}},
+		{route{"list webhook deliveries", http.MethodGet, "/api/webhooks/" + webhookA + "/deliveries", ""}, http.StatusOK, []string{"deliveries"}},
+		{route{"update webhook", http.MethodPut, "/api/webhooks/" + webhookA, `{"url":"https://example.com/other","active":false,"rotate_secret":true}`}, http.StatusOK, []string{"id", "url", "active", "secret", "updated_at"}},
+		{route{"delete webhook", http.MethodDelete, "/api/webhooks/" + webhookA, ""}, http.StatusOK, []string{"message"}},
+		{route{"reply with blank text", http.MethodPost, "/api/accounts/" + accountA + "/inbox/" + contactA + "/reply", `{"text":"  "}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"reply without text", http.MethodPost, "/api/accounts/" + accountA + "/inbox/" + contactA + "/reply", `{}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"import events unknown job", http.MethodGet, "/api/accounts/" + accountA + "/import-chats/events?job_id=missing", ""}, http.StatusNotFound, []string{"error"}},
+		{route{"qr password missing", http.MethodPost, "/api/accounts/qr/password", `{"token":"unknown"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"qr cancel", http.MethodPost, "/api/accounts/qr/cancel", `{"token":"unknown"}`}, http.StatusOK, []string{"message"}},
+		{route{"phone start invalid phone", http.MethodPost, "/api/accounts/phone/start", `{"phone":"12"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"phone code unknown session", http.MethodPost, "/api/accounts/phone/code", `{"token":"unknown","code":"12345"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"phone password missing", http.MethodPost, "/api/accounts/phone/password", `{"token":"unknown"}`}, http.StatusBadRequest, []string{"error"}},
+		{route{"phone cancel", http.MethodPost, "/api/accounts/phone/cancel", `{"token":"unknown"}`}, http.StatusOK, []string{"message"}},
+		{route{"delete contact", http.MethodDelete, "/api/contacts/" + contactA, ""}, http.StatusOK, []string{"message"}},
+		{route{"delete account", http.MethodDelete, "/api/accounts/" + accountA, ""}, http.StatusOK, []string{"message"}},
+		{route{"logout", http.MethodPost, "/api/auth/logout", ""}, http.StatusOK, []string{"message"}},
+	}
+
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := srv.do(tc.method, tc.path, tc.body, cookie)
+			if rec.Code != tc.want {
+				t.Fatalf("%s %s: got status %d, want %d: %s", tc.method, tc.path, rec.Code, tc.want, rec.Body.String())
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("unexpected content type %q", ct)
+			}
+			assertKeys(t, decodeObject(t, rec), tc.keys...)
+		})
+	}
+
+	// The logout above must have invalidated the session.
+	if rec := srv.do(http.MethodGet, "/api/auth/me", "", cookie); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("session still valid after logout: %d", rec.Code)
+	}
+}
+
+func TestExportContactsReturnsOwnContacts(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	rec := srv.do(http.MethodPost, "/api/contacts/export", `{"account_ids":["`+accountA+`"]}`, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var exported []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &exported); err != nil {
+		t.Fatalf("export is not a JSON array: %v", err)
+	}
+	if len(exported) != 1 || exported[0]["id"] != contactA {
+		t.Fatalf("unexpected export: %v", exported)
+	}
+	assertKeys(t, exported[0], "id", "account_id", "telegram_id", "access_hash", "phone", "is_valid")
+}
+
+func TestExportContactsFormats(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	tests := []struct {
+		body        string
+		contentType string
+		want        string
+	}{
+		{`{"account_ids":["` + accountA + `"],"format":"csv","fields":["first_name","phone","labels"]}`, "text/csv; charset=utf-8", "first_name,phone,labels\nCarol,+10000000002,\n"},
+		{`{"account_ids":["` + accountA + `"],"format":"csv","fields":["first_name","phone"],"exclude_pii":true}`, "text/csv; charset=utf-8", "first_name\nCarol\n"},
+		{`{"account_ids":["` + accountA + `"],"format":"vcard","fields":["first_name","phone"]}`, "text/vcard; charset=utf-8", "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Carol\r\nN:;Carol;;;\r\nTEL;VALUE=uri;TYPE=cell:tel:+10000000002\r\nEND:VCARD\r\n"},
+		{`{"account_ids":["` + accountA + `"],"fields":["id","is_valid"]}`, "application/json", "[\n  {\n    \"id\": \"contact-a\",\n    \"is_valid\": true\n  }\n]\n"},
+		{`{"account_ids":["` + accountA + `"],"format":"csv","labels":["vip"]}`, "text/csv; charset=utf-8", "id,account_id,telegram_id,phone,first_name,last_name,username,labels,is_valid,photo,created_at,updated_at,last_delivery,last_delivery_at\n"},
+	}
+
+	for _, tc := range tests {
+		rec := srv.do(http.MethodPost, "/api/contacts/export", tc.body, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Type"); got != tc.contentType {
+			t.Errorf("%s: content type %q, want %q", tc.body, got, tc.contentType)
+		}
+		if got := rec.Body.String(); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.body, got, tc.want)
+		}
+	}
+
+	rec := srv.do(http.MethodPost, "/api/contacts/export", `{"account_ids":["`+accountA+`"],"fields":["ssn"]}`, cookie)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d for an unknown field", rec.Code)
+	}
+}
+
+func TestDeliveryReport(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	rec := srv.do(http.MethodGet, "/api/reports/delivery?job_id="+jobA, "", cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	var report messages.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Recipients) != 1 {
+		t.Fatalf("unexpected recipients: %+v", report.Recipients)
+	}
+	// Carol's inbox message came after the job reached her
+	if row := report.Recipients[0]; row.ContactID != contactA || row.Outcome != messages.OutcomeSent || !row.Replied || row.OptedOut {
+		t.Fatalf("unexpected row: %+v", row)
+	}
+
+	// The interrupted bot job never reached its subscriber
+	rec = srv.do(http.MethodGet, "/api/reports/delivery?account_id="+accountA+"&format=csv&table=accounts", "", cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("content type %q", got)
+	}
+	want := "account_id,jobs,recipients,sent,failed,skipped,not_sent,replied,opted_out\n" + accountA + ",2,2,1,0,0,1,1,0\n"
+	if got := rec.Body.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSendEventsForFinishedJob(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	// The fixture job finished before the server started, so only its final state is sent
+	rec := srv.do(http.MethodGet, "/api/accounts/"+accountA+"/send/events?job_id="+jobA, "", cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	want := `event: status` + "\n" + `data: {"status":"completed","sent":1,"failed":0,"total":1}` + "\n\n"
+	if rec.Body.String() != want {
+		t.Fatalf("unexpected stream:\n%s", rec.Body.String())
+	}
+}
+
+func TestInboxMarkRead(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	unread := func() float64 {
+		t.Helper()
+		rec := srv.do(http.MethodGet, "/api/accounts/"+accountA+"/inbox", "", cookie)
+		return decodeObject(t, rec)["unread"].(float64)
+	}
+
+	if got := unread(); got != 1 {
+		t.Fatalf("got %v unread messages before marking read, want 1", got)
+	}
+
+	rec := srv.do(http.MethodPost, "/api/accounts/"+accountA+"/inbox/"+contactA+"/read", "", cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if got := unread(); got != 0 {
+		t.Fatalf("got %v unread messages after marking read, want 0", got)
+	}
+
+	// Owner B's thread is untouched
+	bob := srv.login(ownerB)
+	rec = srv.do(http.MethodGet, "/api/accounts/"+accountB+"/inbox", "", bob)
+	if got := decodeObject(t, rec)["unread"]; got != float64(1) {
+		t.Fatalf("owner B unread changed: %v", got)
+	}
+}
+
+func TestBotSendJob(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	// No subscriber IDs means every active subscriber of the account
+	rec := srv.do(http.MethodPost, "/api/accounts/"+accountA+"/send", `{"channel":"bot","message":"Hi {{.FirstName}}"}`, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	jobID := decodeObject(t, rec)["id"].(string)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec = srv.do(http.MethodGet, "/api/accounts/"+accountA+"/send/status?job_id="+jobID, "", cookie)
+		body := decodeObject(t, rec)
+		if body["status"] == "completed" {
+			if body["sent"] != float64(1) || body["channel"] != "bot" {
+				t.Fatalf("unexpected job: %v", body)
+			}
+			break
+		}
+		if body["status"] == "failed" || time.Now().After(deadline) {
+			t.Fatalf("job did not complete: %v", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	sent := srv.bot.messages()
+	if len(sent) != 1 || sent[0].Chat.ID != subscriberA || sent[0].Text != "Hi Erin" {
+		t.Fatalf("unexpected bot messages: %+v", sent)
+	}
+}
+
+func TestResumeSendJob(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	rec := srv.do(http.MethodPost, "/api/accounts/"+accountA+"/send/resume", `{"job_id":"`+jobInterrupted+`"}`, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec = srv.do(http.MethodGet, "/api/accounts/"+accountA+"/send/status?job_id="+jobInterrupted, "", cookie)
+		body := decodeObject(t, rec)
+		if body["status"] == "completed" {
+			if body["sent"] != float64(1) || body["error"] != nil {
+				t.Fatalf("unexpected job: %v", body)
+			}
+			break
+		}
+		if body["status"] == "failed" || time.Now().After(deadline) {
+			t.Fatalf("job did not complete: %v", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Markdown reaches the Bot API as HTML
+	sent := srv.bot.messages()
+	if len(sent) != 1 || sent[0].Chat.ID != subscriberA || sent[0].Text != "<b>Hi</b> Erin" {
+		t.Fatalf("unexpected bot messages: %+v", sent)
+	}
+
+	rec = srv.do(http.MethodPost, "/api/accounts/"+accountA+"/send/resume", `{"job_id":"`+jobInterrupted+`"}`, cookie)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("resumed a completed job: %d", rec.Code)
+	}
+}
+
+func TestCancelSendJob(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	rec := srv.do(http.MethodPost, "/api/accounts/"+accountA+"/send/cancel", `{"job_id":"`+jobInterrupted+`"}`, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	if body := decodeObject(t, rec); body["status"] != "cancelled" {
+		t.Fatalf("unexpected job: %v", body)
+	}
+
+	rec = srv.do(http.MethodPost, "/api/accounts/"+accountA+"/send/resume", `{"job_id":"`+jobInterrupted+`"}`, cookie)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("resumed a cancelled job: %d", rec.Code)
+	}
+	if sent := srv.bot.messages(); len(sent) != 0 {
+		t.Fatalf("cancelled job sent messages: %+v", sent)
+	}
+}
+
+func TestWebhookJobCancelled(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	rec := srv.do(http.MethodPost, "/api/accounts/"+accountA+"/send/cancel", `{"job_id":"`+jobInterrupted+`"}`, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Deliveries run in the background
+	deadline := time.Now().Add(5 * time.Second)
+	for len(srv.hooks.events()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	received := srv.hooks.events()
+	if len(received) != 1 {
+		t.Fatalf("got %d deliveries, want 1: %+v", len(received), received)
+	}
+	got := received[0]
+	if got.path != "/a" || got.event.Type != "job.cancelled" || !got.verified {
+		t.Fatalf("unexpected delivery: %+v", got)
+	}
+	if data, _ := got.event.Data.(map[string]any); data["job_id"] != jobInterrupted || data["status"] != "cancelled" {
+		t.Fatalf("unexpected event data: %v", got.event.Data)
+	}
+
+	rec = srv.do(http.MethodGet, "/api/webhooks/"+webhookA+"/deliveries", "", cookie)
+	var body struct {
+		Deliveries []struct {
+			Event    string `json:"event"`
+			Status   string `json:"status"`
+			Attempts int    `json:"attempts"`
+		} `json:"deliveries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Deliveries) != 1 || body.Deliveries[0].Status != "succeeded" || body.Deliveries[0].Attempts != 1 {
+		t.Fatalf("unexpected delivery log: %s", rec.Body.String())
+	}
+}
+
+func TestUploadMedia(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	rec := srv.do(http.MethodPost, "/api/accounts/"+accountA+"/media", uploadBody("report.pdf", "%PDF-1.4"), cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	att := decodeObject(t, rec)
+	if att["kind"] != "document" || att["mime_type"] != "application/pdf" || att["size"] != float64(8) {
+		t.Fatalf("unexpected attachment: %v", att)
+	}
+
+	// The bot channel cannot carry media
+	rec = srv.do(http.MethodPost, "/api/accounts/"+accountA+"/send", `{"channel":"bot","media_ids":["`+att["id"].(string)+`"]}`, cookie)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d for bot media: %s", rec.Code, rec.Body.String())
+	}
+
+	// Attachments are private to the account they were uploaded to
+	bob := srv.login(ownerB)
+	rec = srv.do(http.MethodPost, "/api/accounts/"+accountB+"/send", `{"contact_ids":["`+contactB+`"],"media_ids":["`+att["id"].(string)+`"]}`, bob)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d for a foreign attachment: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSendFromTemplate(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	tests := []struct {
+		body string
+		want messages.TemplateRef
+		text string
+	}{
+		{`{"channel":"bot","template_id":"` + templateA + `","template_version":1}`, messages.TemplateRef{ID: templateA, Name: "Welcome", Version: 1, Language: "en"}, "Hi Erin"},
+		{`{"channel":"bot","template_id":"` + templateA + `","language":"UK"}`, messages.TemplateRef{ID: templateA, Name: "Welcome", Version: 2, Language: "uk"}, "<b>Привіт</b> Erin"},
+	}
+
+	for i, tc := range tests {
+		rec := srv.do(http.MethodPost, "/api/accounts/"+accountA+"/send", tc.body, cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+		}
+		jobID := decodeObject(t, rec)["id"].(string)
+
+		var job messages.SendJob
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			rec = srv.do(http.MethodGet, "/api/accounts/"+accountA+"/send/status?job_id="+jobID, "", cookie)
+			if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+				t.Fatal(err)
+			}
+			if job.Status == messages.JobStatusCompleted {
+				break
+			}
+			if job.Status == messages.JobStatusFailed || time.Now().After(deadline) {
+				t.Fatalf("job did not complete: %+v", job)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		// The job records the exact version it sent
+		if job.Template == nil || *job.Template != tc.want {
+			t.Fatalf("job template = %+v, want %+v", job.Template, tc.want)
+		}
+
+		sent := srv.bot.messages()
+		if len(sent) != i+1 || sent[i].Text != tc.text {
+			t.Fatalf("unexpected bot messages: %+v", sent)
+		}
+	}
+}
+
+func TestSegmentSuppression(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	preview := func() map[string]any {
+		t.Helper()
+		rec := srv.do(http.MethodGet, "/api/accounts/"+accountA+"/segments/"+segmentA+"/preview", "", cookie)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+		}
+		return decodeObject(t, rec)
+	}
+
+	if got := preview(); got["count"] != float64(1) || got["matched"] != float64(1) {
+		t.Fatalf("unexpected preview: %v", got)
+	}
+
+	rec := srv.do(http.MethodPut, "/api/contacts/"+contactA+"/update", `{"first_name":"Carol","suppressed":true}`, cookie)
+	if rec.Code != http.StatusOK || decodeObject(t, rec)["suppressed"] != true {
+		t.Fatalf("suppressing contact: %d %s", rec.Code, rec.Body.String())
+	}
+
+	if got := preview(); got["count"] != float64(0) || got["suppressed"] != float64(1) {
+		t.Fatalf("unexpected preview after suppression: %v", got)
+	}
+
+	// A segment without members does not start a job
+	rec = srv.do(http.MethodPost, "/api/accounts/"+accountA+"/send", `{"segment_id":"`+segmentA+`","message":"hi"}`, cookie)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d for an empty segment: %s", rec.Code, rec.Body.String())
+	}
+
+	// Listing the contact explicitly skips it instead of messaging it
+	rec = srv.do(http.MethodPost, "/api/accounts/"+accountA+"/send", `{"contact_ids":["`+contactA+`"],"message":"hi"}`, cookie)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	jobID := decodeObject(t, rec)["id"].(string)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rec = srv.do(http.MethodGet, "/api/accounts/"+accountA+"/send/status?job_id="+jobID, "", cookie)
+		body := decodeObject(t, rec)
+		if body["status"] == "completed" {
+			results := body["results"].([]any)
+			if body["sent"] != float64(0) || body["failed"] != float64(0) || len(results) != 1 {
+				t.Fatalf("unexpected job: %v", body)
+			}
+			if result := results[0].(map[string]any); result["contact_id"] != contactA || result["error"] != "opted out, skipped" {
+				t.Fatalf("unexpected result: %v", result)
+			}
+			break
+		}
+		if body["status"] == "failed" || time.Now().After(deadline) {
+			t.Fatalf("job did not complete: %v", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Nor can the contact be replied to from the inbox
+	rec = srv.do(http.MethodPost, "/api/accounts/"+accountA+"/inbox/"+contactA+"/reply", `{"text":"hi"}`, cookie)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("got status %d replying to an opted out contact: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBotWebhook(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config) {
+		cfg.BotUpdates = botUpdatesWebhook
+		cfg.BotWebhookURL = "https://example.com/api/bot/webhook"
+		cfg.BotWebhookSecret = "hook-secret"
+	})
+	cookie := srv.login(ownerA)
+
+	start := `{"update_id":1,"message":{"message_id":1,"from":{"id":9100,"is_bot":false,"first_name":"Grace"},"chat":{"id":9100,"type":"private"},"date":1,"text":"/start ` + accountA + `"}}`
+
+	rec := srv.doWithHeader(http.MethodPost, "/api/bot/webhook", start, nil, http.Header{"X-Telegram-Bot-Api-Secret-Token": {"wrong"}})
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d with a wrong secret, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = srv.doWithHeader(http.MethodPost, "/api/bot/webhook", start, nil, http.Header{"X-Telegram-Bot-Api-Secret-Token": {"hook-secret"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = srv.do(http.MethodGet, "/api/accounts/"+accountA+"/bot/subscribers", "", cookie)
+	if body := decodeObject(t, rec); body["active"] != float64(2) {
+		t.Fatalf("webhook /start did not subscribe: %v", body)
+	}
+}
+
+func TestTelegramAuthRejectsBadHash(t *testing.T) {
+	srv := newTestServer(t)
+
+	rec := srv.do(http.MethodPost, "/api/auth/telegram", `{"id":1001,"first_name":"User","auth_date":1,"hash":"bad"}`, nil)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	assertKeys(t, decodeObject(t, rec), "error")
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config) { cfg.MetricsToken = "scrape-me" })
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"no token", nil, http.StatusUnauthorized},
+		{"wrong token", http.Header{"Authorization": {"Bearer nope"}}, http.StatusUnauthorized},
+		{"valid token", http.Header{"Authorization": {"Bearer scrape-me"}}, http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := srv.doWithHeader(http.MethodGet, "/metrics", "", nil, tc.header)
+			if rec.Code != tc.want {
+				t.Fatalf("got status %d, want %d", rec.Code, tc.want)
+			}
+			if tc.want == http.StatusOK && !strings.Contains(rec.Body.String(), "tgsender_telegram_active_connections") {
+				t.Fatalf("metrics output is missing tgsender collectors")
+			}
+		})
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	srv := newTestServer(t)
+
+	rec := srv.do(http.MethodGet, "/api/ready", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	var report health.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	for _, name := range []string{health.CheckDataDir, health.CheckJobs} {
+		if check := report.Checks[name]; check == nil || check.Status != health.StatusOK {
+			t.Fatalf("check %s is not ok: %+v", name, check)
+		}
+	}
+	if _, ok := report.Checks[health.CheckTelegram]; ok {
+		t.Fatal("telegram was checked without being asked for")
+	}
+
+	// The data directory is gone, so nothing can be saved
+	if err := os.RemoveAll(srv.dataDir); err != nil {
+		t.Fatalf("failed to remove data dir: %v", err)
+	}
+	rec = srv.do(http.MethodGet, "/api/ready", "", nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d without a data dir: %s", rec.Code, rec.Body.String())
+	}
+	if body := decodeObject(t, rec); body["status"] != string(health.StatusFail) {
+		t.Fatalf("unexpected report: %v", body)
+	}
+}
+
+func TestReadinessTelegramNeedsToken(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config) { cfg.MetricsToken = "scrape-me" })
+
+	// The local checks stay open to probes ...
+	if rec := srv.do(http.MethodGet, "/api/ready", "", nil); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	// ... but dialing Telegram through every proxy needs the token
+	if rec := srv.do(http.MethodGet, "/api/ready?telegram=true", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d without a token", rec.Code)
+	}
+	wrong := http.Header{}
+	wrong.Set("Authorization", "Bearer guess")
+	if rec := srv.doWithHeader(http.MethodGet, "/api/ready?telegram=true", "", nil, wrong); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d with a wrong token", rec.Code)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	srv := newTestServer(t, func(cfg *config) {
+		cfg.RateLimitPassword = "2/1h"
+		cfg.RateLimitIPHeader = "X-Forwarded-For"
+	})
+	alice := srv.login(ownerA)
+	bob := srv.login(ownerB)
+	body := `{"token":"missing","password":"guess"}`
+
+	// The proxy appends the client IP after whatever the client sent
+	from := func(ip string) http.Header {
+		h := http.Header{}
+		h.Set("X-Forwarded-For", "198.51.100.9, "+ip)
+		return h
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := srv.doWithHeader(http.MethodPost, "/api/accounts/qr/password", body, alice, from("203.0.113.1")); rec.Code != http.StatusBadRequest {
+			t.Fatalf("attempt %d: got %d %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := srv.doWithHeader(http.MethodPost, "/api/accounts/qr/password", body, alice, from("203.0.113.1"))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d %s", rec.Code, rec.Body.String())
+	}
+	if retry, err := strconv.Atoi(rec.Header().Get("Retry-After")); err != nil || retry <= 0 {
+		t.Fatalf("expected a positive Retry-After, got %q", rec.Header().Get("Retry-After"))
+	}
+	assertKeys(t, decodeObject(t, rec), "error")
+
+	// The limit counts per IP ...
+	if rec := srv.doWithHeader(http.MethodPost, "/api/accounts/qr/password", body, bob, from("203.0.113.1")); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("another session from the same IP: got %d", rec.Code)
+	}
+	if rec := srv.doWithHeader(http.MethodPost, "/api/accounts/qr/password", body, bob, from("203.0.113.2")); rec.Code != http.StatusBadRequest {
+		t.Fatalf("another session from another IP: got %d", rec.Code)
+	}
+	// ... and per session
+	if rec := srv.doWithHeader(http.MethodPost, "/api/accounts/qr/password", body, alice, from("203.0.113.3")); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("the same session from another IP: got %d", rec.Code)
+	}
+
+	// Other route groups are not affected
+	if rec := srv.do(http.MethodPost, "/api/accounts/"+accountA+"/check-numbers", `{}`, alice); rec.Code != http.StatusBadRequest {
+		t.Fatalf("check numbers: got %d", rec.Code)
+	}
+}
+
+func TestSpecCoversEveryRoute(t *testing.T) {
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("failed to load spec: %v", err)
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("failed to build router: %v", err)
+	}
+
+	routes := append([]route{
+		{"telegram auth", http.MethodPost, "/api/auth/telegram", ""},
+		{"logout", http.MethodPost, "/api/auth/logout", ""},
+		{"health", http.MethodGet, "/api/health", ""},
+		{"ready", http.MethodGet, "/api/ready", ""},
+		{"openapi", http.MethodGet, "/api/openapi.yaml", ""},
+		{"metrics", http.MethodGet, "/metrics", ""},
+		{"bot webhook", http.MethodPost, "/api/bot/webhook", ""},
+	}, protectedRoutes...)
+
+	for _, tc := range routes {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if _, _, err := router.FindRoute(req); err != nil {
+				t.Fatalf("%s %s is not described by the spec: %v", tc.method, tc.path, err)
+			}
+		})
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	srv := newTestServer(t)
+	bearer := func(secret string) http.Header {
+		return http.Header{"Authorization": []string{"Bearer " + secret}}
+	}
+
+	// Owner A's token reads contacts, but can't send or reach session-only routes
+	rec := srv.doWithHeader(http.MethodGet, "/api/accounts/"+accountA+"/contacts", "", nil, bearer(tokenSecretA))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d reading contacts: %s", rec.Code, rec.Body.String())
+	}
+	rec = srv.doWithHeader(http.MethodPost, "/api/accounts/"+accountA+"/send", `{"contact_ids":["`+contactA+`"],"message":"hi"}`, nil, bearer(tokenSecretA))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d sending without the scope: %s", rec.Code, rec.Body.String())
+	}
+	if rec := srv.doWithHeader(http.MethodGet, "/api/tokens", "", nil, bearer(tokenSecretA)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d listing tokens with a token", rec.Code)
+	}
+
+	// Tokens act for their owner only
+	if rec := srv.doWithHeader(http.MethodGet, "/api/accounts/"+accountB+"/contacts", "", nil, bearer(tokenSecretA)); rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d reading foreign contacts", rec.Code)
+	}
+
+	for _, secret := range []string{tokenSecretExpired, "tgs_unknown"} {
+		if rec := srv.doWithHeader(http.MethodGet, "/api/accounts/"+accountA+"/contacts", "", nil, bearer(secret)); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("got status %d for %s", rec.Code, secret)
+		}
+	}
+
+	// Every accepted request is recorded
+	cookie := srv.login(ownerA)
+	rec = srv.do(http.MethodGet, "/api/tokens/"+tokenA+"/uses", "", cookie)
+	var body struct {
+		Uses []auth.TokenUse `json:"uses"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Uses) != 2 || body.Uses[0].Path != "/api/accounts/"+accountB+"/contacts" || body.Uses[1].Method != http.MethodGet {
+		t.Fatalf("unexpected uses: %s", rec.Body.String())
+	}
+
+	// A new token is shown once and works right away; revoking it stops it
+	rec = srv.do(http.MethodPost, "/api/tokens", `{"name":"Sender","scopes":["send"]}`, cookie)
+	created := decodeObject(t, rec)
+	secret, _ := created["token"].(string)
+	if !strings.HasPrefix(secret, "tgs_") {
+		t.Fatalf("unexpected token: %v", created)
+	}
+	if _, ok := created["hash"]; ok {
+		t.Fatalf("token hash leaked: %v", created)
+	}
+	if rec := srv.doWithHeader(http.MethodGet, "/api/accounts/"+accountA+"/send/history", "", nil, bearer(secret)); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d with a new token: %s", rec.Code, rec.Body.String())
+	}
+	srv.do(http.MethodDelete, "/api/tokens/"+created["id"].(string), "", cookie)
+	if rec := srv.doWithHeader(http.MethodGet, "/api/accounts/"+accountA+"/send/history", "", nil, bearer(secret)); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("got status %d with a revoked token", rec.Code)
+	}
+}
+
+func TestWorkspaceRoles(t *testing.T) {
+	srv := newTestServer(t)
+	alice := srv.login(ownerA)
+	bob := srv.login(ownerB)
+	team := http.Header{}
+	team.Set(workspaces.Header, strconv.FormatInt(workspaceTeam, 10))
+	malformed := http.Header{}
+	malformed.Set(workspaces.Header, "team")
+
+	// As a viewer, owner A sees the team's accounts and contacts but can't change them
+	rec := srv.doWithHeader(http.MethodGet, "/api/accounts", "", alice, team)
+	var list struct {
+		Accounts []struct {
+			ID string `json:"id"`
+		} `json:"accounts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Accounts) != 1 || list.Accounts[0].ID != accountTeam {
+		t.Fatalf("unexpected team accounts: %d %s", rec.Code, rec.Body.String())
+	}
+	createTemplate := `{"name":"Support reply","variants":{"en":"Hi"}}`
+	if rec := srv.doWithHeader(http.MethodPost, "/api/templates", createTemplate, alice, team); rec.Code != http.StatusForbidden {
+		t.Fatalf("viewer created a template: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Promoted to operator, owner A creates a template the whole team sees
+	if rec := srv.do(http.MethodPut, "/api/workspaces/"+strconv.FormatInt(workspaceTeam, 10)+"/members/"+strconv.FormatInt(ownerA, 10), `{"role":"operator"}`, bob); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d promoting: %s", rec.Code, rec.Body.String())
+	}
+	rec = srv.doWithHeader(http.MethodPost, "/api/templates", createTemplate, alice, team)
+	if body := decodeObject(t, rec); rec.Code != http.StatusOK || body["owner_id"] != float64(workspaceTeam) {
+		t.Fatalf("operator could not create a team template: %d %v", rec.Code, body)
+	}
+	rec = srv.doWithHeader(http.MethodGet, "/api/templates", "", bob, team)
+	if !strings.Contains(rec.Body.String(), "Support reply") {
+		t.Fatalf("team template missing for the admin: %s", rec.Body.String())
+	}
+	if rec := srv.do(http.MethodDelete, "/api/accounts/"+accountTeam, "", alice); rec.Code != http.StatusForbidden {
+		t.Fatalf("operator removed a team account: %d", rec.Code)
+	}
+
+	// Someone else can't act in the team without joining it
+	carol := srv.login(3003)
+	if rec := srv.doWithHeader(http.MethodGet, "/api/accounts", "", carol, team); rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d listing a foreign workspace", rec.Code)
+	}
+	if rec := srv.doWithHeader(http.MethodGet, "/api/accounts", "", carol, malformed); rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d for a malformed workspace header", rec.Code)
+	}
+
+	// Invites are used up when accepted
+	if rec := srv.do(http.MethodPost, "/api/invites/"+inviteTeam+"/accept", "", carol); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d accepting: %s", rec.Code, rec.Body.String())
+	}
+	if rec := srv.doWithHeader(http.MethodGet, "/api/accounts/"+accountTeam+"/contacts", "", carol, nil); rec.Code != http.StatusOK {
+		t.Fatalf("got status %d reading team contacts after joining", rec.Code)
+	}
+	if rec := srv.do(http.MethodPost, "/api/invites/"+inviteTeam+"/accept", "", srv.login(4004)); rec.Code != http.StatusNotFound {
+		t.Fatalf("got status %d reusing an invite", rec.Code)
+	}
+
+	// The last admin can neither be demoted nor leave
+	bobPath := "/api/workspaces/" + strconv.FormatInt(workspaceTeam, 10) + "/members/" + strconv.FormatInt(ownerB, 10)
+	if rec := srv.do(http.MethodPut, bobPath, `{"role":"viewer"}`, bob); rec.Code != http.StatusConflict {
+		t.Fatalf("got status %d demoting the last admin", rec.Code)
+	}
+	if rec := srv.do(http.MethodDelete, bobPath, "", bob); rec.Code != http.StatusConflict {
+		t.Fatalf("got status %d removing the last admin", rec.Code)
+	}
+}
+
+// TestTokenScopesMatchSpec checks that exactly the operations marked with
+// x-token-scope accept API tokens, with that scope.
+func TestTokenScopesMatchSpec(t *testing.T) {
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatalf("failed to load spec: %v", err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("failed to build router: %v", err)
+	}
+
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	tokens := make(map[string]string)
+	for _, scope := range auth.Scopes {
+		rec := srv.do(http.MethodPost, "/api/tokens", `{"name":"`+scope+`","scopes":["`+scope+`"]}`, cookie)
+		tokens[scope], _ = decodeObject(t, rec)["token"].(string)
+	}
+
+	for _, tc := range protectedRoutes {
+		t.Run(tc.name, func(t *testing.T) {
+			route, _, err := router.FindRoute(httptest.NewRequest(tc.method, tc.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := route.Operation.Extensions["x-token-scope"].(string)
+
+			for scope, secret := range tokens {
+				header := http.Header{"Authorization": []string{"Bearer " + secret}}
+				rec := srv.doWithHeader(tc.method, tc.path, tc.body, nil, header)
+				switch {
+				case want == "":
+					if rec.Code != http.StatusUnauthorized {
+						t.Errorf("session-only route accepted a %s token: %d", scope, rec.Code)
+					}
+				case scope == want:
+					if rec.Code == http.StatusUnauthorized || rec.Code == http.StatusForbidden {
+						t.Errorf("route rejected a %s token: %d %s", scope, rec.Code, rec.Body.String())
+					}
+				default:
+					if rec.Code != http.StatusForbidden {
+						t.Errorf("route needing %s accepted a %s token: %d", want, scope, rec.Code)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	tests := []route{
+		{"body field of wrong type", http.MethodPost, "/api/accounts/" + accountA + "/send", `{"contact_ids":"` + contactA + `","message":"hi"}`},
+		{"array item of wrong type", http.MethodPost, "/api/accounts/" + accountA + "/check-numbers", `{"phones":[1]}`},
+		{"missing required body field", http.MethodPost, "/api/contacts/export", `{}`},
+		{"malformed body", http.MethodPut, "/api/contacts/" + contactA + "/update", `{"first_name":`},
+		{"missing required query", http.MethodGet, "/api/accounts/qr/status", ""},
+		{"query of wrong type", http.MethodGet, "/api/accounts/" + accountA + "/spam-status?refresh=maybe", ""},
+	}
+
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := srv.do(tc.method, tc.path, tc.body, cookie)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("%s %s: got status %d, want %d: %s", tc.method, tc.path, rec.Code, http.StatusBadRequest, rec.Body.String())
+			}
+			assertKeys(t, decodeObject(t, rec), "error")
+		})
+	}
+}
+
+func TestGeneratedClient(t *testing.T) {
+	srv := newTestServer(t)
+	cookie := srv.login(ownerA)
+
+	server := httptest.NewServer(srv.handler)
+	defer server.Close()
+
+	c, err := client.NewClientWithResponses(server.URL, client.WithRequestEditorFn(func(_ context.Context, req *http.Request) error {
+		req.AddCookie(cookie)
+		return nil
+	}))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	accountsResp, err := c.ListAccountsWithResponse(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("list accounts: %v", err)
+	}
+	if accountsResp.JSON200 == nil || len(accountsResp.JSON200.Accounts) != 1 || accountsResp.JSON200.Accounts[0].Id != accountA {
+		t.Fatalf("unexpected accounts: %d %s", accountsResp.StatusCode(), accountsResp.Body)
+	}
+
+	contactsResp, err := c.ListContactsWithResponse(context.Background(), accountA, nil)
+	if err != nil {
+		t.Fatalf("list contacts: %v", err)
+	}
+	if contactsResp.JSON200 == nil || contactsResp.JSON200.Count != 1 || contactsResp.JSON200.Contacts[0].TelegramId != "7001" {
+		t.Fatalf("unexpected contacts: %d %s", contactsResp.StatusCode(), contactsResp.Body)
+	}
+
+	forbidden, err := c.GetAccountSettingsWithResponse(context.Background(), accountB)
+	if err != nil {
+		t.Fatalf("get settings: %v", err)
+	}
+	if forbidden.JSON403 == nil || forbidden.JSON403.Error == "" {
+		t.Fatalf("expected a 403 error body, got %d %s", forbidden.StatusCode(), forbidden.Body)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -14,8 +15,18 @@ import (
 
 	"github.com/soluchok/tgsender/pkg/accounts"
 	"github.com/soluchok/tgsender/pkg/auth"
+	"github.com/soluchok/tgsender/pkg/botapi"
 	"github.com/soluchok/tgsender/pkg/contacts"
+	"github.com/soluchok/tgsender/pkg/datadir"
+	"github.com/soluchok/tgsender/pkg/health"
+	"github.com/soluchok/tgsender/pkg/inbox"
 	"github.com/soluchok/tgsender/pkg/messages"
+	"github.com/soluchok/tgsender/pkg/metrics"
+	"github.com/soluchok/tgsender/pkg/openapi"
+	"github.com/soluchok/tgsender/pkg/ratelimit"
+	"github.com/soluchok/tgsender/pkg/tracing"
+	"github.com/soluchok/tgsender/pkg/webhooks"
+	"github.com/soluchok/tgsender/pkg/workspaces"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -37,6 +48,137 @@ const (
 	flagStaticDirName  = "static-dir"
 	flagStaticDirValue = ""
 	flagStaticDirUsage = "Directory to serve static files from (e.g., web/dist)"
+
+	flagMetricsTokenName  = "metrics-token"
+	flagMetricsTokenValue = ""
+	flagMetricsTokenUsage = "Bearer token required to scrape /metrics and to check Telegram in /api/ready (empty leaves them open)"
+
+	flagConfigName  = "config"
+	flagConfigValue = ""
+	flagConfigUsage = "Path to a YAML or TOML config file; flags and environment variables override it"
+
+	flagDataDirName  = "data-dir"
+	flagDataDirValue = datadir.Default
+	flagDataDirUsage = "Directory for accounts, contacts, jobs and Telegram sessions"
+
+	flagSessionTTLName  = "session-ttl"
+	flagSessionTTLValue = 24 * time.Hour
+	flagSessionTTLUsage = "Lifetime of a web session"
+
+	flagAuthMaxAgeName  = "auth-max-age"
+	flagAuthMaxAgeValue = 5 * time.Minute
+	flagAuthMaxAgeUsage = "Maximum age of Telegram Login Widget data"
+
+	flagSpamCacheTTLName  = "spam-cache-ttl"
+	flagSpamCacheTTLValue = 10 * time.Minute
+	flagSpamCacheTTLUsage = "How long @SpamBot check results are cached"
+
+	flagImportTimeoutName  = "import-timeout"
+	flagImportTimeoutValue = 6 * time.Hour
+	flagImportTimeoutUsage = "Maximum duration of a contact import job"
+
+	flagJobCleanupDelayName  = "job-cleanup-delay"
+	flagJobCleanupDelayValue = 5 * time.Minute
+	flagJobCleanupDelayUsage = "How long finished import jobs stay available for status queries"
+
+	flagWebhookMaxAttemptsName  = "webhook-max-attempts"
+	flagWebhookMaxAttemptsValue = webhooks.DefaultMaxAttempts
+	flagWebhookMaxAttemptsUsage = "How often a webhook delivery is tried before it is given up"
+
+	flagWebhookRetryDelayName  = "webhook-retry-delay"
+	flagWebhookRetryDelayValue = webhooks.DefaultRetryDelay
+	flagWebhookRetryDelayUsage = "Wait before the first webhook retry, doubled after every further attempt"
+
+	flagWebhookAllowPrivateName  = "webhook-allow-private"
+	flagWebhookAllowPrivateValue = false
+	flagWebhookAllowPrivateUsage = "Let webhooks reach loopback, private and link-local addresses"
+
+	flagInboxListenerName  = "inbox-listener"
+	flagInboxListenerValue = true
+	flagInboxListenerUsage = "Keep linked accounts connected to collect replies into the inbox"
+
+	flagHealthCheckIntervalName  = "health-check-interval"
+	flagHealthCheckIntervalValue = accounts.DefaultCheckInterval
+	flagHealthCheckIntervalUsage = "How often every account's session is validated in the background (0 disables)"
+
+	flagHealthCheckJitterName  = "health-check-jitter"
+	flagHealthCheckJitterValue = accounts.DefaultCheckJitter
+	flagHealthCheckJitterUsage = "Longest random delay before each background validation, to spread them out"
+
+	flagHealthCheckConcurrencyName  = "health-check-concurrency"
+	flagHealthCheckConcurrencyValue = accounts.DefaultCheckConcurrency
+	flagHealthCheckConcurrencyUsage = "How many accounts are validated in the background at the same time"
+
+	flagRateLimitLoginName  = "rate-limit-login"
+	flagRateLimitLoginValue = "10/1m"
+	flagRateLimitLoginUsage = "Telegram logins and phone login codes requested per client IP, as <requests>/<period> (off disables)"
+
+	flagRateLimitPasswordName  = "rate-limit-password"
+	flagRateLimitPasswordValue = "5/1m"
+	flagRateLimitPasswordUsage = "2FA password and login code submissions allowed per client IP and per session, as <requests>/<period>"
+
+	flagRateLimitCheckNumbersName  = "rate-limit-check-numbers"
+	flagRateLimitCheckNumbersValue = "10/1m"
+	flagRateLimitCheckNumbersUsage = "Phone number checks allowed per client IP and per session, as <requests>/<period>"
+
+	flagRateLimitTestProxyName  = "rate-limit-test-proxy"
+	flagRateLimitTestProxyValue = "10/1m"
+	flagRateLimitTestProxyUsage = "Proxy tests allowed per client IP and per session, as <requests>/<period>"
+
+	flagRateLimitIPHeaderName  = "rate-limit-ip-header"
+	flagRateLimitIPHeaderValue = ""
+	flagRateLimitIPHeaderUsage = "Header a reverse proxy puts the client IP in, e.g. X-Forwarded-For (empty uses the connection)"
+
+	flagDeliveryBotTokenName  = "delivery-bot-token"
+	flagDeliveryBotTokenValue = ""
+	flagDeliveryBotTokenUsage = "Bot token for the bot delivery channel (defaults to bot-token)"
+
+	flagBotAPIURLName  = "bot-api-url"
+	flagBotAPIURLValue = "https://api.telegram.org"
+	flagBotAPIURLUsage = "Base URL of the Telegram Bot API"
+
+	flagBotUpdatesName  = "bot-updates"
+	flagBotUpdatesValue = botUpdatesOff
+	flagBotUpdatesUsage = "How the delivery bot receives /start and /stop: off, poll or webhook"
+
+	flagBotWebhookURLName  = "bot-webhook-url"
+	flagBotWebhookURLValue = ""
+	flagBotWebhookURLUsage = "Public URL of /api/bot/webhook, required with --bot-updates=webhook"
+
+	flagBotWebhookSecretName  = "bot-webhook-secret"
+	flagBotWebhookSecretValue = ""
+	flagBotWebhookSecretUsage = "Secret Telegram sends with every webhook request, required with --bot-updates=webhook"
+
+	flagReadyStuckAfterName  = "ready-stuck-after"
+	flagReadyStuckAfterValue = 30 * time.Minute
+	flagReadyStuckAfterUsage = "How long a running job may go without progress before /api/ready reports it as stuck"
+
+	flagTracingEndpointName  = "tracing-endpoint"
+	flagTracingEndpointValue = ""
+	flagTracingEndpointUsage = "OTLP/HTTP collector spans are exported to, as host:port or URL (empty disables tracing)"
+
+	flagTracingInsecureName  = "tracing-insecure"
+	flagTracingInsecureValue = false
+	flagTracingInsecureUsage = "Export spans over plain HTTP to a host:port tracing-endpoint"
+
+	flagTracingSampleRatioName  = "tracing-sample-ratio"
+	flagTracingSampleRatioValue = 1.0
+	flagTracingSampleRatioUsage = "Share of traces that are recorded, from 0 to 1"
+)
+
+// Route groups with their own rate limits
+const (
+	rateGroupLogin        = "login"
+	rateGroupPassword     = "password"
+	rateGroupCheckNumbers = "check-numbers"
+	rateGroupTestProxy    = "test-proxy"
+)
+
+// Modes of receiving delivery bot updates
+const (
+	botUpdatesOff     = "off"
+	botUpdatesPoll    = "poll"
+	botUpdatesWebhook = "webhook"
 )
 
 func New() *cobra.Command {
@@ -49,114 +191,80 @@ func New() *cobra.Command {
 			viper.BindPFlag(flagBotTokenName, cmd.PersistentFlags().Lookup(flagBotTokenName))
 			viper.BindPFlag(flagListenAddrName, cmd.PersistentFlags().Lookup(flagListenAddrName))
 			viper.BindPFlag(flagStaticDirName, cmd.PersistentFlags().Lookup(flagStaticDirName))
+			viper.BindPFlag(flagMetricsTokenName, cmd.PersistentFlags().Lookup(flagMetricsTokenName))
+			viper.BindPFlag(flagConfigName, cmd.PersistentFlags().Lookup(flagConfigName))
+			viper.BindPFlag(flagDataDirName, cmd.PersistentFlags().Lookup(flagDataDirName))
+			viper.BindPFlag(flagSessionTTLName, cmd.PersistentFlags().Lookup(flagSessionTTLName))
+			viper.BindPFlag(flagAuthMaxAgeName, cmd.PersistentFlags().Lookup(flagAuthMaxAgeName))
+			viper.BindPFlag(flagSpamCacheTTLName, cmd.PersistentFlags().Lookup(flagSpamCacheTTLName))
+			viper.BindPFlag(flagImportTimeoutName, cmd.PersistentFlags().Lookup(flagImportTimeoutName))
+			viper.BindPFlag(flagJobCleanupDelayName, cmd.PersistentFlags().Lookup(flagJobCleanupDelayName))
+			viper.BindPFlag(flagWebhookMaxAttemptsName, cmd.PersistentFlags().Lookup(flagWebhookMaxAttemptsName))
+			viper.BindPFlag(flagWebhookRetryDelayName, cmd.PersistentFlags().Lookup(flagWebhookRetryDelayName))
+			viper.BindPFlag(flagWebhookAllowPrivateName, cmd.PersistentFlags().Lookup(flagWebhookAllowPrivateName))
+			viper.BindPFlag(flagInboxListenerName, cmd.PersistentFlags().Lookup(flagInboxListenerName))
+			viper.BindPFlag(flagHealthCheckIntervalName, cmd.PersistentFlags().Lookup(flagHealthCheckIntervalName))
+			viper.BindPFlag(flagHealthCheckJitterName, cmd.PersistentFlags().Lookup(flagHealthCheckJitterName))
+			viper.BindPFlag(flagHealthCheckConcurrencyName, cmd.PersistentFlags().Lookup(flagHealthCheckConcurrencyName))
+			viper.BindPFlag(flagRateLimitLoginName, cmd.PersistentFlags().Lookup(flagRateLimitLoginName))
+			viper.BindPFlag(flagRateLimitPasswordName, cmd.PersistentFlags().Lookup(flagRateLimitPasswordName))
+			viper.BindPFlag(flagRateLimitCheckNumbersName, cmd.PersistentFlags().Lookup(flagRateLimitCheckNumbersName))
+			viper.BindPFlag(flagRateLimitTestProxyName, cmd.PersistentFlags().Lookup(flagRateLimitTestProxyName))
+			viper.BindPFlag(flagRateLimitIPHeaderName, cmd.PersistentFlags().Lookup(flagRateLimitIPHeaderName))
+			viper.BindPFlag(flagDeliveryBotTokenName, cmd.PersistentFlags().Lookup(flagDeliveryBotTokenName))
+			viper.BindPFlag(flagBotAPIURLName, cmd.PersistentFlags().Lookup(flagBotAPIURLName))
+			viper.BindPFlag(flagBotUpdatesName, cmd.PersistentFlags().Lookup(flagBotUpdatesName))
+			viper.BindPFlag(flagBotWebhookURLName, cmd.PersistentFlags().Lookup(flagBotWebhookURLName))
+			viper.BindPFlag(flagBotWebhookSecretName, cmd.PersistentFlags().Lookup(flagBotWebhookSecretName))
+			viper.BindPFlag(flagReadyStuckAfterName, cmd.PersistentFlags().Lookup(flagReadyStuckAfterName))
+			viper.BindPFlag(flagTracingEndpointName, cmd.PersistentFlags().Lookup(flagTracingEndpointName))
+			viper.BindPFlag(flagTracingInsecureName, cmd.PersistentFlags().Lookup(flagTracingInsecureName))
+			viper.BindPFlag(flagTracingSampleRatioName, cmd.PersistentFlags().Lookup(flagTracingSampleRatioName))
 		},
 		RunE: func(cmd *cobra.Command, _ []string) error {
 			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM, os.Kill)
 			defer cancel()
 
-			var cfg *config
-			if err := errors.Join(viper.Unmarshal(&cfg), cfg.Validate()); err != nil {
+			cfg, err := loadConfig(viper.GetViper())
+			if err != nil {
 				return err
 			}
 
-			// Initialize auth handler
-			authHandler := auth.NewHandler(
-				cfg.BotToken,
-				24*time.Hour,  // Session TTL
-				5*time.Minute, // Max age for Telegram auth data
-			)
+			slog.Info("effective config", "config", cfg)
 
-			// Initialize accounts store
-			accountStore, err := accounts.NewStore(".data")
+			// CLI commands that change the stores refuse to run while this lock is held
+			unlock, err := datadir.New(cfg.DataDir).LockServe()
 			if err != nil {
 				return err
 			}
+			defer unlock()
 
-			// Initialize QR auth manager
-			qrManager := accounts.NewQRAuthManager(accountStore, cfg.AppID, cfg.AppHash)
-
-			// Initialize session validator
-			accountValidator := accounts.NewValidator(accountStore, cfg.AppID, cfg.AppHash)
-
-			// Initialize spam checker
-			spamChecker := accounts.NewSpamChecker(accountStore, cfg.AppID, cfg.AppHash)
-
-			// Initialize accounts handler
-			accountsHandler := accounts.NewHandler(accountStore, qrManager, accountValidator, spamChecker, authHandler)
-
-			// Initialize contacts store and handler
-			contactStore, err := contacts.NewStore(".data")
+			shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+				Endpoint:    cfg.TracingEndpoint,
+				Insecure:    cfg.TracingInsecure,
+				SampleRatio: cfg.TracingSampleRatio,
+			})
 			if err != nil {
 				return err
 			}
-			contactChecker := contacts.NewChecker(contactStore, cfg.AppID, cfg.AppHash)
-			jobManager := contacts.NewJobManager(contactChecker)
-			contactsHandler := contacts.NewHandler(contactStore, contactChecker, accountStore, authHandler, jobManager)
-
-			var mux = http.NewServeMux()
-
-			// Auth routes
-			mux.HandleFunc("/api/auth/telegram", authHandler.HandleTelegramAuth)
-			mux.HandleFunc("/api/auth/me", authHandler.HandleMe)
-			mux.HandleFunc("/api/auth/logout", authHandler.HandleLogout)
-
-			// Accounts routes
-			mux.HandleFunc("/api/accounts", accountsHandler.HandleListAccounts)
-			mux.HandleFunc("/api/accounts/{id}", accountsHandler.HandleDeleteAccount)
-			mux.HandleFunc("/api/accounts/{id}/validate", accountsHandler.HandleValidateAccount)
-			mux.HandleFunc("/api/accounts/{id}/spam-status", accountsHandler.HandleCheckSpamStatus)
-			mux.HandleFunc("/api/accounts/{id}/settings", func(w http.ResponseWriter, r *http.Request) {
-				if r.Method == http.MethodGet {
-					accountsHandler.HandleGetSettings(w, r)
-				} else if r.Method == http.MethodPut {
-					accountsHandler.HandleUpdateSettings(w, r)
-				} else {
-					http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			defer func() {
+				// ctx is already cancelled here, flushing needs a fresh deadline
+				flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				if err := shutdownTracing(flushCtx); err != nil {
+					slog.Warn("failed to flush spans", "error", err)
 				}
-			})
-			mux.HandleFunc("/api/accounts/qr/start", accountsHandler.HandleStartQRAuth)
-			mux.HandleFunc("/api/accounts/qr/status", accountsHandler.HandleQRAuthStatus)
-			mux.HandleFunc("/api/accounts/qr/cancel", accountsHandler.HandleCancelQRAuth)
-			mux.HandleFunc("/api/accounts/qr/password", accountsHandler.HandleSubmitPassword)
-			mux.HandleFunc("/api/accounts/{id}/test-proxy", accountsHandler.HandleTestProxy)
-
-			// Contacts routes
-			mux.HandleFunc("/api/accounts/{id}/check-numbers", contactsHandler.HandleCheckNumbers)
-			mux.HandleFunc("/api/accounts/{id}/contacts", contactsHandler.HandleListContacts)
-			mux.HandleFunc("/api/accounts/{id}/import-chats", contactsHandler.HandleImportFromChats)
-			mux.HandleFunc("/api/accounts/{id}/import-chats/status", contactsHandler.HandleImportFromChatsStatus)
-			mux.HandleFunc("/api/accounts/{id}/import-contacts", contactsHandler.HandleImportContacts)
-			mux.HandleFunc("/api/accounts/{id}/import-file", contactsHandler.HandleImportFromFile)
-			mux.HandleFunc("/api/contacts/export", contactsHandler.HandleExportContacts)
-			mux.HandleFunc("/api/contacts/{id}", contactsHandler.HandleDeleteContact)
-			mux.HandleFunc("/api/contacts/{id}/update", contactsHandler.HandleUpdateContact)
-
-			// Messages routes
-			messageSender := messages.NewSender(contactStore, cfg.AppID, cfg.AppHash)
-			jobStore, err := messages.NewJobStore(".data")
+			}()
+
+			handler, shutdown, err := newHandler(cfg)
 			if err != nil {
 				return err
 			}
-			messagesHandler := messages.NewHandler(messageSender, jobStore, accountStore, authHandler)
-			mux.HandleFunc("/api/accounts/{id}/send", messagesHandler.HandleSendMessages)
-			mux.HandleFunc("/api/accounts/{id}/send/status", messagesHandler.HandleSendStatus)
-			mux.HandleFunc("/api/accounts/{id}/send/history", messagesHandler.HandleSendHistory)
-
-			// Health check
-			mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
-				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-			})
-
-			// Serve static files if configured
-			if cfg.StaticDir != "" {
-				slog.Info("serving static files", "dir", cfg.StaticDir)
-				mux.Handle("/", spaHandler(cfg.StaticDir))
-			}
+			defer shutdown()
 
 			var server = &http.Server{
 				Addr:    cfg.ListenAddr,
-				Handler: corsMiddleware(mux),
+				Handler: corsMiddleware(tracing.Middleware(metrics.Middleware(handler))),
 			}
 			context.AfterFunc(ctx, func() { server.Close() })
 
@@ -176,10 +284,466 @@ func New() *cobra.Command {
 	cmd.PersistentFlags().String(flagBotTokenName, "", flagBotTokenUsage)
 	cmd.PersistentFlags().String(flagListenAddrName, flagListenAddrValue, flagListenAddrUsage)
 	cmd.PersistentFlags().String(flagStaticDirName, flagStaticDirValue, flagStaticDirUsage)
+	cmd.PersistentFlags().String(flagMetricsTokenName, flagMetricsTokenValue, flagMetricsTokenUsage)
+	cmd.PersistentFlags().String(flagConfigName, flagConfigValue, flagConfigUsage)
+	cmd.PersistentFlags().String(flagDataDirName, flagDataDirValue, flagDataDirUsage)
+	cmd.PersistentFlags().Duration(flagSessionTTLName, flagSessionTTLValue, flagSessionTTLUsage)
+	cmd.PersistentFlags().Duration(flagAuthMaxAgeName, flagAuthMaxAgeValue, flagAuthMaxAgeUsage)
+	cmd.PersistentFlags().Duration(flagSpamCacheTTLName, flagSpamCacheTTLValue, flagSpamCacheTTLUsage)
+	cmd.PersistentFlags().Duration(flagImportTimeoutName, flagImportTimeoutValue, flagImportTimeoutUsage)
+	cmd.PersistentFlags().Duration(flagJobCleanupDelayName, flagJobCleanupDelayValue, flagJobCleanupDelayUsage)
+	cmd.PersistentFlags().Int(flagWebhookMaxAttemptsName, flagWebhookMaxAttemptsValue, flagWebhookMaxAttemptsUsage)
+	cmd.PersistentFlags().Duration(flagWebhookRetryDelayName, flagWebhookRetryDelayValue, flagWebhookRetryDelayUsage)
+	cmd.PersistentFlags().Bool(flagWebhookAllowPrivateName, flagWebhookAllowPrivateValue, flagWebhookAllowPrivateUsage)
+	cmd.PersistentFlags().Bool(flagInboxListenerName, flagInboxListenerValue, flagInboxListenerUsage)
+	cmd.PersistentFlags().Duration(flagHealthCheckIntervalName, flagHealthCheckIntervalValue, flagHealthCheckIntervalUsage)
+	cmd.PersistentFlags().Duration(flagHealthCheckJitterName, flagHealthCheckJitterValue, flagHealthCheckJitterUsage)
+	cmd.PersistentFlags().Int(flagHealthCheckConcurrencyName, flagHealthCheckConcurrencyValue, flagHealthCheckConcurrencyUsage)
+	cmd.PersistentFlags().String(flagRateLimitLoginName, flagRateLimitLoginValue, flagRateLimitLoginUsage)
+	cmd.PersistentFlags().String(flagRateLimitPasswordName, flagRateLimitPasswordValue, flagRateLimitPasswordUsage)
+	cmd.PersistentFlags().String(flagRateLimitCheckNumbersName, flagRateLimitCheckNumbersValue, flagRateLimitCheckNumbersUsage)
+	cmd.PersistentFlags().String(flagRateLimitTestProxyName, flagRateLimitTestProxyValue, flagRateLimitTestProxyUsage)
+	cmd.PersistentFlags().String(flagRateLimitIPHeaderName, flagRateLimitIPHeaderValue, flagRateLimitIPHeaderUsage)
+	cmd.PersistentFlags().String(flagDeliveryBotTokenName, flagDeliveryBotTokenValue, flagDeliveryBotTokenUsage)
+	cmd.PersistentFlags().String(flagBotAPIURLName, flagBotAPIURLValue, flagBotAPIURLUsage)
+	cmd.PersistentFlags().String(flagBotUpdatesName, flagBotUpdatesValue, flagBotUpdatesUsage)
+	cmd.PersistentFlags().String(flagBotWebhookURLName, flagBotWebhookURLValue, flagBotWebhookURLUsage)
+	cmd.PersistentFlags().String(flagBotWebhookSecretName, flagBotWebhookSecretValue, flagBotWebhookSecretUsage)
+	cmd.PersistentFlags().Duration(flagReadyStuckAfterName, flagReadyStuckAfterValue, flagReadyStuckAfterUsage)
+	cmd.PersistentFlags().String(flagTracingEndpointName, flagTracingEndpointValue, flagTracingEndpointUsage)
+	cmd.PersistentFlags().Bool(flagTracingInsecureName, flagTracingInsecureValue, flagTracingInsecureUsage)
+	cmd.PersistentFlags().Float64(flagTracingSampleRatioName, flagTracingSampleRatioValue, flagTracingSampleRatioUsage)
 
 	return cmd
 }
 
+// loadConfig reads the optional config file and merges it with flags and
+// environment variables, which take precedence.
+func loadConfig(v *viper.Viper) (*config, error) {
+	if path := v.GetString(flagConfigName); path != "" {
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+	}
+
+	var cfg config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to decode config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// newHandler wires the stores, managers and handlers together, registers every API route
+// and validates requests against the OpenAPI document. Call the returned shutdown once the
+// server has stopped to save what the stores keep in memory.
+func newHandler(cfg *config) (http.Handler, func(), error) {
+	// Initialize auth handler with API tokens
+	tokenStore, err := auth.NewTokenStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	authHandler := auth.NewHandler(cfg.BotToken, cfg.SessionTTL, cfg.AuthMaxAge).WithTokenStore(tokenStore)
+	// Routes wrapped with allowTokens also accept API tokens with the scope
+	allowTokens := authHandler.AllowTokens
+
+	// Rate limits of the route groups open to brute force and abuse, per client
+	// IP and per session
+	rateLimits, err := cfg.RateLimits()
+	if err != nil {
+		return nil, nil, err
+	}
+	guard := ratelimit.NewGuard(authHandler.SessionKey).WithIPHeader(cfg.RateLimitIPHeader)
+	limit := func(group string, next http.HandlerFunc) http.HandlerFunc {
+		return guard.Limit(group, rateLimits[group], next)
+	}
+
+	// Team workspaces, which every ownership check goes through
+	workspaceStore, err := workspaces.NewStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Initialize accounts store
+	accountStore, err := accounts.NewStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Sessions of earlier CLI versions become the sessions of their accounts
+	if err := accountStore.MigrateLegacySessions(); err != nil {
+		slog.Error("failed to migrate legacy sessions", "error", err)
+	}
+
+	// Outbound webhooks, resuming deliveries interrupted by a restart
+	webhookStore, err := webhooks.NewStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	webhookDispatcher := webhooks.NewDispatcher(webhookStore, func(accountID string) (int64, bool) {
+		account, ok := accountStore.Get(accountID)
+		if !ok {
+			return 0, false
+		}
+		return account.OwnerID, true
+	}).WithRetry(cfg.WebhookMaxAttempts, cfg.WebhookRetryDelay).
+		WithPrivateNetworks(cfg.WebhookAllowPrivate)
+	webhookDispatcher.Resume()
+
+	// Initialize QR auth manager
+	qrManager := accounts.NewQRAuthManager(accountStore, cfg.AppID, cfg.AppHash)
+
+	// Initialize phone code auth manager
+	phoneAuthManager := accounts.NewPhoneAuthManager(accountStore, cfg.AppID, cfg.AppHash)
+
+	// Initialize session validator
+	accountValidator := accounts.NewValidator(accountStore, cfg.AppID, cfg.AppHash).WithWebhooks(webhookDispatcher)
+
+	// Validate every account in the background to notice revoked sessions early
+	if cfg.HealthCheckInterval > 0 {
+		monitor := accounts.NewMonitor(accountStore, accountValidator).
+			WithInterval(cfg.HealthCheckInterval).
+			WithJitter(cfg.HealthCheckJitter).
+			WithConcurrency(cfg.HealthCheckConcurrency)
+		go monitor.Run(context.Background())
+	}
+
+	// Initialize spam checker
+	spamChecker := accounts.NewSpamChecker(accountStore, cfg.AppID, cfg.AppHash).
+		WithCacheTTL(cfg.SpamCacheTTL).
+		WithWebhooks(webhookDispatcher)
+
+	// Initialize accounts handler
+	accountsHandler := accounts.NewHandler(accountStore, qrManager, accountValidator, spamChecker, authHandler).
+		WithWorkspaces(workspaceStore).
+		WithPhoneAuth(phoneAuthManager)
+
+	// Initialize contacts store and handler
+	contactStore, err := contacts.NewStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	contactChecker := contacts.NewChecker(contactStore, cfg.AppID, cfg.AppHash)
+	jobManager := contacts.NewJobManager(contactChecker).
+		WithTimeout(cfg.ImportTimeout).
+		WithCleanupDelay(cfg.JobCleanupDelay)
+	segmentStore, err := contacts.NewSegmentStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	contactsHandler := contacts.NewHandler(contactStore, contactChecker, accountStore, authHandler, jobManager).
+		WithSegmentStore(segmentStore).
+		WithWebhooks(webhookDispatcher).
+		WithWorkspaces(workspaceStore)
+
+	var mux = http.NewServeMux()
+
+	// Auth routes
+	mux.HandleFunc("/api/auth/telegram", limit(rateGroupLogin, authHandler.HandleTelegramAuth))
+	mux.HandleFunc("/api/auth/me", authHandler.HandleMe)
+	mux.HandleFunc("/api/auth/logout", authHandler.HandleLogout)
+
+	// API token routes, session only
+	mux.HandleFunc("/api/tokens", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			authHandler.HandleListTokens(w, r)
+		} else if r.Method == http.MethodPost {
+			authHandler.HandleCreateToken(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/tokens/{id}", authHandler.HandleDeleteToken)
+	mux.HandleFunc("/api/tokens/{id}/uses", authHandler.HandleListTokenUses)
+
+	// Workspace routes, session only
+	workspacesHandler := workspaces.NewHandler(workspaceStore, authHandler)
+	mux.HandleFunc("/api/workspaces", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			workspacesHandler.HandleListWorkspaces(w, r)
+		} else if r.Method == http.MethodPost {
+			workspacesHandler.HandleCreateWorkspace(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/workspaces/{id}", workspacesHandler.HandleGetWorkspace)
+	mux.HandleFunc("/api/workspaces/{id}/members/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			workspacesHandler.HandleUpdateMember(w, r)
+		} else if r.Method == http.MethodDelete {
+			workspacesHandler.HandleRemoveMember(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/workspaces/{id}/invites", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			workspacesHandler.HandleListInvites(w, r)
+		} else if r.Method == http.MethodPost {
+			workspacesHandler.HandleCreateInvite(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/workspaces/{id}/invites/{code}", workspacesHandler.HandleDeleteInvite)
+	mux.HandleFunc("/api/invites/{code}/accept", workspacesHandler.HandleAcceptInvite)
+
+	// Accounts routes
+	mux.HandleFunc("/api/accounts", allowTokens(auth.ScopeAccounts, accountsHandler.HandleListAccounts))
+	mux.HandleFunc("/api/accounts/{id}", allowTokens(auth.ScopeAccounts, accountsHandler.HandleDeleteAccount))
+	mux.HandleFunc("/api/accounts/{id}/validate", allowTokens(auth.ScopeAccounts, accountsHandler.HandleValidateAccount))
+	mux.HandleFunc("/api/accounts/{id}/status-history", allowTokens(auth.ScopeAccounts, accountsHandler.HandleStatusHistory))
+	mux.HandleFunc("/api/accounts/{id}/spam-status", allowTokens(auth.ScopeAccounts, accountsHandler.HandleCheckSpamStatus))
+	mux.HandleFunc("/api/accounts/{id}/settings", allowTokens(auth.ScopeAccounts, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			accountsHandler.HandleGetSettings(w, r)
+		} else if r.Method == http.MethodPut {
+			accountsHandler.HandleUpdateSettings(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	mux.HandleFunc("/api/accounts/qr/start", allowTokens(auth.ScopeAccounts, accountsHandler.HandleStartQRAuth))
+	mux.HandleFunc("/api/accounts/qr/status", allowTokens(auth.ScopeAccounts, accountsHandler.HandleQRAuthStatus))
+	mux.HandleFunc("/api/accounts/qr/cancel", allowTokens(auth.ScopeAccounts, accountsHandler.HandleCancelQRAuth))
+	mux.HandleFunc("/api/accounts/qr/password", allowTokens(auth.ScopeAccounts, limit(rateGroupPassword, accountsHandler.HandleSubmitPassword)))
+	mux.HandleFunc("/api/accounts/phone/start", allowTokens(auth.ScopeAccounts, limit(rateGroupLogin, accountsHandler.HandleStartPhoneAuth)))
+	mux.HandleFunc("/api/accounts/phone/status", allowTokens(auth.ScopeAccounts, accountsHandler.HandlePhoneAuthStatus))
+	mux.HandleFunc("/api/accounts/phone/code", allowTokens(auth.ScopeAccounts, limit(rateGroupPassword, accountsHandler.HandleSubmitPhoneCode)))
+	mux.HandleFunc("/api/accounts/phone/password", allowTokens(auth.ScopeAccounts, limit(rateGroupPassword, accountsHandler.HandleSubmitPhonePassword)))
+	mux.HandleFunc("/api/accounts/phone/cancel", allowTokens(auth.ScopeAccounts, accountsHandler.HandleCancelPhoneAuth))
+	mux.HandleFunc("/api/accounts/{id}/test-proxy", allowTokens(auth.ScopeAccounts, limit(rateGroupTestProxy, accountsHandler.HandleTestProxy)))
+
+	// Contacts routes
+	mux.HandleFunc("/api/accounts/{id}/check-numbers", limit(rateGroupCheckNumbers, contactsHandler.HandleCheckNumbers))
+	mux.HandleFunc("/api/accounts/{id}/contacts", allowTokens(auth.ScopeContactsRead, contactsHandler.HandleListContacts))
+	mux.HandleFunc("/api/accounts/{id}/import-chats", contactsHandler.HandleImportFromChats)
+	mux.HandleFunc("/api/accounts/{id}/import-chats/status", contactsHandler.HandleImportFromChatsStatus)
+	mux.HandleFunc("/api/accounts/{id}/import-chats/events", contactsHandler.HandleImportEvents)
+	mux.HandleFunc("/api/accounts/{id}/import-contacts", contactsHandler.HandleImportContacts)
+	mux.HandleFunc("/api/accounts/{id}/import-file", contactsHandler.HandleImportFromFile)
+	mux.HandleFunc("/api/contacts/export", allowTokens(auth.ScopeContactsRead, contactsHandler.HandleExportContacts))
+	mux.HandleFunc("/api/contacts/{id}", contactsHandler.HandleDeleteContact)
+	mux.HandleFunc("/api/contacts/{id}/update", contactsHandler.HandleUpdateContact)
+
+	// Segment routes
+	mux.HandleFunc("/api/segments", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			allowTokens(auth.ScopeContactsRead, contactsHandler.HandleListSegments)(w, r)
+		} else if r.Method == http.MethodPost {
+			contactsHandler.HandleCreateSegment(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/segments/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			allowTokens(auth.ScopeContactsRead, contactsHandler.HandleGetSegment)(w, r)
+		} else if r.Method == http.MethodPut {
+			contactsHandler.HandleUpdateSegment(w, r)
+		} else if r.Method == http.MethodDelete {
+			contactsHandler.HandleDeleteSegment(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/accounts/{id}/segments/{segmentId}/preview", allowTokens(auth.ScopeContactsRead, contactsHandler.HandlePreviewSegment))
+
+	// Messages routes
+	messageSender := messages.NewSender(contactStore, cfg.AppID, cfg.AppHash)
+	jobStore, err := messages.NewJobStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := jobStore.RecoverInterrupted(); err != nil {
+		return nil, nil, err
+	}
+	mediaStore, err := messages.NewMediaStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	templateStore, err := messages.NewTemplateStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	quietHoursStore, err := messages.NewQuietHoursStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Bot delivery channel
+	botToken := cfg.DeliveryBotToken
+	if botToken == "" {
+		botToken = cfg.BotToken
+	}
+	botClient := botapi.NewClient(botToken).WithAPIURL(cfg.BotAPIURL)
+	subscriberStore, err := botapi.NewSubscriberStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	botReceiver := botapi.NewReceiver(botClient, subscriberStore, accountStore).WithWebhooks(webhookDispatcher)
+	switch cfg.BotUpdates {
+	case botUpdatesPoll:
+		go botReceiver.Poll(context.Background())
+	case botUpdatesWebhook:
+		go func() {
+			if err := botReceiver.RegisterWebhook(context.Background(), cfg.BotWebhookURL, cfg.BotWebhookSecret); err != nil {
+				slog.Error("failed to register bot webhook", "error", err)
+			}
+		}()
+		mux.HandleFunc("/api/bot/webhook", botReceiver.WebhookHandler(cfg.BotWebhookSecret))
+	}
+	botHandler := botapi.NewHandler(botClient, subscriberStore, accountStore, authHandler).WithWorkspaces(workspaceStore)
+	mux.HandleFunc("/api/accounts/{id}/bot/subscribers", allowTokens(auth.ScopeContactsRead, botHandler.HandleListSubscribers))
+
+	messagesHandler := messages.NewHandler(messageSender, jobStore, accountStore, authHandler).
+		WithBotSender(messages.NewBotSender(botClient, subscriberStore).WithWebhooks(webhookDispatcher)).
+		WithMediaStore(mediaStore).
+		WithTemplateStore(templateStore).
+		WithSegmentStore(segmentStore).
+		WithWebhooks(webhookDispatcher).
+		WithQuietHours(quietHoursStore).
+		WithWorkspaces(workspaceStore)
+	messagesHandler.StartScheduledJobs()
+	mux.HandleFunc("/api/accounts/{id}/media", allowTokens(auth.ScopeSend, messagesHandler.HandleUploadMedia))
+	mux.HandleFunc("/api/accounts/{id}/send", allowTokens(auth.ScopeSend, messagesHandler.HandleSendMessages))
+	mux.HandleFunc("/api/accounts/{id}/send/resume", allowTokens(auth.ScopeSend, messagesHandler.HandleResumeSend))
+	mux.HandleFunc("/api/accounts/{id}/send/cancel", allowTokens(auth.ScopeSend, messagesHandler.HandleCancelSend))
+	mux.HandleFunc("/api/accounts/{id}/send/status", allowTokens(auth.ScopeSend, messagesHandler.HandleSendStatus))
+	mux.HandleFunc("/api/accounts/{id}/send/events", allowTokens(auth.ScopeSend, messagesHandler.HandleSendEvents))
+	mux.HandleFunc("/api/accounts/{id}/send/history", allowTokens(auth.ScopeSend, messagesHandler.HandleSendHistory))
+
+	// Template library routes
+	mux.HandleFunc("/api/templates", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			allowTokens(auth.ScopeSend, messagesHandler.HandleListTemplates)(w, r)
+		} else if r.Method == http.MethodPost {
+			messagesHandler.HandleCreateTemplate(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/templates/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			allowTokens(auth.ScopeSend, messagesHandler.HandleGetTemplate)(w, r)
+		} else if r.Method == http.MethodDelete {
+			messagesHandler.HandleDeleteTemplate(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/templates/{id}/versions", messagesHandler.HandleAddTemplateVersion)
+
+	// Quiet hours policy routes
+	mux.HandleFunc("/api/quiet-hours", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			allowTokens(auth.ScopeSend, messagesHandler.HandleGetQuietHours)(w, r)
+		} else if r.Method == http.MethodPut {
+			messagesHandler.HandleUpdateQuietHours(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	// Webhook routes
+	webhooksHandler := webhooks.NewHandler(webhookStore, webhookDispatcher, authHandler).WithWorkspaces(workspaceStore)
+	mux.HandleFunc("/api/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			webhooksHandler.HandleListWebhooks(w, r)
+		} else if r.Method == http.MethodPost {
+			webhooksHandler.HandleCreateWebhook(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/webhooks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			webhooksHandler.HandleGetWebhook(w, r)
+		} else if r.Method == http.MethodPut {
+			webhooksHandler.HandleUpdateWebhook(w, r)
+		} else if r.Method == http.MethodDelete {
+			webhooksHandler.HandleDeleteWebhook(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/api/webhooks/{id}/deliveries", webhooksHandler.HandleListDeliveries)
+	mux.HandleFunc("/api/webhooks/{id}/test", webhooksHandler.HandleTestWebhook)
+
+	// Inbox routes
+	inboxStore, err := inbox.NewStore(cfg.DataDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	inboxListener := inbox.NewListener(inboxStore, accountStore, contactStore, cfg.AppID, cfg.AppHash)
+	if cfg.InboxListener {
+		go inboxListener.Run(context.Background())
+	}
+	inboxHandler := inbox.NewHandler(inboxStore, inboxListener, accountStore, contactStore, authHandler).WithWorkspaces(workspaceStore)
+	mux.HandleFunc("/api/accounts/{id}/inbox", inboxHandler.HandleListThreads)
+	mux.HandleFunc("/api/accounts/{id}/inbox/{contactId}", inboxHandler.HandleGetThread)
+	mux.HandleFunc("/api/accounts/{id}/inbox/{contactId}/read", inboxHandler.HandleMarkRead)
+	mux.HandleFunc("/api/accounts/{id}/inbox/{contactId}/reply", inboxHandler.HandleReply)
+
+	// Delivery report routes
+	messagesHandler.WithReporter(messages.NewReporter(jobStore, contactStore).
+		WithInbox(inboxStore).
+		WithSubscribers(subscriberStore))
+	mux.HandleFunc("/api/reports/delivery", allowTokens(auth.ScopeSend, messagesHandler.HandleDeliveryReport))
+
+	// Health check
+	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	})
+
+	// Readiness check. The stores above failing to load stops serve, so the
+	// check does not repeat it.
+	readiness := health.NewChecker(cfg.DataDir).
+		WithJobs(jobStore, jobManager).
+		WithAccounts(accountStore).
+		WithToken(cfg.MetricsToken).
+		WithStuckAfter(cfg.ReadyStuckAfter)
+	mux.HandleFunc("/api/ready", readiness.HandleReady)
+
+	// Prometheus metrics
+	mux.Handle("/metrics", metrics.Handler(cfg.MetricsToken))
+
+	// OpenAPI document
+	mux.HandleFunc("/api/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openapi.Spec)
+	})
+
+	// Serve static files if configured
+	if cfg.StaticDir != "" {
+		slog.Info("serving static files", "dir", cfg.StaticDir)
+		mux.Handle("/", spaHandler(cfg.StaticDir))
+	}
+
+	validator, err := openapi.NewValidator()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go tokenStore.Run(ctx)
+	shutdown := func() {
+		cancel()
+		if err := tokenStore.FlushUses(); err != nil {
+			slog.Error("failed to save API token uses", "error", err)
+		}
+	}
+
+	return validator.Middleware(mux), shutdown, nil
+}
+
 // spaHandler returns a handler that serves static files and falls back to index.html for SPA routing
 func spaHandler(staticDir string) http.Handler {
 	fileServer := http.FileServer(http.Dir(staticDir))
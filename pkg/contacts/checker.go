@@ -73,7 +73,7 @@ func (c *Checker) CheckContacts(ctx context.Context, accountID string, sessionPa
 		return nil, fmt.Errorf("failed to create telegram client: %w", err)
 	}
 
-	err = client.Run(ctx, func(ctx context.Context) error {
+	err = tgclient.Run(ctx, client, func(ctx context.Context) error {
 		// Get existing contacts to avoid deleting them later
 		contactsResp, err := client.API().ContactsGetContacts(ctx, 0)
 		if err != nil {
@@ -251,7 +251,7 @@ func (c *Checker) resolveUsernameWithRetry(ctx context.Context, api *tg.Client,
 	}
 
 	// Handle flood wait
-	if flood, floodErr := tgerr.FloodWait(ctx, err); flood {
+	if flood, floodErr := tgclient.FloodWait(ctx, err); flood {
 		slog.Info("flood wait on resolve username, retrying...", "username", username)
 		return c.resolveUsernameWithRetry(ctx, api, username)
 	} else if floodErr != nil {
@@ -362,7 +362,7 @@ func (c *Checker) importContactsWithRetry(ctx context.Context, api *tg.Client, c
 	}
 
 	// Handle flood wait
-	if flood, floodErr := tgerr.FloodWait(ctx, err); flood {
+	if flood, floodErr := tgclient.FloodWait(ctx, err); flood {
 		slog.Info("flood wait, retrying...", "error", err)
 		return c.importContactsWithRetry(ctx, api, contacts)
 	} else if floodErr != nil {
@@ -396,7 +396,7 @@ func (c *Checker) ImportFromChats(ctx context.Context, accountID string, session
 		return nil, fmt.Errorf("failed to create telegram client: %w", err)
 	}
 
-	err = client.Run(ctx, func(ctx context.Context) error {
+	err = tgclient.Run(ctx, client, func(ctx context.Context) error {
 		// Get existing contacts from our store to check for duplicates
 		existingContacts := make(map[int64]bool)
 		for _, contact := range c.store.GetByAccount(accountID) {
@@ -565,7 +565,7 @@ func (c *Checker) ImportFromChatsWithProgress(ctx context.Context, accountID str
 		return nil, fmt.Errorf("failed to create telegram client: %w", err)
 	}
 
-	err = client.Run(ctx, func(ctx context.Context) error {
+	err = tgclient.Run(ctx, client, func(ctx context.Context) error {
 		// Get existing contacts from our store to check for duplicates
 		existingContacts := make(map[int64]bool)
 		for _, contact := range c.store.GetByAccount(accountID) {
@@ -838,7 +838,7 @@ func (c *Checker) ImportFromContacts(ctx context.Context, accountID string, sess
 		return nil, fmt.Errorf("failed to create telegram client: %w", err)
 	}
 
-	err = client.Run(ctx, func(ctx context.Context) error {
+	err = tgclient.Run(ctx, client, func(ctx context.Context) error {
 		// Get existing contacts from our store to check for duplicates
 		existingContacts := make(map[int64]bool)
 		for _, contact := range c.store.GetByAccount(accountID) {
@@ -941,7 +941,7 @@ func (c *Checker) getContactsWithRetry(ctx context.Context, api *tg.Client) (tg.
 	}
 
 	// Handle flood wait
-	if flood, floodErr := tgerr.FloodWait(ctx, err); flood {
+	if flood, floodErr := tgclient.FloodWait(ctx, err); flood {
 		slog.Info("flood wait on get contacts, retrying...", "error", err)
 		return c.getContactsWithRetry(ctx, api)
 	} else if floodErr != nil {
@@ -958,7 +958,7 @@ func (c *Checker) getDialogsWithRetry(ctx context.Context, api *tg.Client, req *
 	}
 
 	// Handle flood wait
-	if flood, floodErr := tgerr.FloodWait(ctx, err); flood {
+	if flood, floodErr := tgclient.FloodWait(ctx, err); flood {
 		slog.Info("flood wait on get dialogs, retrying...", "error", err)
 		return c.getDialogsWithRetry(ctx, api, req)
 	} else if floodErr != nil {
@@ -1042,7 +1042,7 @@ func (c *Checker) ImportFromFile(ctx context.Context, accountID string, sessionP
 		return nil, fmt.Errorf("failed to create telegram client: %w", err)
 	}
 
-	err = client.Run(ctx, func(ctx context.Context) error {
+	err = tgclient.Run(ctx, client, func(ctx context.Context) error {
 		// Get existing contacts from our store
 		existingContacts := make(map[int64]*Contact)
 		for _, contact := range c.store.GetByAccount(accountID) {
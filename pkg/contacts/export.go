@@ -0,0 +1,343 @@
+package contacts
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// ExportFormat is a file format contacts can be exported to
+type ExportFormat string
+
+const (
+	ExportJSON  ExportFormat = "json"
+	ExportCSV   ExportFormat = "csv"
+	ExportVCard ExportFormat = "vcard" // vCard 4.0
+)
+
+// ParseExportFormat validates an export format name; empty means ExportJSON
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch f := ExportFormat(strings.ToLower(s)); f {
+	case "":
+		return ExportJSON, nil
+	case ExportJSON, ExportCSV, ExportVCard:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown export format %q, use json, csv or vcard", s)
+	}
+}
+
+// ContentType returns the MIME type of the format
+func (f ExportFormat) ContentType() string {
+	switch f {
+	case ExportCSV:
+		return "text/csv; charset=utf-8"
+	case ExportVCard:
+		return "text/vcard; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// Extension returns the file name extension of the format
+func (f ExportFormat) Extension() string {
+	switch f {
+	case ExportCSV:
+		return ".csv"
+	case ExportVCard:
+		return ".vcf"
+	default:
+		return ".json"
+	}
+}
+
+// ExportFields are the contact fields an export can contain, in column order
+var ExportFields = []string{
+	"id", "account_id", "telegram_id", "phone", "first_name", "last_name",
+	"username", "labels", "is_valid", "photo", "created_at", "updated_at",
+	"last_delivery", "last_delivery_at",
+}
+
+// PIIFields are the fields left out by ExportOptions.ExcludePII
+var PIIFields = []string{"phone", "username", "photo"}
+
+// ExportOptions selects what an export contains
+type ExportOptions struct {
+	Format     ExportFormat
+	Fields     []string // ExportFields to include, all if empty
+	ExcludePII bool     // Leave out PIIFields even if selected
+	Labels     []string // Only contacts with these labels, combined according to LabelMode
+	LabelMode  LabelMode
+}
+
+// columns returns the fields to export, in the order they were selected
+func (o *ExportOptions) columns() ([]string, error) {
+	fields := o.Fields
+	if len(fields) == 0 {
+		fields = ExportFields
+	}
+
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if !slices.Contains(ExportFields, field) {
+			return nil, fmt.Errorf("unknown field %q, available are %s", field, strings.Join(ExportFields, ", "))
+		}
+		if slices.Contains(columns, field) || o.ExcludePII && slices.Contains(PIIFields, field) {
+			continue
+		}
+		columns = append(columns, field)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no fields left to export")
+	}
+	return columns, nil
+}
+
+// Export writes the contacts of the given accounts sorted by name
+func (s *Store) Export(w io.Writer, accountIDs []string, opts ExportOptions) error {
+	columns, err := opts.columns()
+	if err != nil {
+		return err
+	}
+
+	var contacts []*Contact
+	for _, accountID := range accountIDs {
+		page, err := s.Query(accountID, Query{Labels: opts.Labels, LabelMode: opts.LabelMode})
+		if err != nil {
+			return err
+		}
+		contacts = append(contacts, page.Contacts...)
+	}
+
+	// Sort contacts by name
+	collator := collate.New(language.English)
+	sort.SliceStable(contacts, func(i, j int) bool {
+		nameA := strings.TrimSpace(contacts[i].FirstName + " " + contacts[i].LastName)
+		nameB := strings.TrimSpace(contacts[j].FirstName + " " + contacts[j].LastName)
+		return collator.CompareString(nameA, nameB) < 0
+	})
+
+	switch opts.Format {
+	case ExportCSV:
+		return exportCSV(w, contacts, columns)
+	case ExportVCard:
+		return exportVCard(w, contacts, columns)
+	default:
+		return exportJSON(w, contacts, columns, len(opts.Fields) == 0 && !opts.ExcludePII)
+	}
+}
+
+// exportValue returns a field of a contact as text
+func exportValue(c *Contact, field string) string {
+	switch field {
+	case "id":
+		return c.ID
+	case "account_id":
+		return c.AccountID
+	case "telegram_id":
+		return strconv.FormatInt(c.TelegramID, 10)
+	case "phone":
+		return c.Phone
+	case "first_name":
+		return c.FirstName
+	case "last_name":
+		return c.LastName
+	case "username":
+		return c.Username
+	case "labels":
+		return strings.Join(c.Labels, ";")
+	case "is_valid":
+		return strconv.FormatBool(c.IsValid)
+	case "photo":
+		return c.PhotoURL
+	case "created_at":
+		return c.CreatedAt.Format(time.RFC3339)
+	case "updated_at":
+		return c.UpdatedAt.Format(time.RFC3339)
+	case "last_delivery":
+		return c.LastDelivery
+	case "last_delivery_at":
+		if c.LastDeliveryAt == nil {
+			return ""
+		}
+		return c.LastDeliveryAt.Format(time.RFC3339)
+	}
+	return ""
+}
+
+// exportJSON writes the contacts as a JSON array. A full export keeps the
+// Contact shape; otherwise every object has exactly the selected fields.
+func exportJSON(w io.Writer, contacts []*Contact, columns []string, full bool) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	if full {
+		if contacts == nil {
+			contacts = make([]*Contact, 0)
+		}
+		return encoder.Encode(contacts)
+	}
+
+	objects := make([]map[string]any, 0, len(contacts))
+	for _, c := range contacts {
+		object := make(map[string]any, len(columns))
+		for _, field := range columns {
+			switch field {
+			case "labels":
+				labels := c.Labels
+				if labels == nil {
+					labels = make([]string, 0)
+				}
+				object[field] = labels
+			case "is_valid":
+				object[field] = c.IsValid
+			default:
+				object[field] = exportValue(c, field)
+			}
+		}
+		objects = append(objects, object)
+	}
+	return encoder.Encode(objects)
+}
+
+// exportCSV writes a header row and one row per contact. Labels are joined with ";".
+func exportCSV(w io.Writer, contacts []*Contact, columns []string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	row := make([]string, len(columns))
+	for _, c := range contacts {
+		for i, field := range columns {
+			row[i] = exportValue(c, field)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// vcardExtensions are the properties of fields vCard has no standard property for
+var vcardExtensions = []struct {
+	field    string
+	property string
+}{
+	{"account_id", "X-TGSENDER-ACCOUNT-ID"},
+	{"telegram_id", "X-TELEGRAM-ID"},
+	{"is_valid", "X-TGSENDER-VALID"},
+	{"created_at", "X-TGSENDER-CREATED"},
+	{"last_delivery", "X-TGSENDER-LAST-DELIVERY"},
+	{"last_delivery_at", "X-TGSENDER-LAST-DELIVERY-AT"},
+}
+
+// exportVCard writes one vCard 4.0 (RFC 6350) per contact. Fields without a
+// standard property are written as X- extensions.
+func exportVCard(w io.Writer, contacts []*Contact, columns []string) error {
+	has := func(field string) bool { return slices.Contains(columns, field) }
+
+	for _, c := range contacts {
+		var lines []string
+		add := func(line string) { lines = append(lines, line) }
+
+		add("BEGIN:VCARD")
+		add("VERSION:4.0")
+
+		// FN is required; fall back to the username or phone without names
+		firstName, lastName := "", ""
+		if has("first_name") {
+			firstName = c.FirstName
+		}
+		if has("last_name") {
+			lastName = c.LastName
+		}
+		fn := strings.TrimSpace(firstName + " " + lastName)
+		if fn == "" && has("username") && c.Username != "" {
+			fn = "@" + c.Username
+		}
+		if fn == "" && has("phone") {
+			fn = c.Phone
+		}
+		add("FN:" + vcardEscape(fn))
+		if has("first_name") || has("last_name") {
+			add("N:" + vcardEscape(lastName) + ";" + vcardEscape(firstName) + ";;;")
+		}
+
+		if has("id") {
+			add("UID:urn:tgsender:contact:" + vcardEscape(c.ID))
+		}
+		if has("phone") && c.Phone != "" {
+			add("TEL;VALUE=uri;TYPE=cell:tel:" + strings.ReplaceAll(c.Phone, " ", ""))
+		}
+		if has("username") && c.Username != "" {
+			add("NICKNAME:" + vcardEscape(c.Username))
+			add("URL:https://t.me/" + c.Username)
+		}
+		if has("labels") && len(c.Labels) > 0 {
+			escaped := make([]string, len(c.Labels))
+			for i, label := range c.Labels {
+				escaped[i] = vcardEscape(label)
+			}
+			add("CATEGORIES:" + strings.Join(escaped, ","))
+		}
+		if has("photo") && c.PhotoURL != "" {
+			add("PHOTO:" + c.PhotoURL)
+		}
+		if has("updated_at") {
+			add("REV:" + c.UpdatedAt.UTC().Format("20060102T150405Z"))
+		}
+
+		for _, ext := range vcardExtensions {
+			if value := exportValue(c, ext.field); has(ext.field) && value != "" {
+				add(ext.property + ":" + vcardEscape(value))
+			}
+		}
+
+		add("END:VCARD")
+
+		for _, line := range lines {
+			if _, err := io.WriteString(w, vcardFold(line)+"\r\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// vcardEscape escapes a text value as RFC 6350 section 3.4 requires
+func vcardEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// vcardFold splits lines longer than 75 octets, without breaking UTF-8 sequences
+func vcardFold(line string) string {
+	const limit = 75
+	if len(line) <= limit {
+		return line
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1 // The leading space counts
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
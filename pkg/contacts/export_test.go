@@ -0,0 +1,33 @@
+package contacts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVCardFold(t *testing.T) {
+	line := "NOTE:" + strings.Repeat("é", 60)
+	folded := vcardFold(line)
+
+	for _, part := range strings.Split(folded, "\r\n") {
+		if len(part) > 75 {
+			t.Fatalf("folded line has %d octets: %q", len(part), part)
+		}
+	}
+	if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != line {
+		t.Fatalf("unfolding gives %q", unfolded)
+	}
+}
+
+func TestExportColumns(t *testing.T) {
+	opts := ExportOptions{Fields: []string{"phone", "first_name", "photo", "first_name"}, ExcludePII: true}
+	columns, err := opts.columns()
+	if err != nil || strings.Join(columns, ",") != "first_name" {
+		t.Fatalf("got %v, %v", columns, err)
+	}
+
+	opts = ExportOptions{Fields: []string{"phone"}, ExcludePII: true}
+	if _, err := opts.columns(); err == nil {
+		t.Fatal("expected an error when every field is PII")
+	}
+}
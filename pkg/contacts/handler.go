@@ -2,17 +2,21 @@ package contacts
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"slices"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 
-	"golang.org/x/text/collate"
-	"golang.org/x/text/language"
-
 	"github.com/soluchok/tgsender/pkg/accounts"
 	"github.com/soluchok/tgsender/pkg/auth"
+	"github.com/soluchok/tgsender/pkg/events"
+	"github.com/soluchok/tgsender/pkg/webhooks"
+	"github.com/soluchok/tgsender/pkg/workspaces"
 )
 
 // Handler provides HTTP handlers for contacts management
@@ -22,6 +26,9 @@ type Handler struct {
 	accountStore *accounts.Store
 	auth         *auth.Handler
 	jobManager   *JobManager
+	segments     *SegmentStore
+	webhooks     *webhooks.Dispatcher
+	workspaces   *workspaces.Store
 }
 
 // NewHandler creates a new contacts handler
@@ -35,6 +42,24 @@ func NewHandler(store *Store, checker *Checker, accountStore *accounts.Store, au
 	}
 }
 
+// WithSegmentStore enables the saved segment endpoints
+func (h *Handler) WithSegmentStore(segments *SegmentStore) *Handler {
+	h.segments = segments
+	return h
+}
+
+// WithWebhooks reports contacts marked as suppressed to webhooks
+func (h *Handler) WithWebhooks(dispatcher *webhooks.Dispatcher) *Handler {
+	h.webhooks = dispatcher
+	return h
+}
+
+// WithWorkspaces shares contacts and segments within team workspaces
+func (h *Handler) WithWorkspaces(store *workspaces.Store) *Handler {
+	h.workspaces = store
+	return h
+}
+
 // HandleCheckNumbers handles POST /api/accounts/{id}/check-numbers
 func (h *Handler) HandleCheckNumbers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -55,14 +80,14 @@ func (h *Handler) HandleCheckNumbers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.accountStore.Get(accountID)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -120,7 +145,7 @@ func (h *Handler) HandleCheckNumbers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get session path for this account (uses account ID which is the TelegramID)
-	sessionPath := fmt.Sprintf(".data/account_%s.json", accountID)
+	sessionPath := h.accountStore.SessionPath(accountID)
 
 	// Check contacts
 	input := &CheckInput{
@@ -164,42 +189,117 @@ func (h *Handler) HandleListContacts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.accountStore.Get(accountID)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleViewer) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
 
-	// Get contacts
-	validOnly := r.URL.Query().Get("valid") == "true"
-	var contacts []*Contact
-	if validOnly {
-		contacts = h.store.GetValidByAccount(accountID)
-	} else {
-		contacts = h.store.GetByAccount(accountID)
+	query, errMsg := parseContactQuery(r.URL.Query())
+	if errMsg != "" {
+		writeJSONError(w, errMsg, http.StatusBadRequest)
+		return
 	}
 
-	if contacts == nil {
-		contacts = []*Contact{}
+	page, err := h.store.Query(accountID, query)
+	if errors.Is(err, ErrInvalidCursor) {
+		writeJSONError(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	collator := collate.New(language.English)
-	slices.SortFunc(contacts, func(a, b *Contact) int {
-		nameA := strings.TrimSpace(a.FirstName + " " + a.LastName)
-		nameB := strings.TrimSpace(b.FirstName + " " + b.LastName)
-		return collator.CompareString(nameA, nameB)
-	})
+	response := map[string]interface{}{
+		"contacts": page.Contacts,
+		"count":    len(page.Contacts),
+		"total":    page.Total,
+	}
+	if page.NextCursor != "" {
+		response["next_cursor"] = page.NextCursor
+	}
+	writeJSON(w, response, http.StatusOK)
+}
 
-	writeJSON(w, map[string]interface{}{
-		"contacts": contacts,
-		"count":    len(contacts),
-	}, http.StatusOK)
+// parseContactQuery reads the filters of GET /api/accounts/{id}/contacts.
+// It returns an error message for the client if a parameter is invalid.
+func parseContactQuery(values url.Values) (Query, string) {
+	query := Query{
+		Search: values.Get("q"),
+		Cursor: values.Get("cursor"),
+	}
+
+	for _, labels := range values["labels"] {
+		query.Labels = append(query.Labels, strings.Split(labels, ",")...)
+	}
+
+	switch mode := LabelMode(values.Get("label_mode")); mode {
+	case "", LabelsAll, LabelsAny:
+		query.LabelMode = mode
+	default:
+		return query, "Invalid label_mode, use all or any"
+	}
+
+	if v := values.Get("valid"); v != "" {
+		valid, err := strconv.ParseBool(v)
+		if err != nil {
+			return query, "Invalid valid, use true or false"
+		}
+		query.Valid = &valid
+	}
+
+	switch delivery := values.Get("delivery"); delivery {
+	case "", DeliverySent, DeliveryFailed, DeliveryNone:
+		query.Delivery = delivery
+	default:
+		return query, "Invalid delivery, use sent, failed or none"
+	}
+
+	for name, t := range map[string]*time.Time{
+		"created_after":  &query.CreatedAfter,
+		"created_before": &query.CreatedBefore,
+		"updated_after":  &query.UpdatedAfter,
+		"updated_before": &query.UpdatedBefore,
+	} {
+		if v := values.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return query, fmt.Sprintf("Invalid %s, use RFC 3339", name)
+			}
+			*t = parsed
+		}
+	}
+
+	sortField, err := ParseSortField(values.Get("sort"))
+	if err != nil {
+		return query, "Invalid sort, use name, phone, created_at or updated_at"
+	}
+	query.Sort = sortField
+
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, "Invalid order, use asc or desc"
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			return query, fmt.Sprintf("Invalid limit, use 1 to %d", MaxPageSize)
+		}
+		query.Limit = limit
+	}
+
+	return query, ""
 }
 
 // HandleDeleteContact handles DELETE /api/contacts/{id}
@@ -229,9 +329,9 @@ func (h *Handler) HandleDeleteContact(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify the account belongs to this owner
+	// Verify the caller's role in the account's workspace allows this
 	account, ok := h.accountStore.Get(contact.AccountID)
-	if !ok || account.OwnerID != ownerID {
+	if !ok || h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -271,9 +371,9 @@ func (h *Handler) HandleUpdateContact(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify the account belongs to this owner
+	// Verify the caller's role in the account's workspace allows this
 	account, ok := h.accountStore.Get(contact.AccountID)
-	if !ok || account.OwnerID != ownerID {
+	if !ok || h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -283,17 +383,48 @@ func (h *Handler) HandleUpdateContact(w http.ResponseWriter, r *http.Request) {
 		FirstName string   `json:"first_name"`
 		LastName  string   `json:"last_name"`
 		Labels    []string `json:"labels"`
+
+		Suppressed *bool   `json:"suppressed"` // Unchanged if omitted
+		TimeZone   *string `json:"time_zone"`  // Unchanged if omitted, derived from the phone if empty
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
+	if req.TimeZone != nil && *req.TimeZone != "" {
+		if _, err := ParseTimeZone(*req.TimeZone); err != nil {
+			writeJSONError(w, "Unknown time zone", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Update contact
+	wasSuppressed := contact.Suppressed
 	if err := h.store.Update(contactID, req.FirstName, req.LastName, req.Labels); err != nil {
 		writeJSONError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if req.Suppressed != nil {
+		if err := h.store.SetSuppressed(contactID, *req.Suppressed); err != nil {
+			writeJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if *req.Suppressed && !wasSuppressed {
+			h.webhooks.Emit(contact.AccountID, webhooks.EventRecipientOptedOut, webhooks.OptOutData{
+				AccountID: contact.AccountID,
+				Channel:   "account",
+				ContactID: contactID,
+				Reason:    webhooks.OptOutSuppressed,
+			})
+		}
+	}
+	if req.TimeZone != nil {
+		if err := h.store.SetTimeZone(contactID, *req.TimeZone); err != nil {
+			writeJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
 	// Return updated contact
 	updatedContact, _ := h.store.Get(contactID)
@@ -320,20 +451,20 @@ func (h *Handler) HandleImportFromChats(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.accountStore.Get(accountID)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
 
 	// Get session path for this account (uses account ID which is the TelegramID)
-	sessionPath := fmt.Sprintf(".data/account_%s.json", accountID)
+	sessionPath := h.accountStore.SessionPath(accountID)
 
 	// Start async import job
 	job, isNew := h.jobManager.StartImport(accountID, sessionPath, account.ProxyURL)
@@ -349,6 +480,57 @@ func (h *Handler) HandleImportFromChats(w http.ResponseWriter, r *http.Request)
 	}, http.StatusOK)
 }
 
+// HandleImportEvents handles GET /api/accounts/{id}/import-chats/events
+// Streams import job progress as Server-Sent Events, resuming after Last-Event-ID
+func (h *Handler) HandleImportEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// Get account ID from path
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeJSONError(w, "Account ID required", http.StatusBadRequest)
+		return
+	}
+
+	// Verify account exists and the caller's role in its workspace allows this
+	account, ok := h.accountStore.Get(accountID)
+	if !ok {
+		writeJSONError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleViewer) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// Get job ID from query param
+	jobID := r.URL.Query().Get("job_id")
+	if jobID == "" {
+		writeJSONError(w, "job_id is required", http.StatusBadRequest)
+		return
+	}
+
+	job, found := h.jobManager.GetJob(jobID)
+	if !found || job.AccountID != accountID {
+		writeJSONError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	if !h.jobManager.events.Stream(w, r, jobID) {
+		events.WriteSnapshot(w, events.TypeStatus, newStatusEvent(job))
+	}
+}
+
 // HandleImportContacts handles POST /api/accounts/{id}/import-contacts
 func (h *Handler) HandleImportContacts(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -369,20 +551,20 @@ func (h *Handler) HandleImportContacts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.accountStore.Get(accountID)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
 
 	// Get session path for this account (uses account ID which is the TelegramID)
-	sessionPath := fmt.Sprintf(".data/account_%s.json", accountID)
+	sessionPath := h.accountStore.SessionPath(accountID)
 
 	// Start async import job
 	job, isNew := h.jobManager.StartImportContacts(accountID, sessionPath, account.ProxyURL)
@@ -421,14 +603,14 @@ func (h *Handler) HandleImportFromChatsStatus(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.accountStore.Get(accountID)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleViewer) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -489,7 +671,12 @@ func (h *Handler) HandleExportContacts(w http.ResponseWriter, r *http.Request) {
 
 	// Parse request body
 	var req struct {
-		AccountIDs []string `json:"account_ids"`
+		AccountIDs []string  `json:"account_ids"`
+		Format     string    `json:"format"`      // ExportJSON (default), ExportCSV or ExportVCard
+		Fields     []string  `json:"fields"`      // ExportFields to include, all if empty
+		ExcludePII bool      `json:"exclude_pii"` // Leave out phone, username and photo
+		Labels     []string  `json:"labels"`      // Only contacts with these labels
+		LabelMode  LabelMode `json:"label_mode"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
@@ -501,42 +688,51 @@ func (h *Handler) HandleExportContacts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify all accounts exist and belong to this owner
+	format, err := ParseExportFormat(req.Format)
+	if err != nil {
+		writeJSONError(w, "Unknown format, use json, csv or vcard", http.StatusBadRequest)
+		return
+	}
+
+	switch req.LabelMode {
+	case "", LabelsAll, LabelsAny:
+	default:
+		writeJSONError(w, "Invalid label_mode, use all or any", http.StatusBadRequest)
+		return
+	}
+
+	opts := ExportOptions{
+		Format:     format,
+		Fields:     req.Fields,
+		ExcludePII: req.ExcludePII,
+		Labels:     req.Labels,
+		LabelMode:  req.LabelMode,
+	}
+	if _, err := opts.columns(); err != nil {
+		writeJSONError(w, fmt.Sprintf("Invalid fields: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Verify all accounts exist and the caller may read them
 	for _, accountID := range req.AccountIDs {
 		account, ok := h.accountStore.Get(accountID)
 		if !ok {
 			writeJSONError(w, fmt.Sprintf("Account not found: %s", accountID), http.StatusNotFound)
 			return
 		}
-		if account.OwnerID != ownerID {
+		if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleViewer) != nil {
 			writeJSONError(w, "Unauthorized", http.StatusForbidden)
 			return
 		}
 	}
 
-	// Collect contacts from all selected accounts
-	var allContacts []*Contact
-	for _, accountID := range req.AccountIDs {
-		contacts := h.store.GetByAccount(accountID)
-		allContacts = append(allContacts, contacts...)
-	}
-
-	// Sort contacts by name
-	collator := collate.New(language.English)
-	slices.SortFunc(allContacts, func(a, b *Contact) int {
-		nameA := strings.TrimSpace(a.FirstName + " " + a.LastName)
-		nameB := strings.TrimSpace(b.FirstName + " " + b.LastName)
-		return collator.CompareString(nameA, nameB)
-	})
-
 	// Set headers for file download
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Content-Disposition", "attachment; filename=contacts.json")
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", "attachment; filename=contacts"+format.Extension())
 
-	// Write JSON
-	encoder := json.NewEncoder(w)
-	encoder.SetIndent("", "  ")
-	encoder.Encode(allContacts)
+	if err := h.store.Export(w, req.AccountIDs, opts); err != nil {
+		slog.Error("failed to export contacts", "error", err)
+	}
 }
 
 // HandleImportFromFile handles POST /api/accounts/{id}/import-file
@@ -559,14 +755,14 @@ func (h *Handler) HandleImportFromFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.accountStore.Get(accountID)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -586,7 +782,7 @@ func (h *Handler) HandleImportFromFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get session path for this account (uses account ID which is the TelegramID)
-	sessionPath := fmt.Sprintf(".data/account_%s.json", accountID)
+	sessionPath := h.accountStore.SessionPath(accountID)
 
 	// Import contacts
 	result, err := h.checker.ImportFromFile(r.Context(), accountID, sessionPath, account.ProxyURL, req.Contacts)
@@ -603,18 +799,255 @@ func (h *Handler) HandleImportFromFile(w http.ResponseWriter, r *http.Request) {
 	}, http.StatusOK)
 }
 
-func (h *Handler) getOwnerID(r *http.Request) (int64, bool) {
-	cookie, err := r.Cookie("session_token")
+// HandleListSegments handles GET /api/segments
+// Lists the segments of the workspace selected with the X-Workspace-ID header
+func (h *Handler) HandleListSegments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"segments": h.segments.GetByOwner(workspaceID),
+	}, http.StatusOK)
+}
+
+// segmentRequest is the body of segment create and update requests
+type segmentRequest struct {
+	Name            string        `json:"name"`
+	Filter          SegmentFilter `json:"filter"`
+	ExcludeDelivery []string      `json:"exclude_delivery"`
+}
+
+// segment validates the request as a segment of an owner. It returns an
+// error message for the client if the request is invalid.
+func (req *segmentRequest) segment(ownerID int64) (*Segment, string) {
+	seg := &Segment{
+		OwnerID:         ownerID,
+		Name:            strings.TrimSpace(req.Name),
+		Filter:          req.Filter,
+		ExcludeDelivery: req.ExcludeDelivery,
+	}
+	if err := seg.Validate(); err != nil {
+		return nil, fmt.Sprintf("Invalid segment: %v", err)
+	}
+	return seg, ""
+}
+
+// HandleCreateSegment handles POST /api/segments
+// Creates the segment in the workspace selected with the X-Workspace-ID header
+func (h *Handler) HandleCreateSegment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleOperator)
+	if !ok {
+		return
+	}
+
+	var req segmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	seg, errMsg := req.segment(workspaceID)
+	if errMsg != "" {
+		writeJSONError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	seg, err := h.segments.Create(seg)
+	if errors.Is(err, ErrSegmentNameExists) {
+		writeJSONError(w, "A segment with this name already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
-		return 0, false
+		writeJSONError(w, fmt.Sprintf("Failed to save segment: %v", err), http.StatusInternalServerError)
+		return
 	}
 
-	session, ok := h.auth.GetSession(cookie.Value)
-	if !ok || session.User == nil {
-		return 0, false
+	writeJSON(w, seg, http.StatusOK)
+}
+
+// HandleGetSegment handles GET /api/segments/{id}
+func (h *Handler) HandleGetSegment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	return session.User.ID, true
+	seg, ok := h.ownSegment(w, r, r.PathValue("id"), workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, seg, http.StatusOK)
+}
+
+// HandleUpdateSegment handles PUT /api/segments/{id}
+func (h *Handler) HandleUpdateSegment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	seg, ok := h.ownSegment(w, r, r.PathValue("id"), workspaces.RoleOperator)
+	if !ok {
+		return
+	}
+
+	var req segmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updated, errMsg := req.segment(seg.OwnerID)
+	if errMsg != "" {
+		writeJSONError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+	updated.ID = seg.ID
+
+	updated, err := h.segments.Update(updated)
+	if errors.Is(err, ErrSegmentNameExists) {
+		writeJSONError(w, "A segment with this name already exists", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, ErrSegmentNotFound) {
+		writeJSONError(w, "Segment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to save segment: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, updated, http.StatusOK)
+}
+
+// HandleDeleteSegment handles DELETE /api/segments/{id}
+func (h *Handler) HandleDeleteSegment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	seg, ok := h.ownSegment(w, r, r.PathValue("id"), workspaces.RoleOperator)
+	if !ok {
+		return
+	}
+
+	if err := h.segments.Delete(seg.ID); err != nil && !errors.Is(err, ErrSegmentNotFound) {
+		writeJSONError(w, fmt.Sprintf("Failed to delete segment: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Segment deleted"}, http.StatusOK)
+}
+
+// HandlePreviewSegment handles GET /api/accounts/{id}/segments/{segmentId}/preview
+// Counts the contacts of the account a send to the segment would reach now
+func (h *Handler) HandlePreviewSegment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	seg, ok := h.ownSegment(w, r, r.PathValue("segmentId"), workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	// Verify account exists and belongs to the segment's workspace
+	accountID := r.PathValue("id")
+	account, ok := h.accountStore.Get(accountID)
+	if !ok {
+		writeJSONError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if account.OwnerID != seg.OwnerID {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	membership, err := h.store.Segment(accountID, seg)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to evaluate segment: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"segment_id": seg.ID,
+		"account_id": accountID,
+		"count":      len(membership.ContactIDs),
+		"matched":    membership.Matched,
+		"suppressed": membership.Suppressed,
+		"excluded":   membership.Excluded,
+	}, http.StatusOK)
+}
+
+// ownSegment loads a segment for a caller with at least the role in its
+// workspace, writing the error response if the caller may not use it
+func (h *Handler) ownSegment(w http.ResponseWriter, r *http.Request, id string, need workspaces.Role) (*Segment, bool) {
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	seg, ok := h.segments.Get(id)
+	if !ok {
+		writeJSONError(w, "Segment not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if h.workspaces.Authorize(ownerID, seg.OwnerID, need) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return nil, false
+	}
+
+	return seg, true
+}
+
+func (h *Handler) getOwnerID(r *http.Request) (int64, bool) {
+	return h.auth.OwnerID(r)
+}
+
+// selectWorkspace returns the workspace the request acts in. It writes the
+// error response if the caller lacks the role there.
+func (h *Handler) selectWorkspace(w http.ResponseWriter, r *http.Request, ownerID int64, need workspaces.Role) (int64, bool) {
+	workspaceID, err := h.workspaces.Selected(r, ownerID, need)
+	if errors.Is(err, workspaces.ErrInvalidHeader) {
+		writeJSONError(w, "Invalid "+workspaces.Header+" header", http.StatusBadRequest)
+		return 0, false
+	}
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return 0, false
+	}
+	return workspaceID, true
 }
 
 // Helper functions for JSON responses
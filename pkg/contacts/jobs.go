@@ -6,6 +6,9 @@ import (
 	"encoding/hex"
 	"sync"
 	"time"
+
+	"github.com/soluchok/tgsender/pkg/events"
+	"github.com/soluchok/tgsender/pkg/metrics"
 )
 
 // JobStatus represents the status of an import job
@@ -41,23 +44,78 @@ type ImportJob struct {
 	UpdatedAt  time.Time  `json:"updated_at"`
 }
 
+// ProgressEvent is published when an import job updates its counters
+type ProgressEvent struct {
+	Progress int `json:"progress"`
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+}
+
+// StatusEvent is published when an import job changes status
+type StatusEvent struct {
+	Status   JobStatus `json:"status"`
+	Progress int       `json:"progress"`
+	Imported int       `json:"imported"`
+	Skipped  int       `json:"skipped"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// ErrorEvent is published when an import job fails
+type ErrorEvent struct {
+	Error string `json:"error"`
+}
+
+func newStatusEvent(job *ImportJob) StatusEvent {
+	return StatusEvent{
+		Status:   job.Status,
+		Progress: job.Progress,
+		Imported: job.Imported,
+		Skipped:  job.Skipped,
+		Error:    job.Error,
+	}
+}
+
+const (
+	defaultImportTimeout   = 6 * time.Hour
+	defaultJobCleanupDelay = 5 * time.Minute
+)
+
 // JobManager manages async import jobs
 type JobManager struct {
-	mu      sync.RWMutex
-	jobs    map[string]*ImportJob // job ID -> job
-	byAcct  map[string]string     // account ID -> job ID (for active jobs only)
-	checker *Checker
+	mu           sync.RWMutex
+	jobs         map[string]*ImportJob // job ID -> job
+	byAcct       map[string]string     // account ID -> job ID (for active jobs only)
+	checker      *Checker
+	events       *events.Broker
+	timeout      time.Duration
+	cleanupDelay time.Duration
 }
 
 // NewJobManager creates a new job manager
 func NewJobManager(checker *Checker) *JobManager {
 	return &JobManager{
-		jobs:    make(map[string]*ImportJob),
-		byAcct:  make(map[string]string),
-		checker: checker,
+		jobs:         make(map[string]*ImportJob),
+		byAcct:       make(map[string]string),
+		checker:      checker,
+		events:       events.NewBroker().WithRetention(defaultJobCleanupDelay),
+		timeout:      defaultImportTimeout,
+		cleanupDelay: defaultJobCleanupDelay,
 	}
 }
 
+// WithTimeout sets the maximum duration of an import job
+func (m *JobManager) WithTimeout(timeout time.Duration) *JobManager {
+	m.timeout = timeout
+	return m
+}
+
+// WithCleanupDelay sets how long finished jobs stay available for status queries
+func (m *JobManager) WithCleanupDelay(delay time.Duration) *JobManager {
+	m.cleanupDelay = delay
+	m.events.WithRetention(delay)
+	return m
+}
+
 // StartImport starts an import job for an account, or returns existing running job
 func (m *JobManager) StartImport(accountID, sessionPath, proxyURL string) (*ImportJob, bool) {
 	return m.startImportWithType(accountID, sessionPath, proxyURL, ImportTypeChats)
@@ -96,6 +154,9 @@ func (m *JobManager) startImportWithType(accountID, sessionPath, proxyURL string
 	m.jobs[jobID] = job
 	m.byAcct[accountID] = jobID
 
+	// Let event subscribers attach before the job starts
+	m.events.Open(jobID)
+
 	// Start the job in background
 	go m.runImport(job, sessionPath)
 
@@ -117,6 +178,21 @@ func (m *JobManager) GetJob(jobID string) (*ImportJob, bool) {
 	return &jobCopy, true
 }
 
+// Active returns copies of the jobs that are pending or running
+func (m *JobManager) Active() []*ImportJob {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := make([]*ImportJob, 0, len(m.byAcct))
+	for _, job := range m.jobs {
+		if job.Status == JobStatusPending || job.Status == JobStatusRunning {
+			jobCopy := *job
+			jobs = append(jobs, &jobCopy)
+		}
+	}
+	return jobs
+}
+
 // GetJobByAccount returns the active job for an account
 func (m *JobManager) GetJobByAccount(accountID string) (*ImportJob, bool) {
 	m.mu.RLock()
@@ -142,10 +218,11 @@ func (m *JobManager) runImport(job *ImportJob, sessionPath string) {
 	m.mu.Lock()
 	job.Status = JobStatusRunning
 	job.UpdatedAt = time.Now()
+	m.events.Publish(job.ID, events.TypeStatus, newStatusEvent(job))
 	m.mu.Unlock()
 
-	// Create a context with timeout (10 minutes max)
-	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Hour)
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
 	defer cancel()
 
 	var result *ChatContactsResult
@@ -158,6 +235,7 @@ func (m *JobManager) runImport(job *ImportJob, sessionPath string) {
 			job.Imported = imported
 			job.Skipped = skipped
 			job.UpdatedAt = time.Now()
+			m.publishProgress(job)
 			m.mu.Unlock()
 		})
 	} else {
@@ -168,6 +246,7 @@ func (m *JobManager) runImport(job *ImportJob, sessionPath string) {
 			job.Imported = imported
 			job.Skipped = skipped
 			job.UpdatedAt = time.Now()
+			m.publishProgress(job)
 			m.mu.Unlock()
 		})
 	}
@@ -188,20 +267,39 @@ func (m *JobManager) runImport(job *ImportJob, sessionPath string) {
 	}
 	job.UpdatedAt = time.Now()
 
+	metrics.ImportJobDuration.
+		WithLabelValues(string(job.ImportType), string(job.Status)).
+		Observe(job.UpdatedAt.Sub(job.StartedAt).Seconds())
+
+	if err != nil {
+		m.events.Publish(job.ID, events.TypeError, ErrorEvent{Error: job.Error})
+	}
+	m.events.Publish(job.ID, events.TypeStatus, newStatusEvent(job))
+	m.events.Close(job.ID)
+
 	// Clean up account mapping after completion (allow new jobs)
 	// Keep the job in jobs map for status queries, but remove from byAcct
 	// so a new job can be started
 	delete(m.byAcct, job.AccountID)
 
-	// Schedule cleanup of old job after 5 minutes
+	// Schedule cleanup of old job
 	go func() {
-		time.Sleep(5 * time.Minute)
+		time.Sleep(m.cleanupDelay)
 		m.mu.Lock()
 		delete(m.jobs, job.ID)
 		m.mu.Unlock()
 	}()
 }
 
+// publishProgress publishes the job's counters. The caller must hold m.mu.
+func (m *JobManager) publishProgress(job *ImportJob) {
+	m.events.Publish(job.ID, events.TypeProgress, ProgressEvent{
+		Progress: job.Progress,
+		Imported: job.Imported,
+		Skipped:  job.Skipped,
+	})
+}
+
 func generateJobID() string {
 	bytes := make([]byte, 8)
 	rand.Read(bytes)
@@ -0,0 +1,364 @@
+package contacts
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// SortField is a contact attribute lists can be ordered by
+type SortField string
+
+const (
+	SortByName      SortField = "name"
+	SortByPhone     SortField = "phone"
+	SortByCreatedAt SortField = "created_at"
+	SortByUpdatedAt SortField = "updated_at"
+)
+
+// LabelMode tells how a label filter with several labels matches
+type LabelMode string
+
+const (
+	LabelsAll LabelMode = "all" // Contacts having every label
+	LabelsAny LabelMode = "any" // Contacts having at least one label
+)
+
+// Delivery states of a contact, see Contact.LastDelivery
+const (
+	DeliverySent   = "sent"
+	DeliveryFailed = "failed"
+	DeliveryNone   = "none" // Never messaged
+)
+
+// MaxPageSize is the largest page a query returns
+const MaxPageSize = 1000
+
+// ErrInvalidCursor is returned for cursors that were not issued for the query
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Query selects, orders and pages the contacts of an account. Zero values
+// don't filter.
+type Query struct {
+	Search    string   // Case-insensitive match on name, username and phone
+	Labels    []string // Label filter, combined according to LabelMode
+	LabelMode LabelMode
+	Valid     *bool  // Registered on Telegram or not
+	Delivery  string // DeliverySent, DeliveryFailed or DeliveryNone
+
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+
+	Sort   SortField // SortByName if empty
+	Desc   bool
+	Cursor string // NextCursor of the previous page
+	Limit  int    // Page size, all matching contacts if 0
+}
+
+// Page is one page of query results
+type Page struct {
+	Contacts   []*Contact
+	Total      int    // Matching contacts across all pages
+	NextCursor string // Empty on the last page
+}
+
+// ParseSortField validates a sort field name; empty means SortByName
+func ParseSortField(s string) (SortField, error) {
+	switch SortField(s) {
+	case "", SortByName:
+		return SortByName, nil
+	case SortByPhone, SortByCreatedAt, SortByUpdatedAt:
+		return SortField(s), nil
+	default:
+		return "", fmt.Errorf("unknown sort field %q", s)
+	}
+}
+
+// view is an account's contacts in one sort order, with the data queries
+// match against precomputed. Views are built on first use and dropped when
+// the account's contacts change.
+type view []viewEntry
+
+type viewEntry struct {
+	key     []byte
+	contact *Contact
+	text    string // Lower-case name, username and phone
+	digits  string // Phone digits
+}
+
+type viewKey struct {
+	accountID string
+	sort      SortField
+}
+
+// Query returns a page of an account's contacts
+func (s *Store) Query(accountID string, q Query) (*Page, error) {
+	if q.Sort == "" {
+		q.Sort = SortByName
+	}
+	if q.LabelMode == "" {
+		q.LabelMode = LabelsAll
+	}
+	if q.Limit < 0 || q.Limit > MaxPageSize {
+		return nil, fmt.Errorf("limit must be at most %d", MaxPageSize)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := s.view(accountID, q.Sort)
+	m := newMatcher(q)
+
+	// Position after the cursor, walking backwards for descending order
+	start, step := 0, 1
+	if q.Desc {
+		start, step = len(entries)-1, -1
+	}
+	if q.Cursor != "" {
+		key, id, err := decodeCursor(q.Cursor, q.Sort, q.Desc)
+		if err != nil {
+			return nil, err
+		}
+		if q.Desc {
+			start = sort.Search(len(entries), func(i int) bool {
+				return compareEntry(entries[i], key, id) >= 0
+			}) - 1
+		} else {
+			start = sort.Search(len(entries), func(i int) bool {
+				return compareEntry(entries[i], key, id) > 0
+			})
+		}
+	}
+
+	page := &Page{Contacts: make([]*Contact, 0)}
+	for i := range entries {
+		if m.match(&entries[i]) {
+			page.Total++
+		}
+	}
+
+	var last *viewEntry
+	for i := start; i >= 0 && i < len(entries); i += step {
+		e := &entries[i]
+		if !m.match(e) {
+			continue
+		}
+		if q.Limit > 0 && len(page.Contacts) == q.Limit {
+			page.NextCursor = encodeCursor(last, q.Sort, q.Desc)
+			break
+		}
+		page.Contacts = append(page.Contacts, e.contact)
+		last = e
+	}
+
+	return page, nil
+}
+
+// view returns the sorted view of an account, building it if needed.
+// The caller holds s.mu.
+func (s *Store) view(accountID string, field SortField) view {
+	s.viewsMu.Lock()
+	defer s.viewsMu.Unlock()
+
+	k := viewKey{accountID, field}
+	if v, ok := s.views[k]; ok {
+		return v
+	}
+
+	collator := collate.New(language.English)
+	var buf collate.Buffer
+
+	v := make(view, 0, len(s.byAccount[accountID]))
+	for _, c := range s.byAccount[accountID] {
+		name := strings.TrimSpace(c.FirstName + " " + c.LastName)
+
+		var key []byte
+		switch field {
+		case SortByPhone:
+			key = []byte(c.Phone)
+		case SortByCreatedAt:
+			key = timeKey(c.CreatedAt)
+		case SortByUpdatedAt:
+			key = timeKey(c.UpdatedAt)
+		default:
+			key = append([]byte(nil), collator.KeyFromString(&buf, name)...)
+			buf.Reset()
+		}
+
+		v = append(v, viewEntry{
+			key:     key,
+			contact: c,
+			text:    strings.ToLower(name + "\n" + c.Username + "\n" + c.Phone),
+			digits:  digitsOnly(c.Phone),
+		})
+	}
+
+	sort.Slice(v, func(i, j int) bool {
+		return compareEntry(v[i], v[j].key, v[j].contact.ID) < 0
+	})
+
+	s.views[k] = v
+	return v
+}
+
+// invalidate drops the views of an account. The caller holds s.mu for writing.
+func (s *Store) invalidate(accountID string) {
+	s.viewsMu.Lock()
+	defer s.viewsMu.Unlock()
+
+	for k := range s.views {
+		if k.accountID == accountID {
+			delete(s.views, k)
+		}
+	}
+}
+
+func compareEntry(e viewEntry, key []byte, id string) int {
+	if c := bytes.Compare(e.key, key); c != 0 {
+		return c
+	}
+	return strings.Compare(e.contact.ID, id)
+}
+
+// timeKey encodes a time so that byte order is chronological order
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano())^(1<<63))
+	return key
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// cursor is the position after the last contact of a page
+type cursor struct {
+	Sort SortField `json:"s"`
+	Desc bool      `json:"d,omitempty"`
+	Key  []byte    `json:"k"`
+	ID   string    `json:"i"`
+}
+
+func encodeCursor(e *viewEntry, field SortField, desc bool) string {
+	data, _ := json.Marshal(cursor{Sort: field, Desc: desc, Key: e.key, ID: e.contact.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, field SortField, desc bool) ([]byte, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, "", ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, "", ErrInvalidCursor
+	}
+
+	// A cursor only makes sense in the order it was issued for
+	if c.Sort != field || c.Desc != desc {
+		return nil, "", ErrInvalidCursor
+	}
+
+	return c.Key, c.ID, nil
+}
+
+// matcher applies the filters of a query
+type matcher struct {
+	q      Query
+	search string
+	digits string
+	labels []string
+}
+
+func newMatcher(q Query) *matcher {
+	m := &matcher{q: q, search: strings.ToLower(strings.TrimSpace(q.Search))}
+
+	// Phone searches match regardless of formatting, "+1 (555)" finds "+1555..."
+	if m.search != "" && strings.Trim(m.search, "+-() 0123456789") == "" {
+		m.digits = digitsOnly(m.search)
+	}
+
+	for _, label := range q.Labels {
+		if label = strings.ToLower(strings.TrimSpace(label)); label != "" {
+			m.labels = append(m.labels, label)
+		}
+	}
+
+	return m
+}
+
+func (m *matcher) match(e *viewEntry) bool {
+	c := e.contact
+
+	if m.search != "" && !strings.Contains(e.text, m.search) &&
+		(m.digits == "" || !strings.Contains(e.digits, m.digits)) {
+		return false
+	}
+
+	if len(m.labels) > 0 && !m.matchLabels(c.Labels) {
+		return false
+	}
+
+	if m.q.Valid != nil && c.IsValid != *m.q.Valid {
+		return false
+	}
+
+	if m.q.Delivery != "" {
+		state := c.LastDelivery
+		if state == "" {
+			state = DeliveryNone
+		}
+		if state != m.q.Delivery {
+			return false
+		}
+	}
+
+	if !m.q.CreatedAfter.IsZero() && !c.CreatedAt.After(m.q.CreatedAfter) ||
+		!m.q.CreatedBefore.IsZero() && !c.CreatedAt.Before(m.q.CreatedBefore) ||
+		!m.q.UpdatedAfter.IsZero() && !c.UpdatedAt.After(m.q.UpdatedAfter) ||
+		!m.q.UpdatedBefore.IsZero() && !c.UpdatedAt.Before(m.q.UpdatedBefore) {
+		return false
+	}
+
+	return true
+}
+
+func (m *matcher) matchLabels(labels []string) bool {
+	has := func(want string) bool {
+		for _, label := range labels {
+			if strings.EqualFold(label, want) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, want := range m.labels {
+		found := has(want)
+		if m.q.LabelMode == LabelsAny && found {
+			return true
+		}
+		if m.q.LabelMode == LabelsAll && !found {
+			return false
+		}
+	}
+	return m.q.LabelMode == LabelsAll
+}
@@ -0,0 +1,137 @@
+package contacts
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newQueryStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contacts := []*Contact{
+		{AccountID: "a", TelegramID: 1, Phone: "+1 555 0100", FirstName: "Émile", Username: "emile", Labels: []string{"chat", "vip"}, IsValid: true},
+		{AccountID: "a", TelegramID: 2, Phone: "+15550101", FirstName: "adam", Labels: []string{"phone"}, IsValid: true},
+		{AccountID: "a", TelegramID: 3, Phone: "+15550102", FirstName: "Zoe", LastName: "Quinn", Labels: []string{"vip"}},
+		{AccountID: "a", TelegramID: 4, Phone: "+15550103", FirstName: "Bob", Username: "bobby", IsValid: true},
+		{AccountID: "b", TelegramID: 5, Phone: "+15550104", FirstName: "Other"},
+	}
+	if err := store.BulkCreateOrUpdate(contacts); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func names(contacts []*Contact) string {
+	var s string
+	for i, c := range contacts {
+		if i > 0 {
+			s += ","
+		}
+		s += c.FirstName
+	}
+	return s
+}
+
+func TestQueryFilters(t *testing.T) {
+	store := newQueryStore(t)
+	valid := true
+
+	adam, _ := store.GetByTelegramID("a", 2)
+	if err := store.RecordDelivery(adam.ID, true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{"all sorted by name", Query{}, "adam,Bob,Émile,Zoe"},
+		{"search name", Query{Search: "QUINN"}, "Zoe"},
+		{"search username", Query{Search: "bobby"}, "Bob"},
+		{"search phone digits", Query{Search: "555-0100"}, "Émile"},
+		{"labels all", Query{Labels: []string{"vip", "chat"}}, "Émile"},
+		{"labels any", Query{Labels: []string{"VIP", "phone"}, LabelMode: LabelsAny}, "adam,Émile,Zoe"},
+		{"valid", Query{Valid: &valid}, "adam,Bob,Émile"},
+		{"delivered", Query{Delivery: DeliverySent}, "adam"},
+		{"never messaged", Query{Delivery: DeliveryNone}, "Bob,Émile,Zoe"},
+		{"created after", Query{CreatedAfter: time.Now().Add(time.Hour)}, ""},
+		{"sorted by phone descending", Query{Sort: SortByPhone, Desc: true}, "Bob,Zoe,adam,Émile"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := store.Query("a", tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(page.Contacts); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestQueryPagination(t *testing.T) {
+	store := newQueryStore(t)
+
+	for _, desc := range []bool{false, true} {
+		t.Run(fmt.Sprintf("desc=%v", desc), func(t *testing.T) {
+			var got string
+			query := Query{Limit: 3, Desc: desc}
+			for pages := 0; ; pages++ {
+				page, err := store.Query("a", query)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if page.Total != 4 {
+					t.Fatalf("total = %d, want 4", page.Total)
+				}
+				if got != "" && len(page.Contacts) > 0 {
+					got += ","
+				}
+				got += names(page.Contacts)
+
+				if page.NextCursor == "" {
+					break
+				}
+				if pages > 2 {
+					t.Fatal("pagination does not end")
+				}
+				query.Cursor = page.NextCursor
+			}
+
+			want := "adam,Bob,Émile,Zoe"
+			if desc {
+				want = "Zoe,Émile,Bob,adam"
+			}
+			if got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		})
+	}
+
+	// Changes between pages don't shift the cursor
+	page, _ := store.Query("a", Query{Limit: 2})
+	bob, _ := store.GetByTelegramID("a", 4)
+	if err := store.Delete(bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	page, err := store.Query("a", Query{Limit: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(page.Contacts); got != "Émile,Zoe" {
+		t.Fatalf("got %q after deleting a contact", got)
+	}
+
+	if _, err := store.Query("a", Query{Sort: SortByPhone, Cursor: page.NextCursor + "x"}); err != ErrInvalidCursor {
+		t.Fatalf("got %v for a cursor of another sort order", err)
+	}
+}
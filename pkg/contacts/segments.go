@@ -0,0 +1,323 @@
+package contacts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by the segment store
+var (
+	ErrSegmentNotFound   = errors.New("segment not found")
+	ErrSegmentNameExists = errors.New("a segment with this name already exists")
+)
+
+// Segment is a saved selection of contacts that an owner sends to. It is
+// evaluated against an account's contacts whenever a job starts, so new
+// contacts that match are included.
+type Segment struct {
+	ID              string        `json:"id"`
+	OwnerID         int64         `json:"owner_id"`
+	Name            string        `json:"name"`
+	Filter          SegmentFilter `json:"filter"`
+	ExcludeDelivery []string      `json:"exclude_delivery,omitempty"` // Delivery states to leave out, e.g. DeliveryFailed
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+}
+
+// SegmentFilter selects the contacts of a segment. Zero values don't filter.
+type SegmentFilter struct {
+	Search        string     `json:"q,omitempty"`
+	Labels        []string   `json:"labels,omitempty"`
+	LabelMode     LabelMode  `json:"label_mode,omitempty"`
+	ExcludeLabels []string   `json:"exclude_labels,omitempty"` // Contacts with any of these labels are left out
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	UpdatedAfter  *time.Time `json:"updated_after,omitempty"`
+	UpdatedBefore *time.Time `json:"updated_before,omitempty"`
+}
+
+// Membership is a segment evaluated against the contacts of an account
+type Membership struct {
+	ContactIDs []string `json:"contact_ids"` // Contacts to send to, ordered by name
+	Matched    int      `json:"matched"`     // Contacts matching the filter
+	Suppressed int      `json:"suppressed"`  // Matched, but suppressed or not on Telegram
+	Excluded   int      `json:"excluded"`    // Matched, but left out by their delivery state
+}
+
+// Validate checks a segment before it is saved
+func (seg *Segment) Validate() error {
+	if strings.TrimSpace(seg.Name) == "" {
+		return errors.New("name is required")
+	}
+
+	switch seg.Filter.LabelMode {
+	case "", LabelsAll, LabelsAny:
+	default:
+		return fmt.Errorf("invalid label_mode %q, use all or any", seg.Filter.LabelMode)
+	}
+
+	for _, state := range seg.ExcludeDelivery {
+		switch state {
+		case DeliverySent, DeliveryFailed, DeliveryNone:
+		default:
+			return fmt.Errorf("invalid delivery state %q, use sent, failed or none", state)
+		}
+	}
+
+	return nil
+}
+
+// query returns the contact query of the filter
+func (f *SegmentFilter) query() Query {
+	q := Query{
+		Search:    f.Search,
+		Labels:    f.Labels,
+		LabelMode: f.LabelMode,
+	}
+	for _, t := range []struct {
+		from *time.Time
+		to   *time.Time
+	}{
+		{f.CreatedAfter, &q.CreatedAfter},
+		{f.CreatedBefore, &q.CreatedBefore},
+		{f.UpdatedAfter, &q.UpdatedAfter},
+		{f.UpdatedBefore, &q.UpdatedBefore},
+	} {
+		if t.from != nil {
+			*t.to = *t.from
+		}
+	}
+	return q
+}
+
+// Segment evaluates a segment against the contacts of an account. Suppressed
+// contacts and those not on Telegram are never members.
+func (s *Store) Segment(accountID string, seg *Segment) (*Membership, error) {
+	page, err := s.Query(accountID, seg.Filter.query())
+	if err != nil {
+		return nil, err
+	}
+
+	exclude := make(map[string]bool, len(seg.ExcludeDelivery))
+	for _, state := range seg.ExcludeDelivery {
+		exclude[state] = true
+	}
+	excludeLabels := make(map[string]bool, len(seg.Filter.ExcludeLabels))
+	for _, label := range seg.Filter.ExcludeLabels {
+		excludeLabels[strings.ToLower(strings.TrimSpace(label))] = true
+	}
+
+	membership := &Membership{ContactIDs: make([]string, 0, len(page.Contacts))}
+	for _, c := range page.Contacts {
+		if hasAnyLabel(c.Labels, excludeLabels) {
+			continue
+		}
+		membership.Matched++
+
+		if c.Suppressed || !c.IsValid {
+			membership.Suppressed++
+			continue
+		}
+
+		state := c.LastDelivery
+		if state == "" {
+			state = DeliveryNone
+		}
+		if exclude[state] {
+			membership.Excluded++
+			continue
+		}
+
+		membership.ContactIDs = append(membership.ContactIDs, c.ID)
+	}
+
+	return membership, nil
+}
+
+func hasAnyLabel(labels []string, set map[string]bool) bool {
+	for _, label := range labels {
+		if set[strings.ToLower(label)] {
+			return true
+		}
+	}
+	return false
+}
+
+// SegmentStore persists contact segments
+type SegmentStore struct {
+	mu       sync.RWMutex
+	dataDir  string
+	segments map[string]*Segment // segment ID -> segment
+}
+
+// NewSegmentStore creates a new segment store
+func NewSegmentStore(dataDir string) (*SegmentStore, error) {
+	store := &SegmentStore{
+		dataDir:  dataDir,
+		segments: make(map[string]*Segment),
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("failed to load segments: %w", err)
+	}
+
+	return store, nil
+}
+
+// Create saves a new segment
+func (s *SegmentStore) Create(seg *Segment) (*Segment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTaken(seg.OwnerID, seg.Name, "") {
+		return nil, ErrSegmentNameExists
+	}
+
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	segCopy := *seg
+	segCopy.ID = id
+	segCopy.CreatedAt = time.Now()
+	segCopy.UpdatedAt = segCopy.CreatedAt
+	s.segments[id] = &segCopy
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	result := segCopy
+	return &result, nil
+}
+
+// Update replaces the name, filter and exclusions of a segment
+func (s *SegmentStore) Update(seg *Segment) (*Segment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.segments[seg.ID]
+	if !ok {
+		return nil, ErrSegmentNotFound
+	}
+
+	if s.nameTaken(existing.OwnerID, seg.Name, seg.ID) {
+		return nil, ErrSegmentNameExists
+	}
+
+	existing.Name = seg.Name
+	existing.Filter = seg.Filter
+	existing.ExcludeDelivery = seg.ExcludeDelivery
+	existing.UpdatedAt = time.Now()
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	result := *existing
+	return &result, nil
+}
+
+// Get returns a segment by ID
+func (s *SegmentStore) Get(id string) (*Segment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seg, ok := s.segments[id]
+	if !ok {
+		return nil, false
+	}
+	segCopy := *seg
+	return &segCopy, true
+}
+
+// GetByOwner returns the segments of an owner sorted by name
+func (s *SegmentStore) GetByOwner(ownerID int64) []*Segment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	segments := make([]*Segment, 0)
+	for _, seg := range s.segments {
+		if seg.OwnerID == ownerID {
+			segCopy := *seg
+			segments = append(segments, &segCopy)
+		}
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].Name < segments[j].Name
+	})
+	return segments
+}
+
+// Delete removes a segment. Jobs started for it keep their recipients.
+func (s *SegmentStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.segments[id]; !ok {
+		return ErrSegmentNotFound
+	}
+
+	delete(s.segments, id)
+	return s.save()
+}
+
+// nameTaken reports whether another segment of the owner has the name
+func (s *SegmentStore) nameTaken(ownerID int64, name, exceptID string) bool {
+	for _, seg := range s.segments {
+		if seg.OwnerID == ownerID && seg.ID != exceptID && strings.EqualFold(seg.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *SegmentStore) load() error {
+	filePath := filepath.Join(s.dataDir, "segments.json")
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var segments []*Segment
+	if err := json.Unmarshal(data, &segments); err != nil {
+		return err
+	}
+
+	for _, seg := range segments {
+		s.segments[seg.ID] = seg
+	}
+
+	return nil
+}
+
+func (s *SegmentStore) save() error {
+	segments := make([]*Segment, 0, len(s.segments))
+	for _, seg := range s.segments {
+		segments = append(segments, seg)
+	}
+
+	data, err := json.MarshalIndent(segments, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(s.dataDir, "segments.json")
+	return os.WriteFile(filePath, data, 0600)
+}
@@ -0,0 +1,45 @@
+package contacts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSegmentMembership(t *testing.T) {
+	store := newQueryStore(t)
+
+	adam, _ := store.GetByTelegramID("a", 2)
+	if err := store.RecordDelivery(adam.ID, false, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	bob, _ := store.GetByTelegramID("a", 4)
+	if err := store.SetSuppressed(bob.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		segment Segment
+		want    Membership
+	}{
+		{"everyone", Segment{}, Membership{Matched: 4, Suppressed: 2}}, // Bob and Zoe, who is not on Telegram
+		{"labels", Segment{Filter: SegmentFilter{Labels: []string{"vip", "phone"}, LabelMode: LabelsAny}}, Membership{Matched: 3, Suppressed: 1}},
+		{"exclude labels", Segment{Filter: SegmentFilter{ExcludeLabels: []string{"VIP"}}}, Membership{Matched: 2, Suppressed: 1}},
+		{"exclude failed", Segment{ExcludeDelivery: []string{DeliveryFailed}}, Membership{Matched: 4, Suppressed: 2, Excluded: 1}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := store.Segment("a", &tc.segment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Matched != tc.want.Matched || got.Suppressed != tc.want.Suppressed || got.Excluded != tc.want.Excluded {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+			if len(got.ContactIDs) != got.Matched-got.Suppressed-got.Excluded {
+				t.Fatalf("got %d members of %+v", len(got.ContactIDs), got)
+			}
+		})
+	}
+}
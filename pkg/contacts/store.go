@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
@@ -26,20 +27,35 @@ type Contact struct {
 	IsValid    bool      `json:"is_valid"`            // Whether the phone is registered on Telegram
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
+
+	LastDelivery   string     `json:"last_delivery,omitempty"`    // DeliverySent or DeliveryFailed for the last message sent
+	LastDeliveryAt *time.Time `json:"last_delivery_at,omitempty"` // When the last message was sent
+
+	Suppressed   bool       `json:"suppressed,omitempty"`    // Opted out, never included in segments or messaged
+	SuppressedAt *time.Time `json:"suppressed_at,omitempty"` // When the contact opted out
+
+	TimeZone string `json:"time_zone,omitempty"` // IANA zone for quiet hours, derived from the phone if empty
 }
 
 // Store manages contact storage
 type Store struct {
-	mu       sync.RWMutex
-	dataDir  string
-	contacts map[string]*Contact // keyed by contact ID
+	mu        sync.RWMutex
+	dataDir   string
+	contacts  map[string]*Contact            // keyed by contact ID
+	byAccount map[string]map[string]*Contact // account ID -> contact ID -> contact
+	unsaved   bool                           // Deliveries were recorded since the last save
+
+	viewsMu sync.Mutex
+	views   map[viewKey]view // Sorted contacts per account, see Query
 }
 
 // NewStore creates a new contact store
 func NewStore(dataDir string) (*Store, error) {
 	store := &Store{
-		dataDir:  dataDir,
-		contacts: make(map[string]*Contact),
+		dataDir:   dataDir,
+		contacts:  make(map[string]*Contact),
+		byAccount: make(map[string]map[string]*Contact),
+		views:     make(map[viewKey]view),
 	}
 
 	if err := os.MkdirAll(dataDir, 0700); err != nil {
@@ -59,10 +75,8 @@ func (s *Store) GetByAccount(accountID string) []*Contact {
 	defer s.mu.RUnlock()
 
 	var contacts []*Contact
-	for _, c := range s.contacts {
-		if c.AccountID == accountID {
-			contacts = append(contacts, c)
-		}
+	for _, c := range s.byAccount[accountID] {
+		contacts = append(contacts, c)
 	}
 	return contacts
 }
@@ -73,14 +87,27 @@ func (s *Store) GetValidByAccount(accountID string) []*Contact {
 	defer s.mu.RUnlock()
 
 	var contacts []*Contact
-	for _, c := range s.contacts {
-		if c.AccountID == accountID && c.IsValid {
+	for _, c := range s.byAccount[accountID] {
+		if c.IsValid {
 			contacts = append(contacts, c)
 		}
 	}
 	return contacts
 }
 
+// AccountIDs returns the accounts that have contacts, sorted
+func (s *Store) AccountIDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]string, 0, len(s.byAccount))
+	for id := range s.byAccount {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 // Get returns a contact by ID
 func (s *Store) Get(id string) (*Contact, bool) {
 	s.mu.RLock()
@@ -95,8 +122,21 @@ func (s *Store) GetByPhone(accountID, phone string) (*Contact, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	for _, c := range s.contacts {
-		if c.AccountID == accountID && c.Phone == phone {
+	for _, c := range s.byAccount[accountID] {
+		if c.Phone == phone {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// GetByTelegramID returns a contact by account ID and Telegram user ID
+func (s *Store) GetByTelegramID(accountID string, telegramID int64) (*Contact, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.byAccount[accountID] {
+		if c.TelegramID == telegramID {
 			return c, true
 		}
 	}
@@ -109,13 +149,16 @@ func (s *Store) CreateOrUpdate(contact *Contact) error {
 	defer s.mu.Unlock()
 
 	// Check for existing contact by account ID and phone
-	for _, existing := range s.contacts {
-		if existing.AccountID == contact.AccountID && existing.Phone == contact.Phone {
+	for _, existing := range s.byAccount[contact.AccountID] {
+		if existing.Phone == contact.Phone {
 			// Update existing contact
 			contact.ID = existing.ID
 			contact.CreatedAt = existing.CreatedAt
 			contact.UpdatedAt = time.Now()
-			s.contacts[contact.ID] = contact
+			if contact.TimeZone == "" {
+				contact.TimeZone = existing.TimeZone
+			}
+			s.put(contact)
 			return s.save()
 		}
 	}
@@ -131,7 +174,7 @@ func (s *Store) CreateOrUpdate(contact *Contact) error {
 
 	contact.CreatedAt = time.Now()
 	contact.UpdatedAt = time.Now()
-	s.contacts[contact.ID] = contact
+	s.put(contact)
 
 	return s.save()
 }
@@ -145,8 +188,8 @@ func (s *Store) BulkCreateOrUpdate(contacts []*Contact) error {
 	for _, contact := range contacts {
 		// Check for existing contact by account ID and TelegramID
 		var found bool
-		for _, existing := range s.contacts {
-			if existing.AccountID == contact.AccountID && existing.TelegramID == contact.TelegramID {
+		for _, existing := range s.byAccount[contact.AccountID] {
+			if existing.TelegramID == contact.TelegramID {
 				// Update existing contact
 				contact.ID = existing.ID
 				contact.CreatedAt = existing.CreatedAt
@@ -160,7 +203,10 @@ func (s *Store) BulkCreateOrUpdate(contacts []*Contact) error {
 				if contact.LastName == "" {
 					contact.LastName = existing.LastName
 				}
-				s.contacts[contact.ID] = contact
+				if contact.TimeZone == "" {
+					contact.TimeZone = existing.TimeZone
+				}
+				s.put(contact)
 				found = true
 				break
 			}
@@ -177,7 +223,7 @@ func (s *Store) BulkCreateOrUpdate(contacts []*Contact) error {
 			}
 			contact.CreatedAt = time.Now()
 			contact.UpdatedAt = time.Now()
-			s.contacts[contact.ID] = contact
+			s.put(contact)
 		}
 	}
 
@@ -210,7 +256,7 @@ func (s *Store) Delete(id string) error {
 		return fmt.Errorf("contact not found")
 	}
 
-	delete(s.contacts, id)
+	s.remove(id)
 	return s.save()
 }
 
@@ -228,23 +274,126 @@ func (s *Store) Update(id string, firstName, lastName string, labels []string) e
 	contact.LastName = lastName
 	contact.Labels = labels
 	contact.UpdatedAt = time.Now()
+	s.invalidate(contact.AccountID)
+
+	return s.save()
+}
+
+// SetSuppressed marks a contact as opted out of sends and replies, or back in
+func (s *Store) SetSuppressed(id string, suppressed bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contact, ok := s.contacts[id]
+	if !ok {
+		return fmt.Errorf("contact not found")
+	}
+
+	now := time.Now()
+	if suppressed && !contact.Suppressed {
+		contact.SuppressedAt = &now
+	} else if !suppressed {
+		contact.SuppressedAt = nil
+	}
+	contact.Suppressed = suppressed
+	contact.UpdatedAt = now
+	s.invalidate(contact.AccountID)
+
+	return s.save()
+}
+
+// SetTimeZone sets the IANA time zone quiet hours use for a contact, or
+// clears it with "" so the zone is derived from the phone again
+func (s *Store) SetTimeZone(id, timeZone string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contact, ok := s.contacts[id]
+	if !ok {
+		return fmt.Errorf("contact not found")
+	}
+
+	contact.TimeZone = timeZone
+	contact.UpdatedAt = time.Now()
+	s.invalidate(contact.AccountID)
 
 	return s.save()
 }
 
+// RecordDelivery notes the outcome of the latest message sent to a contact.
+// It is kept in memory until FlushDeliveries or the next change is saved, so
+// a send job does not rewrite the file for every recipient.
+func (s *Store) RecordDelivery(id string, sent bool, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	contact, ok := s.contacts[id]
+	if !ok {
+		return fmt.Errorf("contact not found")
+	}
+
+	contact.LastDelivery = DeliveryFailed
+	if sent {
+		contact.LastDelivery = DeliverySent
+	}
+	contact.LastDeliveryAt = &at
+	s.unsaved = true
+
+	return nil
+}
+
+// FlushDeliveries saves the deliveries recorded since the last save
+func (s *Store) FlushDeliveries() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.unsaved {
+		return nil
+	}
+	return s.save()
+}
+
 // DeleteByAccount removes all contacts for a specific account
 func (s *Store) DeleteByAccount(accountID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for id, c := range s.contacts {
-		if c.AccountID == accountID {
-			delete(s.contacts, id)
-		}
+	for id := range s.byAccount[accountID] {
+		s.remove(id)
 	}
 	return s.save()
 }
 
+// put adds or replaces a contact and keeps the indexes up to date.
+// The caller holds s.mu for writing.
+func (s *Store) put(c *Contact) {
+	if old, ok := s.contacts[c.ID]; ok && old.AccountID != c.AccountID {
+		s.remove(old.ID)
+	}
+
+	s.contacts[c.ID] = c
+	if s.byAccount[c.AccountID] == nil {
+		s.byAccount[c.AccountID] = make(map[string]*Contact)
+	}
+	s.byAccount[c.AccountID][c.ID] = c
+	s.invalidate(c.AccountID)
+}
+
+// remove deletes a contact and its index entries. The caller holds s.mu for writing.
+func (s *Store) remove(id string) {
+	c, ok := s.contacts[id]
+	if !ok {
+		return
+	}
+
+	delete(s.contacts, id)
+	delete(s.byAccount[c.AccountID], id)
+	if len(s.byAccount[c.AccountID]) == 0 {
+		delete(s.byAccount, c.AccountID)
+	}
+	s.invalidate(c.AccountID)
+}
+
 func (s *Store) load() error {
 	filePath := filepath.Join(s.dataDir, "contacts.json")
 	data, err := os.ReadFile(filePath)
@@ -261,7 +410,7 @@ func (s *Store) load() error {
 	}
 
 	for _, c := range contacts {
-		s.contacts[c.ID] = c
+		s.put(c)
 	}
 
 	return nil
@@ -279,7 +428,11 @@ func (s *Store) save() error {
 	}
 
 	filePath := filepath.Join(s.dataDir, "contacts.json")
-	return os.WriteFile(filePath, data, 0600)
+	if err := os.WriteFile(filePath, data, 0600); err != nil {
+		return err
+	}
+	s.unsaved = false
+	return nil
 }
 
 func generateID() (string, error) {
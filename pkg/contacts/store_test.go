@@ -0,0 +1,38 @@
+package contacts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordDeliverySavedOnFlush(t *testing.T) {
+	store := newQueryStore(t)
+	adam, _ := store.GetByTelegramID("a", 2)
+
+	if err := store.RecordDelivery(adam.ID, true, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Get(adam.ID); got.LastDelivery != DeliverySent {
+		t.Fatalf("delivery was not recorded: %+v", got)
+	}
+
+	// Recorded deliveries stay in memory until flushed
+	reloaded, err := NewStore(store.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reloaded.Get(adam.ID); got.LastDelivery != "" {
+		t.Fatalf("delivery was saved before the flush: %+v", got)
+	}
+
+	if err := store.FlushDeliveries(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err = NewStore(store.dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := reloaded.Get(adam.ID); got.LastDelivery != DeliverySent || got.LastDeliveryAt == nil {
+		t.Fatalf("delivery was not saved: %+v", got)
+	}
+}
@@ -0,0 +1,144 @@
+package contacts
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrUnknownTimeZone is returned for time zones that are not IANA names
+var ErrUnknownTimeZone = errors.New("unknown time zone")
+
+// Location returns the time zone of the contact: the one set on it, or else
+// the one of its phone's country. The second result is false when neither is
+// known.
+func (c *Contact) Location() (*time.Location, bool) {
+	name := c.TimeZone
+	if name == "" {
+		name = PhoneTimeZone(c.Phone)
+	}
+	if name == "" {
+		return nil, false
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, false
+	}
+	return loc, true
+}
+
+// ParseTimeZone checks that name is an IANA time zone such as Europe/Kyiv
+func ParseTimeZone(name string) (*time.Location, error) {
+	// LoadLocation also accepts "" and "Local", which depend on the server
+	if name == "" || name == "Local" {
+		return nil, ErrUnknownTimeZone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrUnknownTimeZone
+	}
+	return loc, nil
+}
+
+// PhoneTimeZone returns the time zone of the country a phone number belongs
+// to, from its calling code, or "" if the code is unknown. Countries spanning
+// several zones get the zone most of their population lives in.
+func PhoneTimeZone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+
+	// Calling codes are one to three digits and none is a prefix of another
+	for n := 3; n >= 1; n-- {
+		if len(digits) > n {
+			if zone, ok := callingCodeZones[digits[:n]]; ok {
+				return zone
+			}
+		}
+	}
+	return ""
+}
+
+// callingCodeZones maps country calling codes to a time zone of the country
+var callingCodeZones = map[string]string{
+	"1":   "America/New_York",
+	"7":   "Europe/Moscow",
+	"20":  "Africa/Cairo",
+	"27":  "Africa/Johannesburg",
+	"30":  "Europe/Athens",
+	"31":  "Europe/Amsterdam",
+	"32":  "Europe/Brussels",
+	"33":  "Europe/Paris",
+	"34":  "Europe/Madrid",
+	"36":  "Europe/Budapest",
+	"39":  "Europe/Rome",
+	"40":  "Europe/Bucharest",
+	"41":  "Europe/Zurich",
+	"43":  "Europe/Vienna",
+	"44":  "Europe/London",
+	"45":  "Europe/Copenhagen",
+	"46":  "Europe/Stockholm",
+	"47":  "Europe/Oslo",
+	"48":  "Europe/Warsaw",
+	"49":  "Europe/Berlin",
+	"51":  "America/Lima",
+	"52":  "America/Mexico_City",
+	"54":  "America/Argentina/Buenos_Aires",
+	"55":  "America/Sao_Paulo",
+	"56":  "America/Santiago",
+	"57":  "America/Bogota",
+	"58":  "America/Caracas",
+	"60":  "Asia/Kuala_Lumpur",
+	"61":  "Australia/Sydney",
+	"62":  "Asia/Jakarta",
+	"63":  "Asia/Manila",
+	"64":  "Pacific/Auckland",
+	"65":  "Asia/Singapore",
+	"66":  "Asia/Bangkok",
+	"81":  "Asia/Tokyo",
+	"82":  "Asia/Seoul",
+	"84":  "Asia/Ho_Chi_Minh",
+	"86":  "Asia/Shanghai",
+	"90":  "Europe/Istanbul",
+	"91":  "Asia/Kolkata",
+	"92":  "Asia/Karachi",
+	"93":  "Asia/Kabul",
+	"94":  "Asia/Colombo",
+	"95":  "Asia/Yangon",
+	"98":  "Asia/Tehran",
+	"212": "Africa/Casablanca",
+	"213": "Africa/Algiers",
+	"216": "Africa/Tunis",
+	"234": "Africa/Lagos",
+	"254": "Africa/Nairobi",
+	"351": "Europe/Lisbon",
+	"353": "Europe/Dublin",
+	"358": "Europe/Helsinki",
+	"359": "Europe/Sofia",
+	"370": "Europe/Vilnius",
+	"371": "Europe/Riga",
+	"372": "Europe/Tallinn",
+	"373": "Europe/Chisinau",
+	"374": "Asia/Yerevan",
+	"375": "Europe/Minsk",
+	"380": "Europe/Kyiv",
+	"381": "Europe/Belgrade",
+	"385": "Europe/Zagreb",
+	"420": "Europe/Prague",
+	"421": "Europe/Bratislava",
+	"880": "Asia/Dhaka",
+	"886": "Asia/Taipei",
+	"966": "Asia/Riyadh",
+	"971": "Asia/Dubai",
+	"972": "Asia/Jerusalem",
+	"992": "Asia/Dushanbe",
+	"993": "Asia/Ashgabat",
+	"994": "Asia/Baku",
+	"995": "Asia/Tbilisi",
+	"996": "Asia/Bishkek",
+	"998": "Asia/Tashkent",
+}
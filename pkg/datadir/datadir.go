@@ -0,0 +1,123 @@
+// Package datadir describes where tgsender keeps its files. The CLI commands
+// and serve share one data directory, so a Telegram login made by either is
+// reused by the other.
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Default is the data directory used when none is configured
+const Default = ".data"
+
+// LegacyDir is where earlier CLI versions kept <phone>_session.json files,
+// regardless of the configured data directory
+const LegacyDir = ".data"
+
+// Layout returns the paths of files inside a data directory. Names that come
+// from outside, such as account IDs and phone numbers, are sanitized so that
+// they cannot point outside of it.
+type Layout struct {
+	root string
+}
+
+// New returns the layout of a data directory
+func New(root string) *Layout {
+	if root == "" {
+		root = Default
+	}
+	return &Layout{root: filepath.Clean(root)}
+}
+
+// Root returns the data directory
+func (l *Layout) Root() string {
+	return l.root
+}
+
+// Ensure creates the data directory if it does not exist
+func (l *Layout) Ensure() error {
+	if err := os.MkdirAll(l.root, 0700); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	return nil
+}
+
+// AccountSession returns the Telegram session file of a linked account
+func (l *Layout) AccountSession(accountID string) string {
+	return filepath.Join(l.root, "account_"+sanitize(accountID)+".json")
+}
+
+// PhoneSession returns the Telegram session file of a CLI login that is not
+// linked as an account
+func (l *Layout) PhoneSession(phone string) string {
+	return filepath.Join(l.root, "phone_"+digits(phone)+".json")
+}
+
+// MigrateLegacySessions moves session files left by earlier CLI versions into
+// the layout. A session whose phone belongs to a linked account becomes that
+// account's session; others become phone sessions. Files whose destination
+// already exists are left in place.
+func (l *Layout) MigrateLegacySessions(accountByPhone func(phone string) (string, bool)) error {
+	legacy, err := filepath.Glob(filepath.Join(LegacyDir, "*_session.json"))
+	if err != nil || len(legacy) == 0 {
+		return err
+	}
+
+	if err := l.Ensure(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, from := range legacy {
+		phone := strings.TrimSuffix(filepath.Base(from), "_session.json")
+		if digits(phone) == "" {
+			continue
+		}
+
+		to := l.PhoneSession(phone)
+		if accountID, ok := accountByPhone(phone); ok {
+			to = l.AccountSession(accountID)
+		}
+
+		if _, err := os.Stat(to); err == nil {
+			slog.Warn("not migrating legacy session, destination exists", "from", from, "to", to)
+			continue
+		}
+
+		if err := os.Rename(from, to); err != nil {
+			errs = append(errs, fmt.Errorf("failed to migrate session %s: %w", from, err))
+			continue
+		}
+		slog.Info("migrated legacy session", "from", from, "to", to)
+	}
+
+	return errors.Join(errs...)
+}
+
+// sanitize keeps the characters of a name that are safe in a file name
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return -1
+		}
+	}, name)
+}
+
+// digits keeps the digits of a phone number, so "+1 (555)" and "1555" name
+// the same session
+func digits(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+}
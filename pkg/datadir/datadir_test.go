@@ -0,0 +1,180 @@
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPathsStayInside(t *testing.T) {
+	layout := New("data")
+
+	tests := map[string]string{
+		layout.AccountSession("5001"):          "data/account_5001.json",
+		layout.AccountSession("../../etc/pwd"): "data/account_etcpwd.json",
+		layout.PhoneSession("+1 (555) 0100"):   "data/phone_15550100.json",
+		layout.PhoneSession("../1"):            "data/phone_1.json",
+	}
+	for got, want := range tests {
+		if got != filepath.FromSlash(want) {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestMigrateLegacySessions(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	if err := os.MkdirAll(LegacyDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"380501112233_session.json", "15550100_session.json", "15550199_session.json"} {
+		if err := os.WriteFile(filepath.Join(LegacyDir, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	layout := New("custom")
+	if err := layout.Ensure(); err != nil {
+		t.Fatal(err)
+	}
+	// An existing session is never overwritten
+	if err := os.WriteFile(layout.PhoneSession("15550199"), []byte("newer"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := layout.MigrateLegacySessions(func(phone string) (string, bool) {
+		return "5001", phone == "380501112233"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		layout.AccountSession("5001"):                     "380501112233_session.json",
+		layout.PhoneSession("15550100"):                   "15550100_session.json",
+		layout.PhoneSession("15550199"):                   "newer",
+		filepath.Join(LegacyDir, "15550199_session.json"): "15550199_session.json",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q, %v, want %q", path, data, err, want)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(LegacyDir, "380501112233_session.json")); !os.IsNotExist(err) {
+		t.Errorf("legacy session was not moved: %v", err)
+	}
+}
+
+func TestServeLock(t *testing.T) {
+	layout := New(t.TempDir())
+
+	if err := layout.RequireServeStopped(); err != nil {
+		t.Fatalf("no serve is running: %v", err)
+	}
+
+	unlock, err := layout.LockServe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, ok := layout.ServePID(); !ok || pid != os.Getpid() {
+		t.Fatalf("got pid %d, %v", pid, ok)
+	}
+	if err := layout.RequireServeStopped(); !errors.Is(err, ErrServeRunning) {
+		t.Fatalf("got %v, want ErrServeRunning", err)
+	}
+
+	unlock()
+	if err := layout.RequireServeStopped(); err != nil {
+		t.Fatalf("lock was not released: %v", err)
+	}
+
+	// A lock left by a process that no longer exists is stale
+	if err := os.WriteFile(layout.serveLock(), []byte("999999999"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := layout.ServePID(); ok {
+		t.Fatal("stale lock was reported as running")
+	}
+	unlock, err = layout.LockServe()
+	if err != nil {
+		t.Fatalf("stale lock was not taken over: %v", err)
+	}
+	if pid, ok := layout.ServePID(); !ok || pid != os.Getpid() {
+		t.Fatalf("got pid %d, %v after taking over", pid, ok)
+	}
+	unlock()
+
+	// A lock of a running process, or one being written, is kept
+	for _, held := range []string{strconv.Itoa(os.Getppid()), ""} {
+		if err := os.WriteFile(layout.serveLock(), []byte(held), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := layout.LockServe(); !errors.Is(err, ErrServeRunning) {
+			t.Fatalf("lock %q: got %v, want ErrServeRunning", held, err)
+		}
+		if data, _ := os.ReadFile(layout.serveLock()); string(data) != held {
+			t.Fatalf("lock %q was overwritten with %q", held, data)
+		}
+	}
+}
+
+// TestServeLockHelper takes the serve lock in a child process of
+// TestServeLockIsExclusive
+func TestServeLockHelper(t *testing.T) {
+	dir := os.Getenv("TGSENDER_LOCK_DIR")
+	if dir == "" {
+		t.Skip("only run by TestServeLockIsExclusive")
+	}
+	unlock, err := New(dir).LockServe()
+	if err != nil {
+		fmt.Println("refused")
+		return
+	}
+	fmt.Println("locked")
+	// Hold the lock until every other helper has tried
+	time.Sleep(2 * time.Second)
+	unlock()
+}
+
+func TestServeLockIsExclusive(t *testing.T) {
+	dir := t.TempDir()
+
+	// Serves started at the same time race for the lock
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		locked int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestServeLockHelper$")
+			cmd.Env = append(os.Environ(), "TGSENDER_LOCK_DIR="+dir)
+			out, err := cmd.Output()
+			if err != nil {
+				t.Errorf("helper failed: %v", err)
+				return
+			}
+			if strings.Contains(string(out), "locked") {
+				mu.Lock()
+				locked++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if locked != 1 {
+		t.Fatalf("%d processes took the lock, want 1", locked)
+	}
+}
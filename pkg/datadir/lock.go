@@ -0,0 +1,115 @@
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrServeRunning is returned when serve already uses the data directory
+var ErrServeRunning = errors.New("serve is running with this data directory")
+
+// serveLock is the file serve keeps its process ID in while it runs. Stores
+// are loaded into memory by serve, so other processes must not change them
+// at the same time.
+func (l *Layout) serveLock() string {
+	return filepath.Join(l.root, "serve.pid")
+}
+
+// LockServe records that serve is running and returns a function that
+// releases the lock. The lock file is created atomically, so of two serves
+// started together only one gets it. A lock is taken over only if the process
+// it records no longer exists.
+func (l *Layout) LockServe() (func(), error) {
+	if err := l.Ensure(); err != nil {
+		return nil, err
+	}
+
+	unlock := func() { os.Remove(l.serveLock()) }
+	for attempt := 0; attempt < 3; attempt++ {
+		f, err := os.OpenFile(l.serveLock(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				unlock()
+				return nil, fmt.Errorf("failed to write serve lock: %w", err)
+			}
+			return unlock, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("failed to create serve lock: %w", err)
+		}
+
+		pid, err := l.lockPID()
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// Released in the meantime
+			continue
+		case err != nil:
+			// Possibly written by a serve that is starting right now
+			return nil, fmt.Errorf("%w (%s has no process ID, remove it if serve is not running)", ErrServeRunning, l.serveLock())
+		case pid != os.Getpid() && processExists(pid):
+			return nil, fmt.Errorf("%w (pid %d)", ErrServeRunning, pid)
+		}
+
+		// Left by a process that is gone, or by an earlier run that had this
+		// process ID, as happens in containers
+		if err := os.Remove(l.serveLock()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale serve lock: %w", err)
+		}
+	}
+	return nil, fmt.Errorf("failed to take serve lock %s", l.serveLock())
+}
+
+// ServePID returns the process ID of the serve running with this data
+// directory, if any
+func (l *Layout) ServePID() (int, bool) {
+	pid, err := l.lockPID()
+	if err != nil || !processExists(pid) {
+		return 0, false
+	}
+	return pid, true
+}
+
+// lockPID reads the process ID recorded in the serve lock
+func (l *Layout) lockPID() (int, error) {
+	data, err := os.ReadFile(l.serveLock())
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid process ID %q", data)
+	}
+	return pid, nil
+}
+
+// processExists reports whether a process with the ID is running. A process
+// of another user cannot be signalled but still exists.
+func processExists(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// RequireServeStopped fails while serve is running with this data directory.
+// Commands that change the stores call it, as serve would overwrite their
+// changes with the state it keeps in memory.
+func (l *Layout) RequireServeStopped() error {
+	if pid, ok := l.ServePID(); ok {
+		return fmt.Errorf("%w (pid %d), stop it or use the API instead", ErrServeRunning, pid)
+	}
+	return nil
+}
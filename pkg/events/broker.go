@@ -0,0 +1,169 @@
+// Package events fans out job progress to Server-Sent Events subscribers.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetention  = 5 * time.Minute
+	subscriberBacklog = 64
+)
+
+// Event types published for jobs
+const (
+	TypeRecipient = "recipient" // a send job finished one recipient
+	TypeProgress  = "progress"  // an import job updated its counters
+	TypeStatus    = "status"    // a job changed status
+	TypeError     = "error"     // a job failed
+)
+
+// Event is a single message on a topic. IDs are sequential per topic,
+// starting at 1, so clients can resume with Last-Event-ID.
+type Event struct {
+	ID   int64
+	Type string
+	Data any
+}
+
+// topic holds the history and live subscribers of one job
+type topic struct {
+	events []Event
+	subs   map[chan Event]struct{}
+	closed bool
+	closes int // number of times the topic was closed, to ignore stale expiry timers
+}
+
+// Broker keeps the event history of every open job and delivers new events to
+// subscribers. Closed topics stay available for replay until retention expires.
+type Broker struct {
+	mu        sync.Mutex
+	topics    map[string]*topic
+	retention time.Duration
+}
+
+// NewBroker creates a new event broker
+func NewBroker() *Broker {
+	return &Broker{
+		topics:    make(map[string]*topic),
+		retention: defaultRetention,
+	}
+}
+
+// WithRetention sets how long closed topics stay available for replay
+func (b *Broker) WithRetention(retention time.Duration) *Broker {
+	b.retention = retention
+	return b
+}
+
+// Open creates a topic so that subscribers can attach before the first event.
+// Opening a closed topic that is still retained continues its history.
+func (b *Broker) Open(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.topic(name).closed = false
+}
+
+// Publish appends an event to a topic and delivers it to subscribers.
+// Subscribers that can't keep up are disconnected; they catch up on
+// reconnect by replaying from their last event ID.
+func (b *Broker) Publish(name, eventType string, data any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t := b.topic(name)
+	if t.closed {
+		return
+	}
+
+	event := Event{ID: int64(len(t.events)) + 1, Type: eventType, Data: data}
+	t.events = append(t.events, event)
+
+	for ch := range t.subs {
+		select {
+		case ch <- event:
+		default:
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends a topic. Subscribers receive the remaining events and then
+// their channel is closed. The history is dropped after the retention period.
+func (b *Broker) Close(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[name]
+	if !ok || t.closed {
+		return
+	}
+
+	t.closed = true
+	t.closes++
+	closes := t.closes
+	for ch := range t.subs {
+		delete(t.subs, ch)
+		close(ch)
+	}
+
+	time.AfterFunc(b.retention, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if b.topics[name] == t && t.closed && t.closes == closes {
+			delete(b.topics, name)
+		}
+	})
+}
+
+// Subscribe returns the events after lastEventID and, if the topic is still
+// open, a channel of live events. The channel is nil for closed topics.
+// ok is false if the topic is unknown.
+func (b *Broker) Subscribe(name string, lastEventID int64) (replay []Event, live <-chan Event, unsubscribe func(), ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[name]
+	if !ok {
+		return nil, nil, func() {}, false
+	}
+
+	if lastEventID < 0 {
+		lastEventID = 0
+	}
+	if lastEventID < int64(len(t.events)) {
+		replay = append([]Event(nil), t.events[lastEventID:]...)
+	}
+
+	if t.closed {
+		return replay, nil, func() {}, true
+	}
+
+	ch := make(chan Event, subscriberBacklog)
+	t.subs[ch] = struct{}{}
+
+	unsubscribe = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := t.subs[ch]; ok {
+			delete(t.subs, ch)
+			close(ch)
+		}
+	}
+
+	return replay, ch, unsubscribe, true
+}
+
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{subs: make(map[chan Event]struct{})}
+		b.topics[name] = t
+	}
+	return t
+}
@@ -0,0 +1,161 @@
+package events
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSubscribeReplaysAfterLastEventID(t *testing.T) {
+	b := NewBroker()
+	b.Open("job")
+	b.Publish("job", TypeStatus, "running")
+	b.Publish("job", TypeRecipient, 1)
+	b.Publish("job", TypeRecipient, 2)
+
+	replay, live, unsubscribe, ok := b.Subscribe("job", 1)
+	defer unsubscribe()
+
+	if !ok || live == nil {
+		t.Fatalf("expected an open topic")
+	}
+	if len(replay) != 2 || replay[0].ID != 2 || replay[1].ID != 3 {
+		t.Fatalf("unexpected replay: %+v", replay)
+	}
+
+	b.Publish("job", TypeStatus, "completed")
+	select {
+	case event := <-live:
+		if event.ID != 4 || event.Type != TypeStatus {
+			t.Fatalf("unexpected live event: %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("live event was not delivered")
+	}
+
+	b.Close("job")
+	if _, ok := <-live; ok {
+		t.Fatal("live channel was not closed with the topic")
+	}
+}
+
+func TestSubscribeUnknownTopic(t *testing.T) {
+	if _, _, _, ok := NewBroker().Subscribe("missing", 0); ok {
+		t.Fatal("expected unknown topic")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker()
+	b.Open("job")
+
+	_, live, unsubscribe, _ := b.Subscribe("job", 0)
+	defer unsubscribe()
+
+	for i := 0; i <= subscriberBacklog; i++ {
+		b.Publish("job", TypeRecipient, i)
+	}
+
+	received := 0
+	for range live {
+		received++
+	}
+	if received != subscriberBacklog {
+		t.Fatalf("got %d events before disconnect, want %d", received, subscriberBacklog)
+	}
+
+	// The dropped subscriber can still catch up from where it stopped
+	replay, _, unsubscribe, _ := b.Subscribe("job", int64(received))
+	defer unsubscribe()
+	if len(replay) != 1 || replay[0].ID != subscriberBacklog+1 {
+		t.Fatalf("unexpected replay: %+v", replay)
+	}
+}
+
+func TestClosedTopicExpires(t *testing.T) {
+	b := NewBroker().WithRetention(10 * time.Millisecond)
+	b.Publish("job", TypeStatus, "completed")
+	b.Close("job")
+
+	if _, _, _, ok := b.Subscribe("job", 0); !ok {
+		t.Fatal("closed topic should be kept for replay")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if _, _, _, ok := b.Subscribe("job", 0); ok {
+		t.Fatal("closed topic was not dropped after retention")
+	}
+}
+
+func TestReopenedTopicContinuesHistory(t *testing.T) {
+	b := NewBroker().WithRetention(10 * time.Millisecond)
+	b.Publish("job", TypeStatus, "failed")
+	b.Close("job")
+
+	b.Open("job")
+	b.Publish("job", TypeStatus, "running")
+
+	replay, live, unsubscribe, ok := b.Subscribe("job", 1)
+	defer unsubscribe()
+	if !ok || live == nil || len(replay) != 1 || replay[0].ID != 2 {
+		t.Fatalf("unexpected replay after reopening: %+v", replay)
+	}
+
+	// The expiry scheduled by the first close must not drop the reopened topic
+	time.Sleep(50 * time.Millisecond)
+	if _, _, _, ok := b.Subscribe("job", 0); !ok {
+		t.Fatal("reopened topic was dropped")
+	}
+}
+
+func TestStream(t *testing.T) {
+	b := NewBroker()
+	b.Publish("job", TypeStatus, map[string]string{"status": "running"})
+	b.Publish("job", TypeRecipient, map[string]int{"sent": 1})
+	b.Publish("job", TypeStatus, map[string]string{"status": "completed"})
+	b.Close("job")
+
+	tests := []struct {
+		name   string
+		header string
+		query  string
+		status int
+		want   []string
+	}{
+		{"from start", "", "", http.StatusOK, []string{"id: 1\nevent: status\ndata: {\"status\":\"running\"}\n\n", "id: 3\n"}},
+		{"last event id header", "1", "", http.StatusOK, []string{"id: 2\nevent: recipient\ndata: {\"sent\":1}\n\n"}},
+		{"last event id query", "", "?last_event_id=2", http.StatusOK, []string{"id: 3\nevent: status\n"}},
+		{"nothing left", "3", "", http.StatusNoContent, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/events"+tc.query, nil)
+			if tc.header != "" {
+				req.Header.Set("Last-Event-ID", tc.header)
+			}
+			rec := httptest.NewRecorder()
+
+			if !b.Stream(rec, req, "job") {
+				t.Fatal("topic was not found")
+			}
+			if rec.Code != tc.status {
+				t.Fatalf("got status %d, want %d", rec.Code, tc.status)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(rec.Body.String(), want) {
+					t.Errorf("stream is missing %q:\n%s", want, rec.Body.String())
+				}
+			}
+			if tc.header == "1" && strings.Contains(rec.Body.String(), "id: 1\n") {
+				t.Errorf("stream replayed an acknowledged event:\n%s", rec.Body.String())
+			}
+		})
+	}
+
+	if NewBroker().Stream(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/events", nil), "job") {
+		t.Fatal("unknown topic should not be streamed")
+	}
+}
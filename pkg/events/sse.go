@@ -0,0 +1,112 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const heartbeatInterval = 15 * time.Second
+
+// LastEventID returns the event ID a client wants to resume after. Browsers
+// send the Last-Event-ID header when reconnecting; the last_event_id query
+// parameter covers clients that can't set headers.
+func LastEventID(r *http.Request) int64 {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 0 {
+		return 0
+	}
+	return id
+}
+
+// Stream writes the events of a topic to w as Server-Sent Events, starting
+// after the client's last event ID, until the topic is closed or the client
+// goes away. It returns false without writing anything if the topic is unknown.
+func (b *Broker) Stream(w http.ResponseWriter, r *http.Request, name string) bool {
+	replay, live, unsubscribe, ok := b.Subscribe(name, LastEventID(r))
+	if !ok {
+		return false
+	}
+	defer unsubscribe()
+
+	// A finished topic with nothing left to replay: 204 tells EventSource to stop reconnecting
+	if live == nil && len(replay) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+
+	rc := http.NewResponseController(w)
+	writeHeaders(w)
+
+	for _, event := range replay {
+		if err := writeEvent(w, event); err != nil {
+			return true
+		}
+	}
+	rc.Flush()
+
+	if live == nil {
+		return true
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return true
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return true
+			}
+			rc.Flush()
+		case event, ok := <-live:
+			if !ok {
+				return true
+			}
+			if err := writeEvent(w, event); err != nil {
+				return true
+			}
+			rc.Flush()
+		}
+	}
+}
+
+// WriteSnapshot answers an event stream request with a single event that has
+// no ID. It is used for jobs that finished before the broker knew about them.
+func WriteSnapshot(w http.ResponseWriter, eventType string, data any) {
+	writeHeaders(w)
+	writeEvent(w, Event{Type: eventType, Data: data})
+}
+
+func writeHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeEvent(w http.ResponseWriter, event Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+
+	if event.ID > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
@@ -0,0 +1,335 @@
+package health
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/accounts"
+	"github.com/soluchok/tgsender/pkg/contacts"
+	"github.com/soluchok/tgsender/pkg/messages"
+	tgclient "github.com/soluchok/tgsender/pkg/telegram"
+)
+
+// Status of a check and of the service as a whole
+type Status string
+
+const (
+	StatusOK   Status = "ok"   // Works as expected
+	StatusWarn Status = "warn" // Needs attention but the service can take requests
+	StatusFail Status = "fail" // The service is not ready
+)
+
+// Names of the checks in a report
+const (
+	CheckDataDir  = "data_dir"
+	CheckJobs     = "jobs"
+	CheckTelegram = "telegram"
+)
+
+const (
+	defaultStuckAfter  = 30 * time.Minute
+	defaultConcurrency = 8
+	telegramCacheTTL   = time.Minute
+)
+
+// Report is the outcome of every check, with the worst status of them as
+// the overall status
+type Report struct {
+	Status Status            `json:"status"`
+	Checks map[string]*Check `json:"checks"`
+}
+
+// Check is the outcome of one check. Only the fields of that kind of check
+// are set.
+type Check struct {
+	Status     Status `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+
+	Jobs     map[string]*JobCounts  `json:"jobs,omitempty"`     // Background jobs by kind, "send" or "import"
+	Accounts *ConnectivityBreakdown `json:"accounts,omitempty"` // Telegram connectivity of active accounts
+}
+
+// JobCounts counts the background jobs of one kind that have not finished
+type JobCounts struct {
+	Pending int `json:"pending"` // Waiting for their scheduled time
+	Running int `json:"running"`
+	Paused  int `json:"paused"` // Waiting for quiet hours to end
+	Stuck   int `json:"stuck"`  // Running without progress for longer than the stuck threshold
+}
+
+// ConnectivityBreakdown counts the active accounts by whether a Telegram DC
+// could be reached through their dialer
+type ConnectivityBreakdown struct {
+	Checked     int `json:"checked"`
+	Reachable   int `json:"reachable"`
+	Unreachable int `json:"unreachable"`
+}
+
+// Checker checks that the service can do its work
+type Checker struct {
+	dataDir     string
+	sendJobs    *messages.JobStore
+	importJobs  *contacts.JobManager
+	accounts    *accounts.Store
+	stuckAfter  time.Duration
+	concurrency int
+	token       string
+	checkDC     func(ctx context.Context, proxyURL string) error
+	now         func() time.Time
+
+	// The last Telegram check, reused for telegramCacheTTL so that probes
+	// cannot make the server dial every proxy on each request
+	telegramMu        sync.Mutex
+	telegramCached    *Check
+	telegramCheckedAt time.Time
+}
+
+// NewChecker creates a checker for the data directory
+func NewChecker(dataDir string) *Checker {
+	return &Checker{
+		dataDir:     dataDir,
+		stuckAfter:  defaultStuckAfter,
+		concurrency: defaultConcurrency,
+		checkDC:     tgclient.CheckDC,
+		now:         time.Now,
+	}
+}
+
+// WithJobs counts the send jobs of the store and the import jobs of the manager
+func (c *Checker) WithJobs(sendJobs *messages.JobStore, importJobs *contacts.JobManager) *Checker {
+	c.sendJobs = sendJobs
+	c.importJobs = importJobs
+	return c
+}
+
+// WithAccounts lets the Telegram check reach DCs through the accounts' proxies
+func (c *Checker) WithAccounts(store *accounts.Store) *Checker {
+	c.accounts = store
+	return c
+}
+
+// WithToken requires token as a Bearer token to run the Telegram check
+func (c *Checker) WithToken(token string) *Checker {
+	c.token = token
+	return c
+}
+
+// WithStuckAfter sets how long a running job may go without progress before
+// it counts as stuck
+func (c *Checker) WithStuckAfter(d time.Duration) *Checker {
+	c.stuckAfter = d
+	return c
+}
+
+// Check runs every check, including the Telegram check if telegram is set
+func (c *Checker) Check(ctx context.Context, telegram bool) *Report {
+	report := &Report{Status: StatusOK, Checks: make(map[string]*Check)}
+
+	run := func(name string, check func(ctx context.Context) *Check) {
+		start := time.Now()
+		result := check(ctx)
+		result.DurationMS = time.Since(start).Milliseconds()
+		report.Checks[name] = result
+		if worse(result.Status, report.Status) {
+			report.Status = result.Status
+		}
+	}
+
+	run(CheckDataDir, c.checkDataDir)
+	run(CheckJobs, c.checkJobs)
+	if telegram {
+		run(CheckTelegram, c.cachedTelegram)
+	}
+	return report
+}
+
+// worse reports whether status a is worse than b
+func worse(a, b Status) bool {
+	rank := map[Status]int{StatusOK: 0, StatusWarn: 1, StatusFail: 2}
+	return rank[a] > rank[b]
+}
+
+// checkDataDir writes and removes a file in the data directory
+func (c *Checker) checkDataDir(context.Context) *Check {
+	f, err := os.CreateTemp(c.dataDir, ".ready-*")
+	if err != nil {
+		return &Check{Status: StatusFail, Error: fmt.Sprintf("data directory is not writable: %v", err)}
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write([]byte("ok"))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return &Check{Status: StatusFail, Error: fmt.Sprintf("failed to write to the data directory: %v", err)}
+	}
+	return &Check{Status: StatusOK}
+}
+
+// checkJobs counts unfinished jobs and warns about stuck ones
+func (c *Checker) checkJobs(context.Context) *Check {
+	now := c.now()
+	result := &Check{Status: StatusOK, Jobs: make(map[string]*JobCounts)}
+
+	if c.sendJobs != nil {
+		counts := &JobCounts{}
+		for _, job := range c.sendJobs.List() {
+			switch {
+			case job.Status == messages.JobStatusPending:
+				counts.Pending++
+			case job.Status != messages.JobStatusRunning:
+			case job.PausedUntil != nil:
+				counts.Paused++
+			default:
+				counts.Running++
+				if now.Sub(job.UpdatedAt) > c.stuckAfter {
+					counts.Stuck++
+					slog.Warn("send job is stuck", "job_id", job.ID, "account_id", job.AccountID, "updated_at", job.UpdatedAt)
+				}
+			}
+		}
+		result.Jobs["send"] = counts
+	}
+
+	if c.importJobs != nil {
+		counts := &JobCounts{}
+		for _, job := range c.importJobs.Active() {
+			if job.Status == contacts.JobStatusPending {
+				counts.Pending++
+				continue
+			}
+			counts.Running++
+			if now.Sub(job.UpdatedAt) > c.stuckAfter {
+				counts.Stuck++
+				slog.Warn("import job is stuck", "job_id", job.ID, "account_id", job.AccountID, "updated_at", job.UpdatedAt)
+			}
+		}
+		result.Jobs["import"] = counts
+	}
+
+	for _, counts := range result.Jobs {
+		if counts.Stuck > 0 {
+			result.Status = StatusWarn
+			result.Error = "some jobs made no progress recently"
+		}
+	}
+	return result
+}
+
+// cachedTelegram runs the Telegram check unless it ran recently. Concurrent
+// callers wait for one check instead of each dialing.
+func (c *Checker) cachedTelegram(ctx context.Context) *Check {
+	c.telegramMu.Lock()
+	defer c.telegramMu.Unlock()
+
+	if c.telegramCached == nil || c.now().Sub(c.telegramCheckedAt) >= telegramCacheTTL {
+		result := c.checkTelegram(ctx)
+		if ctx.Err() != nil {
+			// Don't keep a check cut short by a caller going away
+			return result
+		}
+		c.telegramCached, c.telegramCheckedAt = result, c.now()
+	}
+
+	cached := *c.telegramCached
+	breakdown := *cached.Accounts
+	cached.Accounts = &breakdown
+	return &cached
+}
+
+// checkTelegram connects to a Telegram DC once per distinct dialer of the
+// active accounts. It fails if no account can reach Telegram and warns if
+// some cannot. Unreachable accounts are logged rather than reported.
+func (c *Checker) checkTelegram(ctx context.Context) *Check {
+	if c.accounts == nil {
+		return &Check{Status: StatusOK, Accounts: &ConnectivityBreakdown{}}
+	}
+
+	// Accounts by the proxy they connect through, "" for none
+	byProxy := make(map[string][]string)
+	for _, account := range c.accounts.List() {
+		if account.IsActive {
+			byProxy[account.ProxyURL] = append(byProxy[account.ProxyURL], account.ID)
+		}
+	}
+
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		breakdown = &ConnectivityBreakdown{}
+		sem       = make(chan struct{}, c.concurrency)
+	)
+	for proxyURL, accountIDs := range byProxy {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			err := c.checkDC(ctx, proxyURL)
+
+			mu.Lock()
+			defer mu.Unlock()
+			breakdown.Checked += len(accountIDs)
+			if err != nil {
+				breakdown.Unreachable += len(accountIDs)
+				slog.Warn("telegram is unreachable", "account_ids", accountIDs, "error", err)
+				return
+			}
+			breakdown.Reachable += len(accountIDs)
+		}()
+	}
+	wg.Wait()
+
+	result := &Check{Status: StatusOK, Accounts: breakdown}
+	switch {
+	case breakdown.Unreachable == 0:
+	case breakdown.Reachable == 0:
+		result.Status = StatusFail
+		result.Error = "no account can reach Telegram"
+	default:
+		result.Status = StatusWarn
+		result.Error = "some accounts cannot reach Telegram"
+	}
+	return result
+}
+
+// HandleReady handles GET /api/ready. It responds with 503 if any check
+// failed. Set telegram=true to also check Telegram connectivity, which needs
+// the token if one is set.
+func (c *Checker) HandleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	telegram := r.URL.Query().Get("telegram") == "true"
+	if telegram && c.token != "" {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(c.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ready"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	report := c.Check(r.Context(), telegram)
+
+	status := http.StatusOK
+	if report.Status == StatusFail {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
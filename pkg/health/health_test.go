@@ -0,0 +1,126 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/accounts"
+	"github.com/soluchok/tgsender/pkg/messages"
+)
+
+func TestCheckJobsCountsStuckJobs(t *testing.T) {
+	now := time.Now()
+	jobs, err := messages.NewJobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create job store: %v", err)
+	}
+	until := now.Add(time.Hour)
+	for _, job := range []*messages.SendJob{
+		{ID: "fresh", Status: messages.JobStatusRunning, UpdatedAt: now.Add(-time.Minute)},
+		{ID: "stuck", Status: messages.JobStatusRunning, UpdatedAt: now.Add(-time.Hour)},
+		{ID: "paused", Status: messages.JobStatusRunning, UpdatedAt: now.Add(-time.Hour), PausedUntil: &until},
+		{ID: "scheduled", Status: messages.JobStatusPending, UpdatedAt: now.Add(-time.Hour)},
+		{ID: "done", Status: messages.JobStatusCompleted, UpdatedAt: now.Add(-time.Hour)},
+	} {
+		if err := jobs.Create(job); err != nil {
+			t.Fatalf("failed to create job: %v", err)
+		}
+	}
+
+	checker := NewChecker(t.TempDir()).WithJobs(jobs, nil).WithStuckAfter(10 * time.Minute)
+	checker.now = func() time.Time { return now }
+
+	check := checker.checkJobs(context.Background())
+	if check.Status != StatusWarn {
+		t.Fatalf("got status %s, want warn", check.Status)
+	}
+	want := JobCounts{Pending: 1, Running: 2, Paused: 1, Stuck: 1}
+	if got := check.Jobs["send"]; got == nil || *got != want {
+		t.Fatalf("got send jobs %+v, want %+v", got, want)
+	}
+}
+
+func TestCheckTelegramBreakdown(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := accounts.NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create account store: %v", err)
+	}
+	for _, account := range []*accounts.Account{
+		{TelegramID: 1, Phone: "+10000000001", IsActive: true},
+		{TelegramID: 2, Phone: "+10000000002", IsActive: true, ProxyURL: "socks5://proxy-a:1080"},
+		{TelegramID: 3, Phone: "+10000000003", IsActive: true, ProxyURL: "socks5://proxy-b:1080"},
+		{TelegramID: 4, Phone: "+10000000004", IsActive: false, ProxyURL: "socks5://proxy-b:1080"},
+	} {
+		if err := store.Create(account); err != nil {
+			t.Fatalf("failed to create account: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		down    map[string]bool
+		status  Status
+		reached int
+	}{
+		{"all reachable", nil, StatusOK, 3},
+		{"one proxy down", map[string]bool{"socks5://proxy-b:1080": true}, StatusWarn, 2},
+		{"all down", map[string]bool{"": true, "socks5://proxy-a:1080": true, "socks5://proxy-b:1080": true}, StatusFail, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			checker := NewChecker(dataDir).WithAccounts(store)
+			checker.checkDC = func(_ context.Context, proxyURL string) error {
+				if tc.down[proxyURL] {
+					return errors.New("connection refused")
+				}
+				return nil
+			}
+
+			check := checker.checkTelegram(context.Background())
+			if check.Status != tc.status {
+				t.Fatalf("got status %s, want %s", check.Status, tc.status)
+			}
+			want := ConnectivityBreakdown{Checked: 3, Reachable: tc.reached, Unreachable: 3 - tc.reached}
+			if *check.Accounts != want {
+				t.Fatalf("got %+v, want %+v", *check.Accounts, want)
+			}
+		})
+	}
+}
+
+func TestTelegramCheckIsCached(t *testing.T) {
+	store, err := accounts.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create account store: %v", err)
+	}
+	if err := store.Create(&accounts.Account{TelegramID: 1, Phone: "+10000000001", IsActive: true}); err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+
+	now := time.Now()
+	dials := 0
+	checker := NewChecker(t.TempDir()).WithAccounts(store)
+	checker.now = func() time.Time { return now }
+	checker.checkDC = func(context.Context, string) error {
+		dials++
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+		if report := checker.Check(context.Background(), true); report.Checks[CheckTelegram].Status != StatusOK {
+			t.Fatalf("unexpected telegram check: %+v", report.Checks[CheckTelegram])
+		}
+	}
+	if dials != 1 {
+		t.Fatalf("dialed %d times within the cache TTL, want 1", dials)
+	}
+
+	now = now.Add(telegramCacheTTL)
+	checker.Check(context.Background(), true)
+	if dials != 2 {
+		t.Fatalf("dialed %d times after the cache TTL, want 2", dials)
+	}
+}
@@ -0,0 +1,248 @@
+package inbox
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/soluchok/tgsender/pkg/accounts"
+	"github.com/soluchok/tgsender/pkg/auth"
+	"github.com/soluchok/tgsender/pkg/contacts"
+	"github.com/soluchok/tgsender/pkg/workspaces"
+)
+
+// maxReplyLength is Telegram's limit for a text message
+const maxReplyLength = 4096
+
+// Handler provides HTTP handlers for the inbox
+type Handler struct {
+	store        *Store
+	listener     *Listener
+	accountStore *accounts.Store
+	contactStore *contacts.Store
+	auth         *auth.Handler
+	workspaces   *workspaces.Store
+}
+
+// NewHandler creates a new inbox handler
+func NewHandler(store *Store, listener *Listener, accountStore *accounts.Store, contactStore *contacts.Store, authHandler *auth.Handler) *Handler {
+	return &Handler{
+		store:        store,
+		listener:     listener,
+		accountStore: accountStore,
+		contactStore: contactStore,
+		auth:         authHandler,
+	}
+}
+
+// WithWorkspaces lets members of an account's team workspace use its inbox
+func (h *Handler) WithWorkspaces(store *workspaces.Store) *Handler {
+	h.workspaces = store
+	return h
+}
+
+// ThreadView is a thread together with the contact it is with
+type ThreadView struct {
+	*Thread
+	Contact *contacts.Contact `json:"contact,omitempty"`
+}
+
+// ReplyRequest represents the request body for replying to a thread
+type ReplyRequest struct {
+	Text string `json:"text"`
+}
+
+// HandleListThreads handles GET /api/accounts/{id}/inbox
+func (h *Handler) HandleListThreads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account, ok := h.authorizeAccount(w, r, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	threads := h.store.Threads(account.ID)
+	views := make([]ThreadView, 0, len(threads))
+	unread := 0
+	for _, thread := range threads {
+		contact, _ := h.contactStore.Get(thread.ContactID)
+		views = append(views, ThreadView{Thread: thread, Contact: contact})
+		unread += thread.Unread
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"threads": views,
+		"unread":  unread,
+	}, http.StatusOK)
+}
+
+// HandleGetThread handles GET /api/accounts/{id}/inbox/{contactId}
+func (h *Handler) HandleGetThread(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account, ok := h.authorizeAccount(w, r, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	contact, ok := h.getContact(w, r, account.ID)
+	if !ok {
+		return
+	}
+
+	messages := make([]*Message, 0)
+	if conv, ok := h.store.Get(account.ID, contact.ID); ok {
+		messages = conv.Messages
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"contact":  contact,
+		"messages": messages,
+	}, http.StatusOK)
+}
+
+// HandleMarkRead handles POST /api/accounts/{id}/inbox/{contactId}/read
+func (h *Handler) HandleMarkRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account, ok := h.authorizeAccount(w, r, workspaces.RoleOperator)
+	if !ok {
+		return
+	}
+
+	contact, ok := h.getContact(w, r, account.ID)
+	if !ok {
+		return
+	}
+
+	if err := h.store.MarkRead(account.ID, contact.ID); err != nil {
+		writeJSONError(w, "Failed to mark thread as read", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Thread marked as read"}, http.StatusOK)
+}
+
+// HandleReply handles POST /api/accounts/{id}/inbox/{contactId}/reply
+func (h *Handler) HandleReply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account, ok := h.authorizeAccount(w, r, workspaces.RoleOperator)
+	if !ok {
+		return
+	}
+
+	contact, ok := h.getContact(w, r, account.ID)
+	if !ok {
+		return
+	}
+	if contact.Suppressed {
+		writeJSONError(w, "Contact has opted out of messages", http.StatusConflict)
+		return
+	}
+
+	var req ReplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Text = strings.TrimSpace(req.Text)
+	if req.Text == "" {
+		writeJSONError(w, "Text is required", http.StatusBadRequest)
+		return
+	}
+
+	if len([]rune(req.Text)) > maxReplyLength {
+		writeJSONError(w, "Text is too long", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := h.listener.Reply(r.Context(), account, contact, req.Text)
+	if err != nil {
+		slog.Error("failed to send inbox reply",
+			slog.String("account_id", account.ID),
+			slog.String("contact_id", contact.ID),
+			slog.String("error", err.Error()),
+		)
+		writeJSONError(w, "Failed to send reply: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Answering a thread means it has been read
+	if err := h.store.MarkRead(account.ID, contact.ID); err != nil {
+		slog.Error("failed to mark thread as read", "error", err)
+	}
+
+	writeJSON(w, msg, http.StatusOK)
+}
+
+// authorizeAccount loads the account from the path and checks the caller has
+// at least the role in its workspace. It writes the error response and
+// returns false otherwise.
+func (h *Handler) authorizeAccount(w http.ResponseWriter, r *http.Request, need workspaces.Role) (*accounts.Account, bool) {
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Get account ID from path
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeJSONError(w, "Account ID required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	// Verify account exists and the caller's role in its workspace allows this
+	account, ok := h.accountStore.Get(accountID)
+	if !ok {
+		writeJSONError(w, "Account not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if h.workspaces.Authorize(ownerID, account.OwnerID, need) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return nil, false
+	}
+
+	return account, true
+}
+
+// getContact loads the contact from the path and checks it belongs to the account
+func (h *Handler) getContact(w http.ResponseWriter, r *http.Request, accountID string) (*contacts.Contact, bool) {
+	contact, ok := h.contactStore.Get(r.PathValue("contactId"))
+	if !ok || contact.AccountID != accountID {
+		writeJSONError(w, "Contact not found", http.StatusNotFound)
+		return nil, false
+	}
+	return contact, true
+}
+
+func (h *Handler) getOwnerID(r *http.Request) (int64, bool) {
+	return h.auth.OwnerID(r)
+}
+
+// Helper functions for JSON responses
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeJSONError(w http.ResponseWriter, message string, status int) {
+	writeJSON(w, map[string]string{"error": message}, status)
+}
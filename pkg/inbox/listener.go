@@ -0,0 +1,241 @@
+package inbox
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+
+	"github.com/soluchok/tgsender/pkg/accounts"
+	"github.com/soluchok/tgsender/pkg/contacts"
+	tgclient "github.com/soluchok/tgsender/pkg/telegram"
+)
+
+const (
+	defaultSyncInterval = time.Minute
+	minReconnectDelay   = 5 * time.Second
+	maxReconnectDelay   = 5 * time.Minute
+)
+
+// Listener keeps an update connection open for every active account and
+// stores private messages exchanged with known contacts
+type Listener struct {
+	store        *Store
+	accountStore *accounts.Store
+	contactStore *contacts.Store
+	appID        int
+	appHash      string
+	syncInterval time.Duration
+
+	mu      sync.Mutex
+	running map[string]*listenerRun // account ID -> running listener
+}
+
+type listenerRun struct {
+	proxyURL string
+	cancel   context.CancelFunc
+}
+
+// NewListener creates a new inbox listener
+func NewListener(store *Store, accountStore *accounts.Store, contactStore *contacts.Store, appID int, appHash string) *Listener {
+	return &Listener{
+		store:        store,
+		accountStore: accountStore,
+		contactStore: contactStore,
+		appID:        appID,
+		appHash:      appHash,
+		syncInterval: defaultSyncInterval,
+		running:      make(map[string]*listenerRun),
+	}
+}
+
+// WithSyncInterval sets how often the listener picks up added, removed or reconfigured accounts
+func (l *Listener) WithSyncInterval(interval time.Duration) *Listener {
+	l.syncInterval = interval
+	return l
+}
+
+// Run listens on every active account until ctx is done
+func (l *Listener) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		l.sync(ctx)
+
+		select {
+		case <-ctx.Done():
+			l.stopAll()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync starts listeners for new active accounts, restarts those whose proxy
+// changed and stops those that were removed or deactivated
+func (l *Listener) sync(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	active := make(map[string]bool)
+	for _, account := range l.accountStore.List() {
+		if !account.IsActive {
+			continue
+		}
+		active[account.ID] = true
+
+		if run, ok := l.running[account.ID]; ok {
+			if run.proxyURL == account.ProxyURL {
+				continue
+			}
+			run.cancel()
+		}
+
+		runCtx, cancel := context.WithCancel(ctx)
+		l.running[account.ID] = &listenerRun{proxyURL: account.ProxyURL, cancel: cancel}
+		go l.listen(runCtx, account.ID, account.ProxyURL)
+	}
+
+	for accountID, run := range l.running {
+		if !active[accountID] {
+			run.cancel()
+			delete(l.running, accountID)
+		}
+	}
+}
+
+func (l *Listener) stopAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for accountID, run := range l.running {
+		run.cancel()
+		delete(l.running, accountID)
+	}
+}
+
+// listen keeps a client connected for one account, reconnecting with backoff.
+// The update manager keeps the update state in memory between connections,
+// so messages received while disconnected are fetched on reconnect. The state
+// is not saved, so messages received while serve is down are not.
+func (l *Listener) listen(ctx context.Context, accountID, proxyURL string) {
+	delay := minReconnectDelay
+	gaps := l.updateManager(accountID)
+
+	for {
+		start := time.Now()
+		err := l.connect(ctx, gaps, accountID, proxyURL)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// A connection that stayed up for a while resets the backoff
+		if time.Since(start) > maxReconnectDelay {
+			delay = minReconnectDelay
+		}
+
+		slog.Warn("inbox listener disconnected",
+			slog.String("account_id", accountID),
+			slog.Any("error", err),
+			slog.Duration("retry_in", delay),
+		)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// updateManager routes an account's updates to handleMessage. Telegram sends
+// most private messages as UpdateShortMessage, which the manager turns into
+// UpdateNewMessage; it also fetches the updates missed in gaps.
+func (l *Listener) updateManager(accountID string) *updates.Manager {
+	dispatcher := tg.NewUpdateDispatcher()
+	dispatcher.OnNewMessage(func(ctx context.Context, _ tg.Entities, update *tg.UpdateNewMessage) error {
+		if msg, ok := update.Message.(*tg.Message); ok {
+			l.handleMessage(accountID, msg)
+		}
+		return nil
+	})
+
+	return updates.New(updates.Config{Handler: dispatcher})
+}
+
+func (l *Listener) connect(ctx context.Context, gaps *updates.Manager, accountID, proxyURL string) error {
+	client, err := tgclient.CreateClientWithHandler(l.appID, l.appHash, l.accountStore.SessionPath(accountID), proxyURL, gaps)
+	if err != nil {
+		return err
+	}
+
+	return tgclient.Run(ctx, client, func(ctx context.Context) error {
+		self, err := client.Self(ctx)
+		if err != nil {
+			return err
+		}
+
+		return runUpdates(ctx, gaps, client.API(), self.ID, updates.AuthOptions{
+			OnStart: func(ctx context.Context) {
+				slog.Info("inbox listener connected", slog.String("account_id", accountID))
+			},
+		})
+	})
+}
+
+// runUpdates requests the update state, without which Telegram pushes no
+// updates, and handles updates until ctx is done or the connection fails. The
+// manager refuses to run twice until reset, so it is reset for the next
+// connection; the state it saved is kept.
+func runUpdates(ctx context.Context, gaps *updates.Manager, api updates.API, selfID int64, opt updates.AuthOptions) error {
+	defer gaps.Reset()
+	return gaps.Run(ctx, api, selfID, opt)
+}
+
+// handleMessage stores a private message if the other side is a known contact
+func (l *Listener) handleMessage(accountID string, msg *tg.Message) {
+	peer, ok := msg.PeerID.(*tg.PeerUser)
+	if !ok {
+		return
+	}
+
+	contact, ok := l.contactStore.GetByTelegramID(accountID, peer.UserID)
+	if !ok {
+		return
+	}
+
+	direction := DirectionIncoming
+	if msg.Out {
+		direction = DirectionOutgoing
+	}
+
+	added, err := l.store.Add(accountID, contact.ID, &Message{
+		TelegramMessageID: msg.ID,
+		Direction:         direction,
+		Text:              msg.Message,
+		HasMedia:          msg.Media != nil,
+		Read:              msg.Out,
+		Date:              time.Unix(int64(msg.Date), 0),
+	})
+	if err != nil {
+		slog.Error("failed to store inbox message",
+			slog.String("account_id", accountID),
+			slog.String("contact_id", contact.ID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if added && direction == DirectionIncoming {
+		slog.Info("inbox message received",
+			slog.String("account_id", accountID),
+			slog.String("contact_id", contact.ID),
+		)
+	}
+}
@@ -0,0 +1,158 @@
+package inbox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+
+	"github.com/soluchok/tgsender/pkg/contacts"
+)
+
+func TestHandleMessage(t *testing.T) {
+	dataDir := t.TempDir()
+
+	store, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	contactStore, err := contacts.NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create contact store: %v", err)
+	}
+	contact := &contacts.Contact{AccountID: "1", TelegramID: 42, AccessHash: 7, FirstName: "Carol", IsValid: true}
+	if err := contactStore.CreateOrUpdate(contact); err != nil {
+		t.Fatalf("failed to create contact: %v", err)
+	}
+
+	l := NewListener(store, nil, contactStore, 1, "hash")
+
+	// Known contact, incoming and outgoing
+	l.handleMessage("1", &tg.Message{ID: 10, PeerID: &tg.PeerUser{UserID: 42}, Message: "hi there", Date: 1000})
+	l.handleMessage("1", &tg.Message{ID: 11, Out: true, PeerID: &tg.PeerUser{UserID: 42}, Message: "hello", Date: 1001})
+	// Duplicate delivery of the same message
+	l.handleMessage("1", &tg.Message{ID: 10, PeerID: &tg.PeerUser{UserID: 42}, Message: "hi there", Date: 1000})
+	// Unknown user, group chat and another account's contact are ignored
+	l.handleMessage("1", &tg.Message{ID: 12, PeerID: &tg.PeerUser{UserID: 99}, Message: "spam", Date: 1002})
+	l.handleMessage("1", &tg.Message{ID: 13, PeerID: &tg.PeerChat{ChatID: 5}, Message: "group", Date: 1003})
+	l.handleMessage("2", &tg.Message{ID: 14, PeerID: &tg.PeerUser{UserID: 42}, Message: "other", Date: 1004})
+
+	threads := store.Threads("1")
+	if len(threads) != 1 {
+		t.Fatalf("got %d threads, want 1", len(threads))
+	}
+	if threads[0].ContactID != contact.ID || threads[0].Total != 2 || threads[0].Unread != 1 {
+		t.Fatalf("unexpected thread: %+v", threads[0])
+	}
+
+	conv, _ := store.Get("1", contact.ID)
+	if conv.Messages[0].Direction != DirectionIncoming || conv.Messages[0].Text != "hi there" || conv.Messages[0].Read {
+		t.Fatalf("unexpected incoming message: %+v", conv.Messages[0])
+	}
+	if conv.Messages[1].Direction != DirectionOutgoing || !conv.Messages[1].Read {
+		t.Fatalf("unexpected outgoing message: %+v", conv.Messages[1])
+	}
+
+	if threads := store.Threads("2"); len(threads) != 0 {
+		t.Fatalf("message for another account was stored: %+v", threads)
+	}
+
+	// The conversation survives a restart
+	reloaded, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to reload store: %v", err)
+	}
+	if threads := reloaded.Threads("1"); len(threads) != 1 || threads[0].Total != 2 {
+		t.Fatalf("conversation was not persisted: %+v", threads)
+	}
+}
+
+// fakeUpdatesAPI serves the update state of an account with no missed updates
+type fakeUpdatesAPI struct{}
+
+func (fakeUpdatesAPI) UpdatesGetState(context.Context) (*tg.UpdatesState, error) {
+	return &tg.UpdatesState{Pts: 1, Qts: 1, Seq: 1, Date: 1000}, nil
+}
+
+func (fakeUpdatesAPI) UpdatesGetDifference(context.Context, *tg.UpdatesGetDifferenceRequest) (tg.UpdatesDifferenceClass, error) {
+	return &tg.UpdatesDifferenceEmpty{Date: 1000, Seq: 1}, nil
+}
+
+func (fakeUpdatesAPI) UpdatesGetChannelDifference(context.Context, *tg.UpdatesGetChannelDifferenceRequest) (tg.UpdatesChannelDifferenceClass, error) {
+	return &tg.UpdatesChannelDifferenceEmpty{Final: true, Pts: 1}, nil
+}
+
+func TestUpdateManagerStoresShortMessages(t *testing.T) {
+	dataDir := t.TempDir()
+
+	store, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	contactStore, err := contacts.NewStore(dataDir)
+	if err != nil {
+		t.Fatalf("failed to create contact store: %v", err)
+	}
+	contact := &contacts.Contact{AccountID: "1", TelegramID: 42, AccessHash: 7, FirstName: "Carol", IsValid: true}
+	if err := contactStore.CreateOrUpdate(contact); err != nil {
+		t.Fatalf("failed to create contact: %v", err)
+	}
+
+	l := NewListener(store, nil, contactStore, 1, "hash")
+	gaps := l.updateManager("1")
+
+	// Each connection runs the same manager, so it must run again after a disconnect
+	for i, text := range []string{"short reply", "after reconnect"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- runUpdates(ctx, gaps, fakeUpdatesAPI{}, 1000, updates.AuthOptions{
+				OnStart: func(context.Context) { close(started) },
+			})
+		}()
+		select {
+		case <-started:
+		case err := <-done:
+			cancel()
+			t.Fatalf("run %d: update manager did not start: %v", i+1, err)
+		case <-time.After(5 * time.Second):
+			cancel()
+			t.Fatalf("run %d: update manager did not start", i+1)
+		}
+
+		// Telegram sends most incoming private messages in the short form
+		update := &tg.UpdateShortMessage{ID: 20 + i, UserID: 42, Message: text, Pts: 2 + i, PtsCount: 1, Date: 1005 + i}
+		if err := gaps.Handle(ctx, update); err != nil {
+			cancel()
+			t.Fatalf("run %d: failed to handle update: %v", i+1, err)
+		}
+		waitForMessages(t, store, contact.ID, i+1)
+
+		cancel()
+		<-done
+	}
+
+	conv, _ := store.Get("1", contact.ID)
+	for i, msg := range conv.Messages {
+		if msg.Direction != DirectionIncoming || msg.TelegramMessageID != 20+i {
+			t.Fatalf("unexpected message: %+v", msg)
+		}
+	}
+}
+
+// waitForMessages waits until the conversation with a contact has n messages
+func waitForMessages(t *testing.T, store *Store, contactID string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if conv, ok := store.Get("1", contactID); ok && len(conv.Messages) == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d stored messages", n)
+}
@@ -0,0 +1,72 @@
+package inbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/tg"
+
+	"github.com/soluchok/tgsender/pkg/accounts"
+	"github.com/soluchok/tgsender/pkg/contacts"
+	tgclient "github.com/soluchok/tgsender/pkg/telegram"
+)
+
+// Reply sends text from an account to a contact and records it in the conversation
+func (l *Listener) Reply(ctx context.Context, account *accounts.Account, contact *contacts.Contact, text string) (*Message, error) {
+	client, err := tgclient.CreateClient(l.appID, l.appHash, l.accountStore.SessionPath(account.ID), account.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	var messageID int
+	err = tgclient.Run(ctx, client, func(ctx context.Context) error {
+		peer := &tg.InputPeerUser{
+			UserID:     contact.TelegramID,
+			AccessHash: contact.AccessHash,
+		}
+
+		updates, err := message.NewSender(client.API()).To(peer).Text(ctx, text)
+		if err != nil {
+			return err
+		}
+
+		messageID = sentMessageID(updates)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send reply: %w", err)
+	}
+
+	msg := &Message{
+		TelegramMessageID: messageID,
+		Direction:         DirectionOutgoing,
+		Text:              text,
+		Read:              true,
+		Date:              time.Now(),
+	}
+	if _, err := l.store.Add(account.ID, contact.ID, msg); err != nil {
+		return nil, fmt.Errorf("failed to store reply: %w", err)
+	}
+
+	return msg, nil
+}
+
+// sentMessageID extracts the ID Telegram assigned to a message we sent
+func sentMessageID(updates tg.UpdatesClass) int {
+	switch u := updates.(type) {
+	case *tg.UpdateShortSentMessage:
+		return u.ID
+	case *tg.Updates:
+		for _, update := range u.Updates {
+			switch v := update.(type) {
+			case *tg.UpdateMessageID:
+				return v.ID
+			case *tg.UpdateNewMessage:
+				return v.Message.GetID()
+			}
+		}
+	}
+	return 0
+}
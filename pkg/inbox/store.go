@@ -0,0 +1,272 @@
+// Package inbox collects private messages exchanged between linked accounts
+// and their contacts, and lets staff read and answer them.
+package inbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxMessagesPerThread bounds how much history is kept for one conversation
+const maxMessagesPerThread = 500
+
+// Direction tells who wrote a message
+type Direction string
+
+const (
+	DirectionIncoming Direction = "in"  // written by the contact
+	DirectionOutgoing Direction = "out" // written by the linked account
+)
+
+// Message is a single message in a conversation
+type Message struct {
+	ID                string    `json:"id"`
+	TelegramMessageID int       `json:"telegram_message_id,omitempty"` // Message ID within the private chat
+	Direction         Direction `json:"direction"`
+	Text              string    `json:"text"`
+	HasMedia          bool      `json:"has_media,omitempty"`
+	Read              bool      `json:"read"`
+	Date              time.Time `json:"date"`
+}
+
+// Conversation is the message history between an account and one contact
+type Conversation struct {
+	AccountID string     `json:"account_id"`
+	ContactID string     `json:"contact_id"`
+	Messages  []*Message `json:"messages"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Thread summarizes a conversation for listings
+type Thread struct {
+	AccountID   string    `json:"account_id"`
+	ContactID   string    `json:"contact_id"`
+	LastMessage *Message  `json:"last_message,omitempty"`
+	Unread      int       `json:"unread"`
+	Total       int       `json:"total"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Store manages conversation storage
+type Store struct {
+	mu            sync.RWMutex
+	dataDir       string
+	conversations map[string]*Conversation // keyed by account ID + contact ID
+}
+
+// NewStore creates a new conversation store
+func NewStore(dataDir string) (*Store, error) {
+	store := &Store{
+		dataDir:       dataDir,
+		conversations: make(map[string]*Conversation),
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("failed to load conversations: %w", err)
+	}
+
+	return store, nil
+}
+
+// Add appends a message to the conversation between an account and a contact.
+// Messages with a Telegram message ID already in the conversation are not
+// added again; msg is filled with the stored copy instead. It reports whether
+// the message was added.
+func (s *Store) Add(accountID, contactID string, msg *Message) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := conversationKey(accountID, contactID)
+	conv, ok := s.conversations[key]
+	if !ok {
+		conv = &Conversation{AccountID: accountID, ContactID: contactID}
+		s.conversations[key] = conv
+	}
+
+	if msg.TelegramMessageID != 0 {
+		for _, existing := range conv.Messages {
+			if existing.TelegramMessageID == msg.TelegramMessageID {
+				*msg = *existing
+				return false, nil
+			}
+		}
+	}
+
+	if msg.ID == "" {
+		id, err := generateID()
+		if err != nil {
+			return false, err
+		}
+		msg.ID = id
+	}
+	if msg.Date.IsZero() {
+		msg.Date = time.Now()
+	}
+
+	conv.Messages = append(conv.Messages, msg)
+	sort.SliceStable(conv.Messages, func(i, j int) bool {
+		return conv.Messages[i].Date.Before(conv.Messages[j].Date)
+	})
+	if len(conv.Messages) > maxMessagesPerThread {
+		conv.Messages = conv.Messages[len(conv.Messages)-maxMessagesPerThread:]
+	}
+	conv.UpdatedAt = time.Now()
+
+	return true, s.save()
+}
+
+// Threads returns the conversations of an account, most recently active first
+func (s *Store) Threads(accountID string) []*Thread {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	threads := make([]*Thread, 0)
+	for _, conv := range s.conversations {
+		if conv.AccountID == accountID && len(conv.Messages) > 0 {
+			threads = append(threads, summarize(conv))
+		}
+	}
+
+	sort.Slice(threads, func(i, j int) bool {
+		return threads[i].LastMessage.Date.After(threads[j].LastMessage.Date)
+	})
+
+	return threads
+}
+
+// Get returns a copy of the conversation between an account and a contact
+func (s *Store) Get(accountID, contactID string) (*Conversation, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conv, ok := s.conversations[conversationKey(accountID, contactID)]
+	if !ok {
+		return nil, false
+	}
+
+	convCopy := *conv
+	convCopy.Messages = make([]*Message, len(conv.Messages))
+	for i, msg := range conv.Messages {
+		msgCopy := *msg
+		convCopy.Messages[i] = &msgCopy
+	}
+	return &convCopy, true
+}
+
+// Summary returns the thread summary of a conversation
+func (s *Store) Summary(accountID, contactID string) (*Thread, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	conv, ok := s.conversations[conversationKey(accountID, contactID)]
+	if !ok {
+		return nil, false
+	}
+	return summarize(conv), true
+}
+
+// MarkRead marks every incoming message of a conversation as read
+func (s *Store) MarkRead(accountID, contactID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conv, ok := s.conversations[conversationKey(accountID, contactID)]
+	if !ok {
+		return nil
+	}
+
+	changed := false
+	for _, msg := range conv.Messages {
+		if !msg.Read {
+			msg.Read = true
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+func summarize(conv *Conversation) *Thread {
+	thread := &Thread{
+		AccountID: conv.AccountID,
+		ContactID: conv.ContactID,
+		Total:     len(conv.Messages),
+		UpdatedAt: conv.UpdatedAt,
+	}
+
+	for _, msg := range conv.Messages {
+		if !msg.Read {
+			thread.Unread++
+		}
+	}
+
+	if n := len(conv.Messages); n > 0 {
+		last := *conv.Messages[n-1]
+		thread.LastMessage = &last
+	}
+
+	return thread
+}
+
+func conversationKey(accountID, contactID string) string {
+	return accountID + "/" + contactID
+}
+
+func (s *Store) load() error {
+	filePath := filepath.Join(s.dataDir, "conversations.json")
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var conversations []*Conversation
+	if err := json.Unmarshal(data, &conversations); err != nil {
+		return err
+	}
+
+	for _, conv := range conversations {
+		s.conversations[conversationKey(conv.AccountID, conv.ContactID)] = conv
+	}
+
+	return nil
+}
+
+func (s *Store) save() error {
+	conversations := make([]*Conversation, 0, len(s.conversations))
+	for _, conv := range s.conversations {
+		conversations = append(conversations, conv)
+	}
+
+	data, err := json.MarshalIndent(conversations, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(s.dataDir, "conversations.json")
+	return os.WriteFile(filePath, data, 0600)
+}
+
+func generateID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
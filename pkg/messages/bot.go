@@ -0,0 +1,212 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/soluchok/tgsender/pkg/botapi"
+	"github.com/soluchok/tgsender/pkg/openai"
+	"github.com/soluchok/tgsender/pkg/tracing"
+	"github.com/soluchok/tgsender/pkg/webhooks"
+)
+
+// Delivery channels of a send job
+const (
+	ChannelAccount = "account" // Sent by the linked user account to its contacts
+	ChannelBot     = "bot"     // Sent by the delivery bot to its subscribers
+)
+
+// maxBotRetries bounds how often a rate-limited bot message is retried
+const maxBotRetries = 3
+
+// BotSender handles sending messages to bot subscribers via the Bot API
+type BotSender struct {
+	client      *botapi.Client
+	subscribers *botapi.SubscriberStore
+	webhooks    *webhooks.Dispatcher
+}
+
+// NewBotSender creates a new bot message sender
+func NewBotSender(client *botapi.Client, subscribers *botapi.SubscriberStore) *BotSender {
+	return &BotSender{
+		client:      client,
+		subscribers: subscribers,
+	}
+}
+
+// WithWebhooks reports subscribers who blocked the bot to webhooks
+func (s *BotSender) WithWebhooks(dispatcher *webhooks.Dispatcher) *BotSender {
+	s.webhooks = dispatcher
+	return s
+}
+
+// SendToSubscribersWithProgress sends a message to the given subscribers of an
+// account. Recipients who unsubscribed in the meantime are reported as failed
+// and not messaged.
+func (s *BotSender) SendToSubscribersWithProgress(ctx context.Context, accountID string, chatIDs []int64, content Content, delayMinMS, delayMaxMS int, aiPrompt, openAIToken string, onProgress func(sent, failed int, results []RecipientResult)) (*SendResult, error) {
+	result := &SendResult{
+		Results: make([]RecipientResult, 0),
+	}
+
+	if len(chatIDs) == 0 {
+		return result, nil
+	}
+
+	if content.Text == "" {
+		return nil, fmt.Errorf("message text is required")
+	}
+
+	result.Total = len(chatIDs)
+
+	// Create OpenAI client if AI rewriting is enabled
+	var openAIClient *openai.Client
+	if aiPrompt != "" && openAIToken != "" {
+		openAIClient = openai.NewClient(openAIToken)
+		slog.Info("AI message rewriting enabled")
+	}
+
+	report := func(span trace.Span, recipientResult RecipientResult) {
+		endRecipientSpan(span, recipientResult)
+		result.Results = append(result.Results, recipientResult)
+		if onProgress != nil {
+			onProgress(result.Successful, result.Failed, result.Results)
+		}
+	}
+
+	for i, chatID := range chatIDs {
+		recipientResult := RecipientResult{
+			ContactID: strconv.FormatInt(chatID, 10),
+			At:        time.Now(),
+		}
+
+		ctx, span := tracing.Start(ctx, "deliver", attribute.Int64("subscriber.id", chatID))
+
+		sub, ok := s.subscribers.Get(chatID)
+		if !ok || !sub.Subscribed || sub.AccountID != accountID {
+			recipientResult.Name = "Unknown"
+			recipientResult.Error = "not subscribed"
+			recipientResult.Category = ErrorCategoryUnsubscribed
+			result.Failed++
+			report(span, recipientResult)
+			continue
+		}
+		recipientResult.Name = formatName(sub.FirstName, sub.LastName)
+
+		processedMessage, err := renderMessage(content.Text, content.Format, TemplateData{
+			FirstName: sub.FirstName,
+			LastName:  sub.LastName,
+			Name:      formatName(sub.FirstName, sub.LastName),
+			Username:  sub.Username,
+		})
+		if err != nil {
+			recipientResult.Error = fmt.Sprintf("template error: %v", err)
+			recipientResult.Category = ErrorCategoryTemplate
+			result.Failed++
+			slog.Error("failed to process message template",
+				slog.Int64("chat_id", chatID),
+				slog.String("error", err.Error()),
+			)
+			report(span, recipientResult)
+			continue
+		}
+
+		// Use AI to rewrite the personalized message if enabled
+		if openAIClient != nil {
+			rewrittenMessage, err := openAIClient.RewriteMessage(ctx, processedMessage, aiPrompt)
+			if err != nil {
+				slog.Warn("AI rewrite failed, using original message",
+					slog.Int64("chat_id", chatID),
+					slog.String("error", err.Error()),
+				)
+			} else {
+				processedMessage = rewrittenMessage
+			}
+		}
+
+		if err := s.sendMessage(ctx, chatID, processedMessage, content.Format); err != nil {
+			recipientResult.Error = err.Error()
+			recipientResult.Category = categorizeError(err)
+			result.Failed++
+			slog.Error("failed to send bot message",
+				slog.Int64("chat_id", chatID),
+				slog.String("error", err.Error()),
+			)
+
+			// A user who blocked the bot has effectively unsubscribed
+			var apiErr *botapi.Error
+			if errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden {
+				removed, err := s.subscribers.Unsubscribe(chatID)
+				if err != nil {
+					slog.Error("failed to unsubscribe bot subscriber", "chat_id", chatID, "error", err)
+				}
+				if removed {
+					s.webhooks.Emit(accountID, webhooks.EventRecipientOptedOut, webhooks.OptOutData{
+						AccountID:    accountID,
+						Channel:      ChannelBot,
+						SubscriberID: chatID,
+						Reason:       webhooks.OptOutBlocked,
+					})
+				}
+			}
+		} else {
+			recipientResult.Success = true
+			result.Successful++
+			slog.Info("bot message sent", slog.Int64("chat_id", chatID))
+		}
+
+		report(span, recipientResult)
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// Add random delay between messages (except after the last one)
+		if delayMaxMS > 0 && i < len(chatIDs)-1 {
+			delayMS := delayMinMS
+			if delayMaxMS > delayMinMS {
+				delayMS = delayMinMS + rand.Intn(delayMaxMS-delayMinMS+1)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(delayMS) * time.Millisecond):
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// sendMessage sends one message, waiting out rate limits
+func (s *BotSender) sendMessage(ctx context.Context, chatID int64, text string, format Format) error {
+	for attempt := 0; ; attempt++ {
+		var err error
+		if format == FormatPlain || format == "" {
+			_, err = s.client.SendMessage(ctx, chatID, text)
+		} else {
+			_, err = s.client.SendHTMLMessage(ctx, chatID, format.HTML(text))
+		}
+
+		var apiErr *botapi.Error
+		if err == nil || !errors.As(err, &apiErr) || apiErr.RetryAfter == 0 || attempt >= maxBotRetries {
+			return err
+		}
+
+		slog.Info("bot rate limited, retrying...", slog.Int("retry_after", apiErr.RetryAfter))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(apiErr.RetryAfter) * time.Second):
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package messages
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/gotd/td/telegram/message/entity"
+	tghtml "github.com/gotd/td/telegram/message/html"
+	"github.com/gotd/td/telegram/message/styling"
+)
+
+// Format tells how message text is marked up
+type Format string
+
+const (
+	FormatPlain    Format = "plain"
+	FormatMarkdown Format = "markdown" // **bold**, *italic*, ~~strike~~, ||spoiler||, `code`, ```pre```, [text](url)
+	FormatHTML     Format = "html"     // The HTML subset supported by Telegram
+)
+
+// ParseFormat validates a format name; empty means plain text
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case "", FormatPlain:
+		return FormatPlain, nil
+	case FormatMarkdown:
+		return FormatMarkdown, nil
+	case FormatHTML:
+		return FormatHTML, nil
+	default:
+		return "", fmt.Errorf("unknown format %q", s)
+	}
+}
+
+// HTML converts text in this format to Telegram HTML
+func (f Format) HTML(text string) string {
+	switch f {
+	case FormatHTML:
+		return text
+	case FormatMarkdown:
+		return markdownToHTML(text)
+	default:
+		return html.EscapeString(text)
+	}
+}
+
+// Styled converts text in this format to Telegram message entities
+func (f Format) Styled(text string) ([]styling.StyledTextOption, error) {
+	if f == FormatPlain || f == "" {
+		return []styling.StyledTextOption{styling.Plain(text)}, nil
+	}
+
+	markup := f.HTML(text)
+
+	// Parse once up front so markup errors are reported instead of sent
+	var b entity.Builder
+	if err := tghtml.HTML(strings.NewReader(markup), &b, tghtml.Options{}); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", f, err)
+	}
+
+	return []styling.StyledTextOption{tghtml.String(nil, markup)}, nil
+}
+
+// escapeTemplateData escapes values substituted into HTML and markdown
+// templates so that names containing markup characters are sent as written
+func (f Format) escapeTemplateData(data TemplateData) TemplateData {
+	var escape func(string) string
+	switch f {
+	case FormatHTML:
+		escape = html.EscapeString
+	case FormatMarkdown:
+		escape = escapeMarkdown
+	default:
+		return data
+	}
+	return TemplateData{
+		FirstName: escape(data.FirstName),
+		LastName:  escape(data.LastName),
+		Name:      escape(data.Name),
+		Phone:     escape(data.Phone),
+		Username:  escape(data.Username),
+	}
+}
+
+// markdownEscapable are the characters markdownToHTML keeps literal after a
+// backslash
+const markdownEscapable = "\\`*_~|[]()"
+
+// escapeMarkdown backslash-escapes the characters markdownToHTML would read as
+// markup
+func escapeMarkdown(s string) string {
+	var out strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(markdownEscapable, r) {
+			out.WriteByte('\\')
+		}
+		out.WriteRune(r)
+	}
+	return out.String()
+}
+
+// markdownInline maps paired markdown delimiters to HTML tags, longest first
+var markdownInline = []struct {
+	delim string
+	tag   string
+}{
+	{"**", "b"},
+	{"~~", "s"},
+	{"||", "tg-spoiler"},
+	{"__", "u"},
+	{"*", "i"},
+	{"_", "i"},
+}
+
+// markdownToHTML converts the markdown subset Telegram can display to HTML.
+// Unpaired delimiters are kept as literal text.
+func markdownToHTML(s string) string {
+	var out strings.Builder
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune(markdownEscapable, rune(rest[1])):
+			out.WriteString(html.EscapeString(rest[1:2]))
+			i += 2
+			continue
+
+		case strings.HasPrefix(rest, "```"):
+			if end := strings.Index(rest[3:], "```"); end >= 0 {
+				code := rest[3 : 3+end]
+				lang, body, found := strings.Cut(code, "\n")
+				if found && lang != "" && !strings.ContainsAny(lang, " \t") {
+					fmt.Fprintf(&out, `<pre><code class="language-%s">%s</code></pre>`, html.EscapeString(lang), html.EscapeString(body))
+				} else {
+					out.WriteString("<pre>" + html.EscapeString(strings.TrimPrefix(code, "\n")) + "</pre>")
+				}
+				i += 3 + end + 3
+				continue
+			}
+
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				out.WriteString("<code>" + html.EscapeString(rest[1:1+end]) + "</code>")
+				i += 1 + end + 1
+				continue
+			}
+
+		case rest[0] == '[':
+			if text, url, n, ok := markdownLink(rest); ok {
+				fmt.Fprintf(&out, `<a href="%s">%s</a>`, html.EscapeString(url), markdownToHTML(text))
+				i += n
+				continue
+			}
+		}
+
+		if tag, inner, n, ok := markdownSpan(s, i); ok {
+			out.WriteString("<" + tag + ">" + markdownToHTML(inner) + "</" + tag + ">")
+			i += n
+			continue
+		}
+
+		out.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+
+	return out.String()
+}
+
+// markdownLink parses [text](url) at the start of s
+func markdownLink(s string) (text, url string, n int, ok bool) {
+	closeText := strings.Index(s, "](")
+	if closeText < 1 {
+		return "", "", 0, false
+	}
+	closeURL := strings.IndexByte(s[closeText+2:], ')')
+	if closeURL < 1 {
+		return "", "", 0, false
+	}
+	url = s[closeText+2 : closeText+2+closeURL]
+	if strings.ContainsAny(url, " \n") {
+		return "", "", 0, false
+	}
+	return s[1:closeText], url, closeText + 2 + closeURL + 1, true
+}
+
+// markdownSpan parses a delimited span such as **bold** starting at s[i]
+func markdownSpan(s string, i int) (tag, inner string, n int, ok bool) {
+	rest := s[i:]
+	for _, m := range markdownInline {
+		if !strings.HasPrefix(rest, m.delim) {
+			continue
+		}
+
+		// Single-character delimiters must not open or close inside a word,
+		// so snake_case and 2*3*4 stay as they are
+		single := len(m.delim) == 1
+		if single && i > 0 && isWordByte(s[i-1]) {
+			return "", "", 0, false
+		}
+
+		body := rest[len(m.delim):]
+		end := strings.Index(body, m.delim)
+		if end <= 0 || strings.HasPrefix(body, " ") || strings.HasSuffix(body[:end], " ") {
+			continue
+		}
+		after := i + len(m.delim) + end + len(m.delim)
+		if single && after < len(s) && isWordByte(s[after]) {
+			continue
+		}
+
+		return m.tag, body[:end], after - i, true
+	}
+	return "", "", 0, false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,104 @@
+package messages
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/soluchok/tgsender/pkg/botapi"
+	"github.com/soluchok/tgsender/pkg/contacts"
+)
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain <text> & more", "plain &lt;text&gt; &amp; more"},
+		{"**bold** and *italic*", "<b>bold</b> and <i>italic</i>"},
+		{"_italic_ __underline__ ~~strike~~ ||spoiler||", "<i>italic</i> <u>underline</u> <s>strike</s> <tg-spoiler>spoiler</tg-spoiler>"},
+		{"**bold _nested_**", "<b>bold <i>nested</i></b>"},
+		{"snake_case_name and 2*3*4", "snake_case_name and 2*3*4"},
+		{"unpaired ** stays", "unpaired ** stays"},
+		{"`a < b` **x**", "<code>a &lt; b</code> <b>x</b>"},
+		{"```go\nfmt.Println(\"<hi>\")\n```", `<pre><code class="language-go">fmt.Println(&#34;&lt;hi&gt;&#34;)` + "\n" + `</code></pre>`},
+		{"[**site**](https://example.com/?a=1&b=2)", `<a href="https://example.com/?a=1&amp;b=2"><b>site</b></a>`},
+		{`\*not italic\*`, "*not italic*"},
+	}
+
+	for _, tc := range tests {
+		if got := markdownToHTML(tc.in); got != tc.want {
+			t.Errorf("markdownToHTML(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"": FormatPlain, "plain": FormatPlain, "Markdown": FormatMarkdown, "html": FormatHTML} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+
+	if _, err := ParseFormat("rtf"); err == nil {
+		t.Error("ParseFormat accepted an unknown format")
+	}
+}
+
+func TestStyledRejectsBrokenHTML(t *testing.T) {
+	if _, err := FormatHTML.Styled("<b>ok</b>"); err != nil {
+		t.Fatalf("valid HTML rejected: %v", err)
+	}
+	if _, err := FormatHTML.Styled("<b>mismatched</i>"); err == nil {
+		t.Fatal("broken HTML accepted")
+	}
+}
+
+// evilName would become a link and formatting if read as markdown
+const evilName = "[x](https://evil) *y* ||z||"
+
+func TestMarkdownTemplateValuesAreSentAsWritten(t *testing.T) {
+	wantHTML := `Hi [x](https://evil) *y* ||z||, <b>welcome</b>`
+
+	// As sent by a linked account
+	contact := &contacts.Contact{FirstName: evilName}
+	text, err := renderMessage("Hi {{.FirstName}}, **welcome**", FormatMarkdown, contactTemplateData(contact))
+	if err != nil {
+		t.Fatalf("failed to render message: %v", err)
+	}
+	if got := FormatMarkdown.HTML(text); got != wantHTML {
+		t.Errorf("account message: got %q, want %q", got, wantHTML)
+	}
+
+	// As sent by the delivery bot
+	var sent string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(r.Body).Decode(&params)
+		sent = params.Text
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer api.Close()
+
+	subscribers, err := botapi.NewSubscriberStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create subscriber store: %v", err)
+	}
+	if _, err := subscribers.Subscribe(9001, "1", botapi.User{ID: 9001, FirstName: evilName}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	bot := NewBotSender(botapi.NewClient("token").WithAPIURL(api.URL), subscribers)
+	result, err := bot.SendToSubscribersWithProgress(context.Background(), "1", []int64{9001},
+		Content{Text: "Hi {{.FirstName}}, **welcome**", Format: FormatMarkdown}, 0, 0, "", "", nil)
+	if err != nil || result.Successful != 1 {
+		t.Fatalf("failed to send: %v %+v", err, result)
+	}
+	if sent != wantHTML {
+		t.Errorf("bot message: got %q, want %q", sent, wantHTML)
+	}
+}
@@ -2,19 +2,35 @@ package messages
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/soluchok/tgsender/pkg/accounts"
 	"github.com/soluchok/tgsender/pkg/auth"
+	"github.com/soluchok/tgsender/pkg/contacts"
+	"github.com/soluchok/tgsender/pkg/events"
+	"github.com/soluchok/tgsender/pkg/webhooks"
+	"github.com/soluchok/tgsender/pkg/workspaces"
 )
 
 // Handler provides HTTP handlers for message operations
 type Handler struct {
 	sender       *Sender
+	botSender    *BotSender
+	mediaStore   *MediaStore
+	templates    *TemplateStore
+	quietHours   *QuietHoursStore
+	reporter     *Reporter
+	segments     *contacts.SegmentStore
 	jobManager   *JobManager
 	accountStore *accounts.Store
 	auth         *auth.Handler
+	workspaces   *workspaces.Store
 }
 
 // NewHandler creates a new messages handler
@@ -27,6 +43,81 @@ func NewHandler(sender *Sender, jobStore *JobStore, accountStore *accounts.Store
 	}
 }
 
+// WithBotSender enables sending through the delivery bot
+func (h *Handler) WithBotSender(botSender *BotSender) *Handler {
+	h.botSender = botSender
+	h.jobManager.WithBotSender(botSender)
+	return h
+}
+
+// WithWebhooks reports finished send jobs to webhooks
+func (h *Handler) WithWebhooks(dispatcher *webhooks.Dispatcher) *Handler {
+	h.jobManager.WithWebhooks(dispatcher)
+	return h
+}
+
+// WithMediaStore enables media attachments on send jobs
+func (h *Handler) WithMediaStore(mediaStore *MediaStore) *Handler {
+	h.mediaStore = mediaStore
+	return h
+}
+
+// WithTemplateStore enables the template library and sending from templates
+func (h *Handler) WithTemplateStore(templates *TemplateStore) *Handler {
+	h.templates = templates
+	return h
+}
+
+// WithSegmentStore enables sending to saved contact segments
+func (h *Handler) WithSegmentStore(segments *contacts.SegmentStore) *Handler {
+	h.segments = segments
+	return h
+}
+
+// WithQuietHours enables the quiet hours policy of every owner and holds back
+// deliveries during it
+func (h *Handler) WithQuietHours(store *QuietHoursStore) *Handler {
+	h.quietHours = store
+	h.jobManager.WithQuietHours(store, func(accountID string) (int64, bool) {
+		account, ok := h.accountStore.Get(accountID)
+		if !ok {
+			return 0, false
+		}
+		return account.OwnerID, true
+	})
+	return h
+}
+
+// StartScheduledJobs starts the scheduled jobs that were waiting when the
+// server stopped. Call it once the handler is configured.
+func (h *Handler) StartScheduledJobs() {
+	h.jobManager.StartScheduled(func(accountID string) string {
+		account, ok := h.accountStore.Get(accountID)
+		if !ok {
+			return ""
+		}
+		return account.OpenAIToken
+	})
+}
+
+// WithReporter enables delivery reports
+func (h *Handler) WithReporter(reporter *Reporter) *Handler {
+	h.reporter = reporter
+	return h
+}
+
+// WithWorkspaces shares send jobs and templates within team workspaces
+func (h *Handler) WithWorkspaces(store *workspaces.Store) *Handler {
+	h.workspaces = store
+	return h
+}
+
+// maxMediaSize is the largest attachment accepted for upload
+const maxMediaSize = 50 << 20
+
+// maxScheduleAhead is how far in the future a send job can be scheduled
+const maxScheduleAhead = 30 * 24 * time.Hour
+
 // HandleSendMessages handles POST /api/accounts/{id}/send
 func (h *Handler) HandleSendMessages(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -47,14 +138,14 @@ func (h *Handler) HandleSendMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.accountStore.Get(accountID)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -62,26 +153,116 @@ func (h *Handler) HandleSendMessages(w http.ResponseWriter, r *http.Request) {
 	// Parse request body
 	var req struct {
 		ContactIDs []string `json:"contact_ids"`
+		SegmentID  string   `json:"segment_id"` // Saved segment to send to instead of ContactIDs
 		Message    string   `json:"message"`
 		DelayMinMS int      `json:"delay_min_ms"` // Min delay between messages in milliseconds
 		DelayMaxMS int      `json:"delay_max_ms"` // Max delay between messages in milliseconds
 		AIPrompt   string   `json:"ai_prompt"`    // AI prompt for message rewriting
+
+		Channel       string  `json:"channel"`        // ChannelAccount (default) or ChannelBot
+		SubscriberIDs []int64 `json:"subscriber_ids"` // Bot subscribers to send to, all active ones if empty
+
+		Format   string   `json:"format"`    // FormatPlain (default), FormatMarkdown or FormatHTML
+		MediaIDs []string `json:"media_ids"` // Uploaded attachments to send with the message
+
+		TemplateID      string `json:"template_id"`      // Library template to send instead of Message
+		TemplateVersion int    `json:"template_version"` // Template version, the latest if 0
+		Language        string `json:"language"`         // Template variant, the default one if empty
+
+		ScheduledAt *time.Time `json:"scheduled_at"` // Start time, right away if empty or past
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if len(req.ContactIDs) == 0 {
-		writeJSONError(w, "No contacts specified", http.StatusBadRequest)
+	switch req.Channel {
+	case "", ChannelAccount:
+		if req.SegmentID != "" && len(req.ContactIDs) > 0 {
+			writeJSONError(w, "Send to either contact_ids or segment_id", http.StatusBadRequest)
+			return
+		}
+		if req.SegmentID == "" && len(req.ContactIDs) == 0 {
+			writeJSONError(w, "No contacts specified", http.StatusBadRequest)
+			return
+		}
+	case ChannelBot:
+		if h.botSender == nil {
+			writeJSONError(w, "Bot delivery is not configured", http.StatusBadRequest)
+			return
+		}
+		if req.SegmentID != "" {
+			writeJSONError(w, "Bot delivery does not support segments", http.StatusBadRequest)
+			return
+		}
+	default:
+		writeJSONError(w, "Unknown channel", http.StatusBadRequest)
+		return
+	}
+
+	format, err := ParseFormat(req.Format)
+	if err != nil {
+		writeJSONError(w, "Unknown format", http.StatusBadRequest)
 		return
 	}
 
-	if req.Message == "" {
+	// A template supplies both the text and its format
+	var templateRef *TemplateRef
+	if req.TemplateID != "" {
+		if req.Message != "" {
+			writeJSONError(w, "Message and template_id are mutually exclusive", http.StatusBadRequest)
+			return
+		}
+
+		var errMsg string
+		req.Message, format, templateRef, errMsg = h.templateMessage(account.OwnerID, req.TemplateID, req.TemplateVersion, req.Language)
+		if errMsg != "" {
+			writeJSONError(w, errMsg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The message is optional when media is attached; it becomes the caption
+	if req.Message == "" && len(req.MediaIDs) == 0 {
 		writeJSONError(w, "Message is required", http.StatusBadRequest)
 		return
 	}
 
+	if _, err := format.Styled(req.Message); err != nil {
+		writeJSONError(w, fmt.Sprintf("Invalid message: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	content := Content{Text: req.Message, Format: format, Template: templateRef}
+	if len(req.MediaIDs) > 0 {
+		switch {
+		case req.Channel == ChannelBot:
+			writeJSONError(w, "Bot delivery does not support media", http.StatusBadRequest)
+			return
+		case h.mediaStore == nil:
+			writeJSONError(w, "Media is not configured", http.StatusBadRequest)
+			return
+		case len(req.MediaIDs) > MaxAttachments:
+			writeJSONError(w, fmt.Sprintf("At most %d attachments are allowed", MaxAttachments), http.StatusBadRequest)
+			return
+		}
+
+		content.Media, err = h.mediaStore.JobMedia(accountID, req.MediaIDs)
+		if err != nil {
+			writeJSONError(w, "Attachment not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var scheduledAt time.Time
+	if req.ScheduledAt != nil {
+		scheduledAt = *req.ScheduledAt
+		if scheduledAt.After(time.Now().Add(maxScheduleAhead)) {
+			writeJSONError(w, "scheduled_at must be within 30 days", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Cap delays at 60 seconds and ensure valid range
 	if req.DelayMinMS < 0 {
 		req.DelayMinMS = 0
@@ -99,9 +280,6 @@ func (h *Handler) HandleSendMessages(w http.ResponseWriter, r *http.Request) {
 		req.DelayMinMS = req.DelayMaxMS
 	}
 
-	// Get session path (uses account ID which is the TelegramID)
-	sessionPath := ".data/account_" + accountID + ".json"
-
 	// Get OpenAI token if AI prompt is provided
 	var openAIToken string
 	if req.AIPrompt != "" {
@@ -113,12 +291,185 @@ func (h *Handler) HandleSendMessages(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Start async send job
-	job, err := h.jobManager.StartSend(accountID, sessionPath, account.ProxyURL, req.Message, req.ContactIDs, req.DelayMinMS, req.DelayMaxMS, req.AIPrompt, openAIToken)
+	var job *SendJob
+	if req.Channel == ChannelBot {
+		chatIDs, errMsg := h.botRecipients(accountID, req.SubscriberIDs)
+		if errMsg != "" {
+			writeJSONError(w, errMsg, http.StatusBadRequest)
+			return
+		}
+		job, err = h.jobManager.StartBotSend(accountID, content, chatIDs, req.DelayMinMS, req.DelayMaxMS, req.AIPrompt, openAIToken, scheduledAt)
+	} else {
+		// Get session path (uses account ID which is the TelegramID)
+		sessionPath := h.accountStore.SessionPath(accountID)
+		recipients := Recipients{ContactIDs: req.ContactIDs}
+		if req.SegmentID != "" {
+			seg, errMsg := h.segment(account.OwnerID, req.SegmentID)
+			if errMsg != "" {
+				writeJSONError(w, errMsg, http.StatusBadRequest)
+				return
+			}
+			recipients.Segment = seg
+		}
+		job, err = h.jobManager.StartSend(accountID, sessionPath, account.ProxyURL, content, recipients, req.DelayMinMS, req.DelayMaxMS, req.AIPrompt, openAIToken, scheduledAt)
+	}
+	if errors.Is(err, ErrEmptySegment) {
+		writeJSONError(w, "Segment has no contacts to send to", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		writeJSONError(w, fmt.Sprintf("Failed to start send job: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	resp := map[string]interface{}{
+		"id":         job.ID,
+		"account_id": job.AccountID,
+		"status":     job.Status,
+		"total":      job.Total,
+		"sent":       job.Sent,
+		"failed":     job.Failed,
+	}
+	if job.ScheduledAt != nil {
+		resp["scheduled_at"] = job.ScheduledAt
+	}
+	writeJSON(w, resp, http.StatusOK)
+}
+
+// HandleResumeSend handles POST /api/accounts/{id}/send/resume
+// Restarts a failed job for the recipients it has not reached yet
+func (h *Handler) HandleResumeSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// Get account ID from path
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeJSONError(w, "Account ID required", http.StatusBadRequest)
+		return
+	}
+
+	// Verify account exists and the caller's role in its workspace allows this
+	account, ok := h.accountStore.Get(accountID)
+	if !ok {
+		writeJSONError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	job, found := h.jobManager.GetJob(req.JobID)
+	if !found || job.AccountID != accountID {
+		writeJSONError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	// AI rewriting needs the token again, it is not stored with the job
+	var openAIToken string
+	if job.AIPrompt != "" {
+		openAIToken = account.OpenAIToken
+		if openAIToken == "" {
+			writeJSONError(w, "OpenAI token not configured for this account", http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, err := h.jobManager.ResumeSend(job.ID, openAIToken)
+	if errors.Is(err, ErrNotResumable) {
+		writeJSONError(w, "Only failed jobs can be resumed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to resume send job: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"id":         job.ID,
+		"account_id": job.AccountID,
+		"status":     job.Status,
+		"total":      job.Total,
+		"sent":       job.Sent,
+		"failed":     job.Failed,
+	}, http.StatusOK)
+}
+
+// HandleCancelSend handles POST /api/accounts/{id}/send/cancel
+// Cancels a job; a running job stops before its next recipient
+func (h *Handler) HandleCancelSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// Get account ID from path
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeJSONError(w, "Account ID required", http.StatusBadRequest)
+		return
+	}
+
+	// Verify account exists and the caller's role in its workspace allows this
+	account, ok := h.accountStore.Get(accountID)
+	if !ok {
+		writeJSONError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	job, found := h.jobManager.GetJob(req.JobID)
+	if !found || job.AccountID != accountID {
+		writeJSONError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	job, err := h.jobManager.CancelSend(job.ID)
+	if errors.Is(err, ErrNotCancellable) {
+		writeJSONError(w, "Only pending, running or failed jobs can be cancelled", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to cancel send job: %v", err), http.StatusInternalServerError)
+		return
+	}
+
 	writeJSON(w, map[string]interface{}{
 		"id":         job.ID,
 		"account_id": job.AccountID,
@@ -129,6 +480,71 @@ func (h *Handler) HandleSendMessages(w http.ResponseWriter, r *http.Request) {
 	}, http.StatusOK)
 }
 
+// HandleUploadMedia handles POST /api/accounts/{id}/media
+// Stores a multipart "file" upload for use as an attachment in send jobs
+func (h *Handler) HandleUploadMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// Get account ID from path
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeJSONError(w, "Account ID required", http.StatusBadRequest)
+		return
+	}
+
+	// Verify account exists and the caller's role in its workspace allows this
+	account, ok := h.accountStore.Get(accountID)
+	if !ok {
+		writeJSONError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleOperator) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if h.mediaStore == nil {
+		writeJSONError(w, "Media is not configured", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJSONError(w, fmt.Sprintf("File is larger than %d MB", maxMediaSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeJSONError(w, "A file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxMediaSize {
+		writeJSONError(w, fmt.Sprintf("File is larger than %d MB", maxMediaSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	att, err := h.mediaStore.Save(accountID, header.Filename, header.Header.Get("Content-Type"), file)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to store file: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, att, http.StatusOK)
+}
+
 // HandleSendStatus handles GET /api/accounts/{id}/send/status
 func (h *Handler) HandleSendStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -149,14 +565,14 @@ func (h *Handler) HandleSendStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.accountStore.Get(accountID)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleViewer) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
@@ -183,8 +599,9 @@ func (h *Handler) HandleSendStatus(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, job, http.StatusOK)
 }
 
-// HandleSendHistory handles GET /api/accounts/{id}/send/history
-func (h *Handler) HandleSendHistory(w http.ResponseWriter, r *http.Request) {
+// HandleSendEvents handles GET /api/accounts/{id}/send/events
+// Streams job progress as Server-Sent Events, resuming after Last-Event-ID
+func (h *Handler) HandleSendEvents(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
@@ -203,38 +620,512 @@ func (h *Handler) HandleSendHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify account exists and belongs to this owner
+	// Verify account exists and the caller's role in its workspace allows this
 	account, ok := h.accountStore.Get(accountID)
 	if !ok {
 		writeJSONError(w, "Account not found", http.StatusNotFound)
 		return
 	}
 
-	if account.OwnerID != ownerID {
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleViewer) != nil {
 		writeJSONError(w, "Unauthorized", http.StatusForbidden)
 		return
 	}
 
-	// Get all jobs for this account
-	jobs := h.jobManager.GetJobsByAccount(accountID)
-
-	writeJSON(w, map[string]interface{}{
-		"jobs": jobs,
-	}, http.StatusOK)
-}
+	// Get job ID from query param
+	jobID := r.URL.Query().Get("job_id")
+	if jobID == "" {
+		writeJSONError(w, "job_id is required", http.StatusBadRequest)
+		return
+	}
 
-func (h *Handler) getOwnerID(r *http.Request) (int64, bool) {
-	cookie, err := r.Cookie("session_token")
-	if err != nil {
-		return 0, false
+	job, found := h.jobManager.GetJob(jobID)
+	if !found || job.AccountID != accountID {
+		writeJSONError(w, "Job not found", http.StatusNotFound)
+		return
 	}
 
-	session, ok := h.auth.GetSession(cookie.Value)
-	if !ok || session.User == nil {
-		return 0, false
+	// Jobs from before a restart have no event history; send their final state
+	if !h.jobManager.events.Stream(w, r, jobID) {
+		events.WriteSnapshot(w, events.TypeStatus, newStatusEvent(job))
 	}
+}
 
-	return session.User.ID, true
+// HandleSendHistory handles GET /api/accounts/{id}/send/history
+func (h *Handler) HandleSendHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// Get account ID from path
+	accountID := r.PathValue("id")
+	if accountID == "" {
+		writeJSONError(w, "Account ID required", http.StatusBadRequest)
+		return
+	}
+
+	// Verify account exists and the caller's role in its workspace allows this
+	account, ok := h.accountStore.Get(accountID)
+	if !ok {
+		writeJSONError(w, "Account not found", http.StatusNotFound)
+		return
+	}
+
+	if h.workspaces.Authorize(ownerID, account.OwnerID, workspaces.RoleViewer) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// Get all jobs for this account
+	jobs := h.jobManager.GetJobsByAccount(accountID)
+
+	writeJSON(w, map[string]interface{}{
+		"jobs": jobs,
+	}, http.StatusOK)
+}
+
+// templateMessage resolves the template version a send job uses. It returns
+// an error message if the workspace has no such template, version or variant.
+func (h *Handler) templateMessage(workspaceID int64, templateID string, version int, language string) (string, Format, *TemplateRef, string) {
+	if h.templates == nil {
+		return "", "", nil, "Templates are not configured"
+	}
+
+	tmpl, ok := h.templates.Get(templateID)
+	if !ok || tmpl.OwnerID != workspaceID {
+		return "", "", nil, "Template not found"
+	}
+
+	v, ok := tmpl.Version(version)
+	if !ok {
+		return "", "", nil, fmt.Sprintf("Template has no version %d", version)
+	}
+
+	if language == "" {
+		language = v.DefaultLanguage
+	}
+	text, ok := v.Text(language)
+	if !ok {
+		return "", "", nil, fmt.Sprintf("Template has no %s variant", language)
+	}
+
+	return text, v.Format, &TemplateRef{ID: tmpl.ID, Name: tmpl.Name, Version: v.Version, Language: strings.ToLower(language)}, ""
+}
+
+// segment returns a saved segment of the workspace. It returns an error
+// message if the workspace has no such segment.
+func (h *Handler) segment(workspaceID int64, segmentID string) (*contacts.Segment, string) {
+	if h.segments == nil {
+		return nil, "Segments are not configured"
+	}
+
+	seg, ok := h.segments.Get(segmentID)
+	if !ok || seg.OwnerID != workspaceID {
+		return nil, "Segment not found"
+	}
+	return seg, ""
+}
+
+// botRecipients resolves the subscribers a bot job is sent to. It returns an
+// error message if one of them is not an active subscriber of the account.
+func (h *Handler) botRecipients(accountID string, subscriberIDs []int64) ([]int64, string) {
+	if len(subscriberIDs) == 0 {
+		for _, sub := range h.botSender.subscribers.GetByAccount(accountID, true) {
+			subscriberIDs = append(subscriberIDs, sub.ChatID)
+		}
+		if len(subscriberIDs) == 0 {
+			return nil, "Account has no bot subscribers"
+		}
+		return subscriberIDs, ""
+	}
+
+	for _, chatID := range subscriberIDs {
+		sub, ok := h.botSender.subscribers.Get(chatID)
+		if !ok || sub.AccountID != accountID || !sub.Subscribed {
+			return nil, fmt.Sprintf("Subscriber not found: %d", chatID)
+		}
+	}
+	return subscriberIDs, ""
+}
+
+// HandleListTemplates handles GET /api/templates
+// Lists the templates of the workspace selected with the X-Workspace-ID header
+func (h *Handler) HandleListTemplates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"templates": h.templates.GetByOwner(workspaceID),
+		"variables": TemplateFields(),
+	}, http.StatusOK)
+}
+
+// templateRequest is the body of template create and update requests
+type templateRequest struct {
+	Name            string            `json:"name"`
+	Format          string            `json:"format"`
+	DefaultLanguage string            `json:"default_language"`
+	Variants        map[string]string `json:"variants"` // Language code -> message template
+}
+
+// version validates the request as a new template version. It returns an
+// error message for the client if the request is invalid.
+func (req *templateRequest) version() (*TemplateVersion, string) {
+	format, err := ParseFormat(req.Format)
+	if err != nil {
+		return nil, "Unknown format"
+	}
+
+	version, err := NewTemplateVersion(format, req.DefaultLanguage, req.Variants)
+	if err != nil {
+		return nil, fmt.Sprintf("Invalid template: %v", err)
+	}
+	return version, ""
+}
+
+// HandleCreateTemplate handles POST /api/templates
+// Creates the template in the workspace selected with the X-Workspace-ID header
+func (h *Handler) HandleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleOperator)
+	if !ok {
+		return
+	}
+
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeJSONError(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	version, errMsg := req.version()
+	if errMsg != "" {
+		writeJSONError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	tmpl, err := h.templates.Create(workspaceID, req.Name, version)
+	if errors.Is(err, ErrTemplateNameExists) {
+		writeJSONError(w, "A template with this name already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to save template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, tmpl, http.StatusOK)
+}
+
+// HandleGetTemplate handles GET /api/templates/{id}
+func (h *Handler) HandleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmpl, ok := h.ownTemplate(w, r, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, tmpl, http.StatusOK)
+}
+
+// HandleAddTemplateVersion handles POST /api/templates/{id}/versions
+// Earlier versions are kept unchanged for the jobs that used them
+func (h *Handler) HandleAddTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmpl, ok := h.ownTemplate(w, r, workspaces.RoleOperator)
+	if !ok {
+		return
+	}
+
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	version, errMsg := req.version()
+	if errMsg != "" {
+		writeJSONError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	tmpl, err := h.templates.AddVersion(tmpl.ID, strings.TrimSpace(req.Name), version)
+	if errors.Is(err, ErrTemplateNameExists) {
+		writeJSONError(w, "A template with this name already exists", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, ErrTemplateNotFound) {
+		writeJSONError(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to save template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, tmpl, http.StatusOK)
+}
+
+// HandleDeleteTemplate handles DELETE /api/templates/{id}
+func (h *Handler) HandleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tmpl, ok := h.ownTemplate(w, r, workspaces.RoleOperator)
+	if !ok {
+		return
+	}
+
+	if err := h.templates.Delete(tmpl.ID); err != nil && !errors.Is(err, ErrTemplateNotFound) {
+		writeJSONError(w, fmt.Sprintf("Failed to delete template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Template deleted"}, http.StatusOK)
+}
+
+// ownTemplate loads the template named by the path for a caller with at least
+// the role in its workspace, writing the error response if the caller may not
+// use it
+func (h *Handler) ownTemplate(w http.ResponseWriter, r *http.Request, need workspaces.Role) (*Template, bool) {
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	tmpl, ok := h.templates.Get(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, "Template not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if h.workspaces.Authorize(ownerID, tmpl.OwnerID, need) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return nil, false
+	}
+
+	return tmpl, true
+}
+
+// HandleGetQuietHours handles GET /api/quiet-hours
+// Returns the policy of the workspace selected with the X-Workspace-ID header
+func (h *Handler) HandleGetQuietHours(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, h.quietHours.Get(workspaceID), http.StatusOK)
+}
+
+// HandleUpdateQuietHours handles PUT /api/quiet-hours
+// Replaces the policy of the workspace selected with the X-Workspace-ID header
+func (h *Handler) HandleUpdateQuietHours(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Enabled  bool   `json:"enabled"`
+		Start    string `json:"start"`
+		End      string `json:"end"`
+		TimeZone string `json:"time_zone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	policy, err := h.quietHours.Set(workspaceID, QuietHours{
+		Enabled:  req.Enabled,
+		Start:    req.Start,
+		End:      req.End,
+		TimeZone: req.TimeZone,
+	})
+	if errors.Is(err, ErrInvalidQuietHours) {
+		writeJSONError(w, "Start and end must be different times formatted as HH:MM", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, contacts.ErrUnknownTimeZone) {
+		writeJSONError(w, "Unknown time zone", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, policy, http.StatusOK)
+}
+
+// HandleDeliveryReport handles GET /api/reports/delivery
+// Reports on the send jobs of the workspace selected with the X-Workspace-ID
+// header: one job with job_id, or the jobs started between from and to
+func (h *Handler) HandleDeliveryReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	values := r.URL.Query()
+	query := ReportQuery{JobID: values.Get("job_id")}
+	for name, t := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if v := values.Get(name); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeJSONError(w, fmt.Sprintf("Invalid %s, use RFC 3339", name), http.StatusBadRequest)
+				return
+			}
+			*t = parsed
+		}
+	}
+
+	format := values.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeJSONError(w, "Unknown format, use json or csv", http.StatusBadRequest)
+		return
+	}
+	table, err := ParseReportTable(values.Get("table"))
+	if err != nil {
+		writeJSONError(w, "Unknown table, use recipients, accounts or errors", http.StatusBadRequest)
+		return
+	}
+
+	// Only the workspace's accounts, narrowed down with account_id
+	query.AccountIDs = make([]string, 0)
+	for _, account := range h.accountStore.GetByOwner(workspaceID) {
+		query.AccountIDs = append(query.AccountIDs, account.ID)
+	}
+	if requested := values["account_id"]; len(requested) > 0 {
+		for _, accountID := range requested {
+			if !slices.Contains(query.AccountIDs, accountID) {
+				writeJSONError(w, fmt.Sprintf("Account not found: %s", accountID), http.StatusNotFound)
+				return
+			}
+		}
+		query.AccountIDs = requested
+	}
+
+	report, err := h.reporter.Build(query)
+	if errors.Is(err, ErrReportJobNotFound) {
+		writeJSONError(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format != "csv" {
+		writeJSON(w, report, http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=delivery-"+string(table)+".csv")
+	if err := report.WriteCSV(w, table); err != nil {
+		slog.Error("failed to write delivery report", "error", err)
+	}
+}
+
+func (h *Handler) getOwnerID(r *http.Request) (int64, bool) {
+	return h.auth.OwnerID(r)
+}
+
+// selectWorkspace returns the workspace the request acts in. It writes the
+// error response if the caller lacks the role there.
+func (h *Handler) selectWorkspace(w http.ResponseWriter, r *http.Request, ownerID int64, need workspaces.Role) (int64, bool) {
+	workspaceID, err := h.workspaces.Selected(r, ownerID, need)
+	if errors.Is(err, workspaces.ErrInvalidHeader) {
+		writeJSONError(w, "Invalid "+workspaces.Header+" header", http.StatusBadRequest)
+		return 0, false
+	}
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return 0, false
+	}
+	return workspaceID, true
 }
 
 // Helper functions for JSON responses
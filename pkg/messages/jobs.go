@@ -5,12 +5,24 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/soluchok/tgsender/pkg/contacts"
+	"github.com/soluchok/tgsender/pkg/events"
+	"github.com/soluchok/tgsender/pkg/metrics"
+	"github.com/soluchok/tgsender/pkg/tracing"
+	"github.com/soluchok/tgsender/pkg/webhooks"
 )
 
 // JobStatus represents the status of a send job
@@ -21,6 +33,7 @@ const (
 	JobStatusRunning   JobStatus = "running"
 	JobStatusCompleted JobStatus = "completed"
 	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
 )
 
 // SendJob represents an async message sending job
@@ -43,20 +56,132 @@ type SendJob struct {
 	ProxyURL    string            `json:"proxy_url,omitempty"` // Proxy URL for Telegram connection
 	AIPrompt    string            `json:"ai_prompt,omitempty"` // AI rewriting instructions
 	OpenAIToken string            `json:"-"`                   // OpenAI token (not persisted)
+
+	Channel       string  `json:"channel,omitempty"`        // Delivery channel, ChannelAccount if empty
+	SubscriberIDs []int64 `json:"subscriber_ids,omitempty"` // Bot subscriber chat IDs for ChannelBot jobs
+
+	Format Format  `json:"format,omitempty"` // Markup of Message, plain if empty
+	Media  []Media `json:"media,omitempty"`  // Attachments, with their Telegram references once uploaded
+
+	Template *TemplateRef `json:"template,omitempty"` // Template version Message was taken from
+	Segment  *SegmentRef  `json:"segment,omitempty"`  // Segment ContactIDs were resolved from
+
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"` // The job stays pending until then
+	PausedUntil *time.Time `json:"paused_until,omitempty"` // Every recipient left is in quiet hours until then
+}
+
+// SegmentRef identifies the segment a send job was started for and how its
+// membership was resolved. The members themselves are the job's ContactIDs.
+type SegmentRef struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Matched    int    `json:"matched"`
+	Suppressed int    `json:"suppressed"`
+	Excluded   int    `json:"excluded"`
+}
+
+// Recipients selects the contacts an account send job goes to
+type Recipients struct {
+	ContactIDs []string          // Explicit contacts
+	Segment    *contacts.Segment // Evaluated when the job starts, instead of ContactIDs
+}
+
+// ErrEmptySegment is returned when a segment has no members to send to
+var ErrEmptySegment = errors.New("segment has no contacts to send to")
+
+// clone returns a copy of the job that shares no slices with it
+func (j *SendJob) clone() *SendJob {
+	jobCopy := *j
+	jobCopy.Results = make([]RecipientResult, len(j.Results))
+	copy(jobCopy.Results, j.Results)
+	jobCopy.ContactIDs = make([]string, len(j.ContactIDs))
+	copy(jobCopy.ContactIDs, j.ContactIDs)
+	jobCopy.SubscriberIDs = append([]int64(nil), j.SubscriberIDs...)
+	jobCopy.Media = append([]Media(nil), j.Media...)
+	return &jobCopy
+}
+
+// content returns what the job delivers to every recipient
+func (j *SendJob) content() Content {
+	return Content{Text: j.Message, Format: j.Format, Media: j.Media, Template: j.Template}
+}
+
+// pending returns the recipients that have no result yet, so a resumed job
+// continues where it stopped
+func (j *SendJob) pending() ([]string, []int64) {
+	done := make(map[string]bool, len(j.Results))
+	for _, result := range j.Results {
+		done[result.ContactID] = true
+	}
+
+	contactIDs := make([]string, 0, len(j.ContactIDs))
+	for _, id := range j.ContactIDs {
+		if !done[id] {
+			contactIDs = append(contactIDs, id)
+		}
+	}
+
+	subscriberIDs := make([]int64, 0, len(j.SubscriberIDs))
+	for _, id := range j.SubscriberIDs {
+		if !done[strconv.FormatInt(id, 10)] {
+			subscriberIDs = append(subscriberIDs, id)
+		}
+	}
+
+	return contactIDs, subscriberIDs
+}
+
+// RecipientEvent is published when a send job finishes one recipient
+type RecipientEvent struct {
+	Result RecipientResult `json:"result"`
+	Sent   int             `json:"sent"`
+	Failed int             `json:"failed"`
+	Total  int             `json:"total"`
+}
+
+// StatusEvent is published when a send job changes status
+type StatusEvent struct {
+	Status      JobStatus  `json:"status"`
+	Sent        int        `json:"sent"`
+	Failed      int        `json:"failed"`
+	Total       int        `json:"total"`
+	Error       string     `json:"error,omitempty"`
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+}
+
+// ErrorEvent is published when a send job fails
+type ErrorEvent struct {
+	Error string `json:"error"`
+}
+
+func newStatusEvent(job *SendJob) StatusEvent {
+	return StatusEvent{
+		Status:      job.Status,
+		Sent:        job.Sent,
+		Failed:      job.Failed,
+		Total:       job.Total,
+		Error:       job.Error,
+		PausedUntil: job.PausedUntil,
+	}
 }
 
 // JobStore manages persistent storage of send jobs
 type JobStore struct {
-	mu      sync.RWMutex
-	dataDir string
-	jobs    map[string]*SendJob // job ID -> job
+	mu       sync.RWMutex
+	dataDir  string
+	jobs     map[string]*SendJob // job ID -> job
+	archived map[string]*SendJob // job ID -> job removed by Cleanup, kept for reports
 }
 
+// archiveRetention is how long jobs removed by Cleanup are kept for reports
+const archiveRetention = 365 * 24 * time.Hour
+
 // NewJobStore creates a new job store
 func NewJobStore(dataDir string) (*JobStore, error) {
 	store := &JobStore{
-		dataDir: dataDir,
-		jobs:    make(map[string]*SendJob),
+		dataDir:  dataDir,
+		jobs:     make(map[string]*SendJob),
+		archived: make(map[string]*SendJob),
 	}
 
 	if err := os.MkdirAll(dataDir, 0700); err != nil {
@@ -81,12 +206,7 @@ func (s *JobStore) Get(id string) (*SendJob, bool) {
 	}
 
 	// Return a copy
-	jobCopy := *job
-	jobCopy.Results = make([]RecipientResult, len(job.Results))
-	copy(jobCopy.Results, job.Results)
-	jobCopy.ContactIDs = make([]string, len(job.ContactIDs))
-	copy(jobCopy.ContactIDs, job.ContactIDs)
-	return &jobCopy, true
+	return job.clone(), true
 }
 
 // GetByAccount returns all jobs for an account
@@ -97,17 +217,70 @@ func (s *JobStore) GetByAccount(accountID string) []*SendJob {
 	var jobs []*SendJob
 	for _, job := range s.jobs {
 		if job.AccountID == accountID {
-			jobCopy := *job
-			jobCopy.Results = make([]RecipientResult, len(job.Results))
-			copy(jobCopy.Results, job.Results)
-			jobCopy.ContactIDs = make([]string, len(job.ContactIDs))
-			copy(jobCopy.ContactIDs, job.ContactIDs)
-			jobs = append(jobs, &jobCopy)
+			jobs = append(jobs, job.clone())
+		}
+	}
+	return jobs
+}
+
+// List returns every job, most recently started first
+func (s *JobStore) List() []*SendJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jobs := make([]*SendJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.clone())
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.After(jobs[j].StartedAt)
+	})
+	return jobs
+}
+
+// History returns the jobs started in [from, to), including the ones
+// Cleanup archived, most recently started first. Zero times leave the range
+// open.
+func (s *JobStore) History(from, to time.Time) []*SendJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var jobs []*SendJob
+	for _, all := range []map[string]*SendJob{s.jobs, s.archived} {
+		for _, job := range all {
+			if !from.IsZero() && job.StartedAt.Before(from) {
+				continue
+			}
+			if !to.IsZero() && !job.StartedAt.Before(to) {
+				continue
+			}
+			jobs = append(jobs, job.clone())
 		}
 	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].StartedAt.After(jobs[j].StartedAt)
+	})
 	return jobs
 }
 
+// Find returns a job by ID, also if Cleanup archived it
+func (s *JobStore) Find(id string) (*SendJob, bool) {
+	if job, ok := s.Get(id); ok {
+		return job, true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.archived[id]
+	if !ok {
+		return nil, false
+	}
+	return job.clone(), true
+}
+
 // Create adds a new job
 func (s *JobStore) Create(job *SendJob) error {
 	s.mu.Lock()
@@ -147,6 +320,21 @@ func (s *JobStore) UpdateProgress(jobID string, sent, failed int, results []Reci
 	}
 }
 
+// SetMedia records the uploaded media of a job and saves
+func (s *JobStore) SetMedia(jobID string, media []Media) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("job not found: %s", jobID)
+	}
+
+	job.Media = append([]Media(nil), media...)
+	job.UpdatedAt = time.Now()
+	return s.save()
+}
+
 // SetStatus updates job status and saves
 func (s *JobStore) SetStatus(jobID string, status JobStatus, errMsg string) error {
 	s.mu.Lock()
@@ -163,6 +351,81 @@ func (s *JobStore) SetStatus(jobID string, status JobStatus, errMsg string) erro
 	return s.save()
 }
 
+// SetPausedUntil records until when a running job waits for quiet hours to
+// end, or clears it with nil
+func (s *JobStore) SetPausedUntil(jobID string, until *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("job not found: %s", jobID)
+	}
+
+	job.PausedUntil = until
+	job.UpdatedAt = time.Now()
+	return s.save()
+}
+
+// ErrNotResumable is returned when resuming a job that has not failed
+var ErrNotResumable = errors.New("only failed jobs can be resumed")
+
+// Reopen moves a failed job back to pending and saves, so that only one
+// caller can resume it
+func (s *JobStore) Reopen(jobID string) (*SendJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", jobID)
+	}
+	if job.Status != JobStatusFailed {
+		return nil, ErrNotResumable
+	}
+
+	job.Status = JobStatusPending
+	job.Error = ""
+	job.UpdatedAt = time.Now()
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	jobCopy := *job
+	return &jobCopy, nil
+}
+
+// ErrNotCancellable is returned when cancelling a job that already ended
+var ErrNotCancellable = errors.New("only pending, running or failed jobs can be cancelled")
+
+// Cancel marks a job as cancelled and saves. Recipients that were not reached
+// yet are skipped, and the job can no longer be resumed.
+func (s *JobStore) Cancel(jobID string) (*SendJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", jobID)
+	}
+	switch job.Status {
+	case JobStatusPending, JobStatusRunning, JobStatusFailed:
+	default:
+		return nil, ErrNotCancellable
+	}
+
+	job.Status = JobStatusCancelled
+	job.Error = ""
+	job.PausedUntil = nil
+	job.UpdatedAt = time.Now()
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	jobCopy := *job
+	return &jobCopy, nil
+}
+
 // FinalizeJob saves the final job state
 func (s *JobStore) FinalizeJob(jobID string, status JobStatus, sent, failed int, results []RecipientResult, errMsg string) error {
 	s.mu.Lock()
@@ -178,6 +441,7 @@ func (s *JobStore) FinalizeJob(jobID string, status JobStatus, sent, failed int,
 	job.Failed = failed
 	job.Results = results
 	job.Error = errMsg
+	job.PausedUntil = nil
 	job.UpdatedAt = time.Now()
 	return s.save()
 }
@@ -191,7 +455,8 @@ func (s *JobStore) Delete(id string) error {
 	return s.save()
 }
 
-// Cleanup removes old completed/failed jobs (keep last N per account)
+// Cleanup removes old completed/failed jobs (keep last N per account). They
+// are archived for reports until archiveRetention has passed.
 func (s *JobStore) Cleanup(maxPerAccount int) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -203,6 +468,7 @@ func (s *JobStore) Cleanup(maxPerAccount int) error {
 	}
 
 	// For each account, keep only the most recent jobs
+	archived := false
 	for _, jobs := range byAccount {
 		if len(jobs) <= maxPerAccount {
 			continue
@@ -217,13 +483,29 @@ func (s *JobStore) Cleanup(maxPerAccount int) error {
 			}
 		}
 
-		// Delete old jobs
+		// Archive old jobs
 		for i := maxPerAccount; i < len(jobs); i++ {
 			delete(s.jobs, jobs[i].ID)
+			s.archived[jobs[i].ID] = jobs[i]
+			archived = true
 		}
 	}
 
-	return s.save()
+	cutoff := time.Now().Add(-archiveRetention)
+	for id, job := range s.archived {
+		if job.StartedAt.Before(cutoff) {
+			delete(s.archived, id)
+			archived = true
+		}
+	}
+
+	if err := s.save(); err != nil {
+		return err
+	}
+	if !archived {
+		return nil
+	}
+	return s.saveArchive()
 }
 
 func (s *JobStore) load() error {
@@ -242,15 +524,57 @@ func (s *JobStore) load() error {
 	}
 
 	for _, job := range jobs {
-		// Reset any running jobs to failed (server restart)
+		s.jobs[job.ID] = job
+	}
+
+	return s.loadArchive()
+}
+
+func (s *JobStore) loadArchive() error {
+	data, err := os.ReadFile(filepath.Join(s.dataDir, "jobs_archive.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var jobs []*SendJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		s.archived[job.ID] = job
+	}
+
+	return nil
+}
+
+// RecoverInterrupted marks jobs that were pending or running when the server
+// stopped as failed, so they can be resumed. Scheduled jobs that have not
+// started stay pending for JobManager.StartScheduled. Only the process that
+// runs jobs should call it.
+func (s *JobStore) RecoverInterrupted() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := false
+	for _, job := range s.jobs {
+		if job.Status == JobStatusPending && job.ScheduledAt != nil {
+			continue
+		}
 		if job.Status == JobStatusRunning || job.Status == JobStatusPending {
 			job.Status = JobStatusFailed
 			job.Error = "interrupted by server restart"
+			job.PausedUntil = nil
+			changed = true
 		}
-		s.jobs[job.ID] = job
 	}
-
-	return nil
+	if !changed {
+		return nil
+	}
+	return s.save()
 }
 
 func (s *JobStore) save() error {
@@ -268,27 +592,105 @@ func (s *JobStore) save() error {
 	return os.WriteFile(filePath, data, 0600)
 }
 
+func (s *JobStore) saveArchive() error {
+	jobs := make([]*SendJob, 0, len(s.archived))
+	for _, job := range s.archived {
+		jobs = append(jobs, job)
+	}
+
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(s.dataDir, "jobs_archive.json"), data, 0600)
+}
+
 // JobManager manages async send jobs
 type JobManager struct {
-	store  *JobStore
-	sender *Sender
+	store     *JobStore
+	sender    *Sender
+	botSender *BotSender
+	events    *events.Broker
+	webhooks  *webhooks.Dispatcher
+
+	quietHours *QuietHoursStore
+	ownerOf    func(accountID string) (int64, bool) // Owner whose quiet hours apply to an account
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc // job ID -> cancel of its running send
 }
 
 // NewJobManager creates a new job manager
 func NewJobManager(store *JobStore, sender *Sender) *JobManager {
 	return &JobManager{
-		store:  store,
-		sender: sender,
+		store:   store,
+		sender:  sender,
+		events:  events.NewBroker(),
+		cancels: make(map[string]context.CancelFunc),
 	}
 }
 
-// StartSend starts a send job for an account
-func (m *JobManager) StartSend(accountID, sessionPath, proxyURL, message string, contactIDs []string, delayMinMS, delayMaxMS int, aiPrompt, openAIToken string) (*SendJob, error) {
+// WithBotSender enables jobs on the bot delivery channel
+func (m *JobManager) WithBotSender(botSender *BotSender) *JobManager {
+	m.botSender = botSender
+	return m
+}
+
+// WithWebhooks reports finished jobs to webhooks
+func (m *JobManager) WithWebhooks(dispatcher *webhooks.Dispatcher) *JobManager {
+	m.webhooks = dispatcher
+	return m
+}
+
+// WithQuietHours holds back deliveries while recipients are in the quiet hours
+// of the owner of the sending account
+func (m *JobManager) WithQuietHours(store *QuietHoursStore, ownerOf func(accountID string) (int64, bool)) *JobManager {
+	m.quietHours = store
+	m.ownerOf = ownerOf
+	return m
+}
+
+// BotEnabled reports whether jobs can be sent through the delivery bot
+func (m *JobManager) BotEnabled() bool {
+	return m.botSender != nil
+}
+
+// StartSend starts a send job for an account. With a non-zero scheduledAt the
+// job waits until then.
+func (m *JobManager) StartSend(accountID, sessionPath, proxyURL string, content Content, recipients Recipients, delayMinMS, delayMaxMS int, aiPrompt, openAIToken string, scheduledAt time.Time) (*SendJob, error) {
+	contactIDs := recipients.ContactIDs
+
+	// Segments are resolved now, so the job keeps the members it started with
+	var segmentRef *SegmentRef
+	if seg := recipients.Segment; seg != nil {
+		membership, err := m.sender.contactStore.Segment(accountID, seg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate segment: %w", err)
+		}
+		if len(membership.ContactIDs) == 0 {
+			return nil, ErrEmptySegment
+		}
+
+		contactIDs = membership.ContactIDs
+		segmentRef = &SegmentRef{
+			ID:         seg.ID,
+			Name:       seg.Name,
+			Matched:    membership.Matched,
+			Suppressed: membership.Suppressed,
+			Excluded:   membership.Excluded,
+		}
+	}
+
 	job := &SendJob{
 		ID:          generateJobID(),
 		AccountID:   accountID,
 		Status:      JobStatusPending,
-		Message:     message,
+		Message:     content.Text,
+		Format:      content.Format,
+		Media:       content.Media,
+		Template:    content.Template,
+		Segment:     segmentRef,
 		DelayMinMS:  delayMinMS,
 		DelayMaxMS:  delayMaxMS,
 		Total:       len(contactIDs),
@@ -300,8 +702,46 @@ func (m *JobManager) StartSend(accountID, sessionPath, proxyURL, message string,
 		ProxyURL:    proxyURL,
 		AIPrompt:    aiPrompt,
 		OpenAIToken: openAIToken,
+		ScheduledAt: schedule(scheduledAt),
 	}
 
+	return m.start(job, openAIToken)
+}
+
+// StartBotSend starts a send job that delivers through the bot to subscribers of an account
+func (m *JobManager) StartBotSend(accountID string, content Content, chatIDs []int64, delayMinMS, delayMaxMS int, aiPrompt, openAIToken string, scheduledAt time.Time) (*SendJob, error) {
+	if m.botSender == nil {
+		return nil, fmt.Errorf("bot delivery is not configured")
+	}
+	if len(content.Media) > 0 {
+		return nil, fmt.Errorf("bot delivery does not support media")
+	}
+
+	job := &SendJob{
+		ID:            generateJobID(),
+		AccountID:     accountID,
+		Status:        JobStatusPending,
+		Message:       content.Text,
+		Format:        content.Format,
+		Template:      content.Template,
+		DelayMinMS:    delayMinMS,
+		DelayMaxMS:    delayMaxMS,
+		Total:         len(chatIDs),
+		Results:       make([]RecipientResult, 0),
+		StartedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		ContactIDs:    make([]string, 0),
+		AIPrompt:      aiPrompt,
+		OpenAIToken:   openAIToken,
+		Channel:       ChannelBot,
+		SubscriberIDs: chatIDs,
+		ScheduledAt:   schedule(scheduledAt),
+	}
+
+	return m.start(job, openAIToken)
+}
+
+func (m *JobManager) start(job *SendJob, openAIToken string) (*SendJob, error) {
 	if err := m.store.Create(job); err != nil {
 		return nil, fmt.Errorf("failed to create job: %w", err)
 	}
@@ -309,12 +749,67 @@ func (m *JobManager) StartSend(accountID, sessionPath, proxyURL, message string,
 	// Cleanup old jobs (keep last 50 per account)
 	go m.store.Cleanup(50)
 
+	// Let event subscribers attach before the job starts
+	m.events.Open(job.ID)
+
 	// Start the job in background
 	go m.runSend(job.ID, openAIToken)
 
 	return job, nil
 }
 
+// StartScheduled starts the scheduled jobs that were waiting when the server
+// stopped. openAIToken returns the token of an account, for jobs that rewrite
+// messages.
+func (m *JobManager) StartScheduled(openAIToken func(accountID string) string) {
+	for _, job := range m.store.List() {
+		if job.Status != JobStatusPending || job.ScheduledAt == nil {
+			continue
+		}
+
+		var token string
+		if job.AIPrompt != "" {
+			token = openAIToken(job.AccountID)
+		}
+		m.events.Open(job.ID)
+		go m.runSend(job.ID, token)
+	}
+}
+
+// ResumeSend restarts a failed job for the recipients it has not reached yet,
+// reusing media that was already uploaded
+func (m *JobManager) ResumeSend(jobID, openAIToken string) (*SendJob, error) {
+	job, err := m.store.Reopen(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.events.Open(jobID)
+	go m.runSend(jobID, openAIToken)
+
+	return job, nil
+}
+
+// CancelSend cancels a job. A running job stops before its next recipient
+// and keeps the results it has so far.
+func (m *JobManager) CancelSend(jobID string) (*SendJob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, err := m.store.Cancel(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A running job reports its cancellation once it has stopped
+	if cancel, ok := m.cancels[jobID]; ok {
+		cancel()
+	} else {
+		m.emitFinished(job)
+	}
+	return job, nil
+}
+
 // GetJob returns a job by ID
 func (m *JobManager) GetJob(jobID string) (*SendJob, bool) {
 	return m.store.Get(jobID)
@@ -333,45 +828,382 @@ func (m *JobManager) runSend(jobID string, openAIToken string) {
 		return
 	}
 
-	// Update status to running
+	// Cancelling the job stops it while it waits as well as while it sends
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m.mu.Lock()
+	current, ok := m.store.Get(jobID)
+	if !ok || current.Status == JobStatusCancelled {
+		m.mu.Unlock()
+		m.events.Close(jobID)
+		return
+	}
+	m.cancels[jobID] = cancel
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.cancels, jobID)
+		m.mu.Unlock()
+	}()
+
+	// A scheduled job stays pending until its start time
+	if job.ScheduledAt != nil {
+		sleepUntil(ctx, *job.ScheduledAt)
+	}
+
+	// Update status to running, unless the job was cancelled before it started
+	m.mu.Lock()
+	current, ok = m.store.Get(jobID)
+	if !ok || current.Status == JobStatusCancelled {
+		m.mu.Unlock()
+		if ok {
+			m.emitFinished(current)
+			m.events.Publish(jobID, events.TypeStatus, newStatusEvent(current))
+		}
+		m.events.Close(jobID)
+		return
+	}
 	if err := m.store.SetStatus(jobID, JobStatusRunning, ""); err != nil {
+		m.mu.Unlock()
 		slog.Error("failed to update job status", "job_id", jobID, "error", err)
+		m.events.Close(jobID)
 		return
 	}
+	m.mu.Unlock()
 
-	// Create a context with timeout (1 hour max)
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Hour)
-	defer cancel()
+	m.events.Publish(jobID, events.TypeStatus, StatusEvent{Status: JobStatusRunning, Total: job.Total})
 
-	// Run the send with progress callback
-	result, err := m.sender.SendToContactsWithProgress(ctx, job.SessionPath, job.ProxyURL, job.ContactIDs, job.Message, job.DelayMinMS, job.DelayMaxMS, job.AIPrompt, openAIToken, func(sent, failed int, results []RecipientResult) {
-		m.store.UpdateProgress(jobID, sent, failed, results)
-	})
+	ctx, span := tracing.Start(ctx, "send job",
+		attribute.String("job.id", jobID),
+		attribute.String("account.id", job.AccountID),
+		attribute.String("job.channel", job.Channel),
+		attribute.Int("job.total", job.Total),
+	)
+
+	// Recipients are sent to in rounds. Each round holds back the recipients
+	// in quiet hours and ends when the next of the others enters them.
+	tried := make(map[string]bool)
+	var err error
+	for ctx.Err() == nil {
+		next := m.nextRound(jobID, tried, time.Now())
+		if next == nil {
+			break
+		}
 
-	// Finalize the job
+		if next.empty() {
+			// Everyone left is in quiet hours
+			span.AddEvent("quiet hours", trace.WithAttributes(attribute.String("resume_at", next.resumeAt.Format(time.RFC3339))))
+			m.pause(jobID, &next.resumeAt)
+			sleepUntil(ctx, next.resumeAt)
+			m.pause(jobID, nil)
+			continue
+		}
+
+		if err = m.sendRound(ctx, jobID, next, openAIToken); err != nil {
+			break
+		}
+		if next.quietAt.IsZero() || time.Now().Before(next.quietAt) {
+			for _, id := range next.contactIDs {
+				tried[id] = true
+			}
+		}
+	}
+
+	// Finalize the job with the progress saved along the way
 	var status JobStatus
 	var errMsg string
-	var sent, failed int
-	var results []RecipientResult
 
-	if err != nil {
+	currentJob, ok := m.store.Get(jobID)
+	if !ok {
+		tracing.End(span, err)
+		m.events.Close(jobID)
+		return
+	}
+	switch {
+	case currentJob.Status == JobStatusCancelled:
+		status = JobStatusCancelled
+	case err != nil:
 		status = JobStatusFailed
 		errMsg = err.Error()
-		// Keep whatever progress we had
-		if currentJob, ok := m.store.Get(jobID); ok {
-			sent = currentJob.Sent
-			failed = currentJob.Failed
-			results = currentJob.Results
+	default:
+		status = JobStatusCompleted
+	}
+
+	_, storeSpan := tracing.Start(ctx, "jobs.FinalizeJob")
+	finalizeErr := m.store.FinalizeJob(jobID, status, currentJob.Sent, currentJob.Failed, currentJob.Results, errMsg)
+	tracing.End(storeSpan, finalizeErr)
+	if finalizeErr != nil {
+		slog.Error("failed to finalize job", "job_id", jobID, "error", finalizeErr)
+	}
+
+	span.SetAttributes(
+		attribute.String("job.status", string(status)),
+		attribute.Int("job.sent", currentJob.Sent),
+		attribute.Int("job.failed", currentJob.Failed),
+	)
+	tracing.End(span, err)
+
+	if finished, ok := m.store.Get(jobID); ok {
+		m.emitFinished(finished)
+	}
+
+	if errMsg != "" {
+		m.events.Publish(jobID, events.TypeError, ErrorEvent{Error: errMsg})
+	}
+	m.events.Publish(jobID, events.TypeStatus, StatusEvent{
+		Status: status,
+		Sent:   currentJob.Sent,
+		Failed: currentJob.Failed,
+		Total:  job.Total,
+		Error:  errMsg,
+	})
+	m.events.Close(jobID)
+}
+
+// round is the part of a job's pending recipients that can be sent to now
+type round struct {
+	contactIDs    []string
+	subscriberIDs []int64
+	resumeAt      time.Time // When the first held back recipient leaves quiet hours
+	quietAt       time.Time // When the first recipient of the round enters quiet hours
+}
+
+func (r *round) empty() bool {
+	return len(r.contactIDs) == 0 && len(r.subscriberIDs) == 0
+}
+
+// nextRound picks the pending recipients of a job that are not in quiet hours
+// at now. It returns nil when no recipient is left. Contacts in tried were
+// part of a finished round; those still without a result were skipped by the
+// sender and are not tried again.
+func (m *JobManager) nextRound(jobID string, tried map[string]bool, now time.Time) *round {
+	job, ok := m.store.Get(jobID)
+	if !ok || job.Status == JobStatusCancelled {
+		return nil
+	}
+
+	contactIDs, subscriberIDs := job.pending()
+	next := &round{subscriberIDs: subscriberIDs}
+	for _, id := range contactIDs {
+		if !tried[id] {
+			next.contactIDs = append(next.contactIDs, id)
+		}
+	}
+	if next.empty() {
+		return nil
+	}
+
+	policy := m.policy(job.AccountID)
+	if !policy.Enabled {
+		return next
+	}
+
+	// Track the earliest end of held back quiet hours and start of upcoming ones
+	hold := func(loc *time.Location) bool {
+		if until := policy.Until(loc, now); !until.IsZero() {
+			if next.resumeAt.IsZero() || until.Before(next.resumeAt) {
+				next.resumeAt = until
+			}
+			return true
+		}
+		if quietAt := policy.Next(loc, now); next.quietAt.IsZero() || quietAt.Before(next.quietAt) {
+			next.quietAt = quietAt
+		}
+		return false
+	}
+
+	// Bot subscribers have no known time zone
+	if len(next.subscriberIDs) > 0 && hold(policy.Location()) {
+		next.subscriberIDs = nil
+	}
+
+	ready := next.contactIDs[:0]
+	for _, id := range next.contactIDs {
+		contact, ok := m.sender.contactStore.Get(id)
+		if !ok || !contact.IsValid {
+			// Skipped by the sender, so quiet hours do not matter
+			ready = append(ready, id)
+			continue
+		}
+
+		loc, ok := contact.Location()
+		if !ok {
+			loc = policy.Location()
+		}
+		if !hold(loc) {
+			ready = append(ready, id)
+		}
+	}
+	next.contactIDs = ready
+
+	// A round of only skipped contacts would fail with no valid contacts, so
+	// they are dropped while others wait
+	if !next.resumeAt.IsZero() && len(next.subscriberIDs) == 0 && !m.anyValid(next.contactIDs) {
+		for _, id := range next.contactIDs {
+			tried[id] = true
+		}
+		next.contactIDs = nil
+	}
+
+	return next
+}
+
+// sendRound sends to the recipients of a round, saving progress as it goes.
+// A round that reaches quiet hours stops without error; the recipients it did
+// not reach are picked up by the next round. Each round runs for at most an
+// hour.
+func (m *JobManager) sendRound(ctx context.Context, jobID string, next *round, openAIToken string) error {
+	// The job as the round starts; the round adds to its progress
+	job, ok := m.store.Get(jobID)
+	if !ok {
+		return fmt.Errorf("job not found: %s", jobID)
+	}
+
+	ctx, span := tracing.Start(ctx, "send round",
+		attribute.Int("round.recipients", len(next.contactIDs)+len(next.subscriberIDs)),
+	)
+
+	roundCtx, cancel := context.WithTimeout(ctx, 1*time.Hour)
+	defer cancel()
+	if !next.quietAt.IsZero() {
+		roundCtx, cancel = context.WithDeadline(roundCtx, next.quietAt)
+		defer cancel()
+	}
+
+	prior := job.Results
+	onProgress := func(sent, failed int, results []RecipientResult) {
+		all := append(append(make([]RecipientResult, 0, len(prior)+len(results)), prior...), results...)
+		_, storeSpan := tracing.Start(ctx, "jobs.UpdateProgress")
+		m.store.UpdateProgress(jobID, job.Sent+sent, job.Failed+failed, all)
+		storeSpan.End()
+		recordDelivery(job.AccountID, results[len(results)-1])
+		m.events.Publish(jobID, events.TypeRecipient, RecipientEvent{
+			Result: results[len(results)-1],
+			Sent:   job.Sent + sent,
+			Failed: job.Failed + failed,
+			Total:  job.Total,
+		})
+	}
+
+	onMedia := func(media []Media) {
+		if err := m.store.SetMedia(jobID, media); err != nil {
+			slog.Error("failed to save job media", "job_id", jobID, "error", err)
+		}
+	}
+
+	var err error
+	if job.Channel == ChannelBot {
+		if m.botSender == nil {
+			err = fmt.Errorf("bot delivery is not configured")
+		} else {
+			_, err = m.botSender.SendToSubscribersWithProgress(roundCtx, job.AccountID, next.subscriberIDs, job.content(), job.DelayMinMS, job.DelayMaxMS, job.AIPrompt, openAIToken, onProgress)
 		}
 	} else {
-		status = JobStatusCompleted
-		sent = result.Successful
-		failed = result.Failed
-		results = result.Results
+		_, err = m.sender.SendToContactsWithProgress(roundCtx, job.SessionPath, job.ProxyURL, next.contactIDs, job.content(), job.DelayMinMS, job.DelayMaxMS, job.AIPrompt, openAIToken, onMedia, onProgress)
+	}
+
+	if err != nil && ctx.Err() == nil && !next.quietAt.IsZero() && !time.Now().Before(next.quietAt) {
+		// Quiet hours began for a recipient of the round
+		span.AddEvent("quiet hours")
+		err = nil
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// policy returns the quiet hours that apply to an account's jobs
+func (m *JobManager) policy(accountID string) *QuietHours {
+	if m.quietHours == nil || m.ownerOf == nil {
+		return &QuietHours{}
+	}
+	ownerID, ok := m.ownerOf(accountID)
+	if !ok {
+		return &QuietHours{}
+	}
+	return m.quietHours.Get(ownerID)
+}
+
+// anyValid reports whether the sender would message any of the contacts
+func (m *JobManager) anyValid(contactIDs []string) bool {
+	for _, id := range contactIDs {
+		if contact, ok := m.sender.contactStore.Get(id); ok && contact.IsValid {
+			return true
+		}
+	}
+	return false
+}
+
+// pause records that a job waits for quiet hours to end, or resumes it with
+// nil, and tells event subscribers
+func (m *JobManager) pause(jobID string, until *time.Time) {
+	if err := m.store.SetPausedUntil(jobID, until); err != nil {
+		slog.Error("failed to update job pause", "job_id", jobID, "error", err)
+		return
+	}
+	if job, ok := m.store.Get(jobID); ok {
+		m.events.Publish(jobID, events.TypeStatus, newStatusEvent(job))
 	}
+}
+
+// sleepUntil waits until t or until ctx is done
+func sleepUntil(ctx context.Context, t time.Time) {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// schedule returns the start time of a job, nil to start right away
+func schedule(scheduledAt time.Time) *time.Time {
+	if scheduledAt.IsZero() || !scheduledAt.After(time.Now()) {
+		return nil
+	}
+	return &scheduledAt
+}
+
+// emitFinished sends the job.* webhook event of a job that stopped
+func (m *JobManager) emitFinished(job *SendJob) {
+	var event string
+	switch job.Status {
+	case JobStatusCompleted:
+		event = webhooks.EventJobCompleted
+	case JobStatusFailed:
+		event = webhooks.EventJobFailed
+	case JobStatusCancelled:
+		event = webhooks.EventJobCancelled
+	default:
+		return
+	}
+
+	channel := job.Channel
+	if channel == "" {
+		channel = ChannelAccount
+	}
+	m.webhooks.Emit(job.AccountID, event, webhooks.JobData{
+		JobID:     job.ID,
+		AccountID: job.AccountID,
+		Status:    string(job.Status),
+		Channel:   channel,
+		Total:     job.Total,
+		Sent:      job.Sent,
+		Failed:    job.Failed,
+		Error:     job.Error,
+	})
+}
 
-	if err := m.store.FinalizeJob(jobID, status, sent, failed, results, errMsg); err != nil {
-		slog.Error("failed to finalize job", "job_id", jobID, "error", err)
+// recordDelivery updates delivery metrics for a single recipient result
+func recordDelivery(accountID string, result RecipientResult) {
+	switch {
+	case !result.Success:
+		metrics.MessagesFailed.WithLabelValues(accountID, result.Category).Inc()
+	case result.Error == "":
+		// Successful results with an error note are skipped duplicates
+		metrics.MessagesSent.WithLabelValues(accountID).Inc()
 	}
 }
 
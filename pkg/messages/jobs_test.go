@@ -0,0 +1,104 @@
+package messages
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJobStoreRecoverAndCancel(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := NewJobStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	later := now.Add(time.Hour)
+	for _, job := range []*SendJob{
+		{ID: "running", Status: JobStatusRunning, StartedAt: now},
+		{ID: "completed", Status: JobStatusCompleted, StartedAt: now.Add(-time.Hour)},
+		{ID: "scheduled", Status: JobStatusPending, StartedAt: now.Add(-2 * time.Hour), ScheduledAt: &later},
+	} {
+		if err := store.Create(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Loading leaves statuses alone, only the server recovers them
+	store, err = NewJobStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := store.Get("running"); job.Status != JobStatusRunning {
+		t.Fatalf("load changed status to %s", job.Status)
+	}
+
+	if err := store.RecoverInterrupted(); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := store.Get("running"); job.Status != JobStatusFailed || job.Error == "" {
+		t.Fatalf("interrupted job was not failed: %+v", job)
+	}
+	if job, _ := store.Get("scheduled"); job.Status != JobStatusPending {
+		t.Fatalf("scheduled job did not stay pending: %+v", job)
+	}
+
+	job, err := store.Cancel("running")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != JobStatusCancelled || job.Error != "" {
+		t.Fatalf("unexpected cancelled job: %+v", job)
+	}
+	if _, err := store.Reopen("running"); !errors.Is(err, ErrNotResumable) {
+		t.Fatalf("reopened a cancelled job: %v", err)
+	}
+	if _, err := store.Cancel("completed"); !errors.Is(err, ErrNotCancellable) {
+		t.Fatalf("cancelled a completed job: %v", err)
+	}
+
+	if jobs := store.List(); len(jobs) != 3 || jobs[0].ID != "running" {
+		t.Fatalf("List is not ordered by start: %+v", jobs)
+	}
+}
+
+func TestJobStoreCleanupArchivesJobs(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := NewJobStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, job := range []*SendJob{
+		{ID: "new", AccountID: "a", Status: JobStatusCompleted, StartedAt: now},
+		{ID: "old", AccountID: "a", Status: JobStatusCompleted, StartedAt: now.Add(-time.Hour)},
+		{ID: "expired", AccountID: "a", Status: JobStatusCompleted, StartedAt: now.Add(-archiveRetention - time.Hour)},
+	} {
+		if err := store.Create(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Cleanup(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The archive survives a reload, jobs past the retention do not
+	store, err = NewJobStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get("old"); ok {
+		t.Fatal("cleanup kept the old job in the history")
+	}
+	if _, ok := store.Find("old"); !ok {
+		t.Fatal("the old job was not archived")
+	}
+	if _, ok := store.Find("expired"); ok {
+		t.Fatal("a job past the retention was archived")
+	}
+	if jobs := store.History(now.Add(-2*time.Hour), time.Time{}); len(jobs) != 2 || jobs[0].ID != "new" || jobs[1].ID != "old" {
+		t.Fatalf("unexpected history: %+v", jobs)
+	}
+}
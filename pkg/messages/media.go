@@ -0,0 +1,341 @@
+package messages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+)
+
+// MaxAttachments is the most media Telegram accepts in one album
+const MaxAttachments = 10
+
+// MediaKind tells how an attachment is sent
+type MediaKind string
+
+const (
+	MediaPhoto    MediaKind = "photo"    // Compressed and shown inline
+	MediaDocument MediaKind = "document" // Sent as a file
+)
+
+// Attachment is an uploaded file that send jobs can attach
+type Attachment struct {
+	ID        string    `json:"id"`
+	AccountID string    `json:"account_id"`
+	Kind      MediaKind `json:"kind"`
+	FileName  string    `json:"file_name"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Media is an attachment as recorded on a send job. Once uploaded to
+// Telegram, the photo or document reference is kept so that every recipient
+// and every resumed run reuses it instead of uploading the file again.
+type Media struct {
+	AttachmentID  string    `json:"attachment_id,omitempty"`
+	Kind          MediaKind `json:"kind"`
+	FileName      string    `json:"file_name"`
+	MimeType      string    `json:"mime_type,omitempty"`
+	Path          string    `json:"path"`                         // Local copy to upload from
+	TelegramID    int64     `json:"telegram_id,string,omitempty"` // Photo or document ID once uploaded
+	AccessHash    int64     `json:"access_hash,string,omitempty"` // Access hash once uploaded
+	FileReference []byte    `json:"file_reference,omitempty"`     // File reference once uploaded
+}
+
+// Uploaded reports whether the media has a Telegram reference to reuse
+func (m *Media) Uploaded() bool {
+	return m.TelegramID != 0
+}
+
+// MediaFromFile describes a local file as media, sending images as photos
+// and everything else as documents
+func MediaFromFile(path string) (Media, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Media{}, err
+	}
+	if info.IsDir() {
+		return Media{}, fmt.Errorf("%s is a directory", path)
+	}
+
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	return Media{
+		Kind:     mediaKind(mimeType),
+		FileName: filepath.Base(path),
+		MimeType: mimeType,
+		Path:     path,
+	}, nil
+}
+
+func mediaKind(mimeType string) MediaKind {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/webp":
+		return MediaPhoto
+	default:
+		return MediaDocument
+	}
+}
+
+// PrepareMedia uploads media that has no Telegram reference yet. Files are
+// uploaded once and attached to the saved messages chat without sending, which
+// yields a photo or document that can be sent to any recipient.
+func PrepareMedia(ctx context.Context, api *tg.Client, media []Media) ([]Media, error) {
+	prepared := make([]Media, len(media))
+	copy(prepared, media)
+
+	up := uploader.NewUploader(api)
+	self := message.NewSender(api).Self()
+
+	for i := range prepared {
+		m := &prepared[i]
+		if m.Uploaded() {
+			continue
+		}
+
+		file, err := up.FromPath(ctx, m.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload %s: %w", m.FileName, err)
+		}
+
+		var option message.MediaOption
+		if m.Kind == MediaPhoto {
+			option = message.UploadedPhoto(file)
+		} else {
+			doc := message.UploadedDocument(file).Filename(m.FileName).ForceFile(true)
+			if m.MimeType != "" {
+				doc = doc.MIME(m.MimeType)
+			}
+			option = doc
+		}
+
+		uploaded, err := self.UploadMedia(ctx, option)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload %s: %w", m.FileName, err)
+		}
+
+		switch v := uploaded.(type) {
+		case *tg.MessageMediaPhoto:
+			photo, ok := v.Photo.AsNotEmpty()
+			if !ok {
+				return nil, fmt.Errorf("telegram returned no photo for %s", m.FileName)
+			}
+			m.TelegramID, m.AccessHash, m.FileReference = photo.ID, photo.AccessHash, photo.FileReference
+		case *tg.MessageMediaDocument:
+			doc, ok := v.Document.AsNotEmpty()
+			if !ok {
+				return nil, fmt.Errorf("telegram returned no document for %s", m.FileName)
+			}
+			m.TelegramID, m.AccessHash, m.FileReference = doc.ID, doc.AccessHash, doc.FileReference
+		default:
+			return nil, fmt.Errorf("unexpected media %T for %s", uploaded, m.FileName)
+		}
+	}
+
+	return prepared, nil
+}
+
+// Deliver sends formatted text, or uploaded media captioned with it, through b
+func Deliver(ctx context.Context, b *message.RequestBuilder, text string, format Format, media []Media) (tg.UpdatesClass, error) {
+	styled, err := format.Styled(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(media) == 0 {
+		return b.StyledText(ctx, styled...)
+	}
+
+	// The caption goes on the first item, which is how albums display it
+	options := make([]message.MultiMediaOption, len(media))
+	for i := range media {
+		if !media[i].Uploaded() {
+			return nil, fmt.Errorf("%s was not uploaded", media[i].FileName)
+		}
+
+		var caption []message.StyledTextOption
+		if i == 0 && text != "" {
+			caption = styled
+		}
+		options[i] = mediaOption(&media[i], caption)
+	}
+
+	if len(options) == 1 {
+		return b.Media(ctx, options[0])
+	}
+	return b.Album(ctx, options[0], options[1:]...)
+}
+
+func mediaOption(m *Media, caption []message.StyledTextOption) message.MultiMediaOption {
+	if m.Kind == MediaPhoto {
+		return message.Photo(&tg.InputPhoto{ID: m.TelegramID, AccessHash: m.AccessHash, FileReference: m.FileReference}, caption...)
+	}
+	return message.Document(&tg.InputDocument{ID: m.TelegramID, AccessHash: m.AccessHash, FileReference: m.FileReference}, caption...)
+}
+
+// clearMediaRefs returns a copy of media without Telegram references, so that
+// PrepareMedia uploads it again
+func clearMediaRefs(media []Media) []Media {
+	cleared := make([]Media, len(media))
+	for i, m := range media {
+		m.TelegramID, m.AccessHash, m.FileReference = 0, 0, nil
+		cleared[i] = m
+	}
+	return cleared
+}
+
+// isFileReferenceError reports whether Telegram rejected a stale media reference
+func isFileReferenceError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "FILE_REFERENCE_")
+}
+
+// MediaStore keeps uploaded attachments until send jobs use them
+type MediaStore struct {
+	mu          sync.RWMutex
+	dataDir     string
+	attachments map[string]*Attachment // attachment ID -> attachment
+}
+
+// NewMediaStore creates a new media store
+func NewMediaStore(dataDir string) (*MediaStore, error) {
+	store := &MediaStore{
+		dataDir:     dataDir,
+		attachments: make(map[string]*Attachment),
+	}
+
+	if err := os.MkdirAll(filepath.Join(dataDir, "media"), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create media directory: %w", err)
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("failed to load media: %w", err)
+	}
+
+	return store, nil
+}
+
+// Save stores the content of an uploaded file as an attachment of an account
+func (s *MediaStore) Save(accountID, fileName, mimeType string, r io.Reader) (*Attachment, error) {
+	att := &Attachment{
+		ID:        generateJobID(),
+		AccountID: accountID,
+		FileName:  filepath.Base(fileName),
+		MimeType:  mimeType,
+		CreatedAt: time.Now(),
+	}
+	if att.MimeType == "" || att.MimeType == "application/octet-stream" {
+		if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(att.FileName))); byExt != "" {
+			att.MimeType = byExt
+		}
+	}
+	att.Kind = mediaKind(att.MimeType)
+
+	f, err := os.OpenFile(s.Path(att.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create media file: %w", err)
+	}
+	size, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(s.Path(att.ID))
+		return nil, fmt.Errorf("failed to write media file: %w", err)
+	}
+	att.Size = size
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attachments[att.ID] = att
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+
+	attCopy := *att
+	return &attCopy, nil
+}
+
+// Get returns an attachment by ID
+func (s *MediaStore) Get(id string) (*Attachment, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	att, ok := s.attachments[id]
+	if !ok {
+		return nil, false
+	}
+	attCopy := *att
+	return &attCopy, true
+}
+
+// Path returns where the content of an attachment is stored
+func (s *MediaStore) Path(id string) string {
+	return filepath.Join(s.dataDir, "media", id)
+}
+
+// JobMedia returns the job records of attachments, in the given order
+func (s *MediaStore) JobMedia(accountID string, ids []string) ([]Media, error) {
+	media := make([]Media, 0, len(ids))
+	for _, id := range ids {
+		att, ok := s.Get(id)
+		if !ok || att.AccountID != accountID {
+			return nil, fmt.Errorf("attachment not found: %s", id)
+		}
+		media = append(media, Media{
+			AttachmentID: att.ID,
+			Kind:         att.Kind,
+			FileName:     att.FileName,
+			MimeType:     att.MimeType,
+			Path:         s.Path(att.ID),
+		})
+	}
+	return media, nil
+}
+
+func (s *MediaStore) load() error {
+	filePath := filepath.Join(s.dataDir, "media.json")
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var attachments []*Attachment
+	if err := json.Unmarshal(data, &attachments); err != nil {
+		return err
+	}
+
+	for _, att := range attachments {
+		s.attachments[att.ID] = att
+	}
+
+	return nil
+}
+
+func (s *MediaStore) save() error {
+	attachments := make([]*Attachment, 0, len(s.attachments))
+	for _, att := range s.attachments {
+		attachments = append(attachments, att)
+	}
+
+	data, err := json.MarshalIndent(attachments, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(s.dataDir, "media.json")
+	return os.WriteFile(filePath, data, 0600)
+}
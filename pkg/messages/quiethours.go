@@ -0,0 +1,213 @@
+package messages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/contacts"
+)
+
+// QuietHours is an owner's policy of when recipients must not be messaged,
+// in each recipient's own time zone
+type QuietHours struct {
+	OwnerID   int64     `json:"owner_id"`
+	Enabled   bool      `json:"enabled"`
+	Start     string    `json:"start"`     // Local time quiet hours begin, HH:MM
+	End       string    `json:"end"`       // Local time they end, HH:MM; before Start spans midnight
+	TimeZone  string    `json:"time_zone"` // For recipients whose zone is unknown, UTC if empty
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ErrInvalidQuietHours is returned for policies with malformed times
+var ErrInvalidQuietHours = errors.New("start and end must be different times formatted as HH:MM")
+
+// Validate checks the times and time zone of the policy
+func (q *QuietHours) Validate() error {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return ErrInvalidQuietHours
+	}
+	end, err := parseClock(q.End)
+	if err != nil || start == end {
+		return ErrInvalidQuietHours
+	}
+	if q.TimeZone != "" {
+		if _, err := contacts.ParseTimeZone(q.TimeZone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Until returns when the quiet hours that now falls in end for a recipient
+// in loc, or the zero time if now is not in quiet hours
+func (q *QuietHours) Until(loc *time.Location, now time.Time) time.Time {
+	if !q.Enabled {
+		return time.Time{}
+	}
+	start, end := q.clocks()
+
+	// The window that contains now started today or, spanning midnight, yesterday
+	local := now.In(loc)
+	for _, day := range []int{0, -1} {
+		from := atClock(local, day, start)
+		to := atClock(local, day, end)
+		if !to.After(from) {
+			to = atClock(local, day+1, end)
+		}
+		if !now.Before(from) && now.Before(to) {
+			return to
+		}
+	}
+	return time.Time{}
+}
+
+// Next returns when the next quiet hours after now begin for a recipient in
+// loc, or the zero time if the policy is off
+func (q *QuietHours) Next(loc *time.Location, now time.Time) time.Time {
+	if !q.Enabled {
+		return time.Time{}
+	}
+	start, _ := q.clocks()
+
+	local := now.In(loc)
+	if from := atClock(local, 0, start); from.After(now) {
+		return from
+	}
+	return atClock(local, 1, start)
+}
+
+// Location returns the time zone for recipients whose own zone is unknown
+func (q *QuietHours) Location() *time.Location {
+	if loc, err := contacts.ParseTimeZone(q.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+func (q *QuietHours) clocks() (time.Duration, time.Duration) {
+	start, _ := parseClock(q.Start)
+	end, _ := parseClock(q.End)
+	return start, end
+}
+
+// parseClock parses HH:MM into the time since midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// atClock returns the given time of day, days after the date of local, in
+// the zone of local
+func atClock(local time.Time, days int, clock time.Duration) time.Time {
+	return time.Date(local.Year(), local.Month(), local.Day()+days,
+		int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, local.Location())
+}
+
+// QuietHoursStore persists the quiet hours policy of every owner
+type QuietHoursStore struct {
+	mu       sync.RWMutex
+	dataDir  string
+	policies map[int64]*QuietHours // owner ID -> policy
+}
+
+// NewQuietHoursStore creates a new quiet hours store
+func NewQuietHoursStore(dataDir string) (*QuietHoursStore, error) {
+	store := &QuietHoursStore{
+		dataDir:  dataDir,
+		policies: make(map[int64]*QuietHours),
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("failed to load quiet hours: %w", err)
+	}
+
+	return store, nil
+}
+
+// Get returns the policy of an owner. Owners without one get a disabled
+// policy.
+func (s *QuietHoursStore) Get(ownerID int64) *QuietHours {
+	if s == nil {
+		return &QuietHours{OwnerID: ownerID}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	policy, ok := s.policies[ownerID]
+	if !ok {
+		return &QuietHours{OwnerID: ownerID}
+	}
+	policyCopy := *policy
+	return &policyCopy
+}
+
+// Set replaces the policy of an owner
+func (s *QuietHoursStore) Set(ownerID int64, policy QuietHours) (*QuietHours, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy.OwnerID = ownerID
+	policy.UpdatedAt = time.Now()
+	s.policies[ownerID] = &policy
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	policyCopy := policy
+	return &policyCopy, nil
+}
+
+func (s *QuietHoursStore) load() error {
+	filePath := filepath.Join(s.dataDir, "quiet_hours.json")
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var policies []*QuietHours
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		s.policies[policy.OwnerID] = policy
+	}
+
+	return nil
+}
+
+func (s *QuietHoursStore) save() error {
+	policies := make([]*QuietHours, 0, len(s.policies))
+	for _, policy := range s.policies {
+		policies = append(policies, policy)
+	}
+
+	data, err := json.MarshalIndent(policies, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(s.dataDir, "quiet_hours.json")
+	return os.WriteFile(filePath, data, 0600)
+}
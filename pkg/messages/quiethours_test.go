@@ -0,0 +1,98 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/contacts"
+)
+
+func TestQuietHoursWindow(t *testing.T) {
+	policy := &QuietHours{Enabled: true, Start: "21:00", End: "09:00"}
+	kyiv, err := time.LoadLocation("Europe/Kyiv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		wantUntil time.Time
+		wantNext  time.Time
+	}{
+		{"evening", time.Date(2026, 1, 15, 20, 30, 0, 0, kyiv), time.Time{}, time.Date(2026, 1, 15, 21, 0, 0, 0, kyiv)},
+		{"before midnight", time.Date(2026, 1, 15, 23, 0, 0, 0, kyiv), time.Date(2026, 1, 16, 9, 0, 0, 0, kyiv), time.Date(2026, 1, 16, 21, 0, 0, 0, kyiv)},
+		{"after midnight", time.Date(2026, 1, 16, 3, 0, 0, 0, kyiv), time.Date(2026, 1, 16, 9, 0, 0, 0, kyiv), time.Date(2026, 1, 16, 21, 0, 0, 0, kyiv)},
+		{"end is not quiet", time.Date(2026, 1, 16, 9, 0, 0, 0, kyiv), time.Time{}, time.Date(2026, 1, 16, 21, 0, 0, 0, kyiv)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := policy.Until(kyiv, tc.now.UTC()); !got.Equal(tc.wantUntil) {
+				t.Errorf("Until: got %v, want %v", got, tc.wantUntil)
+			}
+			if got := policy.Next(kyiv, tc.now.UTC()); !got.Equal(tc.wantNext) {
+				t.Errorf("Next: got %v, want %v", got, tc.wantNext)
+			}
+		})
+	}
+
+	if err := (&QuietHours{Start: "22:00", End: "22:00"}).Validate(); err == nil {
+		t.Error("an empty window was accepted")
+	}
+}
+
+func TestNextRoundHoldsBackQuietRecipients(t *testing.T) {
+	dataDir := t.TempDir()
+	contactStore, err := contacts.NewStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, phone := range []string{"+380501234567", "+12125550100", "+999123456"} {
+		if err := contactStore.CreateOrUpdate(&contacts.Contact{ID: phone, AccountID: "a", TelegramID: int64(i + 1), Phone: phone, IsValid: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jobStore, err := NewJobStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &SendJob{ID: "job", AccountID: "a", Status: JobStatusRunning, ContactIDs: []string{"+380501234567", "+12125550100", "+999123456"}, Total: 3}
+	if err := jobStore.Create(job); err != nil {
+		t.Fatal(err)
+	}
+
+	quietHours, err := NewQuietHoursStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := quietHours.Set(1, QuietHours{Enabled: true, Start: "21:00", End: "09:00"}); err != nil {
+		t.Fatal(err)
+	}
+	manager := NewJobManager(jobStore, NewSender(contactStore, 0, "")).
+		WithQuietHours(quietHours, func(string) (int64, bool) { return 1, true })
+
+	// 22:30 in Kyiv, 15:30 in New York and 20:30 UTC for the unknown code
+	next := manager.nextRound("job", map[string]bool{}, time.Date(2026, 1, 15, 20, 30, 0, 0, time.UTC))
+	if len(next.contactIDs) != 2 || next.contactIDs[0] != "+12125550100" {
+		t.Fatalf("unexpected round: %v", next.contactIDs)
+	}
+	if want := time.Date(2026, 1, 15, 21, 0, 0, 0, time.UTC); !next.quietAt.Equal(want) {
+		t.Errorf("round ends at %v, want %v", next.quietAt, want)
+	}
+	if want := time.Date(2026, 1, 16, 7, 0, 0, 0, time.UTC); !next.resumeAt.Equal(want) {
+		t.Errorf("Kyiv resumes at %v, want %v", next.resumeAt, want)
+	}
+
+	// Everyone sleeps; Kyiv wakes up first
+	next = manager.nextRound("job", map[string]bool{}, time.Date(2026, 1, 16, 3, 0, 0, 0, time.UTC))
+	if !next.empty() || !next.resumeAt.Equal(time.Date(2026, 1, 16, 7, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected a pause until 07:00 UTC, got %v until %v", next.contactIDs, next.resumeAt)
+	}
+
+	// Contacts tried in a finished round are done
+	if next := manager.nextRound("job", map[string]bool{"+380501234567": true, "+12125550100": true, "+999123456": true}, time.Now()); next != nil {
+		t.Fatalf("expected no round left, got %+v", next)
+	}
+}
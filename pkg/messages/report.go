@@ -0,0 +1,412 @@
+package messages
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/botapi"
+	"github.com/soluchok/tgsender/pkg/contacts"
+	"github.com/soluchok/tgsender/pkg/inbox"
+)
+
+// Outcomes of a recipient in a delivery report
+const (
+	OutcomeSent    = "sent"
+	OutcomeFailed  = "failed"
+	OutcomeSkipped = "skipped"  // A duplicate of an earlier recipient of the job, or opted out
+	OutcomeNotSent = "not_sent" // The job has no result for the recipient, e.g. it was cancelled
+)
+
+// ReportTable is a table of a delivery report that can be written as CSV
+type ReportTable string
+
+const (
+	TableRecipients ReportTable = "recipients"
+	TableAccounts   ReportTable = "accounts"
+	TableErrors     ReportTable = "errors"
+)
+
+// ParseReportTable validates a table name; empty means TableRecipients
+func ParseReportTable(s string) (ReportTable, error) {
+	switch t := ReportTable(strings.ToLower(s)); t {
+	case "":
+		return TableRecipients, nil
+	case TableRecipients, TableAccounts, TableErrors:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown report table %q, use recipients, accounts or errors", s)
+	}
+}
+
+// ErrReportJobNotFound is returned for reports on a job that does not exist
+// or is not among the accounts of the query
+var ErrReportJobNotFound = errors.New("job not found")
+
+// ReportQuery selects the send jobs a delivery report covers
+type ReportQuery struct {
+	AccountIDs []string  // Accounts whose jobs to include, all if nil
+	JobID      string    // A single job, instead of a date range
+	From       time.Time // Jobs started at or after, open if zero
+	To         time.Time // Jobs started before, open if zero
+}
+
+// ReportRow is the outcome for one recipient of a send job
+type ReportRow struct {
+	JobID           string     `json:"job_id"`
+	AccountID       string     `json:"account_id"`
+	Channel         string     `json:"channel"`
+	ContactID       string     `json:"contact_id"` // Bot subscriber chat ID for bot jobs
+	Phone           string     `json:"phone,omitempty"`
+	Name            string     `json:"name,omitempty"`
+	Outcome         string     `json:"outcome"`
+	Category        string     `json:"category,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	JobStartedAt    time.Time  `json:"job_started_at"`
+	At              *time.Time `json:"at,omitempty"` // When the recipient was handled
+	TemplateID      string     `json:"template_id,omitempty"`
+	TemplateVersion int        `json:"template_version,omitempty"`
+	Language        string     `json:"language,omitempty"`
+	Replied         bool       `json:"replied"`
+	RepliedAt       *time.Time `json:"replied_at,omitempty"` // First reply after the message
+	OptedOut        bool       `json:"opted_out"`
+	OptedOutAt      *time.Time `json:"opted_out_at,omitempty"` // Suppression or unsubscribe after the message
+}
+
+// AccountSummary aggregates the recipients of one account in a report
+type AccountSummary struct {
+	AccountID  string `json:"account_id"`
+	Jobs       int    `json:"jobs"`
+	Recipients int    `json:"recipients"`
+	Sent       int    `json:"sent"`
+	Failed     int    `json:"failed"`
+	Skipped    int    `json:"skipped"`
+	NotSent    int    `json:"not_sent"`
+	Replied    int    `json:"replied"`
+	OptedOut   int    `json:"opted_out"`
+}
+
+// ErrorSummary counts the failed recipients of an account by error category
+type ErrorSummary struct {
+	AccountID string `json:"account_id"`
+	Category  string `json:"category"`
+	Count     int    `json:"count"`
+}
+
+// Report is a delivery report over one or more send jobs
+type Report struct {
+	GeneratedAt time.Time        `json:"generated_at"`
+	JobID       string           `json:"job_id,omitempty"`
+	From        *time.Time       `json:"from,omitempty"`
+	To          *time.Time       `json:"to,omitempty"`
+	Jobs        int              `json:"jobs"`
+	Recipients  []ReportRow      `json:"recipients"`
+	ByAccount   []AccountSummary `json:"by_account"`
+	ByError     []ErrorSummary   `json:"by_error"`
+}
+
+// Reporter builds delivery reports from send jobs, including the ones
+// JobStore.Cleanup archived
+type Reporter struct {
+	jobs        *JobStore
+	contacts    *contacts.Store
+	inbox       *inbox.Store
+	subscribers *botapi.SubscriberStore
+}
+
+// NewReporter creates a new delivery reporter
+func NewReporter(jobs *JobStore, contactStore *contacts.Store) *Reporter {
+	return &Reporter{
+		jobs:     jobs,
+		contacts: contactStore,
+	}
+}
+
+// WithInbox reports whether recipients replied, from the inbox
+func (r *Reporter) WithInbox(store *inbox.Store) *Reporter {
+	r.inbox = store
+	return r
+}
+
+// WithSubscribers reports bot subscribers who unsubscribed after a message
+func (r *Reporter) WithSubscribers(store *botapi.SubscriberStore) *Reporter {
+	r.subscribers = store
+	return r
+}
+
+// Build creates the report for the jobs the query selects
+func (r *Reporter) Build(q ReportQuery) (*Report, error) {
+	var jobs []*SendJob
+	if q.JobID != "" {
+		job, ok := r.jobs.Find(q.JobID)
+		if !ok || q.AccountIDs != nil && !slices.Contains(q.AccountIDs, job.AccountID) {
+			return nil, ErrReportJobNotFound
+		}
+		jobs = append(jobs, job)
+	} else {
+		for _, job := range r.jobs.History(q.From, q.To) {
+			if q.AccountIDs == nil || slices.Contains(q.AccountIDs, job.AccountID) {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+
+	report := &Report{
+		GeneratedAt: time.Now(),
+		JobID:       q.JobID,
+		Jobs:        len(jobs),
+		Recipients:  make([]ReportRow, 0),
+	}
+	if q.JobID == "" && !q.From.IsZero() {
+		report.From = &q.From
+	}
+	if q.JobID == "" && !q.To.IsZero() {
+		report.To = &q.To
+	}
+
+	for _, job := range jobs {
+		report.Recipients = append(report.Recipients, r.rows(job)...)
+	}
+	report.summarize(jobs)
+
+	return report, nil
+}
+
+// rows returns a row for every recipient of a job, in the order they were
+// handled, followed by the recipients without a result
+func (r *Reporter) rows(job *SendJob) []ReportRow {
+	base := ReportRow{
+		JobID:        job.ID,
+		AccountID:    job.AccountID,
+		Channel:      job.Channel,
+		JobStartedAt: job.StartedAt,
+	}
+	if base.Channel == "" {
+		base.Channel = ChannelAccount
+	}
+	if job.Template != nil {
+		base.TemplateID = job.Template.ID
+		base.TemplateVersion = job.Template.Version
+		base.Language = job.Template.Language
+	}
+
+	rows := make([]ReportRow, 0, job.Total)
+	for _, result := range job.Results {
+		row := base
+		row.ContactID = result.ContactID
+		row.Phone = result.Phone
+		row.Name = result.Name
+		row.Error = result.Error
+		switch {
+		case result.Success && result.Error != "":
+			row.Outcome = OutcomeSkipped
+		case result.Success:
+			row.Outcome = OutcomeSent
+		default:
+			row.Outcome = OutcomeFailed
+			row.Category = result.Category
+			if row.Category == "" {
+				row.Category = ErrorCategoryOther
+			}
+		}
+		if !result.At.IsZero() {
+			at := result.At
+			row.At = &at
+		}
+		r.follow(&row)
+		rows = append(rows, row)
+	}
+
+	pending, subscriberIDs := job.pending()
+	for _, id := range subscriberIDs {
+		pending = append(pending, strconv.FormatInt(id, 10))
+	}
+	for _, id := range pending {
+		row := base
+		row.ContactID = id
+		row.Outcome = OutcomeNotSent
+		if job.Channel != ChannelBot && r.contacts != nil {
+			if contact, ok := r.contacts.Get(id); ok {
+				row.Phone = contact.Phone
+				row.Name = formatName(contact.FirstName, contact.LastName)
+			}
+		}
+		r.follow(&row)
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// follow fills in whether the recipient replied or opted out after the
+// message, or after the job started if the recipient has no time
+func (r *Reporter) follow(row *ReportRow) {
+	since := row.JobStartedAt
+	if row.At != nil {
+		since = *row.At
+	}
+
+	if row.Channel == ChannelBot {
+		chatID, err := strconv.ParseInt(row.ContactID, 10, 64)
+		if err != nil || r.subscribers == nil {
+			return
+		}
+		if sub, ok := r.subscribers.Get(chatID); ok && sub.UnsubscribedAt != nil && sub.UnsubscribedAt.After(since) {
+			row.OptedOut, row.OptedOutAt = true, sub.UnsubscribedAt
+		}
+		return
+	}
+
+	if r.contacts != nil {
+		if contact, ok := r.contacts.Get(row.ContactID); ok && contact.SuppressedAt != nil && contact.SuppressedAt.After(since) {
+			row.OptedOut, row.OptedOutAt = true, contact.SuppressedAt
+		}
+	}
+
+	// Only a delivered message can be replied to
+	if row.Outcome != OutcomeSent || r.inbox == nil {
+		return
+	}
+	conv, ok := r.inbox.Get(row.AccountID, row.ContactID)
+	if !ok {
+		return
+	}
+	for _, msg := range conv.Messages {
+		if msg.Direction == inbox.DirectionIncoming && msg.Date.After(since) {
+			date := msg.Date
+			row.Replied, row.RepliedAt = true, &date
+			return
+		}
+	}
+}
+
+// summarize aggregates the rows by account and by account and error category
+func (r *Report) summarize(jobs []*SendJob) {
+	accounts := make(map[string]*AccountSummary)
+	account := func(id string) *AccountSummary {
+		summary, ok := accounts[id]
+		if !ok {
+			summary = &AccountSummary{AccountID: id}
+			accounts[id] = summary
+		}
+		return summary
+	}
+	for _, job := range jobs {
+		account(job.AccountID).Jobs++
+	}
+
+	errs := make(map[[2]string]int)
+	for _, row := range r.Recipients {
+		summary := account(row.AccountID)
+		summary.Recipients++
+		switch row.Outcome {
+		case OutcomeSent:
+			summary.Sent++
+		case OutcomeFailed:
+			summary.Failed++
+			errs[[2]string{row.AccountID, row.Category}]++
+		case OutcomeSkipped:
+			summary.Skipped++
+		case OutcomeNotSent:
+			summary.NotSent++
+		}
+		if row.Replied {
+			summary.Replied++
+		}
+		if row.OptedOut {
+			summary.OptedOut++
+		}
+	}
+
+	r.ByAccount = make([]AccountSummary, 0, len(accounts))
+	for _, summary := range accounts {
+		r.ByAccount = append(r.ByAccount, *summary)
+	}
+	sort.Slice(r.ByAccount, func(i, j int) bool {
+		return r.ByAccount[i].AccountID < r.ByAccount[j].AccountID
+	})
+
+	r.ByError = make([]ErrorSummary, 0, len(errs))
+	for key, count := range errs {
+		r.ByError = append(r.ByError, ErrorSummary{AccountID: key[0], Category: key[1], Count: count})
+	}
+	sort.Slice(r.ByError, func(i, j int) bool {
+		a, b := r.ByError[i], r.ByError[j]
+		if a.AccountID != b.AccountID {
+			return a.AccountID < b.AccountID
+		}
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Category < b.Category
+	})
+}
+
+// WriteCSV writes a table of the report with a header row
+func (r *Report) WriteCSV(w io.Writer, table ReportTable) error {
+	cw := csv.NewWriter(w)
+
+	var records [][]string
+	switch table {
+	case TableAccounts:
+		records = append(records, []string{"account_id", "jobs", "recipients", "sent", "failed", "skipped", "not_sent", "replied", "opted_out"})
+		for _, s := range r.ByAccount {
+			records = append(records, []string{s.AccountID, strconv.Itoa(s.Jobs), strconv.Itoa(s.Recipients),
+				strconv.Itoa(s.Sent), strconv.Itoa(s.Failed), strconv.Itoa(s.Skipped), strconv.Itoa(s.NotSent),
+				strconv.Itoa(s.Replied), strconv.Itoa(s.OptedOut)})
+		}
+	case TableErrors:
+		records = append(records, []string{"account_id", "category", "count"})
+		for _, s := range r.ByError {
+			records = append(records, []string{s.AccountID, s.Category, strconv.Itoa(s.Count)})
+		}
+	default:
+		records = append(records, []string{"job_id", "account_id", "channel", "contact_id", "phone", "name",
+			"outcome", "category", "error", "job_started_at", "at", "template_id", "template_version", "language",
+			"replied", "replied_at", "opted_out", "opted_out_at"})
+		for _, row := range r.Recipients {
+			version := ""
+			if row.TemplateVersion > 0 {
+				version = strconv.Itoa(row.TemplateVersion)
+			}
+			records = append(records, []string{row.JobID, row.AccountID, row.Channel, row.ContactID, row.Phone, row.Name,
+				row.Outcome, row.Category, row.Error, row.JobStartedAt.Format(time.RFC3339), formatTime(row.At),
+				row.TemplateID, version, row.Language, strconv.FormatBool(row.Replied), formatTime(row.RepliedAt),
+				strconv.FormatBool(row.OptedOut), formatTime(row.OptedOutAt)})
+		}
+	}
+
+	for _, record := range records {
+		for i, cell := range record {
+			record[i] = escapeCSVCell(cell)
+		}
+	}
+
+	if err := cw.WriteAll(records); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// escapeCSVCell prefixes cells that spreadsheets would run as a formula with
+// a quote. Names and error messages come from Telegram users.
+func escapeCSVCell(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// formatTime formats an optional time for CSV, empty if unset
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
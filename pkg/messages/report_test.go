@@ -0,0 +1,41 @@
+package messages
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+func TestWriteCSVEscapesFormulas(t *testing.T) {
+	report := &Report{Recipients: []ReportRow{{
+		JobID:        "job",
+		Phone:        "+15550100",
+		Name:         "=HYPERLINK(\"http://example.com\")",
+		Error:        "@SUM(A1)",
+		Outcome:      OutcomeSent,
+		JobStartedAt: time.Now(),
+	}}}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf, TableRecipients); err != nil {
+		t.Fatalf("failed to write CSV: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read CSV: %v", err)
+	}
+
+	row := records[1]
+	for i, want := range map[int]string{
+		0: "job",
+		4: "'+15550100",
+		5: "'=HYPERLINK(\"http://example.com\")",
+		6: OutcomeSent,
+		8: "'@SUM(A1)",
+	} {
+		if row[i] != want {
+			t.Errorf("column %s: got %q, want %q", records[0][i], row[i], want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package messages
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/rand"
@@ -12,11 +13,14 @@ import (
 
 	"github.com/gotd/td/telegram/message"
 	"github.com/gotd/td/tg"
-	"github.com/gotd/td/tgerr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/soluchok/tgsender/pkg/contacts"
 	"github.com/soluchok/tgsender/pkg/openai"
 	tgclient "github.com/soluchok/tgsender/pkg/telegram"
+	"github.com/soluchok/tgsender/pkg/tracing"
 )
 
 // SendResult represents the result of sending messages
@@ -29,11 +33,22 @@ type SendResult struct {
 
 // RecipientResult represents the result for a single recipient
 type RecipientResult struct {
-	ContactID string `json:"contact_id"`
-	Phone     string `json:"phone"`
-	Name      string `json:"name"`
-	Success   bool   `json:"success"`
-	Error     string `json:"error,omitempty"`
+	ContactID string    `json:"contact_id"`
+	Phone     string    `json:"phone"`
+	Name      string    `json:"name"`
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty"`
+	Category  string    `json:"category,omitempty"` // Error category, see categorizeError
+	At        time.Time `json:"at"`                 // When the recipient was handled
+}
+
+// Content is what a send job delivers to every recipient
+type Content struct {
+	Text   string  // Message template
+	Format Format  // Markup of the text
+	Media  []Media // Attachments, captioned with the text
+
+	Template *TemplateRef // Template version the text was taken from, if any
 }
 
 // Sender handles sending messages via Telegram
@@ -86,7 +101,7 @@ func (s *Sender) SendToContacts(ctx context.Context, sessionPath, proxyURL strin
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
 
-	err = client.Run(ctx, func(ctx context.Context) error {
+	err = tgclient.Run(ctx, client, func(ctx context.Context) error {
 		sender := message.NewSender(client.API())
 
 		// Track already sent to avoid duplicates
@@ -97,6 +112,7 @@ func (s *Sender) SendToContacts(ctx context.Context, sessionPath, proxyURL strin
 				ContactID: contact.ID,
 				Phone:     contact.Phone,
 				Name:      formatName(contact.FirstName, contact.LastName),
+				At:        time.Now(),
 			}
 
 			// Skip if already sent to this telegram ID
@@ -107,6 +123,11 @@ func (s *Sender) SendToContacts(ctx context.Context, sessionPath, proxyURL strin
 				continue
 			}
 
+			if isSuppressed(s.contactStore, contact.ID) {
+				result.Results = append(result.Results, skipOptedOut(contact))
+				continue
+			}
+
 			sent[contact.TelegramID] = true
 
 			// Process message template for this contact
@@ -114,6 +135,7 @@ func (s *Sender) SendToContacts(ctx context.Context, sessionPath, proxyURL strin
 			if err != nil {
 				recipientResult.Success = false
 				recipientResult.Error = fmt.Sprintf("template error: %v", err)
+				recipientResult.Category = ErrorCategoryTemplate
 				result.Failed++
 				slog.Error("failed to process message template",
 					slog.Int64("telegram_id", contact.TelegramID),
@@ -131,10 +153,11 @@ func (s *Sender) SendToContacts(ctx context.Context, sessionPath, proxyURL strin
 			}
 
 			// Send message
-			err = sendMessage(ctx, sender, peer, processedMessage, contact.Username)
+			err = sendMessage(ctx, sender, peer, processedMessage, FormatPlain, nil, contact.Username)
 			if err != nil {
 				recipientResult.Success = false
 				recipientResult.Error = err.Error()
+				recipientResult.Category = categorizeError(err)
 				result.Failed++
 				slog.Error("failed to send message",
 					slog.Int64("telegram_id", contact.TelegramID),
@@ -150,6 +173,10 @@ func (s *Sender) SendToContacts(ctx context.Context, sessionPath, proxyURL strin
 				)
 			}
 
+			if err := s.contactStore.RecordDelivery(contact.ID, recipientResult.Success, time.Now()); err != nil {
+				slog.Warn("failed to record delivery", slog.String("contact_id", contact.ID), slog.String("error", err.Error()))
+			}
+
 			result.Results = append(result.Results, recipientResult)
 
 			// Add random delay between messages (except after the last one)
@@ -171,6 +198,7 @@ func (s *Sender) SendToContacts(ctx context.Context, sessionPath, proxyURL strin
 
 		return nil
 	})
+	s.flushDeliveries(ctx)
 
 	if err != nil {
 		// Check for auth errors
@@ -184,8 +212,10 @@ func (s *Sender) SendToContacts(ctx context.Context, sessionPath, proxyURL strin
 	return result, nil
 }
 
-// SendToContactsWithProgress sends a message to the specified contacts with progress callback
-func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, proxyURL string, contactIDs []string, messageText string, delayMinMS, delayMaxMS int, aiPrompt, openAIToken string, onProgress func(sent, failed int, results []RecipientResult)) (*SendResult, error) {
+// SendToContactsWithProgress sends content to the specified contacts with progress callback.
+// Media is uploaded before the first recipient unless it already has a Telegram
+// reference; onMedia receives the uploaded media so it can be reused later.
+func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, proxyURL string, contactIDs []string, content Content, delayMinMS, delayMaxMS int, aiPrompt, openAIToken string, onMedia func(media []Media), onProgress func(sent, failed int, results []RecipientResult)) (*SendResult, error) {
 	result := &SendResult{
 		Results: make([]RecipientResult, 0),
 	}
@@ -194,24 +224,40 @@ func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, pr
 		return result, nil
 	}
 
-	if messageText == "" {
+	messageText := content.Text
+	if messageText == "" && len(content.Media) == 0 {
 		return nil, fmt.Errorf("message text is required")
 	}
 
 	// Get contacts by IDs
-	var contactsToSend []*contacts.Contact
+	var contactsToSend, optedOut []*contacts.Contact
 	for _, id := range contactIDs {
 		contact, ok := s.contactStore.Get(id)
-		if ok && contact.IsValid {
+		switch {
+		case !ok || !contact.IsValid:
+		case contact.Suppressed:
+			optedOut = append(optedOut, contact)
+		default:
 			contactsToSend = append(contactsToSend, contact)
 		}
 	}
 
-	if len(contactsToSend) == 0 {
+	if len(contactsToSend) == 0 && len(optedOut) == 0 {
 		return nil, fmt.Errorf("no valid contacts found")
 	}
 
-	result.Total = len(contactsToSend)
+	result.Total = len(contactsToSend) + len(optedOut)
+
+	// Contacts who opted out are skipped without connecting to Telegram
+	for _, contact := range optedOut {
+		result.Results = append(result.Results, skipOptedOut(contact))
+		if onProgress != nil {
+			onProgress(result.Successful, result.Failed, result.Results)
+		}
+	}
+	if len(contactsToSend) == 0 {
+		return result, nil
+	}
 
 	// Create OpenAI client if AI rewriting is enabled
 	var openAIClient *openai.Client
@@ -225,9 +271,20 @@ func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, pr
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
 
-	err = client.Run(ctx, func(ctx context.Context) error {
+	err = tgclient.Run(ctx, client, func(ctx context.Context) error {
 		sender := message.NewSender(client.API())
 
+		// Upload attachments once for all recipients
+		media := content.Media
+		if len(media) > 0 {
+			if media, err = PrepareMedia(ctx, client.API(), media); err != nil {
+				return err
+			}
+			if onMedia != nil {
+				onMedia(media)
+			}
+		}
+
 		// Track already sent to avoid duplicates
 		sent := make(map[int64]bool)
 
@@ -236,6 +293,7 @@ func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, pr
 				ContactID: contact.ID,
 				Phone:     contact.Phone,
 				Name:      formatName(contact.FirstName, contact.LastName),
+				At:        time.Now(),
 			}
 
 			// Skip if already sent to this telegram ID
@@ -249,19 +307,32 @@ func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, pr
 				continue
 			}
 
+			// Contacts who opted out since the job started are not messaged
+			if isSuppressed(s.contactStore, contact.ID) {
+				result.Results = append(result.Results, skipOptedOut(contact))
+				if onProgress != nil {
+					onProgress(result.Successful, result.Failed, result.Results)
+				}
+				continue
+			}
+
 			sent[contact.TelegramID] = true
 
+			ctx, span := tracing.Start(ctx, "deliver", attribute.String("contact.id", contact.ID))
+
 			// Process message template for this contact first
-			processedMessage, err := processMessageTemplate(messageText, contact)
+			processedMessage, err := renderMessage(messageText, content.Format, contactTemplateData(contact))
 			if err != nil {
 				recipientResult.Success = false
 				recipientResult.Error = fmt.Sprintf("template error: %v", err)
+				recipientResult.Category = ErrorCategoryTemplate
 				result.Failed++
 				slog.Error("failed to process message template",
 					slog.Int64("telegram_id", contact.TelegramID),
 					slog.String("phone", contact.Phone),
 					slog.String("error", err.Error()),
 				)
+				endRecipientSpan(span, recipientResult)
 				result.Results = append(result.Results, recipientResult)
 				if onProgress != nil {
 					onProgress(result.Successful, result.Failed, result.Results)
@@ -270,7 +341,7 @@ func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, pr
 			}
 
 			// Use AI to rewrite the personalized message if enabled
-			if openAIClient != nil {
+			if openAIClient != nil && processedMessage != "" {
 				rewrittenMessage, err := openAIClient.RewriteMessage(ctx, processedMessage, aiPrompt)
 				if err != nil {
 					slog.Warn("AI rewrite failed, using original message",
@@ -293,10 +364,22 @@ func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, pr
 			}
 
 			// Send message
-			err = sendMessage(ctx, sender, peer, processedMessage, contact.Username)
+			err = sendMessage(ctx, sender, peer, processedMessage, content.Format, media, contact.Username)
+			if isFileReferenceError(err) {
+				// References expire eventually; upload the files again and retry
+				if media, err = PrepareMedia(ctx, client.API(), clearMediaRefs(media)); err != nil {
+					tracing.End(span, err)
+					return err
+				}
+				if onMedia != nil {
+					onMedia(media)
+				}
+				err = sendMessage(ctx, sender, peer, processedMessage, content.Format, media, contact.Username)
+			}
 			if err != nil {
 				recipientResult.Success = false
 				recipientResult.Error = err.Error()
+				recipientResult.Category = categorizeError(err)
 				result.Failed++
 				slog.Error("failed to send message",
 					slog.Int64("telegram_id", contact.TelegramID),
@@ -312,6 +395,12 @@ func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, pr
 				)
 			}
 
+			// Remember the outcome so contacts can be filtered by delivery state
+			if err := s.contactStore.RecordDelivery(contact.ID, recipientResult.Success, time.Now()); err != nil {
+				slog.Warn("failed to record delivery", slog.String("contact_id", contact.ID), slog.String("error", err.Error()))
+			}
+			endRecipientSpan(span, recipientResult)
+
 			result.Results = append(result.Results, recipientResult)
 
 			// Report progress
@@ -338,6 +427,7 @@ func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, pr
 
 		return nil
 	})
+	s.flushDeliveries(ctx)
 
 	if err != nil {
 		// Check for auth errors
@@ -351,8 +441,8 @@ func (s *Sender) SendToContactsWithProgress(ctx context.Context, sessionPath, pr
 	return result, nil
 }
 
-func sendMessage(ctx context.Context, sender *message.Sender, peer tg.InputPeerClass, text, username string) error {
-	_, err := sender.To(peer).Text(ctx, text)
+func sendMessage(ctx context.Context, sender *message.Sender, peer tg.InputPeerClass, text string, format Format, media []Media, username string) error {
+	_, err := Deliver(ctx, sender.To(peer), text, format, media)
 	if err == nil {
 		return nil
 	}
@@ -363,13 +453,13 @@ func sendMessage(ctx context.Context, sender *message.Sender, peer tg.InputPeerC
 		if resolveErr != nil {
 			return fmt.Errorf("peer invalid and failed to resolve username: %w", resolveErr)
 		}
-		return sendMessage(ctx, sender, resolvedPeer, text, "")
+		return sendMessage(ctx, sender, resolvedPeer, text, format, media, "")
 	}
 
 	// Handle flood wait
-	if flood, floodErr := tgerr.FloodWait(ctx, err); flood {
+	if flood, floodErr := tgclient.FloodWait(ctx, err); flood {
 		slog.Info("flood wait, retrying...")
-		return sendMessage(ctx, sender, peer, text, username)
+		return sendMessage(ctx, sender, peer, text, format, media, username)
 	} else if floodErr != nil {
 		return floodErr
 	}
@@ -377,6 +467,86 @@ func sendMessage(ctx context.Context, sender *message.Sender, peer tg.InputPeerC
 	return err
 }
 
+// Error categories reported for failed recipients
+const (
+	ErrorCategoryTemplate     = "template"
+	ErrorCategoryFloodWait    = "flood_wait"
+	ErrorCategoryPeerFlood    = "peer_flood"
+	ErrorCategoryPeerInvalid  = "peer_invalid"
+	ErrorCategoryPrivacy      = "privacy"
+	ErrorCategoryBlocked      = "blocked"
+	ErrorCategoryDeactivated  = "deactivated"
+	ErrorCategoryAuth         = "auth"
+	ErrorCategoryTimeout      = "timeout"
+	ErrorCategoryUnsubscribed = "unsubscribed"
+	ErrorCategoryOther        = "other"
+)
+
+// isSuppressed reports whether a contact has opted out of messages
+func isSuppressed(store *contacts.Store, id string) bool {
+	contact, ok := store.Get(id)
+	return ok && contact.Suppressed
+}
+
+// skipOptedOut is the result of a contact who opted out, which reports
+// count as skipped
+func skipOptedOut(contact *contacts.Contact) RecipientResult {
+	return RecipientResult{
+		ContactID: contact.ID,
+		Phone:     contact.Phone,
+		Name:      formatName(contact.FirstName, contact.LastName),
+		Success:   true,
+		Error:     "opted out, skipped",
+		At:        time.Now(),
+	}
+}
+
+// flushDeliveries saves the delivery state of the contacts sent to, once
+// per send rather than once per recipient
+func (s *Sender) flushDeliveries(ctx context.Context) {
+	_, span := tracing.Start(ctx, "contacts.FlushDeliveries")
+	err := s.contactStore.FlushDeliveries()
+	tracing.End(span, err)
+	if err != nil {
+		slog.Error("failed to save delivery state", slog.String("error", err.Error()))
+	}
+}
+
+// endRecipientSpan ends the span of one recipient's delivery with its outcome
+func endRecipientSpan(span trace.Span, result RecipientResult) {
+	span.SetAttributes(attribute.Bool("recipient.success", result.Success))
+	if !result.Success {
+		span.SetAttributes(attribute.String("recipient.category", result.Category))
+		span.SetStatus(codes.Error, result.Error)
+	}
+	span.End()
+}
+
+// categorizeError maps a send error to a coarse category suitable for metrics and reports
+func categorizeError(err error) string {
+	errStr := err.Error()
+	switch {
+	case strings.Contains(errStr, "FLOOD_WAIT"), strings.Contains(errStr, "Too Many Requests"):
+		return ErrorCategoryFloodWait
+	case strings.Contains(errStr, "PEER_FLOOD"):
+		return ErrorCategoryPeerFlood
+	case strings.Contains(errStr, "PEER_ID_INVALID"), strings.Contains(errStr, "peer invalid"), strings.Contains(errStr, "chat not found"):
+		return ErrorCategoryPeerInvalid
+	case strings.Contains(errStr, "PRIVACY"):
+		return ErrorCategoryPrivacy
+	case strings.Contains(errStr, "USER_IS_BLOCKED"), strings.Contains(errStr, "YOU_BLOCKED_USER"), strings.Contains(errStr, "bot was blocked"):
+		return ErrorCategoryBlocked
+	case strings.Contains(errStr, "USER_DEACTIVATED"), strings.Contains(errStr, "user is deactivated"):
+		return ErrorCategoryDeactivated
+	case strings.Contains(errStr, "AUTH_KEY_UNREGISTERED"), strings.Contains(errStr, "SESSION_REVOKED"):
+		return ErrorCategoryAuth
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return ErrorCategoryTimeout
+	default:
+		return ErrorCategoryOther
+	}
+}
+
 func resolveUsername(ctx context.Context, sender *message.Sender, username string) (tg.InputPeerClass, error) {
 	peer, err := sender.Resolve(username).AsInputPeer(ctx)
 	if err == nil {
@@ -384,7 +554,7 @@ func resolveUsername(ctx context.Context, sender *message.Sender, username strin
 	}
 
 	// Handle flood wait
-	if flood, floodErr := tgerr.FloodWait(ctx, err); flood {
+	if flood, floodErr := tgclient.FloodWait(ctx, err); flood {
 		return resolveUsername(ctx, sender, username)
 	} else if floodErr != nil {
 		return nil, floodErr
@@ -424,18 +594,32 @@ func templateFuncs() template.FuncMap {
 
 // processMessageTemplate processes the message template with contact data
 func processMessageTemplate(messageTemplate string, contact *contacts.Contact) (string, error) {
-	tmpl, err := template.New("message").Funcs(templateFuncs()).Parse(messageTemplate)
-	if err != nil {
-		return "", fmt.Errorf("invalid template: %w", err)
-	}
+	return executeTemplate(messageTemplate, contactTemplateData(contact))
+}
 
-	data := TemplateData{
+// contactTemplateData returns the template values of a contact
+func contactTemplateData(contact *contacts.Contact) TemplateData {
+	return TemplateData{
 		FirstName: contact.FirstName,
 		LastName:  contact.LastName,
 		Name:      formatName(contact.FirstName, contact.LastName),
 		Phone:     contact.Phone,
 		Username:  contact.Username,
 	}
+}
+
+// renderMessage renders a message template in format for one recipient,
+// escaping the recipient's values so that they are not read as markup
+func renderMessage(messageTemplate string, format Format, data TemplateData) (string, error) {
+	return executeTemplate(messageTemplate, format.escapeTemplateData(data))
+}
+
+// executeTemplate renders a message template for one recipient
+func executeTemplate(messageTemplate string, data TemplateData) (string, error) {
+	tmpl, err := template.New("message").Funcs(templateFuncs()).Parse(messageTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
 
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, data); err != nil {
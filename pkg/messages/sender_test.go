@@ -0,0 +1,35 @@
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCategorizeError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.New("rpc error code 420: FLOOD_WAIT (37)"), ErrorCategoryFloodWait},
+		{errors.New("rpc error code 400: PEER_FLOOD"), ErrorCategoryPeerFlood},
+		{errors.New("rpc error code 400: PEER_ID_INVALID"), ErrorCategoryPeerInvalid},
+		{errors.New("peer invalid and failed to resolve username: not found"), ErrorCategoryPeerInvalid},
+		{errors.New("rpc error code 403: USER_PRIVACY_RESTRICTED"), ErrorCategoryPrivacy},
+		{errors.New("rpc error code 400: USER_IS_BLOCKED"), ErrorCategoryBlocked},
+		{errors.New("rpc error code 400: INPUT_USER_DEACTIVATED"), ErrorCategoryDeactivated},
+		{errors.New("rpc error code 401: SESSION_REVOKED"), ErrorCategoryAuth},
+		{errors.New("bot api error 403: Forbidden: bot was blocked by the user"), ErrorCategoryBlocked},
+		{errors.New("bot api error 400: Bad Request: chat not found"), ErrorCategoryPeerInvalid},
+		{errors.New("bot api error 429: Too Many Requests: retry after 5"), ErrorCategoryFloodWait},
+		{fmt.Errorf("send: %w", context.DeadlineExceeded), ErrorCategoryTimeout},
+		{errors.New("something else"), ErrorCategoryOther},
+	}
+
+	for _, tc := range tests {
+		if got := categorizeError(tc.err); got != tc.want {
+			t.Errorf("categorizeError(%q) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package messages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// Errors returned by the template store
+var (
+	ErrTemplateNotFound   = errors.New("template not found")
+	ErrTemplateNameExists = errors.New("a template with this name already exists")
+)
+
+// languagePattern matches language codes such as "en" or "pt-br"
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// Template is a named message that an owner reuses across send jobs. Every
+// edit adds a version; versions never change once created so that jobs can
+// record exactly what they sent.
+type Template struct {
+	ID        string             `json:"id"`
+	OwnerID   int64              `json:"owner_id"`
+	Name      string             `json:"name"`
+	Versions  []*TemplateVersion `json:"versions"` // Oldest first
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+// TemplateVersion is one revision of a template
+type TemplateVersion struct {
+	Version         int               `json:"version"`
+	Format          Format            `json:"format"`
+	DefaultLanguage string            `json:"default_language"`
+	Variants        map[string]string `json:"variants"`  // Language code -> message template
+	Variables       []string          `json:"variables"` // TemplateData fields the variants use
+	CreatedAt       time.Time         `json:"created_at"`
+}
+
+// Latest returns the newest version of a template
+func (t *Template) Latest() *TemplateVersion {
+	return t.Versions[len(t.Versions)-1]
+}
+
+// Version returns a version of a template, the latest if version is 0
+func (t *Template) Version(version int) (*TemplateVersion, bool) {
+	if version == 0 {
+		return t.Latest(), true
+	}
+	if version < 1 || version > len(t.Versions) {
+		return nil, false
+	}
+	return t.Versions[version-1], true
+}
+
+// Text returns the variant for a language, the default one if language is empty
+func (v *TemplateVersion) Text(language string) (string, bool) {
+	if language == "" {
+		language = v.DefaultLanguage
+	}
+	text, ok := v.Variants[strings.ToLower(language)]
+	return text, ok
+}
+
+// TemplateRef identifies the template version a send job was started from
+type TemplateRef struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Version  int    `json:"version"`
+	Language string `json:"language"`
+}
+
+// NewTemplateVersion validates the variants of a template version and
+// collects the variables they use
+func NewTemplateVersion(format Format, defaultLanguage string, variants map[string]string) (*TemplateVersion, error) {
+	if len(variants) == 0 {
+		return nil, errors.New("at least one variant is required")
+	}
+
+	version := &TemplateVersion{
+		Format:          format,
+		DefaultLanguage: strings.ToLower(defaultLanguage),
+		Variants:        make(map[string]string, len(variants)),
+		CreatedAt:       time.Now(),
+	}
+
+	used := make(map[string]bool)
+	for language, text := range variants {
+		language = strings.ToLower(language)
+		if !languagePattern.MatchString(language) {
+			return nil, fmt.Errorf("invalid language %q", language)
+		}
+		if strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("variant %s is empty", language)
+		}
+
+		variables, err := TemplateVariables(text)
+		if err != nil {
+			return nil, fmt.Errorf("variant %s: %w", language, err)
+		}
+		for _, name := range variables {
+			used[name] = true
+		}
+
+		if _, err := format.Styled(text); err != nil {
+			return nil, fmt.Errorf("variant %s: %w", language, err)
+		}
+
+		version.Variants[language] = text
+	}
+
+	// A single variant is the default without having to name it
+	if version.DefaultLanguage == "" && len(version.Variants) == 1 {
+		for language := range version.Variants {
+			version.DefaultLanguage = language
+		}
+	}
+	if _, ok := version.Variants[version.DefaultLanguage]; !ok {
+		return nil, fmt.Errorf("default language %q has no variant", defaultLanguage)
+	}
+
+	version.Variables = make([]string, 0, len(used))
+	for name := range used {
+		version.Variables = append(version.Variables, name)
+	}
+	sort.Strings(version.Variables)
+
+	return version, nil
+}
+
+// TemplateFields lists the variables message templates can use
+func TemplateFields() []string {
+	t := reflect.TypeOf(TemplateData{})
+	fields := make([]string, t.NumField())
+	for i := range fields {
+		fields[i] = t.Field(i).Name
+	}
+	return fields
+}
+
+// TemplateVariables parses a message template and returns the TemplateData
+// fields it uses. Fields that TemplateData does not have are an error, so
+// typos are caught when the template is saved rather than for every recipient.
+func TemplateVariables(text string) ([]string, error) {
+	tmpl, err := template.New("message").Funcs(templateFuncs()).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+
+	known := make(map[string]bool)
+	for _, name := range TemplateFields() {
+		known[name] = true
+	}
+
+	used := make(map[string]bool)
+	var unknown []string
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		if node == nil || reflect.ValueOf(node).IsNil() {
+			return
+		}
+
+		var field string
+		switch n := node.(type) {
+		case *parse.ListNode:
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.FieldNode:
+			field = n.Ident[0]
+		case *parse.VariableNode:
+			if n.Ident[0] == "$" && len(n.Ident) > 1 {
+				field = n.Ident[1]
+			}
+		}
+
+		if field == "" {
+			return
+		}
+		if !known[field] {
+			unknown = append(unknown, field)
+			return
+		}
+		used[field] = true
+	}
+	walk(tmpl.Tree.Root)
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown variable %s, available are %s", strings.Join(unknown, ", "), strings.Join(TemplateFields(), ", "))
+	}
+
+	variables := make([]string, 0, len(used))
+	for name := range used {
+		variables = append(variables, name)
+	}
+	sort.Strings(variables)
+	return variables, nil
+}
+
+// TemplateStore persists message templates
+type TemplateStore struct {
+	mu        sync.RWMutex
+	dataDir   string
+	templates map[string]*Template // template ID -> template
+}
+
+// NewTemplateStore creates a new template store
+func NewTemplateStore(dataDir string) (*TemplateStore, error) {
+	store := &TemplateStore{
+		dataDir:   dataDir,
+		templates: make(map[string]*Template),
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
+
+	return store, nil
+}
+
+// Create adds a template with its first version
+func (s *TemplateStore) Create(ownerID int64, name string, version *TemplateVersion) (*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nameTaken(ownerID, name, "") {
+		return nil, ErrTemplateNameExists
+	}
+
+	now := time.Now()
+	version.Version = 1
+	tmpl := &Template{
+		ID:        generateJobID(),
+		OwnerID:   ownerID,
+		Name:      name,
+		Versions:  []*TemplateVersion{version},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.templates[tmpl.ID] = tmpl
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return copyTemplate(tmpl), nil
+}
+
+// AddVersion appends a version to a template, renaming it if name is not empty
+func (s *TemplateStore) AddVersion(id, name string, version *TemplateVersion) (*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmpl, ok := s.templates[id]
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+
+	if name != "" && name != tmpl.Name {
+		if s.nameTaken(tmpl.OwnerID, name, id) {
+			return nil, ErrTemplateNameExists
+		}
+		tmpl.Name = name
+	}
+
+	version.Version = len(tmpl.Versions) + 1
+	tmpl.Versions = append(tmpl.Versions, version)
+	tmpl.UpdatedAt = time.Now()
+
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return copyTemplate(tmpl), nil
+}
+
+// Get returns a template by ID
+func (s *TemplateStore) Get(id string) (*Template, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tmpl, ok := s.templates[id]
+	if !ok {
+		return nil, false
+	}
+	return copyTemplate(tmpl), true
+}
+
+// GetByOwner returns the templates of an owner sorted by name
+func (s *TemplateStore) GetByOwner(ownerID int64) []*Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	templates := make([]*Template, 0)
+	for _, tmpl := range s.templates {
+		if tmpl.OwnerID == ownerID {
+			templates = append(templates, copyTemplate(tmpl))
+		}
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates
+}
+
+// Delete removes a template. Jobs started from it keep their message.
+func (s *TemplateStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[id]; !ok {
+		return ErrTemplateNotFound
+	}
+
+	delete(s.templates, id)
+	return s.save()
+}
+
+// nameTaken reports whether another template of the owner has the name
+func (s *TemplateStore) nameTaken(ownerID int64, name, exceptID string) bool {
+	for _, tmpl := range s.templates {
+		if tmpl.OwnerID == ownerID && tmpl.ID != exceptID && strings.EqualFold(tmpl.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyTemplate copies a template so callers cannot modify the stored one.
+// Versions are immutable and shared.
+func copyTemplate(tmpl *Template) *Template {
+	tmplCopy := *tmpl
+	tmplCopy.Versions = append([]*TemplateVersion(nil), tmpl.Versions...)
+	return &tmplCopy
+}
+
+func (s *TemplateStore) load() error {
+	filePath := filepath.Join(s.dataDir, "templates.json")
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var templates []*Template
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return err
+	}
+
+	for _, tmpl := range templates {
+		s.templates[tmpl.ID] = tmpl
+	}
+
+	return nil
+}
+
+func (s *TemplateStore) save() error {
+	templates := make([]*Template, 0, len(s.templates))
+	for _, tmpl := range s.templates {
+		templates = append(templates, tmpl)
+	}
+
+	data, err := json.MarshalIndent(templates, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	filePath := filepath.Join(s.dataDir, "templates.json")
+	return os.WriteFile(filePath, data, 0600)
+}
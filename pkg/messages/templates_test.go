@@ -0,0 +1,62 @@
+package messages
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTemplateVariables(t *testing.T) {
+	got, err := TemplateVariables(`{{pick "Hi" "Hello"}} {{.FirstName}}{{if .Username}} (@{{$.Username}}){{end}}, {{.FirstName}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"FirstName", "Username"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("TemplateVariables = %v, want %v", got, want)
+	}
+
+	for _, text := range []string{"Hi {{.Company}}", "{{with .Name}}{{.Length}}{{end}}", "Hi {{.FirstName"} {
+		if _, err := TemplateVariables(text); err == nil {
+			t.Errorf("TemplateVariables(%q) accepted an invalid template", text)
+		}
+	}
+}
+
+func TestTemplateStoreVersions(t *testing.T) {
+	store, err := NewTemplateStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v1, err := NewTemplateVersion(FormatPlain, "", map[string]string{"EN": "Hi {{.FirstName}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := store.Create(1, "Welcome", v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Create(1, "welcome", v1); err != ErrTemplateNameExists {
+		t.Fatalf("duplicate name: got %v, want %v", err, ErrTemplateNameExists)
+	}
+
+	v2, err := NewTemplateVersion(FormatHTML, "en", map[string]string{"en": "<b>Hi</b> {{.Name}}", "uk": "<b>Привіт</b> {{.Name}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AddVersion(tmpl.ID, "", v2); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, _ = store.Get(tmpl.ID)
+	first, ok := tmpl.Version(1)
+	if !ok || first.DefaultLanguage != "en" || first.Variants["en"] != "Hi {{.FirstName}}" {
+		t.Fatalf("version 1 changed: %+v", first)
+	}
+	if latest, _ := tmpl.Version(0); latest.Version != 2 || !reflect.DeepEqual(latest.Variables, []string{"Name"}) {
+		t.Fatalf("unexpected latest version: %+v", latest)
+	}
+	if text, ok := tmpl.Latest().Text("uk"); !ok || text != "<b>Привіт</b> {{.Name}}" {
+		t.Fatalf("uk variant = %q, %v", text, ok)
+	}
+}
@@ -0,0 +1,164 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tgsender"
+
+// Registry holds every tgsender collector plus the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+var factory = promauto.With(Registry)
+
+var (
+	// MessagesSent counts messages delivered by send jobs
+	MessagesSent = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_sent_total",
+		Help:      "Messages successfully sent, by account.",
+	}, []string{"account_id"})
+
+	// MessagesFailed counts messages that could not be delivered
+	MessagesFailed = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_failed_total",
+		Help:      "Messages that failed to send, by account and error category.",
+	}, []string{"account_id", "category"})
+
+	// ImportJobDuration observes how long contact import jobs run
+	ImportJobDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "import_job_duration_seconds",
+		Help:      "Duration of contact import jobs, by import type and final status.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600, 10800, 21600},
+	}, []string{"import_type", "status"})
+
+	// FloodWaits counts FLOOD_WAIT errors returned by Telegram
+	FloodWaits = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "flood_wait_total",
+		Help:      "FLOOD_WAIT errors returned by Telegram, by RPC method.",
+	}, []string{"method"})
+
+	// FloodWaitSeconds sums the waits Telegram asked for in FLOOD_WAIT errors
+	FloodWaitSeconds = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "flood_wait_seconds_total",
+		Help:      "Seconds Telegram asked us to wait in FLOOD_WAIT errors, by RPC method.",
+	}, []string{"method"})
+
+	// TelegramConnections tracks running Telegram clients
+	TelegramConnections = factory.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "telegram_active_connections",
+		Help:      "Telegram clients that are currently connected.",
+	})
+
+	// SpamChecks counts @SpamBot checks by outcome
+	SpamChecks = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spam_checks_total",
+		Help:      "Spam status checks against @SpamBot, by account and result (limited, free, error).",
+	}, []string{"account_id", "result"})
+
+	// AccountHealthChecks counts session validations of the health monitor
+	AccountHealthChecks = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "account_health_checks_total",
+		Help:      "Background session validations, by result (valid, session_revoked, deactivated, error).",
+	}, []string{"result"})
+
+	// WebhookDeliveries counts attempts to deliver webhook events
+	WebhookDeliveries = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts, by event type and result (succeeded, retried, failed).",
+	}, []string{"event", "result"})
+
+	// RateLimited counts requests rejected by rate limits
+	RateLimited = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Requests rejected with 429, by route group.",
+	}, []string{"group"})
+
+	// HTTPRequestDuration observes API latency
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by route pattern, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+)
+
+// Handler returns the /metrics handler. If token is not empty, requests must
+// carry it as a bearer token.
+func Handler(token string) http.Handler {
+	next := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+	if token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware records the latency of every request handled by next. It must
+// wrap a http.ServeMux so that the matched route pattern is available.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		HTTPRequestDuration.
+			WithLabelValues(route, r.Method, strconv.Itoa(rec.status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -8,6 +8,10 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/soluchok/tgsender/pkg/tracing"
 )
 
 const (
@@ -82,7 +86,10 @@ type ChatResponse struct {
 }
 
 // RewriteMessage rewrites a message using AI based on the given prompt
-func (c *Client) RewriteMessage(ctx context.Context, originalMessage, prompt string) (string, error) {
+func (c *Client) RewriteMessage(ctx context.Context, originalMessage, prompt string) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "openai.RewriteMessage", attribute.String("gen_ai.request.model", c.model))
+	defer func() { tracing.End(span, err) }()
+
 	systemPrompt := fmt.Sprintf(`You are a message rewriting assistant. Your task is to rewrite the following message according to these instructions:
 
 %s
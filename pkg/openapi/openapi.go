@@ -0,0 +1,130 @@
+// Package openapi holds the OpenAPI description of the tgsender HTTP API and
+// validates incoming requests against it.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// Spec is the raw OpenAPI document
+//
+//go:embed openapi.yaml
+var Spec []byte
+
+// Load parses and validates the embedded OpenAPI document
+func Load() (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+
+	doc, err := loader.LoadFromData(Spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse spec: %w", err)
+	}
+
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+
+	return doc, nil
+}
+
+// Validator rejects requests that do not match the OpenAPI document
+type Validator struct {
+	router  routers.Router
+	options *openapi3filter.Options
+}
+
+// NewValidator creates a new validator for the embedded OpenAPI document
+func NewValidator() (*Validator, error) {
+	doc, err := Load()
+	if err != nil {
+		return nil, err
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build router: %w", err)
+	}
+
+	return &Validator{
+		router: router,
+		options: &openapi3filter.Options{
+			// Sessions are checked by the handlers themselves
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}, nil
+}
+
+// Middleware validates parameters and bodies before passing requests to next.
+// Requests for paths or methods the document does not describe are passed
+// through untouched so that next can answer them (SPA files, 404, 405).
+func (v *Validator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := v.router.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    v.options,
+		}
+
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			writeJSONError(w, describe(err), http.StatusBadRequest)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// describe turns a validation error into a short client-facing message
+func describe(err error) string {
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		return "Invalid request"
+	}
+
+	var msg string
+	switch {
+	case reqErr.Parameter != nil:
+		msg = fmt.Sprintf("Invalid %s parameter %q", reqErr.Parameter.In, reqErr.Parameter.Name)
+	case reqErr.RequestBody != nil:
+		msg = "Invalid request body"
+	default:
+		msg = "Invalid request"
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		if field := strings.Join(schemaErr.JSONPointer(), "."); field != "" {
+			return fmt.Sprintf("%s: %s: %s", msg, field, schemaErr.Reason)
+		}
+		return fmt.Sprintf("%s: %s", msg, schemaErr.Reason)
+	}
+
+	if reqErr.Reason != "" {
+		return fmt.Sprintf("%s: %s", msg, reqErr.Reason)
+	}
+
+	return msg
+}
+
+func writeJSONError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
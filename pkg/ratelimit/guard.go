@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/soluchok/tgsender/pkg/metrics"
+)
+
+// Guard limits groups of routes per client IP and per session
+type Guard struct {
+	ipHeader string
+	session  func(r *http.Request) (string, bool)
+}
+
+// NewGuard creates a guard that finds the session of a request with session.
+// Requests without a session are only limited per IP.
+func NewGuard(session func(r *http.Request) (string, bool)) *Guard {
+	return &Guard{session: session}
+}
+
+// WithIPHeader takes the client IP from a header set by a reverse proxy, such
+// as X-Forwarded-For or X-Real-IP, instead of the connection
+func (g *Guard) WithIPHeader(header string) *Guard {
+	g.ipHeader = header
+	return g
+}
+
+// Limit wraps next so that every client IP and every session can make limit
+// requests to the group. Other requests get 429 with Retry-After.
+func (g *Guard) Limit(group string, limit Limit, next http.HandlerFunc) http.HandlerFunc {
+	if !limit.Enabled() {
+		return next
+	}
+
+	byIP := NewLimiter(limit)
+	bySession := NewLimiter(limit)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := byIP.Allow(g.clientIP(r))
+		if ok {
+			if key, signedIn := g.session(r); signedIn {
+				ok, wait = bySession.Allow(key)
+			}
+		}
+
+		if !ok {
+			metrics.RateLimited.WithLabelValues(group).Inc()
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSONError(w, "Too many requests, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// clientIP returns the IP a request comes from
+func (g *Guard) clientIP(r *http.Request) string {
+	if values := r.Header.Values(g.ipHeader); g.ipHeader != "" && len(values) > 0 {
+		// Proxies append to X-Forwarded-For, so only the last entry was set by
+		// the trusted proxy. Earlier entries come from the client.
+		last := values[len(values)-1]
+		if i := strings.LastIndex(last, ","); i >= 0 {
+			last = last[i+1:]
+		}
+		if ip := strings.TrimSpace(last); ip != "" {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func writeJSONError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests requests at once and refills them evenly over Period.
+// The zero Limit allows everything.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses a limit written as "<requests>/<period>", for example
+// "5/1m". An empty string, "0" or "off" disables the limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" || s == "off" {
+		return Limit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q must look like 10/1m", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("limit %q must allow at least 1 request", s)
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must have a positive period", s)
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// bucket holds the tokens left for one key
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter keeps a token bucket per key
+type Limiter struct {
+	mu        sync.Mutex
+	limit     Limit
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewLimiter creates a limiter that applies limit to every key separately
+func NewLimiter(limit Limit) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key. If none is left it returns
+// false and how long until the next token.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if !l.limit.Enabled() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	rate := float64(l.limit.Requests) / l.limit.Period.Seconds() // tokens per second
+	l.sweep(now, rate)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Requests), updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.limit.Requests), b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have refilled since their last use, which
+// are the same as new ones. It runs at most once per period.
+func (l *Limiter) sweep(now time.Time, rate float64) {
+	if now.Sub(l.lastSweep) < l.limit.Period {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*rate >= float64(l.limit.Requests) {
+			delete(l.buckets, key)
+		}
+	}
+}
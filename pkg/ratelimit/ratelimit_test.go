@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"5/1m", Limit{Requests: 5, Period: time.Minute}, false},
+		{" 100/1h ", Limit{Requests: 100, Period: time.Hour}, false},
+		{"", Limit{}, false},
+		{"off", Limit{}, false},
+		{"0", Limit{}, false},
+		{"5", Limit{}, true},
+		{"0/1m", Limit{}, true},
+		{"5/soon", Limit{}, true},
+		{"5/-1m", Limit{}, true},
+	}
+	for _, tc := range tests {
+		got, err := ParseLimit(tc.in)
+		if (err != nil) != tc.wantErr || got != tc.want {
+			t.Errorf("ParseLimit(%q) = %v, %v", tc.in, got, err)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(Limit{Requests: 2, Period: time.Minute})
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("request %d within the burst was denied", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != 30*time.Second {
+		t.Fatalf("expected a denial with 30s to wait, got %v %v", ok, wait)
+	}
+
+	// Keys have their own buckets
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("another key was denied")
+	}
+
+	// One token is back after half the period
+	now = now.Add(30 * time.Second)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("refilled token was denied")
+	}
+	if ok, _ := l.Allow("a"); ok {
+		t.Fatal("only one token should have been refilled")
+	}
+
+	// Buckets that refilled completely are dropped
+	now = now.Add(2 * time.Minute)
+	l.Allow("c")
+	if len(l.buckets) != 1 {
+		t.Fatalf("expected idle buckets to be swept, got %d", len(l.buckets))
+	}
+
+	if ok, _ := NewLimiter(Limit{}).Allow("a"); !ok {
+		t.Fatal("the zero limit denied a request")
+	}
+}
+
+func TestGuardIgnoresSpoofedForwardedFor(t *testing.T) {
+	guard := NewGuard(func(*http.Request) (string, bool) { return "", false }).WithIPHeader("X-Forwarded-For")
+	handler := guard.Limit("test", Limit{Requests: 1, Period: time.Minute}, func(w http.ResponseWriter, r *http.Request) {})
+
+	codes := make([]int, 0, 3)
+	for _, forwarded := range []string{"203.0.113.7", "198.51.100.1, 203.0.113.7", "198.51.100.2,203.0.113.7"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Forwarded-For", forwarded)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		codes = append(codes, w.Code)
+	}
+
+	// A spoofed leading entry must not earn the client a new bucket
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("got status codes %v, want 200 then 429s", codes)
+	}
+}
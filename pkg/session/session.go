@@ -2,20 +2,35 @@ package session
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/gotd/td/telegram"
+
+	"github.com/soluchok/tgsender/pkg/accounts"
+	"github.com/soluchok/tgsender/pkg/datadir"
 )
 
-const sessionDir = ".data"
+// Get returns the session storage of a phone number in a data directory. A
+// phone that serve has linked as an account uses that account's session, so
+// the CLI and serve share one login.
+func Get(dataDir, phoneNumber string) (telegram.SessionStorage, error) {
+	layout := datadir.New(dataDir)
+	if err := layout.Ensure(); err != nil {
+		return nil, err
+	}
+
+	accountStore, err := accounts.NewStore(layout.Root())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open accounts: %w", err)
+	}
+
+	if err := accountStore.MigrateLegacySessions(); err != nil {
+		return nil, err
+	}
 
-func Get(phoneNumber string) (telegram.SessionStorage, error) {
-	if err := os.MkdirAll(sessionDir, 0700); err != nil {
-		return nil, fmt.Errorf("failed to create session directory: %w", err)
+	path := layout.PhoneSession(phoneNumber)
+	if account, ok := accountStore.GetByPhone(phoneNumber); ok {
+		path = accountStore.SessionPath(account.ID)
 	}
 
-	return &telegram.FileSessionStorage{
-		Path: filepath.Join(sessionDir, phoneNumber+"_session.json"),
-	}, nil
+	return &telegram.FileSessionStorage{Path: path}, nil
 }
@@ -9,9 +9,16 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/gotd/td/bin"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/net/proxy"
+
+	"github.com/soluchok/tgsender/pkg/metrics"
+	"github.com/soluchok/tgsender/pkg/tracing"
 )
 
 // ParseProxyURL parses and validates a proxy URL
@@ -52,14 +59,35 @@ func CreateDialer(proxyURL string) (dcs.DialFunc, error) {
 		return nil, err
 	}
 
+	var dial dcs.DialFunc
 	switch u.Scheme {
 	case "socks5":
-		return createSocks5Dialer(u)
+		dial, err = createSocks5Dialer(u)
 	case "http", "https":
-		return createHTTPProxyDialer(u)
+		dial, err = createHTTPProxyDialer(u)
 	default:
 		return nil, fmt.Errorf("unsupported proxy type: %s", u.Scheme)
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	return tracedDial(u, dial), nil
+}
+
+// tracedDial records a span for every connection made through a proxy.
+// Proxy credentials are left out of the span.
+func tracedDial(u *url.URL, dial dcs.DialFunc) dcs.DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, span := tracing.Start(ctx, "telegram.dial",
+			attribute.String("proxy.scheme", u.Scheme),
+			attribute.String("proxy.address", u.Host),
+			attribute.String("server.address", addr),
+		)
+		conn, err := dial(ctx, network, addr)
+		tracing.End(span, err)
+		return conn, err
+	}
 }
 
 // createSocks5Dialer creates a SOCKS5 proxy dialer
@@ -142,6 +170,10 @@ func CreateClientWithHandler(appID int, appHash, sessionPath, proxyURL string, h
 		SessionStorage: &telegram.FileSessionStorage{
 			Path: sessionPath,
 		},
+		Middlewares: []telegram.Middleware{
+			rpcTracing(),
+			floodWaitMetrics(),
+		},
 	}
 
 	if handler != nil {
@@ -165,16 +197,99 @@ func CreateClientWithHandler(appID int, appHash, sessionPath, proxyURL string, h
 	return telegram.NewClient(appID, appHash, opts), nil
 }
 
+// Run runs f on a connected client and counts it as an active connection while it runs
+func Run(ctx context.Context, client *telegram.Client, f func(ctx context.Context) error) error {
+	metrics.TelegramConnections.Inc()
+	defer metrics.TelegramConnections.Dec()
+
+	return client.Run(ctx, f)
+}
+
+// floodWaitMetrics records every FLOOD_WAIT error returned by Telegram
+func floodWaitMetrics() telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			err := next.Invoke(ctx, input, output)
+			if wait, ok := tgerr.AsFloodWait(err); ok {
+				method := rpcMethod(input)
+				metrics.FloodWaits.WithLabelValues(method).Inc()
+				metrics.FloodWaitSeconds.WithLabelValues(method).Add(wait.Seconds())
+			}
+			return err
+		}
+	})
+}
+
+// rpcTracing records a span for every RPC call, with the FLOOD_WAIT
+// Telegram asked for if any
+func rpcTracing() telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			method := rpcMethod(input)
+			ctx, span := tracing.Start(ctx, "telegram "+method, attribute.String("rpc.method", method))
+			err := next.Invoke(ctx, input, output)
+			if wait, ok := tgerr.AsFloodWait(err); ok {
+				span.SetAttributes(attribute.Float64("telegram.flood_wait_seconds", wait.Seconds()))
+			}
+			tracing.End(span, err)
+			return err
+		}
+	})
+}
+
+// FloodWait waits out a FLOOD_WAIT error like tgerr.FloodWait, recording
+// the wait as a span
+func FloodWait(ctx context.Context, err error) (bool, error) {
+	wait, ok := tgerr.AsFloodWait(err)
+	if !ok {
+		return tgerr.FloodWait(ctx, err)
+	}
+
+	ctx, span := tracing.Start(ctx, "telegram.flood_wait", attribute.Float64("telegram.flood_wait_seconds", wait.Seconds()))
+	retry, err := tgerr.FloodWait(ctx, err)
+	if retry {
+		span.End()
+	} else {
+		tracing.End(span, err)
+	}
+	return retry, err
+}
+
+// rpcMethod returns the TL name of a request, e.g. "messages.sendMessage"
+func rpcMethod(input bin.Encoder) string {
+	if named, ok := input.(interface{ TypeName() string }); ok {
+		return named.TypeName()
+	}
+	return fmt.Sprintf("%T", input)
+}
+
 // TestProxy tests proxy connectivity by attempting to connect to a Telegram DC
 func TestProxy(ctx context.Context, proxyURL string) error {
 	if proxyURL == "" {
 		return fmt.Errorf("proxy URL is required")
 	}
 
+	if _, err := ParseProxyURL(proxyURL); err != nil {
+		return err
+	}
+
+	if err := CheckDC(ctx, proxyURL); err != nil {
+		return fmt.Errorf("failed to connect through proxy: %w", err)
+	}
+	return nil
+}
+
+// CheckDC connects to a Telegram DC the way a client with the proxy would,
+// directly if proxyURL is empty
+func CheckDC(ctx context.Context, proxyURL string) error {
 	dialFunc, err := CreateDialer(proxyURL)
 	if err != nil {
 		return err
 	}
+	if dialFunc == nil {
+		var dialer net.Dialer
+		dialFunc = dialer.DialContext
+	}
 
 	// Test connection to Telegram DC2 (149.154.167.40:443)
 	// This is a well-known Telegram data center IP
@@ -183,7 +298,7 @@ func TestProxy(ctx context.Context, proxyURL string) error {
 
 	conn, err := dialFunc(testCtx, "tcp", "149.154.167.40:443")
 	if err != nil {
-		return fmt.Errorf("failed to connect through proxy: %w", err)
+		return err
 	}
 	conn.Close()
 
@@ -0,0 +1,57 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateDestination is returned when a delivery would connect to an
+// address that is not on the public internet
+var ErrPrivateDestination = errors.New("webhook destination is not a public address")
+
+// sharedAddressSpace is the carrier-grade NAT range, private in practice
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// newClient returns the HTTP client deliveries are sent with. Unless
+// allowPrivate is set, it refuses to connect to loopback, private,
+// link-local and other non-public addresses, so endpoints can't be used to
+// reach the server's internal network.
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	if !allowPrivate {
+		// Control sees the resolved address, so DNS names pointing inside
+		// are caught as well as IP literals
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !isPublic(addrPort.Addr()) {
+				return ErrPrivateDestination
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: requestTimeout,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// isPublic reports whether an address is routable on the public internet
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() &&
+		!addr.IsPrivate() &&
+		!sharedAddressSpace.Contains(addr)
+}
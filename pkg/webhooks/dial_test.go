@@ -0,0 +1,66 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		if got := isPublic(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublic(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestDispatcherRefusesPrivateDestinations(t *testing.T) {
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer receiver.Close()
+
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep, err := store.Create(&Endpoint{OwnerID: 1, URL: receiver.URL, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The receiver listens on loopback, which is refused by default
+	delivery, err := NewDispatcher(store, nil).Test(context.Background(), ep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliveryFailed || delivery.Error != ErrPrivateDestination.Error() || hits.Load() != 0 {
+		t.Fatalf("private destination was reached: %+v", delivery)
+	}
+
+	delivery, err = NewDispatcher(store, nil).WithPrivateNetworks(true).Test(context.Background(), ep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliverySucceeded || hits.Load() != 1 {
+		t.Fatalf("opted in private destination was not reached: %+v", delivery)
+	}
+}
@@ -0,0 +1,252 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/soluchok/tgsender/pkg/metrics"
+)
+
+const (
+	// DefaultMaxAttempts is how often a delivery is tried before it fails
+	DefaultMaxAttempts = 6
+	// DefaultRetryDelay is the wait before the first retry; it doubles after every attempt
+	DefaultRetryDelay = 30 * time.Second
+
+	maxRetryDelay  = time.Hour
+	requestTimeout = 10 * time.Second
+	userAgent      = "tgsender-webhooks"
+)
+
+// Dispatcher delivers events to the endpoints subscribed to them, retrying
+// failed attempts with exponential backoff. A nil Dispatcher drops events, so
+// emitters don't need to check whether webhooks are enabled.
+type Dispatcher struct {
+	store       *Store
+	owner       func(accountID string) (int64, bool)
+	client      *http.Client
+	maxAttempts int
+	retryDelay  time.Duration
+}
+
+// NewDispatcher creates a dispatcher. owner resolves the user an account's
+// events belong to.
+func NewDispatcher(store *Store, owner func(accountID string) (int64, bool)) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		owner:       owner,
+		client:      newClient(false),
+		maxAttempts: DefaultMaxAttempts,
+		retryDelay:  DefaultRetryDelay,
+	}
+}
+
+// WithRetry sets how often a delivery is tried and the wait before the first retry
+func (d *Dispatcher) WithRetry(maxAttempts int, retryDelay time.Duration) *Dispatcher {
+	d.maxAttempts = maxAttempts
+	d.retryDelay = retryDelay
+	return d
+}
+
+// WithPrivateNetworks lets deliveries reach loopback and private addresses,
+// which are refused by default
+func (d *Dispatcher) WithPrivateNetworks(allow bool) *Dispatcher {
+	d.client = newClient(allow)
+	return d
+}
+
+// Emit sends an event about an account to the webhooks of its owner
+func (d *Dispatcher) Emit(accountID, event string, data any) {
+	if d == nil {
+		return
+	}
+
+	ownerID, ok := d.owner(accountID)
+	if !ok {
+		return
+	}
+	d.EmitOwner(ownerID, event, data)
+}
+
+// EmitOwner sends an event to the webhooks of an owner
+func (d *Dispatcher) EmitOwner(ownerID int64, event string, data any) {
+	if d == nil {
+		return
+	}
+
+	var eventID string
+	var payload []byte
+	for _, ep := range d.store.GetByOwner(ownerID) {
+		if !ep.Subscribed(event) {
+			continue
+		}
+
+		// Every endpoint receives the same event
+		if payload == nil {
+			var err error
+			if eventID, payload, err = newPayload(event, data); err != nil {
+				slog.Error("failed to encode webhook event", "event", event, "error", err)
+				return
+			}
+		}
+
+		delivery, err := d.enqueue(ep, event, eventID, payload)
+		if err != nil {
+			slog.Error("failed to log webhook delivery", "endpoint_id", ep.ID, "event", event, "error", err)
+			continue
+		}
+		go d.deliver(delivery.ID)
+	}
+}
+
+// Test sends a ping event to an endpoint once, without retries, and returns
+// the logged delivery. It is sent even if the endpoint is inactive.
+func (d *Dispatcher) Test(ctx context.Context, ep *Endpoint) (*Delivery, error) {
+	eventID, payload, err := newPayload(EventPing, map[string]any{"endpoint_id": ep.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := d.enqueue(ep, EventPing, eventID, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := d.post(ctx, ep, delivery)
+	status, errMsg := DeliverySucceeded, ""
+	if err != nil {
+		status, errMsg = DeliveryFailed, err.Error()
+	}
+	return d.store.RecordAttempt(delivery.ID, status, code, errMsg, nil)
+}
+
+// Resume continues the deliveries that were pending when the server stopped
+func (d *Dispatcher) Resume() {
+	for _, delivery := range d.store.Pending() {
+		go d.deliver(delivery.ID)
+	}
+}
+
+func (d *Dispatcher) enqueue(ep *Endpoint, event, eventID string, payload []byte) (*Delivery, error) {
+	return d.store.AddDelivery(&Delivery{
+		EndpointID: ep.ID,
+		EventID:    eventID,
+		Event:      event,
+		Payload:    payload,
+	})
+}
+
+// deliver attempts a delivery until it succeeds or runs out of attempts
+func (d *Dispatcher) deliver(id string) {
+	for {
+		delivery, ok := d.store.GetDelivery(id)
+		if !ok || delivery.Status != DeliveryPending {
+			return
+		}
+
+		if delivery.NextAttemptAt != nil {
+			time.Sleep(time.Until(*delivery.NextAttemptAt))
+		}
+
+		ep, ok := d.store.Get(delivery.EndpointID)
+		if !ok {
+			return // Deleted together with its deliveries
+		}
+		if !ep.Active {
+			d.record(delivery, DeliveryFailed, 0, "endpoint is inactive", nil)
+			return
+		}
+
+		code, err := d.post(context.Background(), ep, delivery)
+		if err == nil {
+			d.record(delivery, DeliverySucceeded, code, "", nil)
+			return
+		}
+
+		if delivery.Attempts+1 >= d.maxAttempts {
+			d.record(delivery, DeliveryFailed, code, err.Error(), nil)
+			return
+		}
+
+		next := time.Now().Add(d.backoff(delivery.Attempts + 1))
+		d.record(delivery, DeliveryPending, code, err.Error(), &next)
+	}
+}
+
+func (d *Dispatcher) record(delivery *Delivery, status DeliveryStatus, code int, errMsg string, next *time.Time) {
+	result := string(status)
+	if status == DeliveryPending {
+		result = "retried"
+	}
+	metrics.WebhookDeliveries.WithLabelValues(delivery.Event, result).Inc()
+
+	if _, err := d.store.RecordAttempt(delivery.ID, status, code, errMsg, next); err != nil {
+		slog.Error("failed to record webhook delivery", "delivery_id", delivery.ID, "error", err)
+	}
+	if status == DeliveryFailed {
+		slog.Warn("webhook delivery failed",
+			slog.String("delivery_id", delivery.ID),
+			slog.String("endpoint_id", delivery.EndpointID),
+			slog.String("event", delivery.Event),
+			slog.String("error", errMsg),
+		)
+	}
+}
+
+// backoff returns the wait after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.retryDelay
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// post sends a delivery once. Responses other than 2xx are errors.
+func (d *Dispatcher) post(ctx context.Context, ep *Endpoint, delivery *Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderSignature, Sign(ep.Secret, time.Now(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if errors.Is(err, ErrPrivateDestination) {
+		// Leave out the address the URL resolved to
+		return 0, ErrPrivateDestination
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// newPayload encodes an event with a new ID
+func newPayload(event string, data any) (string, []byte, error) {
+	id, err := generateID()
+	if err != nil {
+		return "", nil, err
+	}
+	payload, err := json.Marshal(Event{ID: id, Type: event, CreatedAt: time.Now(), Data: data})
+	return id, payload, err
+}
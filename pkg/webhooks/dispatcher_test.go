@@ -0,0 +1,135 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcherRetriesSignedDeliveries(t *testing.T) {
+	var mu sync.Mutex
+	var bodies [][]byte
+	var signatures []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, body)
+		signatures = append(signatures, r.Header.Get(HeaderSignature))
+
+		// Fail the first attempt to force a retry
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep, err := store.Create(&Endpoint{OwnerID: 1, URL: receiver.URL, Events: []string{EventJobCompleted}, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(&Endpoint{OwnerID: 2, URL: receiver.URL, Active: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	owners := map[string]int64{"acc": 1}
+	dispatcher := NewDispatcher(store, func(accountID string) (int64, bool) {
+		ownerID, ok := owners[accountID]
+		return ownerID, ok
+	}).WithRetry(3, 10*time.Millisecond).WithPrivateNetworks(true)
+
+	// Not subscribed, and no owner
+	dispatcher.Emit("acc", EventJobFailed, JobData{JobID: "job"})
+	dispatcher.Emit("unknown", EventJobCompleted, JobData{JobID: "job"})
+
+	dispatcher.Emit("acc", EventJobCompleted, JobData{JobID: "job", AccountID: "acc", Status: "completed"})
+
+	var delivery *Delivery
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if deliveries := store.Deliveries(ep.ID); len(deliveries) == 1 && deliveries[0].Status != DeliveryPending {
+			delivery = deliveries[0]
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if delivery == nil {
+		t.Fatalf("delivery did not finish: %+v", store.Deliveries(ep.ID))
+	}
+	if delivery.Status != DeliverySucceeded || delivery.Attempts != 2 || delivery.ResponseStatus != http.StatusOK {
+		t.Fatalf("unexpected delivery: %+v", delivery)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 {
+		t.Fatalf("got %d requests, want 2", len(bodies))
+	}
+	for i, body := range bodies {
+		ts, _, _ := strings.Cut(strings.TrimPrefix(signatures[i], "t="), ",")
+		unix, _ := strconv.ParseInt(ts, 10, 64)
+		if signatures[i] != Sign(ep.Secret, time.Unix(unix, 0), body) {
+			t.Errorf("attempt %d has a bad signature %q", i+1, signatures[i])
+		}
+	}
+
+	var event Event
+	if err := json.Unmarshal(bodies[1], &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventJobCompleted || event.ID != delivery.EventID {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ep, err := store.Create(&Endpoint{OwnerID: 1, URL: receiver.URL, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher := NewDispatcher(store, nil).WithRetry(2, 10*time.Millisecond).WithPrivateNetworks(true)
+	dispatcher.EmitOwner(1, EventSessionRevoked, AccountData{AccountID: "acc"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if deliveries := store.Deliveries(ep.ID); len(deliveries) == 1 && deliveries[0].Status == DeliveryFailed {
+			if deliveries[0].Attempts != 2 || deliveries[0].Error == "" {
+				t.Fatalf("unexpected delivery: %+v", deliveries[0])
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("delivery did not fail: %+v", store.Deliveries(ep.ID))
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(nil, nil).WithRetry(10, time.Minute)
+
+	for attempts, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 9: time.Hour} {
+		if got := d.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/soluchok/tgsender/pkg/auth"
+	"github.com/soluchok/tgsender/pkg/workspaces"
+)
+
+// Handler provides HTTP handlers for webhook endpoints
+type Handler struct {
+	store      *Store
+	dispatcher *Dispatcher
+	auth       *auth.Handler
+	workspaces *workspaces.Store
+}
+
+// NewHandler creates a new webhooks handler
+func NewHandler(store *Store, dispatcher *Dispatcher, authHandler *auth.Handler) *Handler {
+	return &Handler{
+		store:      store,
+		dispatcher: dispatcher,
+		auth:       authHandler,
+	}
+}
+
+// WithWorkspaces lets team workspace admins manage the workspace's webhooks
+func (h *Handler) WithWorkspaces(store *workspaces.Store) *Handler {
+	h.workspaces = store
+	return h
+}
+
+// endpointView is an endpoint as returned by the API. The secret is only
+// shown when it was just created or rotated.
+type endpointView struct {
+	*Endpoint
+	Secret string `json:"secret,omitempty"`
+}
+
+// endpointRequest is the body of endpoint create and update requests
+type endpointRequest struct {
+	URL          string   `json:"url"`
+	Description  string   `json:"description"`
+	Events       []string `json:"events"`
+	Active       *bool    `json:"active"`        // True when created, unchanged on update if omitted
+	RotateSecret bool     `json:"rotate_secret"` // Update only
+}
+
+// endpoint validates the request as an endpoint. It returns an error message
+// for the client if the request is invalid.
+func (req *endpointRequest) endpoint(ep *Endpoint) string {
+	ep.URL = req.URL
+	ep.Description = req.Description
+	ep.Events = req.Events
+	if ep.Events == nil {
+		ep.Events = make([]string, 0)
+	}
+	if req.Active != nil {
+		ep.Active = *req.Active
+	}
+
+	if err := ep.Validate(); err != nil {
+		return fmt.Sprintf("Invalid webhook: %v", err)
+	}
+	return ""
+}
+
+// HandleListWebhooks handles GET /api/webhooks
+// Lists the webhooks of the workspace selected with the X-Workspace-ID header
+func (h *Handler) HandleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	endpoints := h.store.GetByOwner(workspaceID)
+	views := make([]endpointView, 0, len(endpoints))
+	for _, ep := range endpoints {
+		views = append(views, endpointView{Endpoint: ep})
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"webhooks": views,
+		"events":   Events,
+	}, http.StatusOK)
+}
+
+// HandleCreateWebhook handles POST /api/webhooks
+// Creates the webhook in the workspace selected with the X-Workspace-ID header
+func (h *Handler) HandleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	workspaceID, ok := h.selectWorkspace(w, r, ownerID, workspaces.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req endpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ep := &Endpoint{OwnerID: workspaceID, Active: true}
+	if errMsg := req.endpoint(ep); errMsg != "" {
+		writeJSONError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	ep, err := h.store.Create(ep)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to save webhook: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, endpointView{Endpoint: ep, Secret: ep.Secret}, http.StatusOK)
+}
+
+// HandleGetWebhook handles GET /api/webhooks/{id}
+func (h *Handler) HandleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ep, ok := h.ownEndpoint(w, r, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, endpointView{Endpoint: ep}, http.StatusOK)
+}
+
+// HandleUpdateWebhook handles PUT /api/webhooks/{id}
+func (h *Handler) HandleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ep, ok := h.ownEndpoint(w, r, workspaces.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req endpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if errMsg := req.endpoint(ep); errMsg != "" {
+		writeJSONError(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	ep, err := h.store.Update(ep, req.RotateSecret)
+	if errors.Is(err, ErrEndpointNotFound) {
+		writeJSONError(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to save webhook: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	view := endpointView{Endpoint: ep}
+	if req.RotateSecret {
+		view.Secret = ep.Secret
+	}
+	writeJSON(w, view, http.StatusOK)
+}
+
+// HandleDeleteWebhook handles DELETE /api/webhooks/{id}
+func (h *Handler) HandleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ep, ok := h.ownEndpoint(w, r, workspaces.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	if err := h.store.Delete(ep.ID); err != nil && !errors.Is(err, ErrEndpointNotFound) {
+		writeJSONError(w, fmt.Sprintf("Failed to delete webhook: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Webhook deleted"}, http.StatusOK)
+}
+
+// HandleListDeliveries handles GET /api/webhooks/{id}/deliveries
+// Returns the latest deliveries of the endpoint, newest first
+func (h *Handler) HandleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ep, ok := h.ownEndpoint(w, r, workspaces.RoleViewer)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"deliveries": h.store.Deliveries(ep.ID),
+	}, http.StatusOK)
+}
+
+// HandleTestWebhook handles POST /api/webhooks/{id}/test
+// Sends a ping event once and returns the delivery, whether it succeeded or not
+func (h *Handler) HandleTestWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ep, ok := h.ownEndpoint(w, r, workspaces.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.dispatcher.Test(r.Context(), ep)
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to send test event: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, delivery, http.StatusOK)
+}
+
+// ownEndpoint loads the endpoint in the path and checks that the caller has
+// at least the role in its workspace. It writes the error response if not.
+func (h *Handler) ownEndpoint(w http.ResponseWriter, r *http.Request, need workspaces.Role) (*Endpoint, bool) {
+	ownerID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	ep, ok := h.store.Get(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, "Webhook not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	if h.workspaces.Authorize(ownerID, ep.OwnerID, need) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return nil, false
+	}
+
+	return ep, true
+}
+
+func (h *Handler) getOwnerID(r *http.Request) (int64, bool) {
+	return h.auth.OwnerID(r)
+}
+
+// selectWorkspace returns the workspace the request acts in. It writes the
+// error response if the caller lacks the role there.
+func (h *Handler) selectWorkspace(w http.ResponseWriter, r *http.Request, ownerID int64, need workspaces.Role) (int64, bool) {
+	workspaceID, err := h.workspaces.Selected(r, ownerID, need)
+	if errors.Is(err, workspaces.ErrInvalidHeader) {
+		writeJSONError(w, "Invalid "+workspaces.Header+" header", http.StatusBadRequest)
+		return 0, false
+	}
+	if err != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return 0, false
+	}
+	return workspaceID, true
+}
+
+// Helper functions for JSON responses
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeJSONError(w http.ResponseWriter, message string, status int) {
+	writeJSON(w, map[string]string{"error": message}, status)
+}
@@ -0,0 +1,326 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxDeliveries is how many deliveries are kept per endpoint
+const maxDeliveries = 100
+
+// ErrEndpointNotFound is returned for unknown endpoint IDs
+var ErrEndpointNotFound = errors.New("webhook endpoint not found")
+
+// Store persists webhook endpoints and their delivery log
+type Store struct {
+	mu         sync.RWMutex
+	dataDir    string
+	endpoints  map[string]*Endpoint // endpoint ID -> endpoint
+	deliveries map[string]*Delivery // delivery ID -> delivery
+}
+
+// NewStore creates a new webhook store
+func NewStore(dataDir string) (*Store, error) {
+	store := &Store{
+		dataDir:    dataDir,
+		endpoints:  make(map[string]*Endpoint),
+		deliveries: make(map[string]*Delivery),
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("failed to load webhooks: %w", err)
+	}
+
+	return store, nil
+}
+
+// Create saves a new endpoint with a generated ID and secret
+func (s *Store) Create(ep *Endpoint) (*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	epCopy := *ep
+	epCopy.ID = id
+	epCopy.Secret = secret
+	epCopy.CreatedAt = time.Now()
+	epCopy.UpdatedAt = epCopy.CreatedAt
+	s.endpoints[id] = &epCopy
+
+	if err := s.saveEndpoints(); err != nil {
+		return nil, err
+	}
+
+	result := epCopy
+	return &result, nil
+}
+
+// Update replaces the URL, description, events and active flag of an
+// endpoint, and its secret if rotateSecret is set
+func (s *Store) Update(ep *Endpoint, rotateSecret bool) (*Endpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.endpoints[ep.ID]
+	if !ok {
+		return nil, ErrEndpointNotFound
+	}
+
+	if rotateSecret {
+		secret, err := GenerateSecret()
+		if err != nil {
+			return nil, err
+		}
+		existing.Secret = secret
+	}
+	existing.URL = ep.URL
+	existing.Description = ep.Description
+	existing.Events = ep.Events
+	existing.Active = ep.Active
+	existing.UpdatedAt = time.Now()
+
+	if err := s.saveEndpoints(); err != nil {
+		return nil, err
+	}
+
+	result := *existing
+	return &result, nil
+}
+
+// Get returns an endpoint by ID
+func (s *Store) Get(id string) (*Endpoint, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ep, ok := s.endpoints[id]
+	if !ok {
+		return nil, false
+	}
+	epCopy := *ep
+	return &epCopy, true
+}
+
+// GetByOwner returns the endpoints of an owner, oldest first
+func (s *Store) GetByOwner(ownerID int64) []*Endpoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	endpoints := make([]*Endpoint, 0)
+	for _, ep := range s.endpoints {
+		if ep.OwnerID == ownerID {
+			epCopy := *ep
+			endpoints = append(endpoints, &epCopy)
+		}
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].CreatedAt.Before(endpoints[j].CreatedAt)
+	})
+	return endpoints
+}
+
+// Delete removes an endpoint and its deliveries
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.endpoints[id]; !ok {
+		return ErrEndpointNotFound
+	}
+
+	delete(s.endpoints, id)
+	for deliveryID, d := range s.deliveries {
+		if d.EndpointID == id {
+			delete(s.deliveries, deliveryID)
+		}
+	}
+
+	return errors.Join(s.saveEndpoints(), s.saveDeliveries())
+}
+
+// AddDelivery logs a new pending delivery, dropping the oldest finished
+// deliveries of the endpoint beyond maxDeliveries
+func (s *Store) AddDelivery(d *Delivery) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	dCopy := *d
+	dCopy.ID = id
+	dCopy.Status = DeliveryPending
+	dCopy.CreatedAt = time.Now()
+	dCopy.UpdatedAt = dCopy.CreatedAt
+	s.deliveries[id] = &dCopy
+
+	var finished []*Delivery
+	for _, existing := range s.deliveries {
+		if existing.EndpointID == d.EndpointID && existing.Status != DeliveryPending {
+			finished = append(finished, existing)
+		}
+	}
+	if excess := len(finished) + 1 - maxDeliveries; excess > 0 {
+		sort.Slice(finished, func(i, j int) bool {
+			return finished[i].CreatedAt.Before(finished[j].CreatedAt)
+		})
+		for _, old := range finished[:min(excess, len(finished))] {
+			delete(s.deliveries, old.ID)
+		}
+	}
+
+	if err := s.saveDeliveries(); err != nil {
+		return nil, err
+	}
+
+	result := dCopy
+	return &result, nil
+}
+
+// RecordAttempt saves the outcome of a delivery attempt. A nil next marks
+// the delivery as finished with the given status.
+func (s *Store) RecordAttempt(id string, status DeliveryStatus, responseStatus int, errMsg string, next *time.Time) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deliveries[id]
+	if !ok {
+		return nil, fmt.Errorf("delivery not found: %s", id)
+	}
+
+	d.Attempts++
+	d.Status = status
+	d.ResponseStatus = responseStatus
+	d.Error = errMsg
+	d.NextAttemptAt = next
+	d.UpdatedAt = time.Now()
+
+	if err := s.saveDeliveries(); err != nil {
+		return nil, err
+	}
+
+	result := *d
+	return &result, nil
+}
+
+// GetDelivery returns a delivery by ID
+func (s *Store) GetDelivery(id string) (*Delivery, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d, ok := s.deliveries[id]
+	if !ok {
+		return nil, false
+	}
+	dCopy := *d
+	return &dCopy, true
+}
+
+// Deliveries returns the delivery log of an endpoint, newest first
+func (s *Store) Deliveries(endpointID string) []*Delivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	deliveries := make([]*Delivery, 0)
+	for _, d := range s.deliveries {
+		if d.EndpointID == endpointID {
+			dCopy := *d
+			deliveries = append(deliveries, &dCopy)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	return deliveries
+}
+
+// Pending returns the deliveries still waiting for an attempt
+func (s *Store) Pending() []*Delivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var pending []*Delivery
+	for _, d := range s.deliveries {
+		if d.Status == DeliveryPending {
+			dCopy := *d
+			pending = append(pending, &dCopy)
+		}
+	}
+	return pending
+}
+
+func (s *Store) load() error {
+	var endpoints []*Endpoint
+	if err := readFile(filepath.Join(s.dataDir, "webhooks.json"), &endpoints); err != nil {
+		return err
+	}
+	for _, ep := range endpoints {
+		s.endpoints[ep.ID] = ep
+	}
+
+	var deliveries []*Delivery
+	if err := readFile(filepath.Join(s.dataDir, "webhook_deliveries.json"), &deliveries); err != nil {
+		return err
+	}
+	for _, d := range deliveries {
+		s.deliveries[d.ID] = d
+	}
+
+	return nil
+}
+
+func (s *Store) saveEndpoints() error {
+	endpoints := make([]*Endpoint, 0, len(s.endpoints))
+	for _, ep := range s.endpoints {
+		endpoints = append(endpoints, ep)
+	}
+	return writeFile(filepath.Join(s.dataDir, "webhooks.json"), endpoints)
+}
+
+func (s *Store) saveDeliveries() error {
+	deliveries := make([]*Delivery, 0, len(s.deliveries))
+	for _, d := range s.deliveries {
+		deliveries = append(deliveries, d)
+	}
+	return writeFile(filepath.Join(s.dataDir, "webhook_deliveries.json"), deliveries)
+}
+
+func readFile(filePath string, v any) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeFile(filePath string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0600)
+}
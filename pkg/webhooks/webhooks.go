@@ -0,0 +1,176 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Event types sent to webhook endpoints
+const (
+	EventJobCompleted       = "job.completed"           // A send job reached every recipient
+	EventJobFailed          = "job.failed"              // A send job stopped with an error
+	EventJobCancelled       = "job.cancelled"           // A send job was cancelled
+	EventSessionRevoked     = "account.session_revoked" // Validation found an account logged out
+	EventAccountDeactivated = "account.deactivated"     // Validation found an account deleted or banned by Telegram
+	EventSpamLimited        = "account.spam_limited"    // @SpamBot reported an account as limited
+	EventRecipientOptedOut  = "recipient.opted_out"     // A recipient unsubscribed or was suppressed
+	EventPing               = "ping"                    // Sent by the test endpoint only
+)
+
+// Events are the event types endpoints can subscribe to
+var Events = []string{
+	EventJobCompleted, EventJobFailed, EventJobCancelled,
+	EventSessionRevoked, EventAccountDeactivated, EventSpamLimited, EventRecipientOptedOut,
+}
+
+// Request headers of every delivery
+const (
+	HeaderEvent     = "X-Tgsender-Event"
+	HeaderDelivery  = "X-Tgsender-Delivery"
+	HeaderSignature = "X-Tgsender-Signature"
+)
+
+// Endpoint is a URL an owner wants events delivered to
+type Endpoint struct {
+	ID          string    `json:"id"`
+	OwnerID     int64     `json:"owner_id"`
+	URL         string    `json:"url"`
+	Description string    `json:"description,omitempty"`
+	Events      []string  `json:"events"` // Subscribed event types, every type if empty
+	Active      bool      `json:"active"`
+	Secret      string    `json:"secret"` // HMAC key deliveries are signed with
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate checks the URL and event types of an endpoint
+func (e *Endpoint) Validate() error {
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, event := range e.Events {
+		if !slices.Contains(Events, event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// Subscribed reports whether the endpoint receives an event type
+func (e *Endpoint) Subscribed(event string) bool {
+	return e.Active && (len(e.Events) == 0 || slices.Contains(e.Events, event))
+}
+
+// Event is the JSON body of a delivery
+type Event struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// DeliveryStatus is the state of a delivery
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending" // Waiting for its first or next attempt
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed" // Gave up after the last attempt
+)
+
+// Delivery records sending one event to one endpoint
+type Delivery struct {
+	ID             string          `json:"id"`
+	EndpointID     string          `json:"endpoint_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"` // HTTP status of the last attempt
+	Error          string          `json:"error,omitempty"`           // Why the last attempt failed
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+}
+
+// Sign returns the X-Tgsender-Signature value of a body: the Unix timestamp
+// and the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret.
+// Receivers should recompute it and reject old timestamps.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// GenerateSecret returns a new random signing secret
+func GenerateSecret() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(bytes), nil
+}
+
+func generateID() (string, error) {
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// JobData is the data of job.* events
+type JobData struct {
+	JobID     string `json:"job_id"`
+	AccountID string `json:"account_id"`
+	Status    string `json:"status"`
+	Channel   string `json:"channel"`
+	Total     int    `json:"total"`
+	Sent      int    `json:"sent"`
+	Failed    int    `json:"failed"`
+	Error     string `json:"error,omitempty"`
+}
+
+// AccountData is the data of account.session_revoked and account.deactivated events
+type AccountData struct {
+	AccountID string `json:"account_id"`
+	Phone     string `json:"phone"`
+}
+
+// SpamData is the data of account.spam_limited events
+type SpamData struct {
+	AccountID    string     `json:"account_id"`
+	Phone        string     `json:"phone"`
+	LimitedUntil *time.Time `json:"limited_until,omitempty"`
+	Message      string     `json:"message"`
+}
+
+// Reasons of recipient.opted_out events
+const (
+	OptOutStop       = "stop"       // Sent /stop to the delivery bot
+	OptOutBlocked    = "blocked"    // Blocked the delivery bot
+	OptOutSuppressed = "suppressed" // Marked as suppressed by the owner
+)
+
+// OptOutData is the data of recipient.opted_out events. Bot subscribers are
+// identified by chat ID, account recipients by contact ID.
+type OptOutData struct {
+	AccountID    string `json:"account_id"`
+	Channel      string `json:"channel"`
+	SubscriberID int64  `json:"subscriber_id,omitempty"`
+	ContactID    string `json:"contact_id,omitempty"`
+	Reason       string `json:"reason"`
+}
@@ -0,0 +1,333 @@
+package workspaces
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/soluchok/tgsender/pkg/auth"
+)
+
+// Handler provides HTTP handlers for workspaces, members and invites
+type Handler struct {
+	store *Store
+	auth  *auth.Handler
+}
+
+// NewHandler creates a new workspaces handler
+func NewHandler(store *Store, authHandler *auth.Handler) *Handler {
+	return &Handler{
+		store: store,
+		auth:  authHandler,
+	}
+}
+
+// workspaceView is a workspace with the caller's role in it
+type workspaceView struct {
+	*Workspace
+	Role Role `json:"role"`
+}
+
+// HandleListWorkspaces handles GET /api/workspaces
+func (h *Handler) HandleListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	workspaces := h.store.ForUser(userID)
+	views := make([]workspaceView, 0, len(workspaces))
+	for _, ws := range workspaces {
+		m, _ := ws.Member(userID)
+		views = append(views, workspaceView{Workspace: ws, Role: m.Role})
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"workspaces": views,
+		"roles":      Roles,
+	}, http.StatusOK)
+}
+
+// HandleCreateWorkspace handles POST /api/workspaces
+func (h *Handler) HandleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := h.store.Create(req.Name, userID)
+	if errors.Is(err, ErrNameRequired) {
+		writeJSONError(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, fmt.Sprintf("Failed to save workspace: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, workspaceView{Workspace: ws, Role: RoleAdmin}, http.StatusOK)
+}
+
+// HandleGetWorkspace handles GET /api/workspaces/{id}
+func (h *Handler) HandleGetWorkspace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ws, ok := h.ownWorkspace(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	m, _ := ws.Member(userID)
+	writeJSON(w, workspaceView{Workspace: ws, Role: m.Role}, http.StatusOK)
+}
+
+// HandleUpdateMember handles PUT /api/workspaces/{id}/members/{userId}
+// Changes the role of a member; admins only
+func (h *Handler) HandleUpdateMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, ws, ok := h.ownWorkspace(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.ParseInt(r.PathValue("userId"), 10, 64)
+	if err != nil {
+		writeJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Role Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ws, err = h.store.SetRole(ws.ID, memberID, req.Role)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	m, _ := ws.Member(memberID)
+	writeJSON(w, m, http.StatusOK)
+}
+
+// HandleRemoveMember handles DELETE /api/workspaces/{id}/members/{userId}
+// Admins remove anyone; other members can only leave
+func (h *Handler) HandleRemoveMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ws, ok := h.ownWorkspace(w, r, RoleViewer)
+	if !ok {
+		return
+	}
+
+	memberID, err := strconv.ParseInt(r.PathValue("userId"), 10, 64)
+	if err != nil {
+		writeJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if memberID != userID && h.store.Authorize(userID, ws.ID, RoleAdmin) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if err := h.store.RemoveMember(ws.ID, memberID); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Member removed"}, http.StatusOK)
+}
+
+// HandleListInvites handles GET /api/workspaces/{id}/invites
+func (h *Handler) HandleListInvites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, ws, ok := h.ownWorkspace(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"invites": h.store.Invites(ws.ID),
+	}, http.StatusOK)
+}
+
+// HandleCreateInvite handles POST /api/workspaces/{id}/invites
+func (h *Handler) HandleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ws, ok := h.ownWorkspace(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role Role `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	invite, err := h.store.CreateInvite(ws.ID, req.Role, userID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, invite, http.StatusOK)
+}
+
+// HandleDeleteInvite handles DELETE /api/workspaces/{id}/invites/{code}
+func (h *Handler) HandleDeleteInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, ws, ok := h.ownWorkspace(w, r, RoleAdmin)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteInvite(ws.ID, r.PathValue("code")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	writeJSON(w, map[string]string{"message": "Invite revoked"}, http.StatusOK)
+}
+
+// HandleAcceptInvite handles POST /api/invites/{code}/accept
+func (h *Handler) HandleAcceptInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	ws, err := h.store.AcceptInvite(r.PathValue("code"), userID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	m, _ := ws.Member(userID)
+	writeJSON(w, workspaceView{Workspace: ws, Role: m.Role}, http.StatusOK)
+}
+
+// ownWorkspace loads the workspace in the path and checks that the caller has
+// at least the role in it. It writes the error response if not.
+func (h *Handler) ownWorkspace(w http.ResponseWriter, r *http.Request, need Role) (int64, *Workspace, bool) {
+	userID, ok := h.getOwnerID(r)
+	if !ok {
+		writeJSONError(w, "Not authenticated", http.StatusUnauthorized)
+		return 0, nil, false
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, "Invalid workspace ID", http.StatusBadRequest)
+		return 0, nil, false
+	}
+
+	ws, err := h.store.Get(userID, id)
+	if err != nil {
+		writeStoreError(w, err)
+		return 0, nil, false
+	}
+
+	if h.store.Authorize(userID, ws.ID, need) != nil {
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+		return 0, nil, false
+	}
+
+	return userID, ws, true
+}
+
+func (h *Handler) getOwnerID(r *http.Request) (int64, bool) {
+	return h.auth.OwnerID(r)
+}
+
+// writeStoreError responds with the status of a store error
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		writeJSONError(w, "Workspace not found", http.StatusNotFound)
+	case errors.Is(err, ErrNotMember):
+		writeJSONError(w, "Unauthorized", http.StatusForbidden)
+	case errors.Is(err, ErrMemberNotFound):
+		writeJSONError(w, "Member not found", http.StatusNotFound)
+	case errors.Is(err, ErrInviteNotFound):
+		writeJSONError(w, "Invite not found or expired", http.StatusNotFound)
+	case errors.Is(err, ErrAlreadyMember):
+		writeJSONError(w, "Already a member of the workspace", http.StatusConflict)
+	case errors.Is(err, ErrLastAdmin):
+		writeJSONError(w, "A workspace needs at least one admin", http.StatusConflict)
+	case errors.Is(err, ErrPersonal):
+		writeJSONError(w, "Personal workspaces have no other members", http.StatusBadRequest)
+	case errors.Is(err, ErrInvalidRole):
+		writeJSONError(w, "Role must be viewer, operator or admin", http.StatusBadRequest)
+	default:
+		writeJSONError(w, fmt.Sprintf("Failed to save workspace: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// Helper functions for JSON responses
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeJSONError(w http.ResponseWriter, message string, status int) {
+	writeJSON(w, map[string]string{"error": message}, status)
+}
@@ -0,0 +1,393 @@
+package workspaces
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store persists team workspaces and their invites. Personal workspaces are
+// not stored.
+type Store struct {
+	mu         sync.RWMutex
+	dataDir    string
+	workspaces map[int64]*Workspace // workspace ID -> workspace
+	invites    map[string]*Invite   // invite code -> invite
+}
+
+// NewStore creates a new workspace store
+func NewStore(dataDir string) (*Store, error) {
+	store := &Store{
+		dataDir:    dataDir,
+		workspaces: make(map[int64]*Workspace),
+		invites:    make(map[string]*Invite),
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	if err := store.load(); err != nil {
+		return nil, fmt.Errorf("failed to load workspaces: %w", err)
+	}
+
+	return store, nil
+}
+
+// Create saves a new team workspace with the user as its admin
+func (s *Store) Create(name string, adminID int64) (*Workspace, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := s.generateID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ws := &Workspace{
+		ID:        id,
+		Name:      name,
+		Members:   []*Member{{UserID: adminID, Role: RoleAdmin, JoinedAt: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	s.workspaces[id] = ws
+
+	if err := s.saveWorkspaces(); err != nil {
+		return nil, err
+	}
+	return ws.clone(), nil
+}
+
+// Get returns a workspace the user is a member of
+func (s *Store) Get(userID, workspaceID int64) (*Workspace, error) {
+	if workspaceID == userID {
+		return personal(userID), nil
+	}
+	if s == nil {
+		return nil, ErrNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ws, ok := s.workspaces[workspaceID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if _, ok := ws.Member(userID); !ok {
+		return nil, ErrNotMember
+	}
+	return ws.clone(), nil
+}
+
+// ForUser returns the workspaces of a user: the personal one first, then
+// team workspaces by name
+func (s *Store) ForUser(userID int64) []*Workspace {
+	result := []*Workspace{personal(userID)}
+	if s == nil {
+		return result
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	teams := make([]*Workspace, 0)
+	for _, ws := range s.workspaces {
+		if _, ok := ws.Member(userID); ok {
+			teams = append(teams, ws.clone())
+		}
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		return teams[i].Name < teams[j].Name
+	})
+	return append(result, teams...)
+}
+
+// Role returns the role of a user in a workspace
+func (s *Store) Role(userID, workspaceID int64) (Role, bool) {
+	if workspaceID == userID {
+		return RoleAdmin, true
+	}
+	if s == nil {
+		return "", false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ws, ok := s.workspaces[workspaceID]
+	if !ok {
+		return "", false
+	}
+	m, ok := ws.Member(userID)
+	if !ok {
+		return "", false
+	}
+	return m.Role, true
+}
+
+// SetRole changes the role of a member. The last admin cannot be demoted.
+func (s *Store) SetRole(workspaceID, userID int64, role Role) (*Workspace, error) {
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ws, err := s.team(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := ws.Member(userID)
+	if !ok {
+		return nil, ErrMemberNotFound
+	}
+	if m.Role == RoleAdmin && role != RoleAdmin && ws.admins() == 1 {
+		return nil, ErrLastAdmin
+	}
+
+	m.Role = role
+	ws.UpdatedAt = time.Now()
+	if err := s.saveWorkspaces(); err != nil {
+		return nil, err
+	}
+	return ws.clone(), nil
+}
+
+// RemoveMember removes a user from a workspace. The last admin cannot leave.
+func (s *Store) RemoveMember(workspaceID, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ws, err := s.team(workspaceID)
+	if err != nil {
+		return err
+	}
+	m, ok := ws.Member(userID)
+	if !ok {
+		return ErrMemberNotFound
+	}
+	if m.Role == RoleAdmin && ws.admins() == 1 {
+		return ErrLastAdmin
+	}
+
+	members := make([]*Member, 0, len(ws.Members)-1)
+	for _, member := range ws.Members {
+		if member.UserID != userID {
+			members = append(members, member)
+		}
+	}
+	ws.Members = members
+	ws.UpdatedAt = time.Now()
+	return s.saveWorkspaces()
+}
+
+// CreateInvite creates an invite to a team workspace
+func (s *Store) CreateInvite(workspaceID int64, role Role, createdBy int64) (*Invite, error) {
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+
+	code, err := generateCode()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.team(workspaceID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	invite := &Invite{
+		Code:        code,
+		WorkspaceID: workspaceID,
+		Role:        role,
+		CreatedBy:   createdBy,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(inviteTTL),
+	}
+	s.invites[code] = invite
+
+	if err := s.saveInvites(); err != nil {
+		return nil, err
+	}
+	result := *invite
+	return &result, nil
+}
+
+// Invites returns the open invites of a workspace, newest first
+func (s *Store) Invites(workspaceID int64) []*Invite {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	invites := make([]*Invite, 0)
+	for _, invite := range s.invites {
+		if invite.WorkspaceID == workspaceID && now.Before(invite.ExpiresAt) {
+			inviteCopy := *invite
+			invites = append(invites, &inviteCopy)
+		}
+	}
+	sort.Slice(invites, func(i, j int) bool {
+		return invites[i].CreatedAt.After(invites[j].CreatedAt)
+	})
+	return invites
+}
+
+// DeleteInvite revokes an invite of a workspace
+func (s *Store) DeleteInvite(workspaceID int64, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, ok := s.invites[code]
+	if !ok || invite.WorkspaceID != workspaceID {
+		return ErrInviteNotFound
+	}
+
+	delete(s.invites, code)
+	return s.saveInvites()
+}
+
+// AcceptInvite adds the user to the invite's workspace with its role and
+// uses the invite up
+func (s *Store) AcceptInvite(code string, userID int64) (*Workspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, ok := s.invites[code]
+	if !ok || time.Now().After(invite.ExpiresAt) {
+		return nil, ErrInviteNotFound
+	}
+	ws, err := s.team(invite.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ws.Member(userID); ok {
+		return nil, ErrAlreadyMember
+	}
+
+	ws.Members = append(ws.Members, &Member{UserID: userID, Role: invite.Role, JoinedAt: time.Now()})
+	ws.UpdatedAt = time.Now()
+	delete(s.invites, code)
+
+	if err := s.saveWorkspaces(); err != nil {
+		return nil, err
+	}
+	if err := s.saveInvites(); err != nil {
+		return nil, err
+	}
+	return ws.clone(), nil
+}
+
+// team returns a stored workspace. Personal workspaces are reported as such.
+func (s *Store) team(workspaceID int64) (*Workspace, error) {
+	ws, ok := s.workspaces[workspaceID]
+	if !ok {
+		if workspaceID > 0 {
+			return nil, ErrPersonal
+		}
+		return nil, ErrNotFound
+	}
+	return ws, nil
+}
+
+// generateID returns an unused negative ID that stays exact in JavaScript
+func (s *Store) generateID() (int64, error) {
+	for {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		id := -int64(binary.BigEndian.Uint64(b[:])>>11) - 1
+		if _, ok := s.workspaces[id]; !ok {
+			return id, nil
+		}
+	}
+}
+
+func generateCode() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+func (s *Store) load() error {
+	var workspaces []*Workspace
+	if err := readFile(filepath.Join(s.dataDir, "workspaces.json"), &workspaces); err != nil {
+		return err
+	}
+	for _, ws := range workspaces {
+		s.workspaces[ws.ID] = ws
+	}
+
+	var invites []*Invite
+	if err := readFile(filepath.Join(s.dataDir, "workspace_invites.json"), &invites); err != nil {
+		return err
+	}
+	for _, invite := range invites {
+		s.invites[invite.Code] = invite
+	}
+	return nil
+}
+
+func (s *Store) saveWorkspaces() error {
+	workspaces := make([]*Workspace, 0, len(s.workspaces))
+	for _, ws := range s.workspaces {
+		workspaces = append(workspaces, ws)
+	}
+	return writeFile(filepath.Join(s.dataDir, "workspaces.json"), workspaces)
+}
+
+func (s *Store) saveInvites() error {
+	// Expired invites are dropped whenever invites are saved
+	now := time.Now()
+	invites := make([]*Invite, 0, len(s.invites))
+	for code, invite := range s.invites {
+		if now.After(invite.ExpiresAt) {
+			delete(s.invites, code)
+			continue
+		}
+		invites = append(invites, invite)
+	}
+	return writeFile(filepath.Join(s.dataDir, "workspace_invites.json"), invites)
+}
+
+func readFile(filePath string, v any) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func writeFile(filePath string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0600)
+}
@@ -0,0 +1,169 @@
+// Package workspaces groups users that share accounts. Accounts, templates,
+// segments and webhooks belong to a workspace through their OwnerID, and the
+// contacts and jobs of an account follow it. Every user has a personal
+// workspace whose ID is their Telegram user ID, so data created before
+// workspaces existed keeps belonging to its creator. Team workspaces have
+// negative IDs and never collide with user IDs.
+package workspaces
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Role is what a member may do in a workspace. Each role includes the ones below it.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // Read accounts, contacts, templates, segments and jobs
+	RoleOperator Role = "operator" // Also import and edit contacts, edit templates and segments, send
+	RoleAdmin    Role = "admin"    // Also link, configure and remove accounts, manage webhooks and members
+)
+
+// Roles are the roles members can have, lowest first
+var Roles = []Role{RoleViewer, RoleOperator, RoleAdmin}
+
+// Header selects the workspace list and create requests act in. Without it
+// they act in the caller's personal workspace.
+const Header = "X-Workspace-ID"
+
+// inviteTTL is how long an invite can be accepted
+const inviteTTL = 7 * 24 * time.Hour
+
+// Errors returned by Authorize and the store
+var (
+	ErrNotMember      = errors.New("not a member of the workspace")
+	ErrRoleTooLow     = errors.New("role does not allow this")
+	ErrNotFound       = errors.New("workspace not found")
+	ErrPersonal       = errors.New("personal workspaces have no other members")
+	ErrLastAdmin      = errors.New("a workspace needs at least one admin")
+	ErrMemberNotFound = errors.New("member not found")
+	ErrAlreadyMember  = errors.New("already a member of the workspace")
+	ErrInviteNotFound = errors.New("invite not found or expired")
+	ErrInvalidRole    = errors.New("role must be viewer, operator or admin")
+	ErrNameRequired   = errors.New("name is required")
+	ErrInvalidHeader  = errors.New("invalid " + Header + " header")
+)
+
+// Valid reports whether the role exists
+func (r Role) Valid() bool {
+	return r.rank() > 0
+}
+
+// Allows reports whether the role includes another
+func (r Role) Allows(need Role) bool {
+	return r.rank() >= need.rank() && need.Valid()
+}
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Workspace is a group of users sharing accounts
+type Workspace struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Personal  bool      `json:"personal"`
+	Members   []*Member `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Member is a user's membership in a workspace
+type Member struct {
+	UserID   int64     `json:"user_id"`
+	Role     Role      `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Member returns the membership of a user
+func (ws *Workspace) Member(userID int64) (*Member, bool) {
+	for _, m := range ws.Members {
+		if m.UserID == userID {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// admins counts the admins of the workspace
+func (ws *Workspace) admins() int {
+	count := 0
+	for _, m := range ws.Members {
+		if m.Role == RoleAdmin {
+			count++
+		}
+	}
+	return count
+}
+
+// clone returns a copy that shares no members with the workspace
+func (ws *Workspace) clone() *Workspace {
+	wsCopy := *ws
+	wsCopy.Members = make([]*Member, len(ws.Members))
+	for i, m := range ws.Members {
+		mCopy := *m
+		wsCopy.Members[i] = &mCopy
+	}
+	return &wsCopy
+}
+
+// personal returns the personal workspace of a user
+func personal(userID int64) *Workspace {
+	return &Workspace{
+		ID:       userID,
+		Name:     "Personal",
+		Personal: true,
+		Members:  []*Member{{UserID: userID, Role: RoleAdmin}},
+	}
+}
+
+// Invite lets whoever has the code join a workspace with a role, once
+type Invite struct {
+	Code        string    `json:"code"`
+	WorkspaceID int64     `json:"workspace_id"`
+	Role        Role      `json:"role"`
+	CreatedBy   int64     `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Authorize checks that a user has at least a role in a workspace. It is the
+// one place that decides whether a caller may act on a workspace's data. A
+// nil store only knows personal workspaces.
+func (s *Store) Authorize(userID, workspaceID int64, need Role) error {
+	role, ok := s.Role(userID, workspaceID)
+	if !ok {
+		return ErrNotMember
+	}
+	if !role.Allows(need) {
+		return ErrRoleTooLow
+	}
+	return nil
+}
+
+// Selected returns the workspace a request acts in, chosen with Header, after
+// checking that the user has at least a role in it
+func (s *Store) Selected(r *http.Request, userID int64, need Role) (int64, error) {
+	workspaceID := userID
+	if value := strings.TrimSpace(r.Header.Get(Header)); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, ErrInvalidHeader
+		}
+		workspaceID = id
+	}
+
+	if err := s.Authorize(userID, workspaceID, need); err != nil {
+		return 0, err
+	}
+	return workspaceID, nil
+}
@@ -0,0 +1,110 @@
+package workspaces
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRoleAllows(t *testing.T) {
+	tests := []struct {
+		role, need Role
+		want       bool
+	}{
+		{RoleAdmin, RoleViewer, true},
+		{RoleOperator, RoleOperator, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleViewer, RoleOperator, false},
+		{"", RoleViewer, false},
+		{RoleAdmin, "owner", false},
+	}
+	for _, tc := range tests {
+		if got := tc.role.Allows(tc.need); got != tc.want {
+			t.Errorf("%q allows %q: got %v, want %v", tc.role, tc.need, got, tc.want)
+		}
+	}
+}
+
+func TestStoreMembership(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := NewStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws, err := store.Create("Support", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.ID >= 0 {
+		t.Fatalf("team workspace has a non-negative ID %d", ws.ID)
+	}
+
+	// Everyone is admin of their personal workspace, and only of theirs
+	if err := store.Authorize(2, 2, RoleAdmin); err != nil {
+		t.Fatalf("personal workspace: %v", err)
+	}
+	if err := store.Authorize(2, 1, RoleViewer); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("foreign personal workspace: got %v", err)
+	}
+
+	invite, err := store.CreateInvite(ws.ID, RoleViewer, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AcceptInvite(invite.Code, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.AcceptInvite(invite.Code, 3); !errors.Is(err, ErrInviteNotFound) {
+		t.Fatalf("reused invite: got %v", err)
+	}
+	if err := store.Authorize(2, ws.ID, RoleOperator); !errors.Is(err, ErrRoleTooLow) {
+		t.Fatalf("viewer as operator: got %v", err)
+	}
+
+	if _, err := store.SetRole(ws.ID, 1, RoleViewer); !errors.Is(err, ErrLastAdmin) {
+		t.Fatalf("demoting the last admin: got %v", err)
+	}
+	if _, err := store.SetRole(ws.ID, 2, RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RemoveMember(ws.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateInvite(2, RoleViewer, 2); !errors.Is(err, ErrPersonal) {
+		t.Fatalf("invite to a personal workspace: got %v", err)
+	}
+
+	// Membership survives a reload
+	store, err = NewStore(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := store.ForUser(2)
+	if len(got) != 2 || !got[0].Personal || got[1].ID != ws.ID || len(got[1].Members) != 1 {
+		t.Fatalf("unexpected workspaces after reload: %+v", got)
+	}
+	if _, ok := store.Role(1, ws.ID); ok {
+		t.Fatal("removed member still has a role")
+	}
+}
+
+func TestSelected(t *testing.T) {
+	var store *Store // Without a store only personal workspaces exist
+
+	r := httptest.NewRequest(http.MethodGet, "/api/accounts", nil)
+	if id, err := store.Selected(r, 7, RoleAdmin); err != nil || id != 7 {
+		t.Fatalf("default workspace: got %d %v", id, err)
+	}
+
+	r.Header.Set(Header, "-5")
+	if _, err := store.Selected(r, 7, RoleViewer); !errors.Is(err, ErrNotMember) {
+		t.Fatalf("unknown workspace: got %v", err)
+	}
+
+	r.Header.Set(Header, "five")
+	if _, err := store.Selected(r, 7, RoleViewer); !errors.Is(err, ErrInvalidHeader) {
+		t.Fatalf("malformed header: got %v", err)
+	}
+}
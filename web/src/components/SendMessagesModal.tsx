@@ -19,7 +19,7 @@ interface RecipientResult {
 interface SendJob {
   id: string;
   account_id: string;
-  status: 'pending' | 'running' | 'completed' | 'failed';
+  status: 'pending' | 'running' | 'completed' | 'failed' | 'cancelled';
   message: string;
   delay_min_ms?: number;
   delay_max_ms?: number;
@@ -106,7 +106,7 @@ export function SendMessagesModal({ account, contacts, onClose }: SendMessagesMo
         const job: SendJob = await response.json();
         setCurrentJob(job);
 
-        if (job.status === 'completed' || job.status === 'failed') {
+        if (job.status === 'completed' || job.status === 'failed' || job.status === 'cancelled') {
           if (pollIntervalRef.current) {
             clearInterval(pollIntervalRef.current);
             pollIntervalRef.current = null;
@@ -855,6 +855,8 @@ function HistoryView({ jobs, onViewJob, onBack }: HistoryViewProps) {
         return <span className="status-badge success">Completed</span>;
       case 'failed':
         return <span className="status-badge error">Failed</span>;
+      case 'cancelled':
+        return <span className="status-badge">Cancelled</span>;
       case 'running':
         return <span className="status-badge running">Running</span>;
       default: